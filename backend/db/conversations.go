@@ -3,10 +3,12 @@ package db
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +21,14 @@ var (
 	once     sync.Once
 )
 
+var (
+	ErrConversationNotFound = errors.New("conversation not found")
+	ErrMessageNotFound      = errors.New("message not found")
+	// ErrVersionConflict means the conversation changed since the version
+	// the caller last read
+	ErrVersionConflict = errors.New("conversation version conflict")
+)
+
 // Conversation represents a stored chat conversation
 type Conversation struct {
 	ID              string          `json:"id"`
@@ -28,7 +38,12 @@ type Conversation struct {
 	Cwd             string          `json:"cwd,omitempty"`
 	ClaudeSessionID string          `json:"claudeSessionId,omitempty"`
 	Settings        json.RawMessage `json:"settings,omitempty"`
-	Messages        []Message       `json:"messages"`
+	// Set on a fork: the conversation and message it was forked from
+	ParentConversationID string `json:"parentConversationId,omitempty"`
+	ForkedFromMessageID  string `json:"forkedFromMessageId,omitempty"`
+	// Version increments on every change; 0 in an update skips the check
+	Version  int64     `json:"version"`
+	Messages []Message `json:"messages"`
 }
 
 // Message represents a single chat message
@@ -56,8 +71,11 @@ type ConversationListItem struct {
 	Cwd             string          `json:"cwd,omitempty"`
 	ClaudeSessionID string          `json:"claudeSessionId,omitempty"`
 	Settings        json.RawMessage `json:"settings,omitempty"`
+	Version         int64           `json:"version"`
 	MessageCount    int             `json:"messageCount"`
 	LastMessage     string          `json:"lastMessage,omitempty"`
+	// Set on a fork: the conversation it was forked from
+	ParentConversationID string `json:"parentConversationId,omitempty"`
 }
 
 // Init initializes the SQLite database and creates tables
@@ -73,7 +91,7 @@ func Init() (*sql.DB, error) {
 			return
 		}
 
-		db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL")
+		db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_synchronous=NORMAL&_recursive_triggers=on")
 		if err != nil {
 			initErr = fmt.Errorf("failed to open database: %w", err)
 			return
@@ -85,9 +103,20 @@ func Init() (*sql.DB, error) {
 			return
 		}
 
-		// Create tables
-		if err := createTables(db); err != nil {
-			initErr = fmt.Errorf("failed to create tables: %w", err)
+		// Create or upgrade the schema
+		if err := migrate(db, dbPath); err != nil {
+			db.Close()
+			initErr = fmt.Errorf("failed to migrate database: %w", err)
+			return
+		}
+		if err := migrateSearchIndex(db); err != nil {
+			db.Close()
+			initErr = fmt.Errorf("failed to set up search index: %w", err)
+			return
+		}
+		if err := finishInterruptedReplies(db); err != nil {
+			db.Close()
+			initErr = err
 			return
 		}
 
@@ -98,56 +127,55 @@ func Init() (*sql.DB, error) {
 	return instance, initErr
 }
 
+// finishInterruptedReplies marks replies still streaming when the server
+// last stopped as finished: their claude process went with it, so nothing
+// will complete them and the chat panel would show them as in progress
+// forever. They keep whatever content was last checkpointed.
+func finishInterruptedReplies(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE conversations SET version = version + 1
+		WHERE id IN (SELECT conversation_id FROM messages WHERE is_streaming = 1)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to finish interrupted replies: %w", err)
+	}
+	result, err := tx.Exec(`UPDATE messages SET is_streaming = 0 WHERE is_streaming = 1`)
+	if err != nil {
+		return fmt.Errorf("failed to finish interrupted replies: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("[DB] Marked %d interrupted replies as finished", n)
+	}
+	return nil
+}
+
 // Get returns the database instance (must call Init first)
 func Get() *sql.DB {
 	return instance
 }
 
-func getDBPath() string {
-	// Use XDG data home or fallback to ~/.local/share
+// DataDir returns the app's data directory (XDG data home or ~/.local/share),
+// shared by the conversations database and other app-managed state like the trash.
+func DataDir() string {
 	dataHome := os.Getenv("XDG_DATA_HOME")
 	if dataHome == "" {
 		home, _ := os.UserHomeDir()
 		dataHome = filepath.Join(home, ".local", "share")
 	}
-	return filepath.Join(dataHome, "markdown-themes", "conversations.db")
+	return filepath.Join(dataHome, "markdown-themes")
 }
 
-func createTables(db *sql.DB) error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS conversations (
-		id TEXT PRIMARY KEY,
-		title TEXT NOT NULL DEFAULT 'New conversation',
-		created_at INTEGER NOT NULL,
-		updated_at INTEGER NOT NULL,
-		cwd TEXT,
-		claude_session_id TEXT,
-		settings TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS messages (
-		id TEXT PRIMARY KEY,
-		conversation_id TEXT NOT NULL,
-		role TEXT NOT NULL,
-		content TEXT NOT NULL DEFAULT '',
-		timestamp INTEGER NOT NULL,
-		is_streaming INTEGER NOT NULL DEFAULT 0,
-		tool_use TEXT,
-		usage TEXT,
-		model_usage TEXT,
-		claude_session_id TEXT,
-		cost_usd REAL,
-		duration_ms REAL,
-		FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
-	CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at);
-	`
-
-	_, err := db.Exec(schema)
-	return err
+func getDBPath() string {
+	return filepath.Join(DataDir(), "conversations.db")
 }
 
 // ListConversations returns all conversations with metadata (no full messages)
@@ -160,7 +188,7 @@ func ListConversations() ([]ConversationListItem, error) {
 	rows, err := db.Query(`
 		SELECT
 			c.id, c.title, c.created_at, c.updated_at, c.cwd,
-			c.claude_session_id, c.settings,
+			c.claude_session_id, c.settings, c.version, c.parent_conversation_id,
 			COUNT(m.id) as message_count,
 			(SELECT content FROM messages WHERE conversation_id = c.id ORDER BY timestamp DESC LIMIT 1) as last_message
 		FROM conversations c
@@ -178,10 +206,10 @@ func ListConversations() ([]ConversationListItem, error) {
 		var c ConversationListItem
 		var cwd, claudeSessionID sql.NullString
 		var settings sql.NullString
-		var lastMessage sql.NullString
+		var lastMessage, parentID sql.NullString
 
 		err := rows.Scan(&c.ID, &c.Title, &c.CreatedAt, &c.UpdatedAt,
-			&cwd, &claudeSessionID, &settings,
+			&cwd, &claudeSessionID, &settings, &c.Version, &parentID,
 			&c.MessageCount, &lastMessage)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conversation: %w", err)
@@ -196,6 +224,9 @@ func ListConversations() ([]ConversationListItem, error) {
 		if settings.Valid {
 			c.Settings = json.RawMessage(settings.String)
 		}
+		if parentID.Valid {
+			c.ParentConversationID = parentID.String
+		}
 		if lastMessage.Valid {
 			msg := lastMessage.String
 			if len(msg) > 100 {
@@ -222,13 +253,14 @@ func GetConversation(id string) (*Conversation, error) {
 
 	conv := &Conversation{}
 	var cwd, claudeSessionID sql.NullString
-	var settings sql.NullString
+	var settings, parentID, forkedFrom sql.NullString
 
 	err := db.QueryRow(`
-		SELECT id, title, created_at, updated_at, cwd, claude_session_id, settings
+		SELECT id, title, created_at, updated_at, cwd, claude_session_id, settings, version,
+			   parent_conversation_id, forked_from_message_id
 		FROM conversations WHERE id = ?
 	`, id).Scan(&conv.ID, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt,
-		&cwd, &claudeSessionID, &settings)
+		&cwd, &claudeSessionID, &settings, &conv.Version, &parentID, &forkedFrom)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -246,14 +278,17 @@ func GetConversation(id string) (*Conversation, error) {
 	if settings.Valid {
 		conv.Settings = json.RawMessage(settings.String)
 	}
+	if parentID.Valid {
+		conv.ParentConversationID = parentID.String
+		conv.ForkedFromMessageID = forkedFrom.String
+	}
 
 	// Fetch messages
 	rows, err := db.Query(`
-		SELECT id, conversation_id, role, content, timestamp, is_streaming,
-			   tool_use, usage, model_usage, claude_session_id, cost_usd, duration_ms
+		SELECT `+messageColumns+`
 		FROM messages
 		WHERE conversation_id = ?
-		ORDER BY timestamp ASC
+		ORDER BY timestamp ASC, rowid ASC
 	`, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
@@ -262,38 +297,10 @@ func GetConversation(id string) (*Conversation, error) {
 
 	conv.Messages = []Message{}
 	for rows.Next() {
-		var m Message
-		var isStreaming int
-		var toolUse, usage, modelUsage, claudeSessionID sql.NullString
-		var costUSD, durationMs sql.NullFloat64
-
-		err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.Timestamp,
-			&isStreaming, &toolUse, &usage, &modelUsage, &claudeSessionID,
-			&costUSD, &durationMs)
+		m, err := scanMessage(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-
-		m.IsStreaming = isStreaming != 0
-		if toolUse.Valid {
-			m.ToolUse = json.RawMessage(toolUse.String)
+			return nil, err
 		}
-		if usage.Valid {
-			m.Usage = json.RawMessage(usage.String)
-		}
-		if modelUsage.Valid {
-			m.ModelUsage = json.RawMessage(modelUsage.String)
-		}
-		if claudeSessionID.Valid {
-			m.ClaudeSessionID = claudeSessionID.String
-		}
-		if costUSD.Valid {
-			m.CostUSD = &costUSD.Float64
-		}
-		if durationMs.Valid {
-			m.DurationMs = &durationMs.Float64
-		}
-
 		conv.Messages = append(conv.Messages, m)
 	}
 
@@ -321,7 +328,7 @@ func CreateConversation(conv *Conversation) error {
 		settingsStr = &s
 	}
 
-	_, err := db.Exec(`
+	err := db.QueryRow(`
 		INSERT INTO conversations (id, title, created_at, updated_at, cwd, claude_session_id, settings)
 		VALUES (?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
@@ -329,9 +336,11 @@ func CreateConversation(conv *Conversation) error {
 			updated_at = excluded.updated_at,
 			cwd = excluded.cwd,
 			claude_session_id = excluded.claude_session_id,
-			settings = excluded.settings
+			settings = excluded.settings,
+			version = conversations.version + 1
+		RETURNING version
 	`, conv.ID, conv.Title, conv.CreatedAt, conv.UpdatedAt,
-		nullString(conv.Cwd), nullString(conv.ClaudeSessionID), settingsStr)
+		nullString(conv.Cwd), nullString(conv.ClaudeSessionID), settingsStr).Scan(&conv.Version)
 
 	if err != nil {
 		return fmt.Errorf("failed to create conversation: %w", err)
@@ -347,7 +356,64 @@ func CreateConversation(conv *Conversation) error {
 	return nil
 }
 
-// UpdateConversation updates a conversation's metadata and messages
+// EnsureConversation creates a conversation from conv's metadata unless one
+// with its ID already exists, which is left untouched
+func EnsureConversation(conv *Conversation) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	now := time.Now().UnixMilli()
+	if conv.CreatedAt == 0 {
+		conv.CreatedAt = now
+	}
+	if conv.UpdatedAt == 0 {
+		conv.UpdatedAt = now
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO conversations (id, title, created_at, updated_at, cwd, claude_session_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO NOTHING
+	`, conv.ID, conv.Title, conv.CreatedAt, conv.UpdatedAt,
+		nullString(conv.Cwd), nullString(conv.ClaudeSessionID))
+	if err != nil {
+		return fmt.Errorf("failed to create conversation: %w", err)
+	}
+	return nil
+}
+
+// SetConversationClaudeSession records the Claude session a conversation's
+// next turn resumes, which also completes a pending session fork
+func SetConversationClaudeSession(conversationID, sessionID string) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec(`
+		UPDATE conversations
+		SET claude_session_id = ?, fork_pending = 0, updated_at = ?, version = version + 1
+		WHERE id = ? AND (claude_session_id IS NOT ? OR fork_pending)
+	`, sessionID, time.Now().UnixMilli(), conversationID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		var exists int
+		if err := db.QueryRow(`SELECT 1 FROM conversations WHERE id = ?`, conversationID).Scan(&exists); err == sql.ErrNoRows {
+			return ErrConversationNotFound
+		}
+	}
+	return nil
+}
+
+// UpdateConversation updates a conversation's metadata and, when
+// conv.Messages is set, makes its messages exactly that list: messages not in
+// it are deleted and the rest upserted, skipping unchanged rows. With a
+// nonzero conv.Version the update fails with ErrVersionConflict unless the
+// conversation is still at that version. conv.Version is set to the new one.
 func UpdateConversation(conv *Conversation) error {
 	db := Get()
 	if db == nil {
@@ -368,35 +434,218 @@ func UpdateConversation(conv *Conversation) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
+	err = tx.QueryRow(`
 		UPDATE conversations
-		SET title = ?, updated_at = ?, cwd = ?, claude_session_id = ?, settings = ?
-		WHERE id = ?
+		SET title = ?, updated_at = ?, cwd = ?, claude_session_id = ?, settings = ?,
+			version = version + 1
+		WHERE id = ? AND (? = 0 OR version = ?)
+		RETURNING version
 	`, conv.Title, conv.UpdatedAt, nullString(conv.Cwd),
-		nullString(conv.ClaudeSessionID), settingsStr, conv.ID)
+		nullString(conv.ClaudeSessionID), settingsStr, conv.ID,
+		conv.Version, conv.Version).Scan(&conv.Version)
 
+	if err == sql.ErrNoRows {
+		return versionError(tx, conv.ID)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update conversation: %w", err)
 	}
 
-	// Replace messages: delete old, insert new
 	if conv.Messages != nil {
-		_, err = tx.Exec(`DELETE FROM messages WHERE conversation_id = ?`, conv.ID)
-		if err != nil {
-			return fmt.Errorf("failed to delete old messages: %w", err)
-		}
-
-		for _, m := range conv.Messages {
-			m.ConversationID = conv.ID
-			if err := insertMessageTx(tx, &m); err != nil {
+		ids := make([]interface{}, 0, len(conv.Messages)+1)
+		ids = append(ids, conv.ID)
+		for i := range conv.Messages {
+			conv.Messages[i].ConversationID = conv.ID
+			if err := insertMessageTx(tx, &conv.Messages[i]); err != nil {
 				return err
 			}
+			ids = append(ids, conv.Messages[i].ID)
+		}
+
+		query := `DELETE FROM messages WHERE conversation_id = ?`
+		if len(conv.Messages) > 0 {
+			query += ` AND id NOT IN (?` + strings.Repeat(`, ?`, len(conv.Messages)-1) + `)`
+		}
+		if _, err := tx.Exec(query, ids...); err != nil {
+			return fmt.Errorf("failed to delete old messages: %w", err)
 		}
 	}
 
 	return tx.Commit()
 }
 
+// bumpVersionTx increments a conversation's version and touches updated_at,
+// checking it is at expected first unless expected is 0
+func bumpVersionTx(tx *sql.Tx, conversationID string, expected int64) (int64, error) {
+	var version int64
+	err := tx.QueryRow(`
+		UPDATE conversations SET version = version + 1, updated_at = ?
+		WHERE id = ? AND (? = 0 OR version = ?)
+		RETURNING version
+	`, time.Now().UnixMilli(), conversationID, expected, expected).Scan(&version)
+
+	if err == sql.ErrNoRows {
+		return 0, versionError(tx, conversationID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update conversation: %w", err)
+	}
+	return version, nil
+}
+
+// versionError tells a missing conversation from one at another version
+func versionError(tx *sql.Tx, conversationID string) error {
+	var exists int
+	err := tx.QueryRow(`SELECT 1 FROM conversations WHERE id = ?`, conversationID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return ErrConversationNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get conversation: %w", err)
+	}
+	return ErrVersionConflict
+}
+
+// AppendMessage adds a message to the end of a conversation (or replaces
+// one with the same ID, so retries are harmless) and returns the new
+// conversation version. A nonzero version is checked as in UpdateConversation.
+func AppendMessage(conversationID string, m *Message, version int64) (int64, error) {
+	db := Get()
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	newVersion, err := bumpVersionTx(tx, conversationID, version)
+	if err != nil {
+		return 0, err
+	}
+	m.ConversationID = conversationID
+	if m.Timestamp == 0 {
+		m.Timestamp = time.Now().UnixMilli()
+	}
+	if err := insertMessageTx(tx, m); err != nil {
+		return 0, err
+	}
+	return newVersion, tx.Commit()
+}
+
+// MessagePatch holds the message fields to change; nil fields are left alone
+type MessagePatch struct {
+	Content         *string         `json:"content,omitempty"`
+	IsStreaming     *bool           `json:"isStreaming,omitempty"`
+	ToolUse         json.RawMessage `json:"toolUse,omitempty"`
+	Usage           json.RawMessage `json:"usage,omitempty"`
+	ModelUsage      json.RawMessage `json:"modelUsage,omitempty"`
+	ClaudeSessionID *string         `json:"claudeSessionId,omitempty"`
+	CostUSD         *float64        `json:"costUSD,omitempty"`
+	DurationMs      *float64        `json:"durationMs,omitempty"`
+}
+
+// PatchMessage changes some fields of one message, e.g. to finalize a
+// streaming reply, and returns the updated message and conversation version
+func PatchMessage(conversationID, messageID string, patch MessagePatch, version int64) (*Message, int64, error) {
+	db := Get()
+	if db == nil {
+		return nil, 0, fmt.Errorf("database not initialized")
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		sets = append(sets, column+" = ?")
+		args = append(args, value)
+	}
+	if patch.Content != nil {
+		set("content", *patch.Content)
+	}
+	if patch.IsStreaming != nil {
+		set("is_streaming", *patch.IsStreaming)
+	}
+	if patch.ToolUse != nil {
+		set("tool_use", string(patch.ToolUse))
+	}
+	if patch.Usage != nil {
+		set("usage", string(patch.Usage))
+	}
+	if patch.ModelUsage != nil {
+		set("model_usage", string(patch.ModelUsage))
+	}
+	if patch.ClaudeSessionID != nil {
+		set("claude_session_id", nullString(*patch.ClaudeSessionID))
+	}
+	if patch.CostUSD != nil {
+		set("cost_usd", *patch.CostUSD)
+	}
+	if patch.DurationMs != nil {
+		set("duration_ms", *patch.DurationMs)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	newVersion, err := bumpVersionTx(tx, conversationID, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(sets) > 0 {
+		args = append(args, messageID, conversationID)
+		result, err := tx.Exec(`UPDATE messages SET `+strings.Join(sets, ", ")+
+			` WHERE id = ? AND conversation_id = ?`, args...)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to update message: %w", err)
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil, 0, ErrMessageNotFound
+		}
+	}
+
+	m, err := scanMessage(tx.QueryRow(`SELECT `+messageColumns+`
+		FROM messages WHERE id = ? AND conversation_id = ?`, messageID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, 0, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &m, newVersion, tx.Commit()
+}
+
+// DeleteMessage removes one message and returns the new conversation version
+func DeleteMessage(conversationID, messageID string, version int64) (int64, error) {
+	db := Get()
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	newVersion, err := bumpVersionTx(tx, conversationID, version)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM messages WHERE id = ? AND conversation_id = ?`, messageID, conversationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete message: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, ErrMessageNotFound
+	}
+	return newVersion, tx.Commit()
+}
+
 // DeleteConversation removes a conversation and its messages
 func DeleteConversation(id string) error {
 	db := Get()
@@ -404,8 +653,24 @@ func DeleteConversation(id string) error {
 		return fmt.Errorf("database not initialized")
 	}
 
-	// Messages are deleted by ON DELETE CASCADE
-	result, err := db.Exec(`DELETE FROM conversations WHERE id = ?`, id)
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Forks of this conversation move up to its parent, keeping the branch
+	// tree connected
+	_, err = tx.Exec(`
+		UPDATE conversations
+		SET parent_conversation_id = (SELECT parent_conversation_id FROM conversations WHERE id = ?)
+		WHERE parent_conversation_id = ?
+	`, id, id)
+	if err != nil {
+		return fmt.Errorf("failed to reparent forks: %w", err)
+	}
+
+	result, err := tx.Exec(`DELETE FROM conversations WHERE id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete conversation: %w", err)
 	}
@@ -415,7 +680,15 @@ func DeleteConversation(id string) error {
 		return fmt.Errorf("conversation not found")
 	}
 
-	return nil
+	// Foreign keys are off, so ON DELETE CASCADE doesn't remove these
+	if _, err := tx.Exec(`DELETE FROM messages WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete messages: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM claude_imports WHERE conversation_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete claude import: %w", err)
+	}
+
+	return tx.Commit()
 }
 
 // insertMessages inserts multiple messages in a transaction
@@ -435,6 +708,51 @@ func insertMessages(db *sql.DB, messages []Message) error {
 	return tx.Commit()
 }
 
+// messageColumns are the columns scanMessage reads, in order
+const messageColumns = `id, conversation_id, role, content, timestamp, is_streaming,
+	tool_use, usage, model_usage, claude_session_id, cost_usd, duration_ms`
+
+// scanMessage reads a row of messageColumns
+func scanMessage(row interface{ Scan(...interface{}) error }) (Message, error) {
+	var m Message
+	var isStreaming int
+	var toolUse, usage, modelUsage, claudeSessionID sql.NullString
+	var costUSD, durationMs sql.NullFloat64
+
+	err := row.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.Timestamp,
+		&isStreaming, &toolUse, &usage, &modelUsage, &claudeSessionID,
+		&costUSD, &durationMs)
+	if err == sql.ErrNoRows {
+		return m, err
+	}
+	if err != nil {
+		return m, fmt.Errorf("failed to scan message: %w", err)
+	}
+
+	m.IsStreaming = isStreaming != 0
+	if toolUse.Valid {
+		m.ToolUse = json.RawMessage(toolUse.String)
+	}
+	if usage.Valid {
+		m.Usage = json.RawMessage(usage.String)
+	}
+	if modelUsage.Valid {
+		m.ModelUsage = json.RawMessage(modelUsage.String)
+	}
+	if claudeSessionID.Valid {
+		m.ClaudeSessionID = claudeSessionID.String
+	}
+	if costUSD.Valid {
+		m.CostUSD = &costUSD.Float64
+	}
+	if durationMs.Valid {
+		m.DurationMs = &durationMs.Float64
+	}
+	return m, nil
+}
+
+// insertMessageTx upserts a message. Rows that would not change are left
+// alone, so saving a whole conversation only writes the messages that did.
 func insertMessageTx(tx *sql.Tx, m *Message) error {
 	isStreaming := 0
 	if m.IsStreaming {
@@ -455,11 +773,36 @@ func insertMessageTx(tx *sql.Tx, m *Message) error {
 		modelUsage = &s
 	}
 
-	_, err := tx.Exec(`
-		INSERT OR REPLACE INTO messages
+	// Message IDs are global; one from another conversation must not be moved
+	// here, which would change that conversation without bumping its version
+	var owner string
+	err := tx.QueryRow(`SELECT conversation_id FROM messages WHERE id = ?`, m.ID).Scan(&owner)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to look up message: %w", err)
+	}
+	if err == nil && owner != m.ConversationID {
+		return fmt.Errorf("%w: message %s belongs to another conversation", ErrVersionConflict, m.ID)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO messages
 		(id, conversation_id, role, content, timestamp, is_streaming,
 		 tool_use, usage, model_usage, claude_session_id, cost_usd, duration_ms)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			role = excluded.role,
+			content = excluded.content, timestamp = excluded.timestamp,
+			is_streaming = excluded.is_streaming, tool_use = excluded.tool_use,
+			usage = excluded.usage, model_usage = excluded.model_usage,
+			claude_session_id = excluded.claude_session_id,
+			cost_usd = excluded.cost_usd, duration_ms = excluded.duration_ms
+		WHERE messages.conversation_id = excluded.conversation_id
+		AND (messages.role, messages.content, messages.timestamp,
+			messages.is_streaming, messages.tool_use, messages.usage, messages.model_usage,
+			messages.claude_session_id, messages.cost_usd, messages.duration_ms)
+		IS NOT (excluded.role, excluded.content, excluded.timestamp,
+			excluded.is_streaming, excluded.tool_use, excluded.usage, excluded.model_usage,
+			excluded.claude_session_id, excluded.cost_usd, excluded.duration_ms)
 	`, m.ID, m.ConversationID, m.Role, m.Content, m.Timestamp,
 		isStreaming, toolUse, usage, modelUsage,
 		nullString(m.ClaudeSessionID), m.CostUSD, m.DurationMs)
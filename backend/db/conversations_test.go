@@ -0,0 +1,37 @@
+package db
+
+import "testing"
+
+func TestFinishInterruptedReplies(t *testing.T) {
+	db, dbPath := openTestDB(t)
+	if err := migrate(db, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`
+		INSERT INTO conversations (id, title, created_at, updated_at) VALUES ('c1', 'T', 1, 1), ('c2', 'U', 1, 1);
+		INSERT INTO messages (id, conversation_id, role, content, timestamp, is_streaming) VALUES
+			('m1', 'c1', 'user', 'hi', 1, 0),
+			('m2', 'c1', 'assistant', 'partial', 2, 1),
+			('m3', 'c2', 'assistant', 'done', 2, 0);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := finishInterruptedReplies(db); err != nil {
+		t.Fatal(err)
+	}
+	var streaming int
+	db.QueryRow(`SELECT COUNT(*) FROM messages WHERE is_streaming = 1`).Scan(&streaming)
+	var content string
+	db.QueryRow(`SELECT content FROM messages WHERE id = 'm2'`).Scan(&content)
+	if streaming != 0 || content != "partial" {
+		t.Errorf("got %d still streaming, m2 content %q", streaming, content)
+	}
+	var v1, v2 int
+	db.QueryRow(`SELECT version FROM conversations WHERE id = 'c1'`).Scan(&v1)
+	db.QueryRow(`SELECT version FROM conversations WHERE id = 'c2'`).Scan(&v2)
+	if v1 != v2+1 {
+		t.Errorf("expected only c1's version bumped, got %d and %d", v1, v2)
+	}
+}
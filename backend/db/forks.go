@@ -0,0 +1,261 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrConversationExists means a fork was asked for under an ID already in use
+	ErrConversationExists = errors.New("conversation already exists")
+	// ErrSessionNotForkable means the Claude session continues past the fork
+	// point and could not be copied without those later turns
+	ErrSessionNotForkable = errors.New("claude session cannot be forked at this message")
+)
+
+// SessionTruncator copies the first turns prompts of a Claude session, with
+// Claude's work on them, into a new session and returns the new session's ID
+type SessionTruncator func(sessionID string, turns int) (string, error)
+
+// ConversationBranch is a conversation in a tree of forks
+type ConversationBranch struct {
+	ID                  string                `json:"id"`
+	Title               string                `json:"title"`
+	CreatedAt           int64                 `json:"createdAt"`
+	UpdatedAt           int64                 `json:"updatedAt"`
+	ForkedFromMessageID string                `json:"forkedFromMessageId,omitempty"`
+	MessageCount        int                   `json:"messageCount"`
+	Children            []*ConversationBranch `json:"children"`
+}
+
+// ForkConversation copies a conversation's messages up to and including
+// messageID into a new conversation newID, linked back to the original.
+// The fork takes over the Claude session of the last copied reply, marked
+// to be forked (claude --resume --fork-session) on the fork's first turn
+// so the original thread's session is left as it was. The CLI resumes a
+// whole session, so when the original continued that session after
+// messageID the fork instead gets a copy truncated at the fork point from
+// truncate, failing with ErrSessionNotForkable if that can't be made.
+func ForkConversation(sourceID, messageID, newID string, truncate SessionTruncator) (*Conversation, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	source, err := GetConversation(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, ErrConversationNotFound
+	}
+	cut := -1
+	for i, m := range source.Messages {
+		if m.ID == messageID {
+			cut = i
+			break
+		}
+	}
+	if cut < 0 {
+		return nil, ErrMessageNotFound
+	}
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM conversations WHERE id = ?)`, newID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check fork id: %w", err)
+	}
+	if exists {
+		return nil, ErrConversationExists
+	}
+
+	title := source.Title
+	if !strings.HasSuffix(title, " (fork)") {
+		title += " (fork)"
+	}
+	now := time.Now().UnixMilli()
+	fork := &Conversation{
+		ID:                   newID,
+		Title:                title,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+		Cwd:                  source.Cwd,
+		Settings:             source.Settings,
+		ParentConversationID: sourceID,
+		ForkedFromMessageID:  messageID,
+		Messages:             make([]Message, 0, cut+1),
+	}
+	for i, m := range source.Messages[:cut+1] {
+		m.ID = fmt.Sprintf("%s_%d", newID, i)
+		m.ConversationID = newID
+		m.IsStreaming = false
+		if m.ClaudeSessionID != "" {
+			fork.ClaudeSessionID = m.ClaudeSessionID
+		}
+		fork.Messages = append(fork.Messages, m)
+	}
+	// Messages saved before replies recorded their session only have the
+	// conversation's, which is right when forking from the latest message
+	if fork.ClaudeSessionID == "" && cut == len(source.Messages)-1 {
+		fork.ClaudeSessionID = source.ClaudeSessionID
+	}
+
+	pending := fork.ClaudeSessionID != ""
+	if pending && sessionContinues(source.Messages[cut+1:], fork.ClaudeSessionID) {
+		turns := 0
+		for _, m := range fork.Messages {
+			if m.Role == "assistant" && m.ClaudeSessionID == fork.ClaudeSessionID {
+				turns++
+			}
+		}
+		if truncate == nil {
+			return nil, ErrSessionNotForkable
+		}
+		session, err := truncate(fork.ClaudeSessionID, turns)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSessionNotForkable, err)
+		}
+		// The copy is the fork's alone, so it is resumed rather than forked
+		fork.ClaudeSessionID = session
+		pending = false
+	}
+
+	var settingsStr *string
+	if fork.Settings != nil {
+		s := string(fork.Settings)
+		settingsStr = &s
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO conversations (id, title, created_at, updated_at, cwd, claude_session_id, settings,
+			parent_conversation_id, forked_from_message_id, fork_pending)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING version
+	`, fork.ID, fork.Title, fork.CreatedAt, fork.UpdatedAt, nullString(fork.Cwd),
+		nullString(fork.ClaudeSessionID), settingsStr, fork.ParentConversationID,
+		fork.ForkedFromMessageID, pending).Scan(&fork.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fork: %w", err)
+	}
+
+	for i := range fork.Messages {
+		if err := insertMessageTx(tx, &fork.Messages[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return fork, tx.Commit()
+}
+
+// sessionContinues reports whether any of the later messages continued the
+// Claude session
+func sessionContinues(later []Message, sessionID string) bool {
+	for _, m := range later {
+		if m.ClaudeSessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionForkPending reports whether a conversation is a fork whose next turn
+// must fork its Claude session rather than resume it
+func SessionForkPending(conversationID string) (bool, error) {
+	db := Get()
+	if db == nil {
+		return false, fmt.Errorf("database not initialized")
+	}
+
+	var pending bool
+	err := db.QueryRow(`SELECT fork_pending FROM conversations WHERE id = ?`, conversationID).Scan(&pending)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get conversation: %w", err)
+	}
+	return pending, nil
+}
+
+// ConversationBranches returns the tree of forks a conversation belongs to,
+// from the conversation they all descend from, or nil if the conversation
+// does not exist. Children are ordered oldest first.
+func ConversationBranches(id string) (*ConversationBranch, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	var rootID string
+	err := db.QueryRow(`
+		WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+			SELECT id, parent_conversation_id, 0 FROM conversations WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_conversation_id, a.depth + 1
+			FROM conversations c JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id FROM ancestors ORDER BY depth DESC LIMIT 1
+	`, id).Scan(&rootID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find root conversation: %w", err)
+	}
+
+	rows, err := db.Query(`
+		WITH RECURSIVE tree(id) AS (
+			SELECT ?
+			UNION
+			SELECT c.id FROM conversations c JOIN tree t ON c.parent_conversation_id = t.id
+		)
+		SELECT c.id, c.title, c.created_at, c.updated_at, c.parent_conversation_id,
+			   c.forked_from_message_id,
+			   (SELECT COUNT(*) FROM messages m WHERE m.conversation_id = c.id)
+		FROM conversations c JOIN tree t ON t.id = c.id
+		ORDER BY c.created_at ASC
+	`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	defer rows.Close()
+
+	branches := make(map[string]*ConversationBranch)
+	parents := make(map[string]string)
+	var order []string
+	for rows.Next() {
+		b := &ConversationBranch{Children: []*ConversationBranch{}}
+		var parentID, forkedFrom sql.NullString
+		if err := rows.Scan(&b.ID, &b.Title, &b.CreatedAt, &b.UpdatedAt,
+			&parentID, &forkedFrom, &b.MessageCount); err != nil {
+			return nil, fmt.Errorf("failed to scan branch: %w", err)
+		}
+		if forkedFrom.Valid {
+			b.ForkedFromMessageID = forkedFrom.String
+		}
+		branches[b.ID] = b
+		parents[b.ID] = parentID.String
+		order = append(order, b.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	for _, branchID := range order {
+		if branchID == rootID {
+			continue
+		}
+		if parent, ok := branches[parents[branchID]]; ok {
+			parent.Children = append(parent.Children, branches[branchID])
+		}
+	}
+	return branches[rootID], nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ClaudeImport records a Claude Code CLI transcript imported as a
+// conversation, and the transcript's size and mtime when last synced
+type ClaudeImport struct {
+	SessionID      string `json:"sessionId"`
+	ConversationID string `json:"conversationId"`
+	SourcePath     string `json:"sourcePath"`
+	SourceSize     int64  `json:"sourceSize"`
+	SourceModTime  int64  `json:"sourceModTime"` // Unix ms
+	ImportedAt     int64  `json:"importedAt"`
+}
+
+// GetClaudeImport returns the import of a Claude session, or nil if it was
+// never imported or its conversation has since been deleted
+func GetClaudeImport(sessionID string) (*ClaudeImport, error) {
+	return getClaudeImport(`i.session_id = ?`, sessionID)
+}
+
+// GetClaudeImportForConversation returns the import a conversation came
+// from, or nil if it was not imported
+func GetClaudeImportForConversation(conversationID string) (*ClaudeImport, error) {
+	return getClaudeImport(`i.conversation_id = ?`, conversationID)
+}
+
+func getClaudeImport(where string, arg string) (*ClaudeImport, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	imp := &ClaudeImport{}
+	err := db.QueryRow(`
+		SELECT i.session_id, i.conversation_id, i.source_path, i.source_size,
+			   i.source_mtime, i.imported_at
+		FROM claude_imports i
+		JOIN conversations c ON c.id = i.conversation_id
+		WHERE `+where, arg).Scan(&imp.SessionID, &imp.ConversationID, &imp.SourcePath,
+		&imp.SourceSize, &imp.SourceModTime, &imp.ImportedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claude import: %w", err)
+	}
+	return imp, nil
+}
+
+// ConversationForClaudeSession returns the ID of a conversation already
+// using a Claude session (one started in the chat panel), or "" if none
+func ConversationForClaudeSession(sessionID string) (string, error) {
+	db := Get()
+	if db == nil {
+		return "", fmt.Errorf("database not initialized")
+	}
+
+	var id string
+	err := db.QueryRow(`
+		SELECT id FROM conversations WHERE claude_session_id = ?
+		UNION ALL
+		SELECT m.conversation_id FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE m.claude_session_id = ?
+		LIMIT 1
+	`, sessionID, sessionID).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up claude session: %w", err)
+	}
+	return id, nil
+}
+
+// SaveClaudeImport writes an imported conversation and records the import.
+// Messages are upserted by ID, so a re-sync updates the imported messages
+// and keeps any added since in the chat panel. An existing conversation
+// keeps its title, settings and Claude session.
+func SaveClaudeImport(conv *Conversation, imp *ClaudeImport) error {
+	db := Get()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO conversations (id, title, created_at, updated_at, cwd, claude_session_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			updated_at = MAX(conversations.updated_at, excluded.updated_at),
+			cwd = COALESCE(conversations.cwd, excluded.cwd),
+			claude_session_id = COALESCE(conversations.claude_session_id, excluded.claude_session_id),
+			version = conversations.version + 1
+	`, conv.ID, conv.Title, conv.CreatedAt, conv.UpdatedAt,
+		nullString(conv.Cwd), nullString(conv.ClaudeSessionID))
+	if err != nil {
+		return fmt.Errorf("failed to save imported conversation: %w", err)
+	}
+
+	for i := range conv.Messages {
+		conv.Messages[i].ConversationID = conv.ID
+		if err := insertMessageTx(tx, &conv.Messages[i]); err != nil {
+			return err
+		}
+	}
+
+	imp.ConversationID = conv.ID
+	imp.ImportedAt = time.Now().UnixMilli()
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO claude_imports
+		(session_id, conversation_id, source_path, source_size, source_mtime, imported_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, imp.SessionID, imp.ConversationID, imp.SourcePath, imp.SourceSize,
+		imp.SourceModTime, imp.ImportedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record claude import: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,205 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema steps, named NNNN_description.sql. Step N
+// takes the database from user_version N-1 to N. Steps are never edited once
+// released; change the schema by adding the next one. A step whose first line
+// is "-- requires: fts5" is skipped, though still counted, by builds without
+// FTS5.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version  int
+	name     string
+	sql      string
+	requires string // SQLite feature the step needs, e.g. "fts5"
+}
+
+const requiresPrefix = "-- requires: "
+
+// Migration backups kept beside the database, newest first
+const maxBackups = 3
+
+// loadMigrations returns the steps in fsys's migrations directory in order,
+// checking they are numbered 1, 2, 3... without gaps
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := migration{version: version, name: entry.Name(), sql: string(data)}
+		firstLine, _, _ := strings.Cut(m.sql, "\n")
+		if feature, ok := strings.CutPrefix(strings.TrimSpace(firstLine), requiresPrefix); ok {
+			m.requires = feature
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %s is out of sequence, expected version %d", m.name, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// SchemaVersion returns the schema version this binary migrates databases to
+func SchemaVersion() int {
+	migrations, _ := loadMigrations(migrationFiles)
+	return len(migrations)
+}
+
+// migrate brings the database at dbPath up to the latest schema, one
+// transaction per step with PRAGMA user_version recording the step reached.
+// An existing database is first copied aside with VACUUM INTO, keeping the
+// last maxBackups copies. A database
+// from a newer build is refused rather than touched.
+func migrate(db *sql.DB, dbPath string) error {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+	return applyMigrations(db, dbPath, migrations)
+}
+
+// applyMigrations runs the steps of migrations the database hasn't reached
+func applyMigrations(db *sql.DB, dbPath string, migrations []migration) error {
+	var current int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	latest := len(migrations)
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d); "+
+			"update markdown-themes, or restore a backup of %s made before the upgrade", current, latest, dbPath)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if backup, err := backupDatabase(db, dbPath, current); err != nil {
+		return fmt.Errorf("failed to back up database before migrating: %w", err)
+	} else if backup != "" {
+		log.Printf("[DB] Backed up schema version %d to %s", current, backup)
+		if err := pruneBackups(dbPath, maxBackups); err != nil {
+			log.Printf("[DB] Failed to remove old backups: %s", err)
+		}
+	}
+
+	for _, m := range migrations[current:] {
+		supported, err := migrationSupported(db, m)
+		if err != nil {
+			return err
+		}
+		if !supported {
+			m.sql = ""
+		}
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+		if supported {
+			log.Printf("[DB] Migrated to schema version %d (%s)", m.version, m.name)
+		} else {
+			log.Printf("[DB] Skipped %s, SQLite lacks %s; schema version is now %d", m.name, m.requires, m.version)
+		}
+	}
+	return nil
+}
+
+// migrationSupported reports whether SQLite has what the step requires
+func migrationSupported(db *sql.DB, m migration) (bool, error) {
+	switch m.requires {
+	case "":
+		return true, nil
+	case "fts5":
+		return hasFTS5(db)
+	}
+	return false, fmt.Errorf("migration %s requires unknown feature %q", m.name, m.requires)
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %s: %w", m.name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return fmt.Errorf("migration %s failed: %w", m.name, err)
+	}
+	// user_version lives in the database header, written with the transaction
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.version)); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", m.name, err)
+	}
+	return tx.Commit()
+}
+
+// backupDatabase copies a database that holds any tables to
+// <dbPath>.v<version>-<time>.bak and returns the copy's path, or "" for a
+// new, empty database
+func backupDatabase(db *sql.DB, dbPath string, version int) (string, error) {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		return "", err
+	}
+	if tables == 0 {
+		return "", nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d-%s.bak", dbPath, version, time.Now().Format("20060102-150405"))
+	if _, err := db.Exec(`VACUUM INTO ?`, backup); err != nil {
+		return "", err
+	}
+	return backup, nil
+}
+
+// pruneBackups deletes all but the newest keep backups of dbPath
+func pruneBackups(dbPath string, keep int) error {
+	backups, err := filepath.Glob(dbPath + ".v*-*.bak")
+	if err != nil || len(backups) <= keep {
+		return err
+	}
+	modTimes := make(map[string]time.Time, len(backups))
+	for _, b := range backups {
+		if info, err := os.Stat(b); err == nil {
+			modTimes[b] = info.ModTime()
+		}
+	}
+	// Names sort by version only up to v9, so go by age
+	sort.Slice(backups, func(i, j int) bool { return modTimes[backups[i]].After(modTimes[backups[j]]) })
+	for _, b := range backups[keep:] {
+		if err := os.Remove(b); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+-- Conversations and their messages. IF NOT EXISTS because databases created
+-- before migrations existed already have these tables at user_version 0.
+CREATE TABLE IF NOT EXISTS conversations (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL DEFAULT 'New conversation',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	cwd TEXT,
+	claude_session_id TEXT,
+	settings TEXT
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	conversation_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	content TEXT NOT NULL DEFAULT '',
+	timestamp INTEGER NOT NULL,
+	is_streaming INTEGER NOT NULL DEFAULT 0,
+	tool_use TEXT,
+	usage TEXT,
+	model_usage TEXT,
+	claude_session_id TEXT,
+	cost_usd REAL,
+	duration_ms REAL,
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id ON messages(conversation_id);
+CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp);
+CREATE INDEX IF NOT EXISTS idx_conversations_updated_at ON conversations(updated_at);
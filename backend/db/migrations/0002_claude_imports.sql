@@ -0,0 +1,12 @@
+-- Claude Code CLI transcripts imported as conversations
+CREATE TABLE IF NOT EXISTS claude_imports (
+	session_id TEXT PRIMARY KEY,
+	conversation_id TEXT NOT NULL,
+	source_path TEXT NOT NULL,
+	source_size INTEGER NOT NULL,
+	source_mtime INTEGER NOT NULL,
+	imported_at INTEGER NOT NULL,
+	FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_claude_imports_conversation_id ON claude_imports(conversation_id);
@@ -0,0 +1,3 @@
+-- Incremented on every change to a conversation or its messages, for
+-- optimistic concurrency between tabs
+ALTER TABLE conversations ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
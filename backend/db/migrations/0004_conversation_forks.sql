@@ -0,0 +1,8 @@
+-- Conversations forked from another at one of its messages. fork_pending is
+-- set until the fork's first turn has branched the Claude session it
+-- inherited, so the original thread's session is never resumed in place.
+ALTER TABLE conversations ADD COLUMN parent_conversation_id TEXT;
+ALTER TABLE conversations ADD COLUMN forked_from_message_id TEXT;
+ALTER TABLE conversations ADD COLUMN fork_pending INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_conversations_parent ON conversations(parent_conversation_id);
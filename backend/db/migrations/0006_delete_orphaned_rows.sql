@@ -0,0 +1,4 @@
+-- Foreign keys are not enforced, so ON DELETE CASCADE never fired and
+-- deleted conversations left their messages and import records behind
+DELETE FROM messages WHERE conversation_id NOT IN (SELECT id FROM conversations);
+DELETE FROM claude_imports WHERE conversation_id NOT IN (SELECT id FROM conversations);
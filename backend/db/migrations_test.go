@@ -0,0 +1,193 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "conversations.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, dbPath
+}
+
+func userVersion(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var v int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	return n > 0
+}
+
+var testSteps = []migration{
+	{version: 1, name: "0001_a.sql", sql: `CREATE TABLE a (x INTEGER);`},
+	{version: 2, name: "0002_b.sql", sql: `CREATE TABLE b (x INTEGER);`},
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("embedded migrations: got %d, err %v", len(migrations), err)
+	}
+
+	cases := map[string]fstest.MapFS{
+		"gap": {
+			"migrations/0001_a.sql": {Data: []byte("SELECT 1;")},
+			"migrations/0003_c.sql": {Data: []byte("SELECT 1;")},
+		},
+		"duplicate": {
+			"migrations/0001_a.sql": {Data: []byte("SELECT 1;")},
+			"migrations/0001_b.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad name": {
+			"migrations/initial.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	migrations, err = loadMigrations(fstest.MapFS{
+		"migrations/0002_b.sql": {Data: []byte("B")},
+		"migrations/0001_a.sql": {Data: []byte("A")},
+	})
+	if err != nil || len(migrations) != 2 || migrations[0].sql != "A" || migrations[1].version != 2 {
+		t.Errorf("got %+v, err %v", migrations, err)
+	}
+}
+
+func TestMigrate_SkipsStepsNeedingMissingFeature(t *testing.T) {
+	migrations, err := loadMigrations(fstest.MapFS{
+		"migrations/0001_a.sql":   {Data: []byte("CREATE TABLE a (x INTEGER);")},
+		"migrations/0002_fts.sql": {Data: []byte("-- requires: fts5\nCREATE VIRTUAL TABLE f USING fts5(x);")},
+	})
+	if err != nil || migrations[1].requires != "fts5" {
+		t.Fatalf("got %+v, err %v", migrations, err)
+	}
+
+	db, dbPath := openTestDB(t)
+	if err := applyMigrations(db, dbPath, migrations); err != nil {
+		t.Fatal(err)
+	}
+	available, _ := hasFTS5(db)
+	if v := userVersion(t, db); v != 2 {
+		t.Errorf("got version %d, want 2 either way", v)
+	}
+	if tableExists(t, db, "f") != available {
+		t.Errorf("expected the fts5 step run only with FTS5 (available: %v)", available)
+	}
+
+	fresh, freshPath := openTestDB(t)
+	unknown := []migration{{version: 1, name: "0001_x.sql", requires: "teleport"}}
+	if err := applyMigrations(fresh, freshPath, unknown); err == nil {
+		t.Error("expected an unknown requirement to fail")
+	}
+}
+
+func TestMigrate_RefusesNewerSchema(t *testing.T) {
+	db, dbPath := openTestDB(t)
+	if _, err := db.Exec(`PRAGMA user_version = 99`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(db, dbPath); err == nil {
+		t.Fatal("expected a newer schema to be refused")
+	}
+	if userVersion(t, db) != 99 || tableExists(t, db, "conversations") {
+		t.Error("expected the database left untouched")
+	}
+}
+
+func TestMigrate_BacksUpOnlyExistingDatabase(t *testing.T) {
+	db, dbPath := openTestDB(t)
+
+	if err := applyMigrations(db, dbPath, testSteps[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := filepath.Glob(dbPath + ".*.bak"); len(backups) != 0 {
+		t.Errorf("expected no backup of a new database, got %v", backups)
+	}
+
+	if err := applyMigrations(db, dbPath, testSteps); err != nil {
+		t.Fatal(err)
+	}
+	backups, _ := filepath.Glob(dbPath + ".v1-*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("expected one backup at version 1, got %v", backups)
+	}
+	backup, err := sql.Open("sqlite3", backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if userVersion(t, backup) != 1 || !tableExists(t, backup, "a") || tableExists(t, backup, "b") {
+		t.Error("expected the backup to hold the version 1 schema")
+	}
+	if userVersion(t, db) != 2 {
+		t.Errorf("got version %d, want 2", userVersion(t, db))
+	}
+}
+
+func TestMigrate_FailingStepRollsBack(t *testing.T) {
+	db, dbPath := openTestDB(t)
+	steps := []migration{
+		testSteps[0],
+		{version: 2, name: "0002_broken.sql", sql: `CREATE TABLE b (x INTEGER); INSERT INTO missing VALUES (1);`},
+	}
+
+	if err := applyMigrations(db, dbPath, steps); err == nil {
+		t.Fatal("expected the broken step to fail")
+	}
+	if v := userVersion(t, db); v != 1 {
+		t.Errorf("got version %d, want 1", v)
+	}
+	if !tableExists(t, db, "a") || tableExists(t, db, "b") {
+		t.Error("expected step 1 kept and step 2 rolled back")
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "conversations.db")
+	now := time.Now()
+	var paths []string
+	for i, version := range []string{"v2", "v9", "v10", "v11", "v12"} {
+		path := dbPath + "." + version + "-20250101-000000.bak"
+		os.WriteFile(path, nil, 0644)
+		os.Chtimes(path, now, now.Add(time.Duration(i)*time.Minute))
+		paths = append(paths, path)
+	}
+	other := dbPath + "-wal"
+	os.WriteFile(other, nil, 0644)
+
+	if err := pruneBackups(dbPath, 3); err != nil {
+		t.Fatal(err)
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if kept := err == nil; kept != (i >= 2) {
+			t.Errorf("%s: kept %v", filepath.Base(path), kept)
+		}
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Error("expected other files left alone")
+	}
+}
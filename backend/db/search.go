@@ -0,0 +1,436 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var searchIndexTriggers = []string{
+	"messages_fts_ai", "messages_fts_ad", "messages_fts_au",
+	"conversations_fts_ai", "conversations_fts_ad", "conversations_fts_au",
+}
+
+// ftsEnabled is set by Init when SQLite was built with FTS5 (go build -tags
+// sqlite_fts5) and the search index is in place
+var ftsEnabled bool
+
+// FTSEnabled reports whether search uses the FTS5 index rather than LIKE
+func FTSEnabled() bool {
+	return ftsEnabled
+}
+
+// hasFTS5 reports whether SQLite was built with FTS5 (go build -tags
+// sqlite_fts5)
+func hasFTS5(db *sql.DB) (bool, error) {
+	var available bool
+	if err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5: %w", err)
+	}
+	return available, nil
+}
+
+// migrateSearchIndex keeps the triggers of the FTS5 index, created by the
+// numbered migration that requires fts5, in line with how the binary was
+// built. It runs after the migrations on every start: without FTS5 the
+// triggers are dropped (a database indexed by an FTS5 build would otherwise
+// fail every write), and once FTS5 is back that migration is rerun to put
+// them back and rebuild the index.
+func migrateSearchIndex(db *sql.DB) error {
+	available, err := hasFTS5(db)
+	if err != nil {
+		return err
+	}
+	if !available {
+		for _, name := range searchIndexTriggers {
+			if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+				return fmt.Errorf("failed to drop search trigger: %w", err)
+			}
+		}
+		log.Printf("[DB] SQLite lacks FTS5, chat search falls back to LIKE (build with -tags sqlite_fts5)")
+		return nil
+	}
+
+	var triggers int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?, ?, ?, ?, ?, ?)`,
+		searchIndexTriggers[0], searchIndexTriggers[1], searchIndexTriggers[2],
+		searchIndexTriggers[3], searchIndexTriggers[4], searchIndexTriggers[5]).Scan(&triggers)
+	if err != nil {
+		return fmt.Errorf("failed to check search index: %w", err)
+	}
+	if triggers == len(searchIndexTriggers) {
+		ftsEnabled = true
+		return nil
+	}
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+	var step *migration
+	for i := range migrations {
+		if migrations[i].requires == "fts5" {
+			step = &migrations[i]
+		}
+	}
+	if step == nil {
+		return fmt.Errorf("no migration creates the search index")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(step.sql); err != nil {
+		return fmt.Errorf("failed to rebuild search index (%s): %w", step.name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	ftsEnabled = true
+	log.Printf("[DB] Built chat search index")
+	return nil
+}
+
+// SearchOptions filters a conversation search
+type SearchOptions struct {
+	Query string
+	Cwd   string
+	Since int64 // Unix ms, 0 for no bound
+	Until int64
+	Limit int
+}
+
+// SearchMatch is a message matching a search
+type SearchMatch struct {
+	MessageID string `json:"messageId"`
+	Role      string `json:"role"`
+	Timestamp int64  `json:"timestamp"`
+	// HTML: the text is escaped and matches are wrapped in <mark>
+	Snippet string `json:"snippet"`
+}
+
+// SearchResult is a conversation matching a search, with its best matches
+type SearchResult struct {
+	ConversationID string        `json:"conversationId"`
+	Title          string        `json:"title"`
+	TitleHighlight string        `json:"titleHighlight,omitempty"` // HTML, set when the title matched
+	Cwd            string        `json:"cwd,omitempty"`
+	UpdatedAt      int64         `json:"updatedAt"`
+	MatchCount     int           `json:"matchCount"`
+	Matches        []SearchMatch `json:"matches"`
+	Score          float64       `json:"score"`
+}
+
+const (
+	// Messages fetched before grouping by conversation
+	maxSearchRows = 1000
+	// Matches returned per conversation
+	maxSearchMatches = 3
+	// How much a title match outweighs a message match
+	titleMatchWeight = 2
+	// Snippet markers, replaced by <mark> after escaping
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// SearchConversations finds conversations whose title or messages contain
+// every word of the query, most relevant first: ranked by BM25 with FTS5,
+// or by number of matching messages with the LIKE fallback
+func SearchConversations(opts SearchOptions) ([]SearchResult, error) {
+	db := Get()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	terms := strings.Fields(opts.Query)
+	if len(terms) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	var results map[string]*SearchResult
+	var err error
+	if ftsEnabled {
+		results, err = searchFTS(db, terms, opts)
+	} else {
+		results, err = searchLike(db, terms, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]SearchResult, 0, len(results))
+	for _, r := range results {
+		if r.Matches == nil {
+			r.Matches = []SearchMatch{}
+		}
+		sorted = append(sorted, *r)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Score != sorted[j].Score {
+			return sorted[i].Score > sorted[j].Score
+		}
+		return sorted[i].UpdatedAt > sorted[j].UpdatedAt
+	})
+	if opts.Limit > 0 && len(sorted) > opts.Limit {
+		sorted = sorted[:opts.Limit]
+	}
+	return sorted, nil
+}
+
+// ftsQuery quotes each term so FTS5 syntax in the query is taken literally,
+// and matches the last as a prefix for search-as-you-type
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " ") + "*"
+}
+
+// searchFilters is the cwd and date filter shared by the search queries;
+// column is the timestamp compared with the date range
+func searchFilters(column string, opts SearchOptions) (string, []interface{}) {
+	where := ` AND (? = '' OR c.cwd = ?) AND (? = 0 OR ` + column + ` >= ?) AND (? = 0 OR ` + column + ` <= ?)`
+	return where, []interface{}{opts.Cwd, opts.Cwd, opts.Since, opts.Since, opts.Until, opts.Until}
+}
+
+func searchFTS(db *sql.DB, terms []string, opts SearchOptions) (map[string]*SearchResult, error) {
+	match := ftsQuery(terms)
+	results := make(map[string]*SearchResult)
+
+	filter, args := searchFilters("m.timestamp", opts)
+	rows, err := db.Query(`
+		SELECT m.id, m.conversation_id, m.role, m.timestamp,
+			snippet(messages_fts, 0, ?, ?, '…', 16), bm25(messages_fts),
+			c.title, c.cwd, c.updated_at
+		FROM messages_fts
+		JOIN messages m ON m.rowid = messages_fts.rowid
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE messages_fts MATCH ?`+filter+`
+		ORDER BY bm25(messages_fts)
+		LIMIT ?
+	`, append(append([]interface{}{markStart, markEnd, match}, args...), maxSearchRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m SearchMatch
+		var conversationID, title string
+		var cwd sql.NullString
+		var rank float64
+		var updatedAt int64
+		if err := rows.Scan(&m.MessageID, &conversationID, &m.Role, &m.Timestamp,
+			&m.Snippet, &rank, &title, &cwd, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r := searchResult(results, conversationID, title, cwd.String, updatedAt)
+		r.MatchCount++
+		// bm25 is negative, more so for better matches; rows come best first
+		if len(r.Matches) < maxSearchMatches {
+			m.Snippet = markSnippet(m.Snippet)
+			r.Matches = append(r.Matches, m)
+			r.Score -= rank
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	filter, args = searchFilters("c.updated_at", opts)
+	rows, err = db.Query(`
+		SELECT c.id, c.title, c.cwd, c.updated_at,
+			highlight(conversations_fts, 0, ?, ?), bm25(conversations_fts)
+		FROM conversations_fts
+		JOIN conversations c ON c.rowid = conversations_fts.rowid
+		WHERE conversations_fts MATCH ?`+filter+`
+		LIMIT ?
+	`, append(append([]interface{}{markStart, markEnd, match}, args...), maxSearchRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search titles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, title, highlighted string
+		var cwd sql.NullString
+		var updatedAt int64
+		var rank float64
+		if err := rows.Scan(&id, &title, &cwd, &updatedAt, &highlighted, &rank); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r := searchResult(results, id, title, cwd.String, updatedAt)
+		r.TitleHighlight = markSnippet(highlighted)
+		r.Score -= titleMatchWeight * rank
+	}
+	return results, rows.Err()
+}
+
+func searchLike(db *sql.DB, terms []string, opts SearchOptions) (map[string]*SearchResult, error) {
+	results := make(map[string]*SearchResult)
+
+	var contentWhere, titleWhere []string
+	var contentArgs, titleArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term) + "%"
+		contentWhere = append(contentWhere, `m.content LIKE ? ESCAPE '\'`)
+		titleWhere = append(titleWhere, `c.title LIKE ? ESCAPE '\'`)
+		contentArgs = append(contentArgs, pattern)
+		titleArgs = append(titleArgs, pattern)
+	}
+
+	filter, args := searchFilters("m.timestamp", opts)
+	rows, err := db.Query(`
+		SELECT m.id, m.conversation_id, m.role, m.timestamp, m.content,
+			c.title, c.cwd, c.updated_at
+		FROM messages m
+		JOIN conversations c ON c.id = m.conversation_id
+		WHERE `+strings.Join(contentWhere, " AND ")+filter+`
+		ORDER BY m.timestamp DESC
+		LIMIT ?
+	`, append(append(contentArgs, args...), maxSearchRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var m SearchMatch
+		var conversationID, content, title string
+		var cwd sql.NullString
+		var updatedAt int64
+		if err := rows.Scan(&m.MessageID, &conversationID, &m.Role, &m.Timestamp,
+			&content, &title, &cwd, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r := searchResult(results, conversationID, title, cwd.String, updatedAt)
+		r.MatchCount++
+		r.Score++
+		if len(r.Matches) < maxSearchMatches {
+			m.Snippet = likeSnippet(content, terms)
+			r.Matches = append(r.Matches, m)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	filter, args = searchFilters("c.updated_at", opts)
+	rows, err = db.Query(`
+		SELECT c.id, c.title, c.cwd, c.updated_at
+		FROM conversations c
+		WHERE `+strings.Join(titleWhere, " AND ")+filter+`
+		LIMIT ?
+	`, append(append(titleArgs, args...), maxSearchRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search titles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, title string
+		var cwd sql.NullString
+		var updatedAt int64
+		if err := rows.Scan(&id, &title, &cwd, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		r := searchResult(results, id, title, cwd.String, updatedAt)
+		r.TitleHighlight = markSnippet(markTerms(title, terms))
+		r.Score += titleMatchWeight
+	}
+	return results, rows.Err()
+}
+
+func searchResult(results map[string]*SearchResult, id, title, cwd string, updatedAt int64) *SearchResult {
+	r := results[id]
+	if r == nil {
+		r = &SearchResult{ConversationID: id, Title: title, Cwd: cwd, UpdatedAt: updatedAt}
+		results[id] = r
+	}
+	return r
+}
+
+// markSnippet escapes a snippet for HTML and turns its markers into <mark>
+func markSnippet(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(s)
+}
+
+// likeSnippet cuts the text around the first match of any term, with the
+// matches marked, much like FTS5's snippet()
+func likeSnippet(content string, terms []string) string {
+	const context = 60 // Characters either side
+
+	lower := strings.ToLower(content)
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 || len(lower) != len(content) {
+		first = 0 // Lowercasing changed byte offsets; start at the top
+	}
+
+	start := first
+	for n := 0; start > 0 && n < context; n++ {
+		_, size := utf8.DecodeLastRuneInString(content[:start])
+		start -= size
+	}
+	end := first
+	for n := 0; end < len(content) && n < 2*context; n++ {
+		_, size := utf8.DecodeRuneInString(content[end:])
+		end += size
+	}
+
+	snippet := strings.Join(strings.Fields(content[start:end]), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(content) {
+		snippet += "…"
+	}
+	return markSnippet(markTerms(snippet, terms))
+}
+
+// markTerms wraps case-insensitive occurrences of the terms in markers
+func markTerms(s string, terms []string) string {
+	lower := strings.ToLower(s)
+	if len(lower) != len(s) {
+		return s
+	}
+	marked := make([]bool, len(s))
+	for _, term := range terms {
+		t := strings.ToLower(term)
+		for i := 0; t != "" && i <= len(lower)-len(t); {
+			j := strings.Index(lower[i:], t)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(t); k++ {
+				marked[k] = true
+			}
+			i += j + len(t)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			b.WriteString(markStart)
+		}
+		b.WriteByte(s[i])
+		if marked[i] && (i == len(s)-1 || !marked[i+1]) {
+			b.WriteString(markEnd)
+		}
+	}
+	return b.String()
+}
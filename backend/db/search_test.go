@@ -0,0 +1,116 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// seedSearchDB returns a migrated database holding two conversations
+func seedSearchDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, dbPath := openTestDB(t)
+	if err := migrate(db, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec(`
+		INSERT INTO conversations (id, title, created_at, updated_at, cwd) VALUES
+			('c1', 'Parser refactor', 1, 100, '/src/app'),
+			('c2', 'Release notes', 1, 200, '/src/docs');
+		INSERT INTO messages (id, conversation_id, role, content, timestamp) VALUES
+			('m1', 'c1', 'user', 'Why does the parser drop 100% of comments?', 10),
+			('m2', 'c1', 'assistant', 'The PARSER skips comment tokens.', 20),
+			('m3', 'c2', 'user', 'List the parser changes for the release', 150);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSearchLike(t *testing.T) {
+	db := seedSearchDB(t)
+
+	results, err := searchLike(db, []string{"parser"}, SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := results["c1"], results["c2"]
+	if len(results) != 2 || c1 == nil || c2 == nil {
+		t.Fatalf("got %+v", results)
+	}
+	// Two messages plus the title outweigh one message
+	if c1.MatchCount != 2 || c1.Score != 2+titleMatchWeight || c2.Score != 1 {
+		t.Errorf("got c1 %+v, c2 %+v", c1, c2)
+	}
+	if c1.TitleHighlight != "<mark>Parser</mark> refactor" {
+		t.Errorf("got title highlight %q", c1.TitleHighlight)
+	}
+	if c1.Matches[0].MessageID != "m2" || c1.Matches[0].Snippet != "The <mark>PARSER</mark> skips comment tokens." {
+		t.Errorf("expected the newest match first, got %+v", c1.Matches)
+	}
+
+	// Every term must match; LIKE wildcards are literal
+	results, _ = searchLike(db, []string{"parser", "100%"}, SearchOptions{})
+	if len(results) != 1 || results["c1"].MatchCount != 1 {
+		t.Errorf("got %+v", results)
+	}
+	results, _ = searchLike(db, []string{"parser", "1_0"}, SearchOptions{})
+	if len(results) != 0 {
+		t.Errorf("expected _ to match only itself, got %+v", results)
+	}
+}
+
+func TestSearchLike_Filters(t *testing.T) {
+	db := seedSearchDB(t)
+
+	results, _ := searchLike(db, []string{"parser"}, SearchOptions{Cwd: "/src/docs"})
+	if len(results) != 1 || results["c2"] == nil {
+		t.Errorf("cwd: got %+v", results)
+	}
+
+	results, _ = searchLike(db, []string{"parser"}, SearchOptions{Since: 15, Until: 120})
+	c1 := results["c1"]
+	if len(results) != 1 || c1 == nil || c1.MatchCount != 1 || c1.Matches[0].MessageID != "m2" {
+		t.Errorf("dates: got %+v", results)
+	}
+	// The title is checked against the conversation's last update
+	if c1 != nil && c1.TitleHighlight != "<mark>Parser</mark> refactor" {
+		t.Errorf("expected the title match kept, got %+v", c1)
+	}
+}
+
+func TestLikeSnippet(t *testing.T) {
+	long := strings.Repeat("a ", 50) + "needle <b>" + strings.Repeat(" z", 100)
+	snippet := likeSnippet(long, []string{"needle"})
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("expected both ends cut, got %q", snippet)
+	}
+	if !strings.Contains(snippet, "<mark>needle</mark> &lt;b&gt;") {
+		t.Errorf("expected the match marked and the text escaped, got %q", snippet)
+	}
+
+	if got := likeSnippet("short\n\ntext here", []string{"here"}); got != "short text <mark>here</mark>" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMarkTerms(t *testing.T) {
+	cases := []struct {
+		s     string
+		terms []string
+		want  string
+	}{
+		{"Go go GO", []string{"go"}, "[Go] [go] [GO]"},
+		{"parsers", []string{"pars", "ser"}, "[parser]s"},
+		{"no match", []string{"x"}, "no match"},
+		// Lowercasing changes the length, so nothing is marked
+		{"İstanbul", []string{"stan"}, "İstanbul"},
+	}
+	for _, c := range cases {
+		got := strings.NewReplacer(markStart, "[", markEnd, "]").Replace(markTerms(c.s, c.terms))
+		if got != c.want {
+			t.Errorf("markTerms(%q, %q) = %q, want %q", c.s, c.terms, got, c.want)
+		}
+	}
+}
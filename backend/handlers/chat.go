@@ -11,6 +11,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"markdown-themes-backend/db"
 )
 
 // ChatRequest represents the incoming chat request
@@ -28,6 +30,8 @@ type ChatRequest struct {
 	PermissionMode     string        `json:"permissionMode,omitempty"`
 	TeammateMode       string        `json:"teammateMode,omitempty"`
 	Agent              string        `json:"agent,omitempty"`
+	UserMessageID      string        `json:"userMessageId,omitempty"`      // browser's ID for the prompt, reused when saving the turn
+	AssistantMessageID string        `json:"assistantMessageId,omitempty"` // browser's ID for the reply
 	LastEventID        int64         `json:"lastEventId,omitempty"`
 	Streaming          *bool         `json:"streaming,omitempty"` // nil/true = stream-json, false = json (no --verbose)
 }
@@ -300,6 +304,11 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 	// Add session resumption if provided
 	if req.ClaudeSessionID != "" {
 		args = append(args, "--resume", req.ClaudeSessionID)
+		// A fork's first turn branches the session it inherited, leaving
+		// the original conversation's session as it was
+		if pending, _ := db.SessionForkPending(req.ConversationID); pending {
+			args = append(args, "--fork-session")
+		}
 	}
 
 	cmd := exec.Command("claude", args...)
@@ -355,6 +364,9 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 	// Reconnects are handled above and return early, so this always starts a new stream.
 	buf := resetBuffer(convID)
 
+	// Save the prompt and an empty streaming reply before any output arrives
+	rec := startChatRecorder(req, convID, lastUserMessage)
+
 	// Buffer the initial start event
 	buf.appendEvent(map[string]interface{}{
 		"type":           "start",
@@ -435,6 +447,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 						text, _ := blockMap["text"].(string)
 						if text != "" {
 							accumulatedContent += text
+							rec.appendContent(text)
 							buf.appendEvent(map[string]interface{}{
 								"type":    "content",
 								"content": text,
@@ -455,6 +468,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 					} else if blockType == "tool_use" {
 						toolName, _ := blockMap["name"].(string)
 						toolID, _ := blockMap["id"].(string)
+						rec.toolStart(toolName, toolID)
 						buf.appendEvent(map[string]interface{}{
 							"type": "tool_start",
 							"tool": map[string]interface{}{
@@ -484,6 +498,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 				if deltaType == "text_delta" {
 					text, _ := delta["text"].(string)
 					accumulatedContent += text
+					rec.appendContent(text)
 					buf.appendEvent(map[string]interface{}{
 						"type":    "content",
 						"content": text,
@@ -517,6 +532,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 					if blockType == "tool_use" {
 						toolName, _ := contentBlock["name"].(string)
 						toolID, _ := contentBlock["id"].(string)
+						rec.toolStart(toolName, toolID)
 						buf.appendEvent(map[string]interface{}{
 							"type": "tool_start",
 							"tool": map[string]interface{}{
@@ -547,6 +563,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 						"type": "thinking_end",
 					})
 				} else if currentBlockType == "tool_use" {
+					rec.toolEnd()
 					buf.appendEvent(map[string]interface{}{
 						"type": "tool_end",
 					})
@@ -600,6 +617,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 				if accumulatedContent == "" {
 					if resultText, ok := event["result"].(string); ok && resultText != "" {
 						accumulatedContent = resultText
+						rec.setContent(resultText)
 						buf.appendEvent(map[string]interface{}{
 							"type":    "content",
 							"content": resultText,
@@ -636,8 +654,12 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 					doneEvent["lastCallUsage"] = usage
 					log.Printf("[Chat] lastCallUsage source: result.usage (fallback), tokens: %v", usage)
 				}
+				// Save before the browser hears the turn is done and saves its copy
+				rec.finish(claudeSessionID, usage, modelUsage, costUSD, duration)
 				buf.appendEvent(doneEvent)
 			}
+
+			rec.checkpoint()
 		}
 
 		// Wait for process to finish
@@ -647,6 +669,7 @@ func Chat(w http.ResponseWriter, r *http.Request) {
 				errMsg = err.Error()
 			}
 			log.Printf("[Chat] Claude process exited with error: %s (stderr: %s)", err, errMsg)
+			rec.fail()
 
 			buf.appendEvent(map[string]interface{}{
 				"type":  "error",
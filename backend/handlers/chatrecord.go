@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"markdown-themes-backend/db"
+)
+
+// chatCheckpointInterval is how often a streaming reply is written to the
+// database while it grows
+const chatCheckpointInterval = 2 * time.Second
+
+// chatRecorder saves a chat turn to the database as it streams, so the reply
+// survives the browser tab going away: the prompt and an empty streaming reply
+// when the turn starts, the reply so far every chatCheckpointInterval, and the
+// final reply with its usage and cost from the result event. The browser saves
+// the same message IDs when it sees the turn finish, so the two writes agree.
+// Database errors are logged and never interrupt the stream. A nil recorder
+// (no database) does nothing.
+type chatRecorder struct {
+	conversationID string
+	messageID      string
+	model          string
+	content        string
+	tools          []map[string]string
+	dirty          bool
+	savedAt        time.Time
+}
+
+// startChatRecorder saves the turn's prompt and the empty reply, creating the
+// conversation if the browser has not saved it yet
+func startChatRecorder(req ChatRequest, conversationID, prompt string) *chatRecorder {
+	if db.Get() == nil {
+		return nil
+	}
+
+	now := time.Now()
+	userID := req.UserMessageID
+	if userID == "" {
+		userID = fmt.Sprintf("msg_%d_user", now.UnixNano())
+	}
+	assistantID := req.AssistantMessageID
+	if assistantID == "" {
+		assistantID = fmt.Sprintf("msg_%d_assistant", now.UnixNano())
+	}
+
+	conv := &db.Conversation{
+		ID:              conversationID,
+		Title:           importTitle("", prompt),
+		Cwd:             req.Cwd,
+		ClaudeSessionID: req.ClaudeSessionID,
+	}
+	if err := db.EnsureConversation(conv); err != nil {
+		log.Printf("[Chat] Failed to save conversation %s: %s", conversationID, err)
+		return nil
+	}
+
+	// The reply is a millisecond later so it always sorts after the prompt
+	ts := now.UnixMilli()
+	messages := []db.Message{
+		{ID: userID, Role: "user", Content: prompt, Timestamp: ts},
+		{ID: assistantID, Role: "assistant", Timestamp: ts + 1, IsStreaming: true},
+	}
+	for i := range messages {
+		if _, err := db.AppendMessage(conversationID, &messages[i], 0); err != nil {
+			log.Printf("[Chat] Failed to save message %s: %s", messages[i].ID, err)
+			return nil
+		}
+	}
+
+	return &chatRecorder{
+		conversationID: conversationID,
+		messageID:      assistantID,
+		model:          req.Model,
+		savedAt:        now,
+	}
+}
+
+// appendContent adds streamed reply text
+func (rec *chatRecorder) appendContent(text string) {
+	if rec == nil || text == "" {
+		return
+	}
+	rec.content += text
+	rec.dirty = true
+}
+
+// setContent replaces the reply text, for replies that arrive whole
+func (rec *chatRecorder) setContent(text string) {
+	if rec == nil {
+		return
+	}
+	rec.content = text
+	rec.dirty = true
+}
+
+// toolStart and toolEnd record tool calls as the chat panel's toolUse events
+func (rec *chatRecorder) toolStart(name, id string) {
+	if rec == nil {
+		return
+	}
+	rec.tools = append(rec.tools, map[string]string{"type": "start", "name": name, "id": id})
+	rec.dirty = true
+}
+
+func (rec *chatRecorder) toolEnd() {
+	if rec == nil {
+		return
+	}
+	rec.tools = append(rec.tools, map[string]string{"type": "end"})
+	rec.dirty = true
+}
+
+// checkpoint saves the reply so far if it changed and the last save is more
+// than chatCheckpointInterval old
+func (rec *chatRecorder) checkpoint() {
+	if rec == nil || !rec.dirty || time.Since(rec.savedAt) < chatCheckpointInterval {
+		return
+	}
+	rec.save(rec.patch(true))
+}
+
+// finish saves the completed reply with the result event's usage, cost,
+// duration and Claude session, and points the conversation at that session
+func (rec *chatRecorder) finish(claudeSessionID string, usage, modelUsage map[string]interface{}, costUSD, durationMs float64) {
+	if rec == nil {
+		return
+	}
+	patch := rec.patch(false)
+	if usage != nil {
+		patch.Usage, _ = json.Marshal(usage)
+	}
+	if primary := primaryModelUsage(modelUsage, rec.model); primary != nil {
+		patch.ModelUsage, _ = json.Marshal(primary)
+	}
+	patch.CostUSD = &costUSD
+	patch.DurationMs = &durationMs
+	if claudeSessionID != "" {
+		patch.ClaudeSessionID = &claudeSessionID
+	}
+	rec.save(patch)
+
+	if rec.messageID != "" && claudeSessionID != "" {
+		if err := db.SetConversationClaudeSession(rec.conversationID, claudeSessionID); err != nil {
+			log.Printf("[Chat] Failed to save Claude session for %s: %s", rec.conversationID, err)
+		}
+	}
+}
+
+// fail saves the reply as it stood when the process failed
+func (rec *chatRecorder) fail() {
+	if rec == nil {
+		return
+	}
+	patch := rec.patch(false)
+	if rec.content == "" {
+		errored := "(Error occurred)"
+		patch.Content = &errored
+	}
+	rec.save(patch)
+}
+
+func (rec *chatRecorder) patch(streaming bool) db.MessagePatch {
+	content := rec.content
+	patch := db.MessagePatch{Content: &content, IsStreaming: &streaming}
+	if len(rec.tools) > 0 {
+		patch.ToolUse, _ = json.Marshal(rec.tools)
+	}
+	return patch
+}
+
+// save writes a patch to the reply. Once the conversation or reply is gone
+// (deleted in the browser mid-turn) the recorder stops writing.
+func (rec *chatRecorder) save(patch db.MessagePatch) {
+	if rec.messageID == "" {
+		return
+	}
+	_, _, err := db.PatchMessage(rec.conversationID, rec.messageID, patch, 0)
+	if errors.Is(err, db.ErrConversationNotFound) || errors.Is(err, db.ErrMessageNotFound) {
+		log.Printf("[Chat] Conversation %s was deleted, no longer saving the reply", rec.conversationID)
+		rec.messageID = ""
+		return
+	}
+	if err != nil {
+		log.Printf("[Chat] Failed to save reply %s: %s", rec.messageID, err)
+		return
+	}
+	rec.dirty = false
+	rec.savedAt = time.Now()
+}
+
+// primaryModelUsage picks the turn's main model out of a result's per-model
+// usage, as the chat panel does: the configured model if present, else the
+// one that read the most context (subagents see less of the conversation)
+func primaryModelUsage(modelUsage map[string]interface{}, model string) map[string]interface{} {
+	var best map[string]interface{}
+	var bestTokens float64
+	for name, v := range modelUsage {
+		usage, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if model != "" && (name == model || strings.Contains(name, model)) {
+			return usage
+		}
+		var tokens float64
+		for _, key := range []string{"inputTokens", "cacheReadInputTokens", "cacheCreationInputTokens"} {
+			n, _ := usage[key].(float64)
+			tokens += n
+		}
+		if best == nil || tokens > bestTokens {
+			best, bestTokens = usage, tokens
+		}
+	}
+	return best
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"markdown-themes-backend/db"
+)
+
+func TestPrimaryModelUsage(t *testing.T) {
+	modelUsage := map[string]interface{}{
+		"claude-haiku-4-5":  map[string]interface{}{"inputTokens": 5000.0},
+		"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 10.0, "cacheReadInputTokens": 20000.0},
+	}
+
+	if got := primaryModelUsage(modelUsage, ""); got["inputTokens"] != 10.0 {
+		t.Errorf("got %v, want the model that read the most context", got)
+	}
+	if got := primaryModelUsage(modelUsage, "haiku"); got["inputTokens"] != 5000.0 {
+		t.Errorf("got %v, want the configured model", got)
+	}
+	if got := primaryModelUsage(nil, "haiku"); got != nil {
+		t.Errorf("got %v, want nil", got)
+	}
+}
+
+func TestChatRecorder_SavesTurn(t *testing.T) {
+	setupTestDB(t)
+	req := ChatRequest{Cwd: "/work", Model: "sonnet", UserMessageID: "rec-u", AssistantMessageID: "rec-a"}
+
+	rec := startChatRecorder(req, "rec-1", "Explain the parser")
+	if rec == nil {
+		t.Fatal("expected a recorder")
+	}
+	conv, _ := db.GetConversation("rec-1")
+	if conv == nil || conv.Title != "Explain the parser" || len(conv.Messages) != 2 {
+		t.Fatalf("expected the prompt saved at turn start, got %+v", conv)
+	}
+	user, reply := conv.Messages[0], conv.Messages[1]
+	if user.ID != "rec-u" || user.Content != "Explain the parser" || reply.ID != "rec-a" || !reply.IsStreaming {
+		t.Errorf("unexpected messages %+v", conv.Messages)
+	}
+	if reply.Timestamp <= user.Timestamp {
+		t.Errorf("expected the reply after the prompt, got %d and %d", user.Timestamp, reply.Timestamp)
+	}
+
+	rec.appendContent("The parser ")
+	rec.toolStart("Read", "toolu_1")
+	rec.checkpoint() // Too soon after the start
+	if conv, _ = db.GetConversation("rec-1"); conv.Messages[1].Content != "" {
+		t.Errorf("expected no save within the interval, got %q", conv.Messages[1].Content)
+	}
+	rec.savedAt = time.Now().Add(-chatCheckpointInterval)
+	rec.checkpoint()
+	conv, _ = db.GetConversation("rec-1")
+	if reply = conv.Messages[1]; reply.Content != "The parser " || !reply.IsStreaming || reply.ToolUse == nil {
+		t.Errorf("expected the partial reply checkpointed, got %+v", reply)
+	}
+
+	rec.toolEnd()
+	rec.appendContent("reads tokens.")
+	rec.finish("sess-rec",
+		map[string]interface{}{"input_tokens": 10.0, "output_tokens": 5.0},
+		map[string]interface{}{"claude-sonnet-4-5": map[string]interface{}{"inputTokens": 10.0}},
+		0.5, 1200)
+
+	conv, _ = db.GetConversation("rec-1")
+	reply = conv.Messages[1]
+	if reply.Content != "The parser reads tokens." || reply.IsStreaming {
+		t.Errorf("expected the finished reply, got %+v", reply)
+	}
+	var usage, modelUsage map[string]float64
+	json.Unmarshal(reply.Usage, &usage)
+	json.Unmarshal(reply.ModelUsage, &modelUsage)
+	if usage["output_tokens"] != 5 || modelUsage["inputTokens"] != 10 {
+		t.Errorf("got usage %s, modelUsage %s", reply.Usage, reply.ModelUsage)
+	}
+	if reply.CostUSD == nil || *reply.CostUSD != 0.5 || reply.DurationMs == nil || *reply.DurationMs != 1200 {
+		t.Errorf("got cost %v, duration %v", reply.CostUSD, reply.DurationMs)
+	}
+	if reply.ClaudeSessionID != "sess-rec" || conv.ClaudeSessionID != "sess-rec" {
+		t.Errorf("expected the session on the reply and conversation, got %q and %q", reply.ClaudeSessionID, conv.ClaudeSessionID)
+	}
+	var tools []map[string]string
+	json.Unmarshal(reply.ToolUse, &tools)
+	if len(tools) != 2 || tools[0]["name"] != "Read" || tools[1]["type"] != "end" {
+		t.Errorf("got toolUse %s", reply.ToolUse)
+	}
+}
+
+func TestChatRecorder_StopsAfterDelete(t *testing.T) {
+	setupTestDB(t)
+	rec := startChatRecorder(ChatRequest{UserMessageID: "del-u", AssistantMessageID: "del-a"}, "rec-del", "hi")
+	if err := db.DeleteConversation("rec-del"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec.appendContent("late")
+	rec.fail()
+	if rec.messageID != "" {
+		t.Error("expected the recorder to stop once the conversation is gone")
+	}
+	if conv, _ := db.GetConversation("rec-del"); conv != nil {
+		t.Errorf("expected the conversation to stay deleted, got %+v", conv)
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"bufio"
 	"encoding/json"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -11,88 +13,297 @@ import (
 	"markdown-themes-backend/models"
 )
 
-// ClaudeSession handles GET /api/claude/session - find active Claude sessions
-// Scans ~/.claude/projects/ for recently modified conversation .jsonl files
-func ClaudeSession(w http.ResponseWriter, r *http.Request) {
+// ClaudeTranscript is a conversation transcript under ~/.claude/projects
+type ClaudeTranscript struct {
+	SessionID       string // Session UUID, or "agent-<id>" for a subagent
+	ParentSessionID string // Spawning session, when known from the path
+	ProjectDir      string // ~/.claude/projects/<encoded working dir>
+	Path            string
+	ModTime         time.Time
+	Size            int64
+}
+
+// IsSubagent reports whether the transcript belongs to a Task subagent
+func (t ClaudeTranscript) IsSubagent() bool {
+	return strings.HasPrefix(t.SessionID, "agent-")
+}
+
+// ClaudeTranscriptHeader is what the opening entries of a transcript record
+type ClaudeTranscriptHeader struct {
+	SessionID   string // For a subagent, the session that spawned it
+	AgentID     string
+	WorkingDir  string
+	GitBranch   string
+	FirstPrompt string
+}
+
+// claudeEntry is the part of a transcript line the handlers look at
+type claudeEntry struct {
+	Type        string `json:"type"`
+	UUID        string `json:"uuid"`
+	Timestamp   string `json:"timestamp"`
+	SessionID   string `json:"sessionId"`
+	AgentID     string `json:"agentId"`
+	Cwd         string `json:"cwd"`
+	GitBranch   string `json:"gitBranch"`
+	IsMeta      bool   `json:"isMeta"`
+	IsSidechain bool   `json:"isSidechain"`
+	Summary     string `json:"summary"`
+	Message     struct {
+		ID      string          `json:"id"`
+		Role    string          `json:"role"`
+		Model   string          `json:"model"`
+		Content json.RawMessage `json:"content"`
+		Usage   *struct {
+			InputTokens              int `json:"input_tokens"`
+			OutputTokens             int `json:"output_tokens"`
+			CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+}
+
+// claudeContentBlock is one block of a message's content list
+type claudeContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Thinking  string          `json:"thinking"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	IsError   bool            `json:"is_error"`
+}
+
+// Header scanning gives up after this much of a transcript
+const maxTranscriptHeaderBytes = 256 * 1024
+
+// ClaudeProjectsDir returns ~/.claude/projects
+func ClaudeProjectsDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		http.Error(w, `{"error": "cannot determine home directory"}`, http.StatusInternalServerError)
-		return
+		return "", err
 	}
+	return filepath.Join(home, ".claude", "projects"), nil
+}
 
-	claudeProjectsDir := filepath.Join(home, ".claude", "projects")
-
-	// Check if .claude/projects exists
-	if _, err := os.Stat(claudeProjectsDir); os.IsNotExist(err) {
-		http.Error(w, `{"error": "no Claude projects directory found"}`, http.StatusNotFound)
-		return
+// ListClaudeTranscripts returns the transcripts modified after since (all of
+// them for the zero time). Claude Code stores sessions as {sessionId}.jsonl
+// and subagents either beside them as agent-{id}.jsonl or under
+// {sessionId}/subagents/; the latter are only looked for while the parent
+// session itself was modified after since.
+func ListClaudeTranscripts(since time.Time) ([]ClaudeTranscript, error) {
+	projectsDir, err := ClaudeProjectsDir()
+	if err != nil {
+		return nil, err
 	}
-
-	// Find the most recently modified .jsonl conversation file
-	var bestSession *models.ClaudeSessionInfo
-	var bestModTime time.Time
-
-	// Walk through project directories
-	projectEntries, err := os.ReadDir(claudeProjectsDir)
+	projectEntries, err := os.ReadDir(projectsDir)
 	if err != nil {
-		http.Error(w, `{"error": "cannot read Claude projects directory"}`, http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
+	var transcripts []ClaudeTranscript
 	for _, projectEntry := range projectEntries {
 		if !projectEntry.IsDir() {
 			continue
 		}
+		projectDir := filepath.Join(projectsDir, projectEntry.Name())
+		for _, t := range listTranscriptFiles(projectDir, projectDir, "", since) {
+			transcripts = append(transcripts, t)
+			if !t.IsSubagent() {
+				subagentsDir := filepath.Join(projectDir, t.SessionID, "subagents")
+				transcripts = append(transcripts, listTranscriptFiles(subagentsDir, projectDir, t.SessionID, since)...)
+			}
+		}
+	}
+	return transcripts, nil
+}
 
-		projectDir := filepath.Join(claudeProjectsDir, projectEntry.Name())
-
-		// Look for .jsonl files directly in the project directory
-		// Claude Code stores conversations as {sessionId}.jsonl
-		entries, err := os.ReadDir(projectDir)
-		if err != nil {
+func listTranscriptFiles(dir, projectDir, parentSessionID string, since time.Time) []ClaudeTranscript {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var transcripts []ClaudeTranscript
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().After(since) {
 			continue
 		}
+		transcripts = append(transcripts, ClaudeTranscript{
+			SessionID:       strings.TrimSuffix(entry.Name(), ".jsonl"),
+			ParentSessionID: parentSessionID,
+			ProjectDir:      projectDir,
+			Path:            filepath.Join(dir, entry.Name()),
+			ModTime:         info.ModTime(),
+			Size:            info.Size(),
+		})
+	}
+	return transcripts
+}
 
-		for _, entry := range entries {
-			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
-				continue
-			}
+// ReadClaudeTranscriptHeader scans the start of a transcript for its working
+// directory, branch, owning session and first user prompt. WorkingDir falls
+// back to resolving the project directory.
+func ReadClaudeTranscriptHeader(t ClaudeTranscript) ClaudeTranscriptHeader {
+	header := ClaudeTranscriptHeader{SessionID: t.ParentSessionID}
 
-			filePath := filepath.Join(projectDir, entry.Name())
-			info, err := entry.Info()
+	if file, err := os.Open(t.Path); err == nil {
+		reader := bufio.NewReader(io.LimitReader(file, maxTranscriptHeaderBytes))
+		for header.WorkingDir == "" || header.FirstPrompt == "" {
+			line, err := reader.ReadBytes('\n')
+			var entry claudeEntry
+			if json.Unmarshal(line, &entry) == nil {
+				if header.SessionID == "" {
+					header.SessionID = entry.SessionID
+				}
+				if header.AgentID == "" {
+					header.AgentID = entry.AgentID
+				}
+				if header.WorkingDir == "" {
+					header.WorkingDir = entry.Cwd
+				}
+				if header.GitBranch == "" {
+					header.GitBranch = entry.GitBranch
+				}
+				if header.FirstPrompt == "" && entry.Type == "user" && !entry.IsMeta {
+					header.FirstPrompt = userPromptText(entry.Message.Content)
+				}
+			}
 			if err != nil {
-				continue
+				break
 			}
+		}
+		file.Close()
+	}
 
-			modTime := info.ModTime()
+	if header.WorkingDir == "" {
+		header.WorkingDir = ResolveClaudeProjectDir(t.ProjectDir)
+	}
+	return header
+}
 
-			// Only consider files modified in the last 30 minutes as potentially active
-			if time.Since(modTime) > 30*time.Minute {
-				continue
-			}
+// userPromptText returns the text a user typed, skipping tool results and
+// the tagged entries Claude Code records for slash commands
+func userPromptText(content json.RawMessage) string {
+	text := claudeContentText(content)
+	if strings.HasPrefix(text, "<") {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+// transcriptPrompt returns the prompt of a transcript line that starts a
+// turn, or "" for any other line, including an interruption notice
+func transcriptPrompt(entry claudeEntry) string {
+	if entry.Type != "user" || entry.IsMeta || entry.IsSidechain {
+		return ""
+	}
+	prompt := userPromptText(entry.Message.Content)
+	if strings.HasPrefix(prompt, "[Request interrupted") {
+		return ""
+	}
+	return prompt
+}
 
-			if bestSession == nil || modTime.After(bestModTime) {
-				sessionID := strings.TrimSuffix(entry.Name(), ".jsonl")
-				workingDir := decodeProjectPath(projectEntry.Name())
+// claudeContentText joins the text of a message's content, which is either
+// a string or a list of blocks
+func claudeContentText(content json.RawMessage) string {
+	var text string
+	if json.Unmarshal(content, &text) == nil {
+		return text
+	}
+	var blocks []claudeContentBlock
+	if json.Unmarshal(content, &blocks) != nil {
+		return ""
+	}
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == "text" && block.Text != "" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
 
-				bestSession = &models.ClaudeSessionInfo{
-					SessionID:        sessionID,
-					WorkingDir:       workingDir,
-					ConversationPath: filePath,
-					Pane:             "",
+// ClaudeSession handles GET /api/claude/session - find active Claude sessions
+// Scans ~/.claude/projects/ for recently modified conversation .jsonl files,
+// or with ?pane= (a tmux pane ID or terminal ID) returns the session of the
+// claude running in that terminal
+func ClaudeSession(w http.ResponseWriter, r *http.Request) {
+	if pane := r.URL.Query().Get("pane"); pane != "" {
+		// State files sanitize "%3" to "_3"
+		if strings.HasPrefix(pane, "_") {
+			pane = "%" + pane[1:]
+		}
+		for _, p := range FindClaudePanes() {
+			if (p.Pane == pane || p.TerminalID == pane) && p.ConversationPath != "" {
+				transcript := ClaudeTranscript{SessionID: p.SessionID, ProjectDir: filepath.Dir(p.ConversationPath), Path: p.ConversationPath}
+				json.NewEncoder(w).Encode(models.ClaudeSessionInfo{
+					SessionID:        p.SessionID,
+					WorkingDir:       ReadClaudeTranscriptHeader(transcript).WorkingDir,
+					ConversationPath: p.ConversationPath,
+					Pane:             p.Pane,
+					TerminalID:       p.TerminalID,
 					Status:           "active",
-				}
-				bestModTime = modTime
+				})
+				return
 			}
 		}
+		http.Error(w, `{"error": "no Claude session found in pane"}`, http.StatusNotFound)
+		return
+	}
+
+	claudeProjectsDir, err := ClaudeProjectsDir()
+	if err != nil {
+		http.Error(w, `{"error": "cannot determine home directory"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Check if .claude/projects exists
+	if _, err := os.Stat(claudeProjectsDir); os.IsNotExist(err) {
+		http.Error(w, `{"error": "no Claude projects directory found"}`, http.StatusNotFound)
+		return
+	}
+
+	// Only consider files modified in the last 30 minutes as potentially active
+	transcripts, err := ListClaudeTranscripts(time.Now().Add(-30 * time.Minute))
+	if err != nil {
+		http.Error(w, `{"error": "cannot read Claude projects directory"}`, http.StatusInternalServerError)
+		return
 	}
 
-	if bestSession == nil {
+	// Find the most recently modified session transcript
+	var best *ClaudeTranscript
+	for i, t := range transcripts {
+		if t.IsSubagent() {
+			continue
+		}
+		if best == nil || t.ModTime.After(best.ModTime) {
+			best = &transcripts[i]
+		}
+	}
+
+	if best == nil {
 		http.Error(w, `{"error": "no active Claude session found"}`, http.StatusNotFound)
 		return
 	}
 
-	json.NewEncoder(w).Encode(bestSession)
+	session := models.ClaudeSessionInfo{
+		SessionID:        best.SessionID,
+		WorkingDir:       ReadClaudeTranscriptHeader(*best).WorkingDir,
+		ConversationPath: best.Path,
+		Status:           "active",
+	}
+	if p, ok := ClaudePaneForSession(best.SessionID); ok {
+		session.Pane = p.Pane
+		session.TerminalID = p.TerminalID
+	}
+	json.NewEncoder(w).Encode(session)
 }
 
 // ClaudeSessionByID handles GET /api/claude/session/{sessionId} - find a specific session's JSONL file
@@ -103,55 +314,72 @@ func ClaudeSessionByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	home, err := os.UserHomeDir()
+	transcript, err := FindClaudeTranscript(sessionID)
 	if err != nil {
-		http.Error(w, `{"error": "cannot determine home directory"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error": "session not found"}`, http.StatusNotFound)
 		return
 	}
 
-	claudeProjectsDir := filepath.Join(home, ".claude", "projects")
-	targetFile := sessionID + ".jsonl"
+	session := models.ClaudeSessionInfo{
+		SessionID:        sessionID,
+		WorkingDir:       ReadClaudeTranscriptHeader(transcript).WorkingDir,
+		ConversationPath: transcript.Path,
+		Status:           "found",
+	}
+	paneSession := sessionID
+	if transcript.ParentSessionID != "" {
+		paneSession = transcript.ParentSessionID
+	}
+	if p, ok := ClaudePaneForSession(paneSession); ok {
+		session.Pane = p.Pane
+		session.TerminalID = p.TerminalID
+	}
+	json.NewEncoder(w).Encode(session)
+}
 
-	// Scan all project directories for the JSONL file
+// FindClaudeTranscript scans all project directories for a session's
+// transcript, or for a subagent's ("agent-<id>") under any session
+func FindClaudeTranscript(sessionID string) (ClaudeTranscript, error) {
+	if sessionID == "" || strings.ContainsAny(sessionID, `/\`) || strings.HasPrefix(sessionID, ".") {
+		return ClaudeTranscript{}, os.ErrNotExist
+	}
+	claudeProjectsDir, err := ClaudeProjectsDir()
+	if err != nil {
+		return ClaudeTranscript{}, err
+	}
 	projectEntries, err := os.ReadDir(claudeProjectsDir)
 	if err != nil {
-		http.Error(w, `{"error": "cannot read Claude projects directory"}`, http.StatusNotFound)
-		return
+		return ClaudeTranscript{}, err
 	}
 
+	targetFile := sessionID + ".jsonl"
 	for _, projectEntry := range projectEntries {
 		if !projectEntry.IsDir() {
 			continue
 		}
-
-		filePath := filepath.Join(claudeProjectsDir, projectEntry.Name(), targetFile)
-		if _, err := os.Stat(filePath); err == nil {
-			workingDir := decodeProjectPath(projectEntry.Name())
-			session := models.ClaudeSessionInfo{
-				SessionID:        sessionID,
-				WorkingDir:       workingDir,
-				ConversationPath: filePath,
-				Pane:             "",
-				Status:           "found",
+		projectDir := filepath.Join(claudeProjectsDir, projectEntry.Name())
+		candidates := []string{filepath.Join(projectDir, targetFile)}
+		if strings.HasPrefix(sessionID, "agent-") {
+			nested, _ := filepath.Glob(filepath.Join(projectDir, "*", "subagents", targetFile))
+			candidates = append(candidates, nested...)
+		}
+		for _, path := range candidates {
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			transcript := ClaudeTranscript{
+				SessionID:  sessionID,
+				ProjectDir: projectDir,
+				Path:       path,
+				ModTime:    info.ModTime(),
+				Size:       info.Size(),
+			}
+			if dir := filepath.Dir(path); dir != projectDir {
+				transcript.ParentSessionID = filepath.Base(filepath.Dir(dir))
 			}
-			json.NewEncoder(w).Encode(session)
-			return
+			return transcript, nil
 		}
 	}
-
-	http.Error(w, `{"error": "session not found"}`, http.StatusNotFound)
-}
-
-// decodeProjectPath converts the encoded directory name back to a filesystem path.
-// e.g., "-home-user-projects-myapp" -> "/home/user/projects/myapp"
-func decodeProjectPath(encoded string) string {
-	// The encoding replaces leading / with nothing and all / with -
-	// So "-home-user-projects-myapp" came from "/home/user/projects/myapp"
-	// We restore by adding leading / and replacing - with /
-	// But this is ambiguous (directory names can contain hyphens)
-	// Best effort: replace leading dash with / and subsequent dashes with /
-	if strings.HasPrefix(encoded, "-") {
-		return "/" + strings.Replace(encoded[1:], "-", "/", -1)
-	}
-	return "/" + strings.Replace(encoded, "-", "/", -1)
+	return ClaudeTranscript{}, os.ErrNotExist
 }
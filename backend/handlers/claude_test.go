@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupClaudeProjects points HOME at a temp dir and returns its
+// .claude/projects directory
+func setupClaudeProjects(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".claude", "projects")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeTranscript(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListClaudeTranscripts_FindsSessionsAndSubagents(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	project := filepath.Join(projects, "-home-user-app")
+	writeTranscript(t, filepath.Join(project, "sess-1.jsonl"), `{"type":"user"}`)
+	writeTranscript(t, filepath.Join(project, "agent-old.jsonl"), `{"type":"user"}`)
+	writeTranscript(t, filepath.Join(project, "sess-1", "subagents", "agent-abc.jsonl"), `{"type":"user"}`)
+	writeTranscript(t, filepath.Join(project, "notes.txt"), "x")
+
+	transcripts, err := ListClaudeTranscripts(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]ClaudeTranscript)
+	for _, tr := range transcripts {
+		byID[tr.SessionID] = tr
+	}
+	if len(byID) != 3 {
+		t.Fatalf("expected 3 transcripts, got %v", transcripts)
+	}
+	if byID["sess-1"].IsSubagent() || !byID["agent-old"].IsSubagent() {
+		t.Errorf("unexpected subagent classification: %v", byID)
+	}
+	if byID["agent-abc"].ParentSessionID != "sess-1" {
+		t.Errorf("expected parent sess-1, got %q", byID["agent-abc"].ParentSessionID)
+	}
+	if byID["agent-abc"].ProjectDir != project {
+		t.Errorf("expected project dir %s, got %s", project, byID["agent-abc"].ProjectDir)
+	}
+}
+
+func TestListClaudeTranscripts_SkipsOlderThanSince(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	old := filepath.Join(projects, "-p", "old.jsonl")
+	writeTranscript(t, old, `{}`)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(old, past, past)
+	writeTranscript(t, filepath.Join(projects, "-p", "new.jsonl"), `{}`)
+
+	transcripts, _ := ListClaudeTranscripts(time.Now().Add(-time.Minute))
+	if len(transcripts) != 1 || transcripts[0].SessionID != "new" {
+		t.Fatalf("expected only the new transcript, got %v", transcripts)
+	}
+}
+
+func TestReadClaudeTranscriptHeader(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-my-app", "sess.jsonl")
+	writeTranscript(t, path,
+		`{"type":"summary","summary":"x"}`,
+		`{"type":"user","isMeta":true,"sessionId":"sess","cwd":"/home/user/my-app","gitBranch":"main","message":{"role":"user","content":"Caveat"}}`,
+		`{"type":"user","sessionId":"sess","message":{"role":"user","content":"<command-name>/clear</command-name>"}}`,
+		`{"type":"user","sessionId":"sess","message":{"role":"user","content":[{"type":"text","text":"Fix the build"}]}}`,
+	)
+
+	header := ReadClaudeTranscriptHeader(ClaudeTranscript{SessionID: "sess", ProjectDir: filepath.Dir(path), Path: path})
+	if header.WorkingDir != "/home/user/my-app" {
+		t.Errorf("expected cwd from transcript, got %q", header.WorkingDir)
+	}
+	if header.GitBranch != "main" || header.SessionID != "sess" {
+		t.Errorf("unexpected header %+v", header)
+	}
+	if header.FirstPrompt != "Fix the build" {
+		t.Errorf("expected first prompt, got %q", header.FirstPrompt)
+	}
+}
+
+func TestReadClaudeTranscriptHeader_FallsBackToProjectName(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "agent-1.jsonl")
+	writeTranscript(t, path, `{"type":"user","agentId":"1","message":{"role":"user","content":"Explore"}}`)
+
+	header := ReadClaudeTranscriptHeader(ClaudeTranscript{SessionID: "agent-1", ParentSessionID: "parent", ProjectDir: filepath.Dir(path), Path: path})
+	if header.WorkingDir != "/home/user/app" {
+		t.Errorf("expected decoded project path, got %q", header.WorkingDir)
+	}
+	if header.SessionID != "parent" || header.AgentID != "1" || header.FirstPrompt != "Explore" {
+		t.Errorf("unexpected header %+v", header)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"markdown-themes-backend/models"
+)
+
+// Longest text sent in one event; tool results reading whole files are cut
+const maxClaudeEventText = 64 * 1024
+
+// ParseClaudeEvents normalizes one transcript line, found at offset, into
+// events. Claude Code writes each content block of an assistant message as
+// its own line repeating the message's usage, so usage events carry the
+// messageId and later ones replace earlier ones rather than add to them.
+// Summaries, snapshots and meta entries produce no events.
+func ParseClaudeEvents(line []byte, offset int64) []models.ClaudeSessionEvent {
+	var entry claudeEntry
+	if json.Unmarshal(line, &entry) != nil || entry.IsMeta {
+		return nil
+	}
+	if entry.Type != "user" && entry.Type != "assistant" {
+		return nil
+	}
+
+	base := models.ClaudeSessionEvent{
+		Offset:      offset,
+		UUID:        entry.UUID,
+		Timestamp:   entry.Timestamp,
+		MessageID:   entry.Message.ID,
+		IsSidechain: entry.IsSidechain,
+	}
+	event := func(kind string) models.ClaudeSessionEvent {
+		e := base
+		e.Kind = kind
+		return e
+	}
+
+	var events []models.ClaudeSessionEvent
+	var text string
+	if json.Unmarshal(entry.Message.Content, &text) == nil {
+		if text != "" {
+			kind := "user"
+			if entry.Type == "assistant" {
+				kind = "text"
+			}
+			e := event(kind)
+			e.Text, e.Truncated = truncateEventText(text)
+			events = append(events, e)
+		}
+	} else {
+		var blocks []claudeContentBlock
+		json.Unmarshal(entry.Message.Content, &blocks)
+		for _, block := range blocks {
+			switch block.Type {
+			case "text":
+				if block.Text == "" {
+					continue
+				}
+				kind := "text"
+				if entry.Type == "user" {
+					kind = "user"
+				}
+				e := event(kind)
+				e.Text, e.Truncated = truncateEventText(block.Text)
+				events = append(events, e)
+			case "thinking":
+				if block.Thinking == "" {
+					continue
+				}
+				e := event("thinking")
+				e.Text, e.Truncated = truncateEventText(block.Thinking)
+				events = append(events, e)
+			case "tool_use":
+				e := event("tool_use")
+				e.ToolUseID = block.ID
+				e.ToolName = block.Name
+				e.Input = block.Input
+				events = append(events, e)
+			case "tool_result":
+				e := event("tool_result")
+				e.ToolUseID = block.ToolUseID
+				e.IsError = block.IsError
+				e.Text, e.Truncated = truncateEventText(claudeContentText(block.Content))
+				events = append(events, e)
+			}
+		}
+	}
+
+	if entry.Type == "assistant" && entry.Message.Usage != nil {
+		u := entry.Message.Usage
+		e := event("usage")
+		e.Model = entry.Message.Model
+		e.Usage = &models.ClaudeUsage{
+			InputTokens:              u.InputTokens,
+			OutputTokens:             u.OutputTokens,
+			CacheCreationInputTokens: u.CacheCreationInputTokens,
+			CacheReadInputTokens:     u.CacheReadInputTokens,
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// truncateEventText cuts text to maxClaudeEventText bytes on a character
+// boundary, reporting whether it did
+func truncateEventText(text string) (string, bool) {
+	if len(text) <= maxClaudeEventText {
+		return text, false
+	}
+	cut := maxClaudeEventText
+	for cut > 0 && text[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	return text[:cut], true
+}
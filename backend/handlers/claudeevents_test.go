@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseClaudeEvents_UserPrompt(t *testing.T) {
+	events := ParseClaudeEvents([]byte(`{"type":"user","uuid":"u1","timestamp":"2026-01-01T00:00:00Z","message":{"role":"user","content":"hello"}}`), 42)
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %v", events)
+	}
+	e := events[0]
+	if e.Kind != "user" || e.Text != "hello" || e.Offset != 42 || e.UUID != "u1" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestParseClaudeEvents_AssistantBlocksAndUsage(t *testing.T) {
+	line := `{"type":"assistant","uuid":"a1","message":{"id":"msg_1","role":"assistant","model":"claude-x",` +
+		`"content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"Done"},{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"/x"}}],` +
+		`"usage":{"input_tokens":10,"output_tokens":5,"cache_read_input_tokens":100}}}`
+	events := ParseClaudeEvents([]byte(line), 0)
+
+	var kinds []string
+	for _, e := range events {
+		kinds = append(kinds, e.Kind)
+	}
+	if strings.Join(kinds, ",") != "thinking,text,tool_use,usage" {
+		t.Fatalf("unexpected kinds %v", kinds)
+	}
+	if events[2].ToolName != "Read" || events[2].ToolUseID != "toolu_1" || string(events[2].Input) != `{"file_path":"/x"}` {
+		t.Errorf("unexpected tool_use %+v", events[2])
+	}
+	usage := events[3]
+	if usage.MessageID != "msg_1" || usage.Model != "claude-x" || usage.Usage.InputTokens != 10 || usage.Usage.CacheReadInputTokens != 100 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+}
+
+func TestParseClaudeEvents_ToolResult(t *testing.T) {
+	line := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","is_error":true,"content":[{"type":"text","text":"boom"}]}]}}`
+	events := ParseClaudeEvents([]byte(line), 0)
+	if len(events) != 1 || events[0].Kind != "tool_result" || !events[0].IsError || events[0].Text != "boom" || events[0].ToolUseID != "toolu_1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestParseClaudeEvents_SkipsMetaAndOtherTypes(t *testing.T) {
+	for _, line := range []string{
+		`{"type":"summary","summary":"x"}`,
+		`{"type":"user","isMeta":true,"message":{"content":"Caveat"}}`,
+		`not json`,
+	} {
+		if events := ParseClaudeEvents([]byte(line), 0); len(events) != 0 {
+			t.Errorf("expected no events for %s, got %v", line, events)
+		}
+	}
+}
+
+func TestParseClaudeEvents_TruncatesLongText(t *testing.T) {
+	long := strings.Repeat("é", maxClaudeEventText)
+	events := ParseClaudeEvents([]byte(`{"type":"user","message":{"content":"`+long+`"}}`), 0)
+	if len(events) != 1 || !events[0].Truncated || len(events[0].Text) > maxClaudeEventText {
+		t.Fatalf("expected truncated event, got truncated=%v len=%d", events[0].Truncated, len(events[0].Text))
+	}
+	if !strings.HasSuffix(events[0].Text, "é") {
+		t.Error("expected truncation on a character boundary")
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"markdown-themes-backend/utils"
+)
+
+// forkClaudeSession copies the start of a session's transcript, up to the
+// prompt after its first turns ones, into a new session beside it and
+// returns the new session's ID. A conversation forked partway through a
+// session resumes the copy, so Claude doesn't remember the later turns.
+func forkClaudeSession(sessionID string, turns int) (string, error) {
+	t, err := FindClaudeTranscript(sessionID)
+	if err != nil {
+		return "", err
+	}
+	if t.IsSubagent() {
+		return "", fmt.Errorf("%s is a subagent transcript", sessionID)
+	}
+	file, err := os.Open(t.Path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	newID := newClaudeSessionID()
+	encodedID, _ := json.Marshal(newID)
+	var out bytes.Buffer
+	prompts := 0
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break // EOF, possibly mid-line
+		}
+		var entry claudeEntry
+		if json.Unmarshal(line, &entry) != nil {
+			continue
+		}
+		if transcriptPrompt(entry) != "" {
+			prompts++
+			if prompts > turns {
+				break
+			}
+		}
+		if entry.SessionID != "" {
+			var fields map[string]json.RawMessage
+			json.Unmarshal(line, &fields)
+			fields["sessionId"] = encodedID
+			line, _ = json.Marshal(fields)
+			line = append(line, '\n')
+		}
+		out.Write(line)
+	}
+	if prompts < turns {
+		return "", fmt.Errorf("transcript of %s has %d turns, expected at least %d", sessionID, prompts, turns)
+	}
+
+	path := filepath.Join(filepath.Dir(t.Path), newID+".jsonl")
+	if err := utils.WriteFileAtomic(path, out.Bytes(), 0600); err != nil {
+		return "", err
+	}
+	return newID, nil
+}
+
+// newClaudeSessionID returns a random (version 4) UUID, the form Claude
+// Code gives session IDs
+func newClaudeSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/db"
+	"markdown-themes-backend/models"
+)
+
+var errEmptyTranscript = errors.New("transcript has no messages")
+
+// ClaudeImportResult is the outcome of importing one session
+type ClaudeImportResult struct {
+	SessionID      string `json:"sessionId"`
+	ConversationID string `json:"conversationId,omitempty"`
+	// imported, updated, unchanged, exists (a chat panel conversation
+	// already uses the session), or failed
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ImportClaudeTranscript imports a session transcript as a conversation, or
+// re-syncs the conversation it was imported as when the transcript changed
+func ImportClaudeTranscript(t ClaudeTranscript) ClaudeImportResult {
+	result := ClaudeImportResult{SessionID: t.SessionID}
+	fail := func(err error) ClaudeImportResult {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+	if t.IsSubagent() {
+		return fail(errors.New("subagent transcripts are imported with their session"))
+	}
+
+	imp, err := db.GetClaudeImport(t.SessionID)
+	if err != nil {
+		return fail(err)
+	}
+	if imp != nil {
+		result.ConversationID = imp.ConversationID
+		if imp.SourceSize == t.Size && imp.SourceModTime == t.ModTime.UnixMilli() {
+			result.Status = "unchanged"
+			return result
+		}
+	} else {
+		existing, err := db.ConversationForClaudeSession(t.SessionID)
+		if err != nil {
+			return fail(err)
+		}
+		if existing != "" {
+			result.ConversationID = existing
+			result.Status = "exists"
+			return result
+		}
+		result.ConversationID = "claude_" + t.SessionID
+	}
+
+	conv, err := convertClaudeTranscript(t, result.ConversationID)
+	if err != nil {
+		return fail(err)
+	}
+	err = db.SaveClaudeImport(conv, &db.ClaudeImport{
+		SessionID:     t.SessionID,
+		SourcePath:    t.Path,
+		SourceSize:    t.Size,
+		SourceModTime: t.ModTime.UnixMilli(),
+	})
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Status = "imported"
+	if imp != nil {
+		result.Status = "updated"
+	}
+	return result
+}
+
+// importTurn collects the assistant side of one prompt: every API message
+// Claude sent until the next prompt
+type importTurn struct {
+	message db.Message
+	prompt  int64 // Prompt timestamp, Unix ms
+	last    int64 // Last assistant line's
+	tools   []map[string]string
+	usages  map[string]importUsage // By API message ID, each line repeats it
+	order   []string
+}
+
+type importUsage struct {
+	model string
+	usage models.ClaudeUsage
+}
+
+// convertClaudeTranscript turns a transcript into a conversation shaped like
+// the chat panel's: each prompt becomes a user message and everything Claude
+// did until the next prompt one assistant message, with its text, tool calls
+// and their input, and summed usage. Tool results, thinking and sidechains
+// are left out, as is a last line still being written.
+func convertClaudeTranscript(t ClaudeTranscript, conversationID string) (*db.Conversation, error) {
+	file, err := os.Open(t.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	conv := &db.Conversation{
+		ID:              conversationID,
+		ClaudeSessionID: t.SessionID,
+		Messages:        []db.Message{},
+	}
+	var summary, firstPrompt string
+	var turn *importTurn
+	finish := func() {
+		if turn != nil {
+			if m, ok := turn.finish(); ok {
+				conv.Messages = append(conv.Messages, m)
+			}
+			turn = nil
+		}
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break // EOF, possibly mid-line
+		}
+		lineOffset := offset
+		offset += int64(len(line))
+
+		var entry claudeEntry
+		if json.Unmarshal(line, &entry) != nil || entry.IsMeta || entry.IsSidechain {
+			continue
+		}
+		if conv.Cwd == "" {
+			conv.Cwd = entry.Cwd
+		}
+		ts := t.ModTime.UnixMilli()
+		if parsed, err := time.Parse(time.RFC3339, entry.Timestamp); err == nil {
+			ts = parsed.UnixMilli()
+		}
+		id := entry.UUID
+		if id == "" {
+			id = fmt.Sprintf("line%d", lineOffset)
+		}
+		id = t.SessionID + "_" + id
+
+		switch entry.Type {
+		case "summary":
+			if entry.Summary != "" {
+				summary = entry.Summary
+			}
+		case "user":
+			prompt := transcriptPrompt(entry)
+			if prompt == "" {
+				continue // Tool results and command output
+			}
+			finish()
+			if firstPrompt == "" {
+				firstPrompt = prompt
+			}
+			conv.Messages = append(conv.Messages, db.Message{
+				ID:        id,
+				Role:      "user",
+				Content:   prompt,
+				Timestamp: ts,
+			})
+			turn = &importTurn{prompt: ts}
+		case "assistant":
+			if turn == nil {
+				turn = &importTurn{prompt: ts}
+			}
+			turn.add(entry, id, ts)
+		}
+	}
+	finish()
+
+	if len(conv.Messages) == 0 {
+		return nil, errEmptyTranscript
+	}
+	conv.CreatedAt = conv.Messages[0].Timestamp
+	conv.UpdatedAt = conv.Messages[len(conv.Messages)-1].Timestamp
+	conv.Title = importTitle(summary, firstPrompt)
+	if conv.Cwd == "" {
+		conv.Cwd = ResolveClaudeProjectDir(t.ProjectDir)
+	}
+	return conv, nil
+}
+
+func (turn *importTurn) add(entry claudeEntry, id string, ts int64) {
+	if turn.message.ID == "" {
+		turn.message = db.Message{
+			ID:              id,
+			Role:            "assistant",
+			Timestamp:       ts,
+			ClaudeSessionID: entry.SessionID,
+		}
+		turn.usages = make(map[string]importUsage)
+	}
+	turn.last = max(turn.last, ts)
+
+	var blocks []claudeContentBlock
+	json.Unmarshal(entry.Message.Content, &blocks)
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			if text := strings.TrimSpace(block.Text); text != "" {
+				if turn.message.Content != "" {
+					turn.message.Content += "\n\n"
+				}
+				turn.message.Content += text
+			}
+		case "tool_use":
+			// input is kept as JSON text, as the chat panel accumulates it
+			// from tool_input events
+			start := map[string]string{"type": "start", "name": block.Name, "id": block.ID}
+			if len(block.Input) > 0 {
+				start["input"] = string(block.Input)
+			}
+			turn.tools = append(turn.tools, start, map[string]string{"type": "end"})
+		}
+	}
+
+	messageID := entry.Message.ID
+	if messageID == "" {
+		messageID = id
+	}
+	if _, seen := turn.usages[messageID]; !seen {
+		turn.order = append(turn.order, messageID)
+	}
+	u := importUsage{model: entry.Message.Model}
+	if eu := entry.Message.Usage; eu != nil {
+		u.usage = models.ClaudeUsage{
+			InputTokens:              eu.InputTokens,
+			OutputTokens:             eu.OutputTokens,
+			CacheCreationInputTokens: eu.CacheCreationInputTokens,
+			CacheReadInputTokens:     eu.CacheReadInputTokens,
+		}
+	}
+	turn.usages[messageID] = u
+}
+
+// finish builds the turn's assistant message with usage in the shapes the
+// chat panel stores from claude's result event: usage summed over the turn,
+// modelUsage for the model that did most of the work, and the cost
+func (turn *importTurn) finish() (db.Message, bool) {
+	m := turn.message
+	if m.ID == "" {
+		return m, false
+	}
+	if len(turn.tools) > 0 {
+		m.ToolUse, _ = json.Marshal(turn.tools)
+	}
+
+	var total models.ClaudeUsage
+	var cost float64
+	byModel := make(map[string]*models.ClaudeUsage)
+	for _, id := range turn.order {
+		u := turn.usages[id]
+		total.InputTokens += u.usage.InputTokens
+		total.OutputTokens += u.usage.OutputTokens
+		total.CacheCreationInputTokens += u.usage.CacheCreationInputTokens
+		total.CacheReadInputTokens += u.usage.CacheReadInputTokens
+		cost += claudeUsageCost(u.model, u.usage)
+
+		if u.model == "" || u.model == "<synthetic>" {
+			continue
+		}
+		mu := byModel[u.model]
+		if mu == nil {
+			mu = &models.ClaudeUsage{}
+			byModel[u.model] = mu
+		}
+		mu.InputTokens += u.usage.InputTokens
+		mu.OutputTokens += u.usage.OutputTokens
+		mu.CacheCreationInputTokens += u.usage.CacheCreationInputTokens
+		mu.CacheReadInputTokens += u.usage.CacheReadInputTokens
+	}
+
+	if total != (models.ClaudeUsage{}) {
+		m.Usage, _ = json.Marshal(map[string]int{
+			"input_tokens":                total.InputTokens,
+			"output_tokens":               total.OutputTokens,
+			"cache_creation_input_tokens": total.CacheCreationInputTokens,
+			"cache_read_input_tokens":     total.CacheReadInputTokens,
+		})
+		m.CostUSD = &cost
+	}
+
+	var primary string
+	for model, u := range byModel {
+		p := byModel[primary]
+		if p == nil || contextTokens(*u) > contextTokens(*p) || (contextTokens(*u) == contextTokens(*p) && model < primary) {
+			primary = model
+		}
+	}
+	if u := byModel[primary]; u != nil {
+		m.ModelUsage, _ = json.Marshal(map[string]interface{}{
+			"inputTokens":              u.InputTokens,
+			"outputTokens":             u.OutputTokens,
+			"cacheCreationInputTokens": u.CacheCreationInputTokens,
+			"cacheReadInputTokens":     u.CacheReadInputTokens,
+			"costUSD":                  claudeUsageCost(primary, *u),
+		})
+	}
+
+	if turn.last > turn.prompt {
+		duration := float64(turn.last - turn.prompt)
+		m.DurationMs = &duration
+	}
+	return m, true
+}
+
+// contextTokens counts the input a model read; the main model reads the
+// whole conversation, subagents less
+func contextTokens(u models.ClaudeUsage) int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// importTitle titles a conversation like the chat panel does, from the
+// transcript's summary or else the first line of its first prompt
+func importTitle(summary, firstPrompt string) string {
+	title := summary
+	if title == "" {
+		title = strings.TrimSpace(strings.SplitN(firstPrompt, "\n", 2)[0])
+	}
+	if title == "" {
+		return "Imported session"
+	}
+	if runes := []rune(title); len(runes) > 50 {
+		title = string(runes[:47]) + "..."
+	}
+	return title
+}
+
+// ConversationsImport handles POST /api/chat/conversations/import - imports
+// Claude Code CLI sessions as conversations. Body: {"sessionIds": [...]} for
+// specific sessions, or {"project": "...", "since": "..."} (both optional)
+// to import every session, skipping those already imported and unchanged.
+func ConversationsImport(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		SessionIDs []string `json:"sessionIds"`
+		Project    string   `json:"project"`
+		Since      string   `json:"since"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	var transcripts []ClaudeTranscript
+	var results []ClaudeImportResult
+	if len(req.SessionIDs) > 0 {
+		for _, id := range req.SessionIDs {
+			t, err := FindClaudeTranscript(id)
+			if err != nil {
+				results = append(results, ClaudeImportResult{SessionID: id, Status: "failed", Error: "session not found"})
+				continue
+			}
+			transcripts = append(transcripts, t)
+		}
+	} else {
+		var since time.Time
+		if req.Since != "" {
+			var err error
+			if since, err = parseDateParam(req.Since, false); err != nil {
+				http.Error(w, `{"error": "invalid since date"}`, http.StatusBadRequest)
+				return
+			}
+		}
+		all, err := ListClaudeTranscripts(since)
+		if err != nil {
+			http.Error(w, `{"error": "no Claude projects directory found"}`, http.StatusNotFound)
+			return
+		}
+		project := strings.TrimSuffix(req.Project, "/")
+		for _, t := range all {
+			name := filepath.Base(t.ProjectDir)
+			if t.IsSubagent() || t.Size == 0 || (project != "" && name != project && name != EncodeProjectPath(project)) {
+				continue
+			}
+			transcripts = append(transcripts, t)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, t := range transcripts {
+		result := ImportClaudeTranscript(t)
+		if result.Status == "failed" && result.Error != errEmptyTranscript.Error() {
+			log.Printf("[Conversations] Failed to import %s: %s", t.Path, result.Error)
+		}
+		results = append(results, result)
+	}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	if results == nil {
+		results = []ClaudeImportResult{}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"counts":  counts,
+	})
+}
+
+// ConversationSync handles POST /api/chat/conversations/{id}/sync - re-syncs
+// a conversation imported from Claude Code with its transcript, which may
+// have grown since (the session was continued in the terminal)
+func ConversationSync(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		http.Error(w, `{"error": "conversation id required"}`, http.StatusBadRequest)
+		return
+	}
+
+	imp, err := db.GetClaudeImportForConversation(id)
+	if err != nil {
+		log.Printf("[Conversations] Failed to get import of %s: %s", id, err)
+		http.Error(w, `{"error": "failed to get conversation"}`, http.StatusInternalServerError)
+		return
+	}
+	if imp == nil {
+		http.Error(w, `{"error": "conversation was not imported from Claude Code"}`, http.StatusNotFound)
+		return
+	}
+
+	t, err := FindClaudeTranscript(imp.SessionID)
+	if err != nil {
+		http.Error(w, `{"error": "source transcript no longer exists"}`, http.StatusNotFound)
+		return
+	}
+	result := ImportClaudeTranscript(t)
+	if result.Status == "failed" {
+		log.Printf("[Conversations] Failed to sync %s: %s", id, result.Error)
+		http.Error(w, `{"error": "failed to sync conversation"}`, http.StatusInternalServerError)
+		return
+	}
+
+	conv, err := db.GetConversation(id)
+	if err != nil || conv == nil {
+		http.Error(w, `{"error": "failed to get conversation"}`, http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       result.Status,
+		"conversation": conv,
+	})
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"markdown-themes-backend/db"
+)
+
+func TestConvertClaudeTranscript_GroupsTurns(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "sess-1.jsonl")
+	writeTranscript(t, path,
+		`{"type":"user","uuid":"u1","sessionId":"sess-1","cwd":"/home/user/app","timestamp":"2025-01-01T10:00:00Z","message":{"role":"user","content":"Fix the bug\nin main.go"}}`,
+		`{"type":"user","uuid":"m1","isMeta":true,"timestamp":"2025-01-01T10:00:00Z","message":{"role":"user","content":"caveat"}}`,
+		`{"type":"assistant","uuid":"a1","sessionId":"sess-1","timestamp":"2025-01-01T10:00:02Z","message":{"id":"msg_1","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Looking."}],"usage":{"input_tokens":100,"output_tokens":5}}}`,
+		`{"type":"assistant","uuid":"a2","sessionId":"sess-1","timestamp":"2025-01-01T10:00:03Z","message":{"id":"msg_1","model":"claude-sonnet-4-5","content":[{"type":"tool_use","id":"toolu_1","name":"Read","input":{"file_path":"main.go"}}],"usage":{"input_tokens":100,"output_tokens":20}}}`,
+		`{"type":"user","uuid":"r1","sessionId":"sess-1","timestamp":"2025-01-01T10:00:04Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"}]}}`,
+		`{"type":"assistant","uuid":"a3","sessionId":"sess-1","isSidechain":true,"timestamp":"2025-01-01T10:00:05Z","message":{"id":"msg_side","model":"claude-haiku-4-5","content":[{"type":"text","text":"side"}],"usage":{"input_tokens":999}}}`,
+		`{"type":"assistant","uuid":"a4","sessionId":"sess-1","timestamp":"2025-01-01T10:00:06Z","message":{"id":"msg_2","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Fixed."}],"usage":{"input_tokens":10,"cache_read_input_tokens":200,"output_tokens":30}}}`,
+		`{"type":"user","uuid":"c1","sessionId":"sess-1","timestamp":"2025-01-01T10:01:00Z","message":{"role":"user","content":"<command-name>/cost</command-name>"}}`,
+		`{"type":"user","uuid":"u2","sessionId":"sess-1","timestamp":"2025-01-01T10:02:00Z","message":{"role":"user","content":[{"type":"text","text":"Thanks"}]}}`,
+		`{"type":"summary","summary":"Fixing the main.go bug"}`,
+	)
+	// A line still being written is left for the next sync
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"type":"assistant","uuid":"a5","message":{"content":[{"type":"text","text":"partial`)
+	f.Close()
+
+	conv, err := convertClaudeTranscript(ClaudeTranscript{SessionID: "sess-1", ProjectDir: filepath.Dir(path), Path: path}, "claude_sess-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if conv.Title != "Fixing the main.go bug" || conv.Cwd != "/home/user/app" || conv.ClaudeSessionID != "sess-1" {
+		t.Errorf("got title %q cwd %q session %q", conv.Title, conv.Cwd, conv.ClaudeSessionID)
+	}
+	if len(conv.Messages) != 3 {
+		t.Fatalf("got %d messages, want 3: %+v", len(conv.Messages), conv.Messages)
+	}
+
+	user, assistant, next := conv.Messages[0], conv.Messages[1], conv.Messages[2]
+	if user.ID != "sess-1_u1" || user.Role != "user" || user.Content != "Fix the bug\nin main.go" {
+		t.Errorf("unexpected user message %+v", user)
+	}
+	if next.Role != "user" || next.Content != "Thanks" {
+		t.Errorf("unexpected second prompt %+v", next)
+	}
+	if conv.CreatedAt != user.Timestamp || conv.UpdatedAt != next.Timestamp {
+		t.Errorf("got createdAt %d updatedAt %d", conv.CreatedAt, conv.UpdatedAt)
+	}
+
+	if assistant.ID != "sess-1_a1" || assistant.Content != "Looking.\n\nFixed." || assistant.ClaudeSessionID != "sess-1" {
+		t.Errorf("unexpected assistant message %+v", assistant)
+	}
+	var tools []map[string]string
+	json.Unmarshal(assistant.ToolUse, &tools)
+	if len(tools) != 2 || tools[0]["name"] != "Read" || tools[0]["id"] != "toolu_1" ||
+		tools[0]["input"] != `{"file_path":"main.go"}` || tools[1]["type"] != "end" {
+		t.Errorf("unexpected toolUse %s", assistant.ToolUse)
+	}
+
+	// msg_1's usage counts once (its last line's); the sidechain not at all
+	var usage map[string]int
+	json.Unmarshal(assistant.Usage, &usage)
+	if usage["input_tokens"] != 110 || usage["output_tokens"] != 50 || usage["cache_read_input_tokens"] != 200 {
+		t.Errorf("unexpected usage %s", assistant.Usage)
+	}
+	var modelUsage map[string]float64
+	json.Unmarshal(assistant.ModelUsage, &modelUsage)
+	if modelUsage["inputTokens"] != 110 || modelUsage["costUSD"] == 0 {
+		t.Errorf("unexpected modelUsage %s", assistant.ModelUsage)
+	}
+	if assistant.CostUSD == nil || *assistant.CostUSD != modelUsage["costUSD"] {
+		t.Errorf("got cost %v, want %v", assistant.CostUSD, modelUsage["costUSD"])
+	}
+	if assistant.DurationMs == nil || *assistant.DurationMs != 6000 {
+		t.Errorf("got duration %v, want 6000", assistant.DurationMs)
+	}
+}
+
+func TestConvertClaudeTranscript_Empty(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "sess-2.jsonl")
+	writeTranscript(t, path, `{"type":"summary","summary":"Nothing"}`)
+
+	_, err := convertClaudeTranscript(ClaudeTranscript{SessionID: "sess-2", ProjectDir: filepath.Dir(path), Path: path}, "c")
+	if err != errEmptyTranscript {
+		t.Errorf("got %v, want errEmptyTranscript", err)
+	}
+}
+
+func TestImportClaudeTranscript_SkipsUnchangedAndResyncs(t *testing.T) {
+	setupTestDB(t)
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "sess-imp-1.jsonl")
+	lines := []string{
+		`{"type":"user","uuid":"u1","sessionId":"sess-imp-1","timestamp":"2025-01-01T10:00:00Z","message":{"role":"user","content":"Hello"}}`,
+		`{"type":"assistant","uuid":"a1","sessionId":"sess-imp-1","timestamp":"2025-01-01T10:00:02Z","message":{"id":"msg_1","content":[{"type":"text","text":"Hi."}]}}`,
+	}
+	writeTranscript(t, path, lines...)
+
+	find := func() ClaudeTranscript {
+		t.Helper()
+		transcript, err := FindClaudeTranscript("sess-imp-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return transcript
+	}
+	result := ImportClaudeTranscript(find())
+	if result.Status != "imported" || result.ConversationID != "claude_sess-imp-1" {
+		t.Fatalf("unexpected first import %+v", result)
+	}
+	if result := ImportClaudeTranscript(find()); result.Status != "unchanged" {
+		t.Errorf("expected unchanged on reimport, got %+v", result)
+	}
+
+	// Continued in the chat panel, then in the terminal
+	if _, err := db.AppendMessage(result.ConversationID, &db.Message{
+		ID: "sess-imp-1-panel", Role: "user", Content: "From the panel", Timestamp: 1735725700000,
+	}, 0); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := db.GetConversation(result.ConversationID)
+	lines = append(lines,
+		`{"type":"user","uuid":"u2","sessionId":"sess-imp-1","timestamp":"2025-01-01T10:05:00Z","message":{"role":"user","content":"More"}}`,
+		`{"type":"assistant","uuid":"a2","sessionId":"sess-imp-1","timestamp":"2025-01-01T10:05:02Z","message":{"id":"msg_2","content":[{"type":"text","text":"Done."}]}}`,
+	)
+	writeTranscript(t, path, lines...)
+
+	if result := ImportClaudeTranscript(find()); result.Status != "updated" || result.ConversationID != "claude_sess-imp-1" {
+		t.Fatalf("expected updated after the transcript grew, got %+v", result)
+	}
+	conv, err := db.GetConversation("claude_sess-imp-1")
+	if err != nil || conv == nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, m := range conv.Messages {
+		contents = append(contents, m.Content)
+	}
+	if len(contents) != 5 || contents[0] != "Hello" || contents[1] != "Hi." || contents[4] != "Done." {
+		t.Errorf("unexpected messages after resync %q", contents)
+	}
+	found := false
+	for _, m := range conv.Messages {
+		found = found || m.ID == "sess-imp-1-panel"
+	}
+	if !found {
+		t.Error("resync dropped the message added in the chat panel")
+	}
+	if conv.Version <= before.Version {
+		t.Errorf("expected the version to be bumped past %d, got %d", before.Version, conv.Version)
+	}
+
+	imp, _ := db.GetClaudeImport("sess-imp-1")
+	if info, _ := os.Stat(path); imp == nil || imp.SourceSize != info.Size() {
+		t.Errorf("import record not updated: %+v", imp)
+	}
+}
+
+func TestImportClaudeTranscript_SessionAlreadyInChatPanel(t *testing.T) {
+	setupTestDB(t)
+	projects := setupClaudeProjects(t)
+	if err := db.CreateConversation(&db.Conversation{
+		ID: "panel-imp-2", Title: "Panel chat", ClaudeSessionID: "sess-imp-2", Messages: []db.Message{},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(projects, "-home-user-app", "sess-imp-2.jsonl")
+	writeTranscript(t, path,
+		`{"type":"user","uuid":"u1","sessionId":"sess-imp-2","timestamp":"2025-01-01T10:00:00Z","message":{"role":"user","content":"Hello"}}`)
+	transcript, err := FindClaudeTranscript("sess-imp-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := ImportClaudeTranscript(transcript)
+	if result.Status != "exists" || result.ConversationID != "panel-imp-2" {
+		t.Errorf("expected exists for panel-imp-2, got %+v", result)
+	}
+	if conv, _ := db.GetConversation("claude_sess-imp-2"); conv != nil {
+		t.Error("expected no duplicate conversation")
+	}
+	if imp, _ := db.GetClaudeImport("sess-imp-2"); imp != nil {
+		t.Errorf("expected no import record, got %+v", imp)
+	}
+}
+
+func TestImportClaudeTranscript_ReimportsAfterDelete(t *testing.T) {
+	setupTestDB(t)
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "sess-imp-4.jsonl")
+	writeTranscript(t, path,
+		`{"type":"user","uuid":"u1","sessionId":"sess-imp-4","timestamp":"2025-01-01T10:00:00Z","message":{"role":"user","content":"Hello"}}`,
+		`{"type":"assistant","uuid":"a1","sessionId":"sess-imp-4","timestamp":"2025-01-01T10:00:02Z","message":{"id":"msg_1","content":[{"type":"text","text":"Hi."}]}}`)
+	transcript, err := FindClaudeTranscript("sess-imp-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := ImportClaudeTranscript(transcript); result.Status != "imported" {
+		t.Fatalf("unexpected first import %+v", result)
+	}
+
+	if err := db.DeleteConversation("claude_sess-imp-4"); err != nil {
+		t.Fatal(err)
+	}
+	var orphans int
+	db.Get().QueryRow(`SELECT COUNT(*) FROM messages WHERE conversation_id = ?`, "claude_sess-imp-4").Scan(&orphans)
+	if orphans != 0 {
+		t.Errorf("expected the conversation's messages to be deleted, %d left", orphans)
+	}
+	// Rows left behind by deletes before they were removed explicitly
+	db.Get().Exec(`INSERT INTO messages (id, conversation_id, role, content, timestamp, claude_session_id)
+		VALUES ('sess-imp-4-orphan', 'deleted-conv', 'assistant', '', 0, 'sess-imp-4')`)
+
+	result := ImportClaudeTranscript(transcript)
+	if result.Status != "imported" || result.ConversationID != "claude_sess-imp-4" {
+		t.Fatalf("expected a fresh import after delete, got %+v", result)
+	}
+	if conv, _ := db.GetConversation("claude_sess-imp-4"); conv == nil || len(conv.Messages) != 2 {
+		t.Errorf("expected the reimported conversation with 2 messages, got %+v", conv)
+	}
+}
+
+func TestImportClaudeTranscript_RejectsSubagent(t *testing.T) {
+	setupTestDB(t)
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "sess-imp-3", "subagents", "agent-abc.jsonl")
+	writeTranscript(t, path,
+		`{"type":"user","uuid":"u1","sessionId":"sess-imp-3","timestamp":"2025-01-01T10:00:00Z","message":{"role":"user","content":"Search"}}`)
+
+	result := ImportClaudeTranscript(ClaudeTranscript{SessionID: "agent-abc", ProjectDir: filepath.Join(projects, "-home-user-app"), Path: path})
+	if result.Status != "failed" || result.Error == "" {
+		t.Errorf("expected a failed subagent import, got %+v", result)
+	}
+	if conv, _ := db.GetConversation("claude_agent-abc"); conv != nil {
+		t.Error("expected no conversation for the subagent")
+	}
+}
+
+func TestImportTitle(t *testing.T) {
+	if got := importTitle("", "  First line\nsecond"); got != "First line" {
+		t.Errorf("got %q", got)
+	}
+	long := "This prompt is far too long to be used as the title of a conversation"
+	if got := importTitle("", long); got != long[:47]+"..." {
+		t.Errorf("got %q", got)
+	}
+	if got := importTitle("", ""); got != "Imported session" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClaudePane is a claude process running in one of our mt-* terminals, with
+// the transcript it is writing when that could be determined
+type ClaudePane struct {
+	TerminalID       string `json:"terminalId"` // MDT_SESSION_ID, the mt-* tmux session
+	Pane             string `json:"pane"`       // tmux pane ID, e.g. "%3"
+	PID              int    `json:"pid"`
+	Cwd              string `json:"cwd"`
+	StartedAt        string `json:"startedAt"`
+	SessionID        string `json:"sessionId,omitempty"`
+	ConversationPath string `json:"conversationPath,omitempty"`
+}
+
+// tmuxPane is one line of tmux list-panes
+type tmuxPane struct {
+	session string
+	id      string
+	pid     int
+}
+
+// claudeProcess is a claude process found under a pane
+type claudeProcess struct {
+	pid        int
+	terminalID string
+	pane       string
+	cwd        string
+	started    time.Time
+	sessionID  string // From --resume or --session-id
+}
+
+// procInfo is what the process tree walk reads from /proc/<pid>/stat
+type procInfo struct {
+	ppid      int
+	startTick int64 // Clock ticks after boot
+}
+
+var (
+	// procRoot is where process information is read from
+	procRoot = "/proc"
+	// listTmuxPanes lists every pane of the tmux server
+	listTmuxPanes = func() ([]tmuxPane, error) {
+		out, err := tmuxCmd("list-panes", "-a", "-F", "#{session_name}\t#{pane_id}\t#{pane_pid}").Output()
+		if err != nil {
+			return nil, err
+		}
+		return parseTmuxPanes(string(out)), nil
+	}
+)
+
+// USER_HZ, which Linux fixes at 100 for /proc/<pid>/stat start times
+const clockTicksPerSecond = 100
+
+// How long a pane scan is reused; the subagent watcher asks per session
+const claudePanesTTL = 2 * time.Second
+
+var claudePanesCache = struct {
+	sync.Mutex
+	at    time.Time
+	panes []ClaudePane
+}{}
+
+func parseTmuxPanes(out string) []tmuxPane {
+	var panes []tmuxPane
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		panes = append(panes, tmuxPane{session: fields[0], id: fields[1], pid: pid})
+	}
+	return panes
+}
+
+// FindClaudePanes returns the claude processes running in mt-* terminals.
+// Transcripts are matched by the process's cwd (its project directory) and
+// --resume/--session-id arguments; when several processes share a project,
+// each transcript goes to the newest process started before the transcript
+// began, and each process gets its most recently written one.
+func FindClaudePanes() []ClaudePane {
+	claudePanesCache.Lock()
+	defer claudePanesCache.Unlock()
+	if time.Since(claudePanesCache.at) < claudePanesTTL {
+		return claudePanesCache.panes
+	}
+
+	panes := []ClaudePane{}
+	if procs := findClaudeProcesses(); len(procs) > 0 {
+		panes = matchClaudeTranscripts(procs)
+	}
+	claudePanesCache.at = time.Now()
+	claudePanesCache.panes = panes
+	return panes
+}
+
+// ClaudePaneForSession returns the pane running a session. For a subagent
+// pass the parent's session ID: subagents run inside its process.
+func ClaudePaneForSession(sessionID string) (ClaudePane, bool) {
+	for _, p := range FindClaudePanes() {
+		if p.SessionID == sessionID {
+			return p, true
+		}
+	}
+	return ClaudePane{}, false
+}
+
+// findClaudeProcesses walks the process tree under each mt-* pane and
+// returns the outermost claude processes
+func findClaudeProcesses() []claudeProcess {
+	panes, err := listTmuxPanes()
+	if err != nil || len(panes) == 0 {
+		return nil
+	}
+	procs, children := readProcTree()
+	bootTime := readBootTime()
+
+	var found []claudeProcess
+	for _, pane := range panes {
+		if !strings.HasPrefix(pane.session, "mt-") {
+			continue
+		}
+		stack := []int{pane.pid}
+		for len(stack) > 0 {
+			pid := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			args := readProcArgs(pid)
+			if !isClaudeProcess(readProcComm(pid), args) {
+				stack = append(stack, children[pid]...)
+				continue
+			}
+			terminalID := readProcEnv(pid, "MDT_SESSION_ID")
+			if terminalID == "" {
+				terminalID = pane.session
+			}
+			cwd, _ := os.Readlink(filepath.Join(procRoot, strconv.Itoa(pid), "cwd"))
+			found = append(found, claudeProcess{
+				pid:        pid,
+				terminalID: terminalID,
+				pane:       pane.id,
+				cwd:        cwd,
+				started:    bootTime.Add(time.Duration(procs[pid].startTick) * time.Second / clockTicksPerSecond),
+				sessionID:  claudeSessionArg(args),
+			})
+		}
+	}
+	return found
+}
+
+// readProcTree reads every process's parent and start time
+func readProcTree() (map[int]procInfo, map[int][]int) {
+	procs := make(map[int]procInfo)
+	children := make(map[int][]int)
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return procs, children
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(procRoot, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		info, ok := parseProcStat(string(data))
+		if !ok {
+			continue
+		}
+		procs[pid] = info
+		children[info.ppid] = append(children[info.ppid], pid)
+	}
+	return procs, children
+}
+
+// parseProcStat reads the parent PID (field 4) and start time (field 22)
+// from /proc/<pid>/stat. The command name in field 2 may contain spaces and
+// parentheses, so fields are counted from the last ")".
+func parseProcStat(stat string) (procInfo, bool) {
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return procInfo{}, false
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return procInfo{}, false
+	}
+	ppid, err1 := strconv.Atoi(fields[1])
+	start, err2 := strconv.ParseInt(fields[19], 10, 64)
+	if err1 != nil || err2 != nil {
+		return procInfo{}, false
+	}
+	return procInfo{ppid: ppid, startTick: start}, true
+}
+
+func readBootTime() time.Time {
+	file, err := os.Open(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return time.Time{}
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "btime "); ok {
+			secs, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			return time.Unix(secs, 0)
+		}
+	}
+	return time.Time{}
+}
+
+func readProcComm(pid int) string {
+	data, _ := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "comm"))
+	return strings.TrimSpace(string(data))
+}
+
+func readProcArgs(pid int) []string {
+	data, _ := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
+	return strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+}
+
+func readProcEnv(pid int, key string) string {
+	data, _ := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "environ"))
+	for _, entry := range strings.Split(string(data), "\x00") {
+		if value, ok := strings.CutPrefix(entry, key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// isClaudeProcess recognizes the native claude binary and the npm CLI run
+// through node
+func isClaudeProcess(comm string, args []string) bool {
+	if comm == "claude" {
+		return true
+	}
+	for i, arg := range args {
+		if i > 1 {
+			break
+		}
+		if filepath.Base(arg) == "claude" || strings.Contains(arg, "claude-code/cli") {
+			return true
+		}
+	}
+	return false
+}
+
+// claudeSessionArg returns the session named by --resume/-r or --session-id
+func claudeSessionArg(args []string) string {
+	for i, arg := range args {
+		for _, flag := range []string{"--resume", "-r", "--session-id"} {
+			if arg == flag && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				return args[i+1]
+			}
+			if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// matchClaudeTranscripts pairs processes with the transcripts they write
+func matchClaudeTranscripts(procs []claudeProcess) []ClaudePane {
+	earliest := time.Now()
+	for _, p := range procs {
+		if p.started.Before(earliest) {
+			earliest = p.started
+		}
+	}
+	transcripts, _ := ListClaudeTranscripts(earliest.Add(-time.Minute))
+	byProject := make(map[string][]ClaudeTranscript)
+	for _, t := range transcripts {
+		if !t.IsSubagent() {
+			name := filepath.Base(t.ProjectDir)
+			byProject[name] = append(byProject[name], t)
+		}
+	}
+
+	// Newest process first, so a transcript goes to the latest process
+	// started before it began
+	sort.Slice(procs, func(i, j int) bool { return procs[i].started.After(procs[j].started) })
+	claimed := make(map[string]bool)
+	matched := make(map[int]ClaudeTranscript)
+	for _, p := range procs {
+		if p.sessionID == "" {
+			continue
+		}
+		if t, err := FindClaudeTranscript(p.sessionID); err == nil {
+			matched[p.pid] = t
+			claimed[t.Path] = true
+		}
+	}
+	starts := make(map[string]time.Time)
+	for _, p := range procs {
+		if _, ok := matched[p.pid]; ok || p.cwd == "" {
+			continue
+		}
+		var best *ClaudeTranscript
+		for _, t := range byProject[EncodeProjectPath(p.cwd)] {
+			if claimed[t.Path] {
+				continue
+			}
+			start, ok := starts[t.Path]
+			if !ok {
+				start = transcriptStartTime(t.Path)
+				starts[t.Path] = start
+			}
+			// Allow for the clock tick rounding of the process start time
+			if start.Before(p.started.Add(-time.Second)) {
+				continue
+			}
+			claimed[t.Path] = true
+			if best == nil || t.ModTime.After(best.ModTime) {
+				best = &t
+			}
+		}
+		if best != nil {
+			matched[p.pid] = *best
+		}
+	}
+
+	panes := make([]ClaudePane, 0, len(procs))
+	for _, p := range procs {
+		pane := ClaudePane{
+			TerminalID: p.terminalID,
+			Pane:       p.pane,
+			PID:        p.pid,
+			Cwd:        p.cwd,
+			StartedAt:  p.started.UTC().Format(time.RFC3339),
+		}
+		if t, ok := matched[p.pid]; ok {
+			pane.SessionID = t.SessionID
+			pane.ConversationPath = t.Path
+		}
+		panes = append(panes, pane)
+	}
+	return panes
+}
+
+// transcriptStartTime returns the timestamp of a transcript's first entry
+func transcriptStartTime(path string) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(io.LimitReader(file, maxTranscriptHeaderBytes))
+	for {
+		line, err := reader.ReadBytes('\n')
+		var entry claudeEntry
+		if json.Unmarshal(line, &entry) == nil && entry.Timestamp != "" {
+			if t, err := time.Parse(time.RFC3339, entry.Timestamp); err == nil {
+				return t
+			}
+		}
+		if err != nil {
+			return time.Time{}
+		}
+	}
+}
+
+// ClaudePanes handles GET /api/claude/panes - lists claude processes in
+// terminals with their transcripts, for jumping between the two
+func ClaudePanes(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{"panes": FindClaudePanes()})
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"markdown-themes-backend/models"
+)
+
+func TestParseProcStat_CommWithSpacesAndParens(t *testing.T) {
+	stat := "4242 (my (weird) proc) S 17 4242 4242 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 987654 1000 100 0 0\n"
+	info, ok := parseProcStat(stat)
+	if !ok {
+		t.Fatal("expected stat to parse")
+	}
+	if info.ppid != 17 || info.startTick != 987654 {
+		t.Errorf("got %+v, want ppid 17 startTick 987654", info)
+	}
+
+	if _, ok := parseProcStat("4242 (truncated) S 1"); ok {
+		t.Error("expected short stat to be rejected")
+	}
+}
+
+func TestParseTmuxPanes(t *testing.T) {
+	panes := parseTmuxPanes("mt-abc\t%3\t1234\nother\t%4\t99\nbad line\n")
+	if len(panes) != 2 {
+		t.Fatalf("got %d panes, want 2", len(panes))
+	}
+	if panes[0] != (tmuxPane{session: "mt-abc", id: "%3", pid: 1234}) {
+		t.Errorf("got %+v", panes[0])
+	}
+}
+
+func TestIsClaudeProcess(t *testing.T) {
+	tests := []struct {
+		comm string
+		args []string
+		want bool
+	}{
+		{"claude", []string{"claude"}, true},
+		{"node", []string{"node", "/usr/lib/node_modules/@anthropic-ai/claude-code/cli.js"}, true},
+		{"node", []string{"/home/u/.local/bin/claude", "--resume"}, true},
+		{"bash", []string{"bash"}, false},
+		{"vim", []string{"vim", "notes.md", "claude"}, false},
+	}
+	for _, tt := range tests {
+		if got := isClaudeProcess(tt.comm, tt.args); got != tt.want {
+			t.Errorf("isClaudeProcess(%q, %q) = %v, want %v", tt.comm, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestClaudeSessionArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"claude", "--resume", "abc"}, "abc"},
+		{[]string{"claude", "-r", "abc", "--verbose"}, "abc"},
+		{[]string{"claude", "--session-id=abc"}, "abc"},
+		{[]string{"claude", "--resume", "--verbose"}, ""},
+		{[]string{"claude"}, ""},
+	}
+	for _, tt := range tests {
+		if got := claudeSessionArg(tt.args); got != tt.want {
+			t.Errorf("claudeSessionArg(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+// fakeProc lays out a /proc tree in a temp dir and points procRoot at it
+type fakeProc struct {
+	t    *testing.T
+	root string
+	boot time.Time
+}
+
+func setupFakeProc(t *testing.T, boot time.Time) *fakeProc {
+	t.Helper()
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "stat"), []byte(fmt.Sprintf("cpu 1 2 3\nbtime %d\n", boot.Unix())), 0644)
+
+	oldRoot, oldList := procRoot, listTmuxPanes
+	procRoot = root
+	t.Cleanup(func() {
+		procRoot, listTmuxPanes = oldRoot, oldList
+		resetClaudePanesCache()
+	})
+	resetClaudePanesCache()
+	return &fakeProc{t: t, root: root, boot: boot}
+}
+
+func (f *fakeProc) add(pid, ppid int, comm string, started time.Time, cwd string, env []string, args ...string) {
+	f.t.Helper()
+	dir := filepath.Join(f.root, strconv.Itoa(pid))
+	os.MkdirAll(dir, 0755)
+	ticks := started.Sub(f.boot) * clockTicksPerSecond / time.Second
+	stat := fmt.Sprintf("%d (%s) S %d %d 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 %d 0 0\n", pid, comm, ppid, pid, ticks)
+	os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644)
+	os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.Join(args, "\x00")+"\x00"), 0644)
+	os.WriteFile(filepath.Join(dir, "environ"), []byte(strings.Join(env, "\x00")+"\x00"), 0644)
+	if cwd != "" {
+		if err := os.Symlink(cwd, filepath.Join(dir, "cwd")); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+func resetClaudePanesCache() {
+	claudePanesCache.Lock()
+	claudePanesCache.at = time.Time{}
+	claudePanesCache.panes = nil
+	claudePanesCache.Unlock()
+}
+
+func transcriptLine(sessionID, cwd string, ts time.Time) string {
+	return fmt.Sprintf(`{"type":"user","sessionId":%q,"cwd":%q,"timestamp":%q,"message":{"role":"user","content":"hi"}}`,
+		sessionID, cwd, ts.UTC().Format(time.RFC3339))
+}
+
+func TestFindClaudePanes_MatchesProcessesToTranscripts(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	now := time.Now().Truncate(time.Second)
+	boot := now.Add(-time.Hour)
+	proc := setupFakeProc(t, boot)
+
+	cwd := t.TempDir()
+	projectDir := filepath.Join(projects, EncodeProjectPath(cwd))
+
+	// Two claudes in the same project: the older one in mt-a, the newer in
+	// mt-b, plus a resumed session in mt-c
+	olderStart := now.Add(-20 * time.Minute)
+	newerStart := now.Add(-5 * time.Minute)
+	proc.add(100, 1, "bash", olderStart, cwd, nil, "bash")
+	proc.add(101, 100, "claude", olderStart, cwd, []string{"MDT_SESSION_ID=mt-a"}, "claude")
+	proc.add(200, 1, "zsh", newerStart, cwd, nil, "zsh")
+	proc.add(201, 200, "node", newerStart, cwd, []string{"MDT_SESSION_ID=mt-b"}, "node", "/opt/claude-code/cli.js")
+	proc.add(202, 201, "claude", newerStart, cwd, nil, "claude") // Nested: ignored
+	proc.add(300, 1, "bash", now.Add(-time.Minute), cwd, nil, "bash")
+	proc.add(301, 300, "claude", now.Add(-time.Minute), cwd, nil, "claude", "--resume", "old-session")
+	proc.add(400, 1, "bash", now.Add(-time.Minute), cwd, nil, "bash") // Not a claude pane
+
+	listTmuxPanes = func() ([]tmuxPane, error) {
+		return []tmuxPane{
+			{session: "mt-a", id: "%1", pid: 100},
+			{session: "mt-b", id: "%2", pid: 200},
+			{session: "mt-c", id: "%3", pid: 300},
+			{session: "mt-d", id: "%4", pid: 400},
+			{session: "work", id: "%5", pid: 101},
+		}, nil
+	}
+
+	older := filepath.Join(projectDir, "sess-older.jsonl")
+	newer := filepath.Join(projectDir, "sess-newer.jsonl")
+	resumed := filepath.Join(projectDir, "old-session.jsonl")
+	writeTranscript(t, older, transcriptLine("sess-older", cwd, olderStart.Add(30*time.Second)))
+	writeTranscript(t, newer, transcriptLine("sess-newer", cwd, newerStart.Add(10*time.Second)))
+	writeTranscript(t, resumed, transcriptLine("old-session", cwd, now.Add(-48*time.Hour)))
+
+	panes := FindClaudePanes()
+	if len(panes) != 3 {
+		t.Fatalf("got %d panes, want 3: %+v", len(panes), panes)
+	}
+	byPane := make(map[string]ClaudePane)
+	for _, p := range panes {
+		byPane[p.Pane] = p
+	}
+	want := map[string]struct{ terminal, session, path string }{
+		"%1": {"mt-a", "sess-older", older},
+		"%2": {"mt-b", "sess-newer", newer},
+		"%3": {"mt-c", "old-session", resumed},
+	}
+	for pane, w := range want {
+		p := byPane[pane]
+		if p.TerminalID != w.terminal || p.SessionID != w.session || p.ConversationPath != w.path {
+			t.Errorf("pane %s = %+v, want terminal %s session %s", pane, p, w.terminal, w.session)
+		}
+	}
+	if byPane["%2"].PID != 201 {
+		t.Errorf("expected the outermost claude process, got pid %d", byPane["%2"].PID)
+	}
+
+	p, ok := ClaudePaneForSession("sess-newer")
+	if !ok || p.Pane != "%2" {
+		t.Errorf("ClaudePaneForSession(sess-newer) = %+v, %v", p, ok)
+	}
+}
+
+func TestClaudeSession_ByPane(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	now := time.Now().Truncate(time.Second)
+	proc := setupFakeProc(t, now.Add(-time.Hour))
+
+	cwd := t.TempDir()
+	started := now.Add(-10 * time.Minute)
+	proc.add(100, 1, "bash", started, cwd, nil, "bash")
+	proc.add(101, 100, "claude", started, cwd, []string{"MDT_SESSION_ID=mt-x"}, "claude")
+	listTmuxPanes = func() ([]tmuxPane, error) {
+		return []tmuxPane{{session: "mt-x", id: "%7", pid: 100}}, nil
+	}
+	path := filepath.Join(projects, EncodeProjectPath(cwd), "sess-1.jsonl")
+	writeTranscript(t, path, transcriptLine("sess-1", cwd, started.Add(time.Minute)))
+
+	for _, pane := range []string{"%7", "_7", "mt-x"} {
+		rec := httptest.NewRecorder()
+		ClaudeSession(rec, httptest.NewRequest("GET", "/api/claude/session?pane="+url.QueryEscape(pane), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("pane %s: status %d: %s", pane, rec.Code, rec.Body.String())
+		}
+		var info models.ClaudeSessionInfo
+		json.Unmarshal(rec.Body.Bytes(), &info)
+		if info.SessionID != "sess-1" || info.Pane != "%7" || info.TerminalID != "mt-x" || info.WorkingDir != cwd {
+			t.Errorf("pane %s: got %+v", pane, info)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	ClaudeSession(rec, httptest.NewRequest("GET", "/api/claude/session?pane=%259", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown pane: status %d, want 404", rec.Code)
+	}
+}
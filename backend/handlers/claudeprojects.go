@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// projectDirCache maps encoded project directory names to their resolution
+var projectDirCache = struct {
+	sync.Mutex
+	entries map[string]projectDirEntry
+}{entries: make(map[string]projectDirEntry)}
+
+// projectDirEntry is a cached resolution. A fallback (no existing directory
+// found) is reused while the project directory is unchanged, for at most
+// projectDirMissTTL in case the working directory reappears.
+type projectDirEntry struct {
+	path       string
+	found      bool
+	projectMod time.Time
+	checkedAt  time.Time
+}
+
+const (
+	// Transcripts consulted for a recorded cwd before probing the filesystem
+	maxProjectCwdProbes = 5
+	projectDirMissTTL   = time.Minute
+)
+
+// EncodeProjectPath names a working directory the way Claude Code does under
+// ~/.claude/projects: every character other than a letter or digit becomes
+// "-", so "/home/u/my-app" is "-home-u-my-app".
+func EncodeProjectPath(path string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, path)
+}
+
+// ResolveClaudeProjectDir returns the working directory a project directory
+// (full path or encoded name) belongs to. The encoding is lossy, so it
+// prefers the cwd recorded in the project's transcripts, then the existing
+// directory whose encoding matches, then a recorded cwd that has since moved
+// or encodes differently, and only then a naive decode. Resolved paths are
+// cached until they stop existing, fallbacks as described on projectDirEntry.
+func ResolveClaudeProjectDir(projectDir string) string {
+	name := filepath.Base(projectDir)
+	var projectMod time.Time
+	if projectsDir, err := ClaudeProjectsDir(); err == nil {
+		if info, err := os.Stat(filepath.Join(projectsDir, name)); err == nil {
+			projectMod = info.ModTime()
+		}
+	}
+
+	projectDirCache.Lock()
+	cached, ok := projectDirCache.entries[name]
+	projectDirCache.Unlock()
+	if ok && cached.found && isDir(cached.path) {
+		return cached.path
+	}
+	if ok && !cached.found && cached.projectMod.Equal(projectMod) && time.Since(cached.checkedAt) < projectDirMissTTL {
+		return cached.path
+	}
+
+	entry := projectDirEntry{projectMod: projectMod, checkedAt: time.Now(), found: true}
+	recorded, other := projectCwdFromTranscripts(name)
+	entry.path = recorded
+	if !isDir(entry.path) {
+		entry.path = probeProjectPath(name)
+	}
+	if entry.path == "" && isDir(other) {
+		entry.path = other
+	}
+	if entry.path == "" {
+		entry.found = false
+		entry.path = recorded
+		if entry.path == "" {
+			entry.path = naiveProjectPath(name)
+		}
+	}
+
+	projectDirCache.Lock()
+	projectDirCache.entries[name] = entry
+	projectDirCache.Unlock()
+	return entry.path
+}
+
+// projectCwdFromTranscripts reads the cwd recorded at the start of the
+// project's most recent transcripts. recorded encodes back to the project's
+// name; other is the first one that does not (the session had cd'd away).
+func projectCwdFromTranscripts(name string) (recorded, other string) {
+	projectsDir, err := ClaudeProjectsDir()
+	if err != nil {
+		return "", ""
+	}
+	projectDir := filepath.Join(projectsDir, name)
+	transcripts := listTranscriptFiles(projectDir, projectDir, "", time.Time{})
+	sort.Slice(transcripts, func(i, j int) bool {
+		return transcripts[i].ModTime.After(transcripts[j].ModTime)
+	})
+
+	for i, t := range transcripts {
+		if i == maxProjectCwdProbes {
+			break
+		}
+		cwd := readTranscriptCwd(t.Path)
+		if cwd == "" {
+			continue
+		}
+		if EncodeProjectPath(cwd) == name {
+			return cwd, other
+		}
+		if other == "" {
+			other = cwd
+		}
+	}
+	return "", other
+}
+
+// readTranscriptCwd returns the first cwd recorded in a transcript
+func readTranscriptCwd(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(io.LimitReader(file, maxTranscriptHeaderBytes))
+	for {
+		line, err := reader.ReadBytes('\n')
+		var entry claudeEntry
+		if json.Unmarshal(line, &entry) == nil && entry.Cwd != "" {
+			return entry.Cwd
+		}
+		if err != nil {
+			return ""
+		}
+	}
+}
+
+// probeProjectPath walks down from the root, at each level following the
+// entries whose encoded name matches the next part of the encoded path, and
+// returns the first existing directory that encodes to exactly name
+func probeProjectPath(name string) string {
+	if !strings.HasPrefix(name, "-") {
+		return ""
+	}
+	var walk func(dir, rest string) string
+	walk = func(dir, rest string) string {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return ""
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !entry.IsDir() && !(entry.Type()&os.ModeSymlink != 0 && isDir(path)) {
+				continue
+			}
+			encoded := EncodeProjectPath(entry.Name())
+			if rest == encoded {
+				return path
+			}
+			if strings.HasPrefix(rest, encoded+"-") {
+				if found := walk(path, rest[len(encoded)+1:]); found != "" {
+					return found
+				}
+			}
+		}
+		return ""
+	}
+	return walk(string(filepath.Separator), name[1:])
+}
+
+// naiveProjectPath reads every "-" as "/", right only for paths without
+// hyphens or dots; used when nothing on disk matches
+func naiveProjectPath(name string) string {
+	return "/" + strings.ReplaceAll(strings.TrimPrefix(name, "-"), "-", "/")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// ClaudeProjects handles GET /api/claude/projects - lists the project
+// directories under ~/.claude/projects with their resolved working dirs
+func ClaudeProjects(w http.ResponseWriter, r *http.Request) {
+	projectsDir, err := ClaudeProjectsDir()
+	if err != nil {
+		http.Error(w, `{"error": "cannot determine home directory"}`, http.StatusInternalServerError)
+		return
+	}
+	entries, err := os.ReadDir(projectsDir)
+	if err != nil {
+		http.Error(w, `{"error": "no Claude projects directory found"}`, http.StatusNotFound)
+		return
+	}
+
+	type project struct {
+		ProjectDir string `json:"projectDir"`
+		WorkingDir string `json:"workingDir"`
+		Exists     bool   `json:"exists"`
+	}
+	projects := []project{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		workingDir := ResolveClaudeProjectDir(entry.Name())
+		projects = append(projects, project{
+			ProjectDir: entry.Name(),
+			WorkingDir: workingDir,
+			Exists:     isDir(workingDir),
+		})
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"projects": projects})
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEncodeProjectPath(t *testing.T) {
+	if got := EncodeProjectPath("/home/u/my-app/.config_v2"); got != "-home-u-my-app--config-v2" {
+		t.Errorf("unexpected encoding %q", got)
+	}
+}
+
+func TestResolveClaudeProjectDir_ProbesHyphenatedPath(t *testing.T) {
+	setupClaudeProjects(t)
+	base := t.TempDir()
+	want := filepath.Join(base, "markdown-themes", "src.d")
+	os.MkdirAll(want, 0755)
+	// A decoy that matches the naive split of the first component only
+	os.MkdirAll(filepath.Join(base, "markdown"), 0755)
+
+	if got := ResolveClaudeProjectDir(EncodeProjectPath(want)); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestResolveClaudeProjectDir_PrefersRecordedCwd(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	base := t.TempDir()
+	// Both "a-b" and "a/b" exist; only the transcript can tell them apart
+	want := filepath.Join(base, "a", "b")
+	os.MkdirAll(want, 0755)
+	os.MkdirAll(filepath.Join(base, "a-b"), 0755)
+
+	name := EncodeProjectPath(want)
+	writeTranscript(t, filepath.Join(projects, name, "s.jsonl"), `{"type":"user","cwd":"`+want+`","message":{"content":"hi"}}`)
+
+	if got := ResolveClaudeProjectDir(filepath.Join(projects, name)); got != want {
+		t.Errorf("expected recorded cwd %s, got %s", want, got)
+	}
+}
+
+func TestResolveClaudeProjectDir_FallsBackToNaiveDecode(t *testing.T) {
+	setupClaudeProjects(t)
+	if got := ResolveClaudeProjectDir("-nonexistent-dir-xyz"); got != "/nonexistent/dir/xyz" {
+		t.Errorf("expected naive decode, got %s", got)
+	}
+}
+
+func TestResolveClaudeProjectDir_CachesMissUntilProjectChanges(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	want := filepath.Join(t.TempDir(), "gone-app")
+	name := EncodeProjectPath(want)
+	os.MkdirAll(filepath.Join(projects, name), 0755)
+
+	naive := ResolveClaudeProjectDir(name)
+	if naive == want {
+		t.Fatalf("expected a fallback while %s is missing", want)
+	}
+
+	// Still the cached fallback: the project directory hasn't changed
+	os.MkdirAll(want, 0755)
+	if got := ResolveClaudeProjectDir(name); got != naive {
+		t.Errorf("expected the cached fallback %s, got %s", naive, got)
+	}
+
+	// A new session in the project invalidates it
+	writeTranscript(t, filepath.Join(projects, name, "s.jsonl"), `{"type":"summary","summary":"new"}`)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(projects, name), later, later)
+	if got := ResolveClaudeProjectDir(name); got != want {
+		t.Errorf("expected %s after the project changed, got %s", want, got)
+	}
+}
+
+func TestClaudeSessionInfo_UsesResolvedWorkingDir(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	dir := filepath.Join(t.TempDir(), "my-app")
+	os.MkdirAll(dir, 0755)
+	path := filepath.Join(projects, EncodeProjectPath(dir), "s.jsonl")
+	writeTranscript(t, path, `{"type":"summary","summary":"no cwd here"}`)
+
+	header := ReadClaudeTranscriptHeader(ClaudeTranscript{SessionID: "s", ProjectDir: filepath.Dir(path), Path: path})
+	if header.WorkingDir != dir {
+		t.Errorf("expected %s, got %s", dir, header.WorkingDir)
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"markdown-themes-backend/models"
+)
+
+const (
+	defaultSessionsLimit = 50
+	maxSessionsLimit     = 500
+)
+
+// claudeModelPrices are list prices in USD per million input and output
+// tokens, matched in order against the model name. Cache writes cost 1.25x
+// and cache reads 0.1x the input price.
+var claudeModelPrices = []struct {
+	match         string
+	input, output float64
+}{
+	{"opus-4-5", 5, 25},
+	{"opus", 15, 75},
+	{"sonnet", 3, 15},
+	{"haiku-4", 1, 5},
+	{"3-5-haiku", 0.8, 4},
+	{"haiku", 0.25, 1.25},
+}
+
+// claudeUsageCost estimates what usage cost on model (0 for unknown models)
+func claudeUsageCost(model string, u models.ClaudeUsage) float64 {
+	for _, p := range claudeModelPrices {
+		if strings.Contains(model, p.match) {
+			input := float64(u.InputTokens) + 1.25*float64(u.CacheCreationInputTokens) + 0.1*float64(u.CacheReadInputTokens)
+			return (input*p.input + float64(u.OutputTokens)*p.output) / 1e6
+		}
+	}
+	return 0
+}
+
+// cachedSessionSummary is a summary valid while its transcript keeps the
+// same mtime and size
+type cachedSessionSummary struct {
+	modTime time.Time
+	size    int64
+	summary models.ClaudeSessionSummary
+}
+
+var sessionSummaryCache = struct {
+	sync.Mutex
+	entries map[string]*cachedSessionSummary
+}{entries: make(map[string]*cachedSessionSummary)}
+
+// ClaudeSessions handles GET /api/claude/sessions - lists every session
+// under ~/.claude/projects, most recently active first.
+//
+// Query params: project (working dir, or encoded project dir name), since
+// and until (RFC 3339 or YYYY-MM-DD, against last and first activity), q
+// (text in the summary, first prompt, working dir, branch or session ID),
+// subagents ("true" includes subagent transcripts), limit, cursor.
+func ClaudeSessions(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultSessionsLimit
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, maxSessionsLimit)
+		}
+	}
+	offset := 0
+	if c := q.Get("cursor"); c != "" {
+		parsed, err := strconv.Atoi(c)
+		if err != nil || parsed < 0 {
+			http.Error(w, `{"error": "invalid cursor"}`, http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	var since, until time.Time
+	var err error
+	if s := q.Get("since"); s != "" {
+		if since, err = parseDateParam(s, false); err != nil {
+			http.Error(w, `{"error": "invalid since date"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	if u := q.Get("until"); u != "" {
+		if until, err = parseDateParam(u, true); err != nil {
+			http.Error(w, `{"error": "invalid until date"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A transcript last written before since cannot match
+	transcripts, err := ListClaudeTranscripts(since)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, `{"error": "no Claude projects directory found"}`, http.StatusNotFound)
+			return
+		}
+		http.Error(w, `{"error": "cannot read Claude projects directory"}`, http.StatusInternalServerError)
+		return
+	}
+	if q.Get("subagents") != "true" {
+		sessions := transcripts[:0]
+		for _, t := range transcripts {
+			if !t.IsSubagent() {
+				sessions = append(sessions, t)
+			}
+		}
+		transcripts = sessions
+	}
+
+	project := strings.TrimSuffix(q.Get("project"), "/")
+	text := strings.ToLower(q.Get("q"))
+	var matched []models.ClaudeSessionSummary
+	for _, s := range summarizeClaudeTranscripts(transcripts) {
+		if project != "" && s.ProjectDir != project && s.WorkingDir != project && !strings.HasPrefix(s.WorkingDir, project+"/") {
+			continue
+		}
+		if !until.IsZero() && s.StartTime != "" {
+			if start, err := time.Parse(time.RFC3339, s.StartTime); err == nil && start.After(until) {
+				continue
+			}
+		}
+		if text != "" && !sessionMatchesText(s, text) {
+			continue
+		}
+		matched = append(matched, s)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].Modified > matched[j].Modified
+	})
+
+	page := []models.ClaudeSessionSummary{}
+	if offset < len(matched) {
+		page = matched[offset:min(offset+limit, len(matched))]
+	}
+	resp := map[string]interface{}{
+		"sessions": page,
+		"total":    len(matched),
+	}
+	if next := offset + limit; next < len(matched) {
+		resp["nextCursor"] = strconv.Itoa(next)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseDateParam accepts RFC 3339 or a bare date, which means the start of
+// that day, or its end when endOfDay is set
+func parseDateParam(s string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
+
+func sessionMatchesText(s models.ClaudeSessionSummary, text string) bool {
+	for _, field := range []string{s.Summary, s.FirstPrompt, s.WorkingDir, s.GitBranch, s.SessionID} {
+		if strings.Contains(strings.ToLower(field), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeClaudeTranscripts returns a summary per transcript, reparsing
+// only those whose mtime or size changed since they were cached
+func summarizeClaudeTranscripts(transcripts []ClaudeTranscript) []models.ClaudeSessionSummary {
+	summaries := make([]models.ClaudeSessionSummary, len(transcripts))
+	var stale []int
+
+	sessionSummaryCache.Lock()
+	for i, t := range transcripts {
+		if c, ok := sessionSummaryCache.entries[t.Path]; ok && c.modTime.Equal(t.ModTime) && c.size == t.Size {
+			summaries[i] = c.summary
+		} else {
+			stale = append(stale, i)
+		}
+	}
+	sessionSummaryCache.Unlock()
+
+	// Parse in parallel: the first listing reads every transcript
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), max(len(stale), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				summaries[i] = summarizeClaudeTranscript(transcripts[i])
+			}
+		}()
+	}
+	for _, i := range stale {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	sessionSummaryCache.Lock()
+	for _, i := range stale {
+		t := transcripts[i]
+		sessionSummaryCache.entries[t.Path] = &cachedSessionSummary{modTime: t.ModTime, size: t.Size, summary: summaries[i]}
+	}
+	if len(stale) > 0 {
+		// Forget transcripts that were deleted
+		listed := make(map[string]bool, len(transcripts))
+		for _, t := range transcripts {
+			listed[t.Path] = true
+		}
+		for path := range sessionSummaryCache.entries {
+			if !listed[path] {
+				if _, err := os.Stat(path); err != nil {
+					delete(sessionSummaryCache.entries, path)
+				}
+			}
+		}
+	}
+	sessionSummaryCache.Unlock()
+
+	return summaries
+}
+
+// summarizeClaudeTranscript reads a whole transcript. Assistant messages
+// span one line per content block, each repeating the message's usage, so
+// usage is taken once per message ID (the last line's, which is final).
+func summarizeClaudeTranscript(t ClaudeTranscript) models.ClaudeSessionSummary {
+	s := models.ClaudeSessionSummary{
+		SessionID:        t.SessionID,
+		ProjectDir:       filepath.Base(t.ProjectDir),
+		ConversationPath: t.Path,
+		Models:           []string{},
+		Size:             t.Size,
+		Modified:         t.ModTime.UTC().Format(time.RFC3339),
+	}
+
+	type messageUsage struct {
+		model string
+		usage models.ClaudeUsage
+	}
+	usages := make(map[string]messageUsage)
+	var usageOrder []string
+	seenModels := make(map[string]bool)
+
+	if file, err := os.Open(t.Path); err == nil {
+		reader := bufio.NewReaderSize(file, 64*1024)
+		for lineNum := 0; ; lineNum++ {
+			line, err := reader.ReadBytes('\n')
+			var entry claudeEntry
+			if len(line) > 0 && json.Unmarshal(line, &entry) == nil {
+				if entry.Timestamp != "" {
+					if s.StartTime == "" {
+						s.StartTime = entry.Timestamp
+					}
+					s.EndTime = entry.Timestamp
+				}
+				if s.WorkingDir == "" {
+					s.WorkingDir = entry.Cwd
+				}
+				if entry.GitBranch != "" {
+					s.GitBranch = entry.GitBranch
+				}
+
+				switch entry.Type {
+				case "summary":
+					if entry.Summary != "" {
+						s.Summary = entry.Summary
+					}
+				case "user":
+					if !entry.IsMeta && claudeContentText(entry.Message.Content) != "" {
+						s.MessageCount++
+						if s.FirstPrompt == "" {
+							s.FirstPrompt = userPromptText(entry.Message.Content)
+						}
+					}
+				case "assistant":
+					id := entry.Message.ID
+					if id == "" {
+						id = fmt.Sprintf("line-%d", lineNum)
+					}
+					if _, seen := usages[id]; !seen {
+						s.MessageCount++
+						usageOrder = append(usageOrder, id)
+					}
+					mu := messageUsage{model: entry.Message.Model}
+					if u := entry.Message.Usage; u != nil {
+						mu.usage = models.ClaudeUsage{
+							InputTokens:              u.InputTokens,
+							OutputTokens:             u.OutputTokens,
+							CacheCreationInputTokens: u.CacheCreationInputTokens,
+							CacheReadInputTokens:     u.CacheReadInputTokens,
+						}
+					}
+					usages[id] = mu
+					if model := entry.Message.Model; model != "" && model != "<synthetic>" && !seenModels[model] {
+						seenModels[model] = true
+						s.Models = append(s.Models, model)
+					}
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		file.Close()
+	}
+
+	for _, id := range usageOrder {
+		mu := usages[id]
+		s.Usage.InputTokens += mu.usage.InputTokens
+		s.Usage.OutputTokens += mu.usage.OutputTokens
+		s.Usage.CacheCreationInputTokens += mu.usage.CacheCreationInputTokens
+		s.Usage.CacheReadInputTokens += mu.usage.CacheReadInputTokens
+		s.CostUSD += claudeUsageCost(mu.model, mu.usage)
+	}
+	s.TotalTokens = s.Usage.InputTokens + s.Usage.OutputTokens + s.Usage.CacheCreationInputTokens + s.Usage.CacheReadInputTokens
+
+	if s.WorkingDir == "" {
+		s.WorkingDir = ResolveClaudeProjectDir(t.ProjectDir)
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"markdown-themes-backend/models"
+)
+
+type sessionsResponse struct {
+	Sessions   []models.ClaudeSessionSummary `json:"sessions"`
+	Total      int                           `json:"total"`
+	NextCursor string                        `json:"nextCursor"`
+}
+
+func getSessions(t *testing.T, params url.Values) sessionsResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/claude/sessions?"+params.Encode(), nil)
+	rr := httptest.NewRecorder()
+	ClaudeSessions(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp sessionsResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestSummarizeClaudeTranscript(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-home-user-app", "sess.jsonl")
+	writeTranscript(t, path,
+		`{"type":"summary","summary":"Fix the build"}`,
+		`{"type":"user","timestamp":"2026-01-01T10:00:00Z","cwd":"/home/user/app","gitBranch":"main","message":{"role":"user","content":"why is CI red?"}}`,
+		`{"type":"assistant","timestamp":"2026-01-01T10:00:05Z","message":{"id":"m1","model":"claude-sonnet-4-5","content":[{"type":"thinking","thinking":"x"}],"usage":{"input_tokens":100,"output_tokens":1}}}`,
+		`{"type":"assistant","timestamp":"2026-01-01T10:00:06Z","message":{"id":"m1","model":"claude-sonnet-4-5","content":[{"type":"text","text":"Looking"}],"usage":{"input_tokens":100,"output_tokens":50}}}`,
+		`{"type":"user","timestamp":"2026-01-01T10:01:00Z","gitBranch":"fix-ci","message":{"role":"user","content":"thanks"}}`,
+		`{"type":"assistant","timestamp":"2026-01-01T10:02:00Z","message":{"id":"m2","model":"claude-opus-4-1","content":[{"type":"text","text":"ok"}],"usage":{"input_tokens":0,"output_tokens":0,"cache_read_input_tokens":1000000}}}`,
+	)
+	info, _ := os.Stat(path)
+
+	s := summarizeClaudeTranscript(ClaudeTranscript{SessionID: "sess", ProjectDir: filepath.Dir(path), Path: path, ModTime: info.ModTime(), Size: info.Size()})
+	if s.Summary != "Fix the build" || s.FirstPrompt != "why is CI red?" || s.WorkingDir != "/home/user/app" {
+		t.Errorf("unexpected text fields %+v", s)
+	}
+	if s.MessageCount != 4 {
+		t.Errorf("expected 4 messages, got %d", s.MessageCount)
+	}
+	if len(s.Models) != 2 || s.Models[0] != "claude-sonnet-4-5" {
+		t.Errorf("unexpected models %v", s.Models)
+	}
+	if s.Usage.InputTokens != 100 || s.Usage.OutputTokens != 50 || s.TotalTokens != 1000150 {
+		t.Errorf("expected usage counted once per message, got %+v total %d", s.Usage, s.TotalTokens)
+	}
+	// sonnet: 100*3/1e6 + 50*15/1e6; opus: 1e6 cache reads at 0.1*15/1e6
+	if want := 0.0003 + 0.00075 + 1.5; math.Abs(s.CostUSD-want) > 1e-9 {
+		t.Errorf("expected cost %v, got %v", want, s.CostUSD)
+	}
+	if s.StartTime != "2026-01-01T10:00:00Z" || s.EndTime != "2026-01-01T10:02:00Z" || s.GitBranch != "fix-ci" {
+		t.Errorf("unexpected times/branch %+v", s)
+	}
+}
+
+func TestClaudeSessions_FiltersAndPages(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	for i, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(projects, "-home-user-app", name+".jsonl")
+		writeTranscript(t, path, `{"type":"user","cwd":"/home/user/app","message":{"content":"task `+name+`"}}`)
+		mod := time.Now().Add(time.Duration(i-3) * time.Hour)
+		os.Chtimes(path, mod, mod)
+	}
+	writeTranscript(t, filepath.Join(projects, "-home-user-other", "d.jsonl"), `{"type":"user","cwd":"/home/user/other","message":{"content":"elsewhere"}}`)
+	writeTranscript(t, filepath.Join(projects, "-home-user-app", "a", "subagents", "agent-1.jsonl"), `{"type":"user","message":{"content":"sub"}}`)
+
+	resp := getSessions(t, url.Values{"project": {"/home/user/app"}, "limit": {"2"}})
+	if resp.Total != 3 || len(resp.Sessions) != 2 || resp.NextCursor != "2" {
+		t.Fatalf("unexpected first page: total %d, %d sessions, cursor %q", resp.Total, len(resp.Sessions), resp.NextCursor)
+	}
+	if resp.Sessions[0].SessionID != "c" {
+		t.Errorf("expected most recent first, got %s", resp.Sessions[0].SessionID)
+	}
+	resp = getSessions(t, url.Values{"project": {"/home/user/app"}, "limit": {"2"}, "cursor": {"2"}})
+	if len(resp.Sessions) != 1 || resp.Sessions[0].SessionID != "a" || resp.NextCursor != "" {
+		t.Fatalf("unexpected second page %+v", resp)
+	}
+
+	if resp = getSessions(t, url.Values{"q": {"ELSEWHERE"}}); resp.Total != 1 || resp.Sessions[0].SessionID != "d" {
+		t.Errorf("text filter: unexpected %+v", resp)
+	}
+	since := time.Now().Add(-90 * time.Minute).UTC().Format(time.RFC3339)
+	if resp = getSessions(t, url.Values{"since": {since}, "project": {"-home-user-app"}}); resp.Total != 1 {
+		t.Errorf("since filter: expected 1, got %d", resp.Total)
+	}
+	if resp = getSessions(t, url.Values{"subagents": {"true"}}); resp.Total != 5 {
+		t.Errorf("expected subagents included, got %d", resp.Total)
+	}
+}
+
+func TestClaudeSessions_CacheInvalidatedByMtime(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-p", "s.jsonl")
+	writeTranscript(t, path, `{"type":"user","message":{"content":"first"}}`)
+	if resp := getSessions(t, nil); resp.Sessions[0].MessageCount != 1 {
+		t.Fatalf("expected 1 message, got %+v", resp.Sessions)
+	}
+
+	writeTranscript(t, path, `{"type":"user","message":{"content":"first"}}`, `{"type":"user","message":{"content":"second"}}`)
+	if resp := getSessions(t, nil); resp.Sessions[0].MessageCount != 2 {
+		t.Errorf("expected reparse after change, got %d messages", resp.Sessions[0].MessageCount)
+	}
+}
+
+func TestClaudeSessions_InvalidParams(t *testing.T) {
+	setupClaudeProjects(t)
+	for _, params := range []url.Values{{"cursor": {"x"}}, {"since": {"yesterday"}}} {
+		req := httptest.NewRequest(http.MethodGet, "/api/claude/sessions?"+params.Encode(), nil)
+		rr := httptest.NewRecorder()
+		ClaudeSessions(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", params, rr.Code)
+		}
+	}
+}
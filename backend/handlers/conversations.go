@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -59,8 +63,7 @@ func ConversationCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := db.CreateConversation(&conv); err != nil {
-		log.Printf("[Conversations] Failed to create: %s", err)
-		http.Error(w, `{"error": "failed to create conversation"}`, http.StatusInternalServerError)
+		conversationError(w, err, "create", conv.ID)
 		return
 	}
 
@@ -68,7 +71,8 @@ func ConversationCreate(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(conv)
 }
 
-// ConversationUpdate handles PUT /api/chat/conversations/{id}
+// ConversationUpdate handles PUT /api/chat/conversations/{id}. A nonzero
+// version in the body must match the stored one or the update fails with 409.
 func ConversationUpdate(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	if id == "" {
@@ -85,14 +89,171 @@ func ConversationUpdate(w http.ResponseWriter, r *http.Request) {
 	conv.ID = id
 
 	if err := db.UpdateConversation(&conv); err != nil {
-		log.Printf("[Conversations] Failed to update %s: %s", id, err)
-		http.Error(w, `{"error": "failed to update conversation"}`, http.StatusInternalServerError)
+		conversationError(w, err, "update", id)
 		return
 	}
 
 	json.NewEncoder(w).Encode(conv)
 }
 
+// conversationError reports a failed change to a conversation: 404 for a
+// missing conversation or message, 409 for a version conflict, a taken id or
+// a session that can't be forked
+func conversationError(w http.ResponseWriter, err error, action, id string) {
+	switch {
+	case errors.Is(err, db.ErrConversationNotFound):
+		http.Error(w, `{"error": "conversation not found"}`, http.StatusNotFound)
+	case errors.Is(err, db.ErrMessageNotFound):
+		http.Error(w, `{"error": "message not found"}`, http.StatusNotFound)
+	case errors.Is(err, db.ErrConversationExists):
+		http.Error(w, `{"error": "a conversation with that id already exists"}`, http.StatusConflict)
+	case errors.Is(err, db.ErrSessionNotForkable):
+		log.Printf("[Conversations] Cannot %s %s: %s", action, id, err)
+		http.Error(w, `{"error": "the Claude session continues past this message and its transcript could not be copied"}`, http.StatusConflict)
+	case errors.Is(err, db.ErrVersionConflict):
+		http.Error(w, `{"error": "conversation was changed by another client, reload it"}`, http.StatusConflict)
+	default:
+		log.Printf("[Conversations] Failed to %s %s: %s", action, id, err)
+		http.Error(w, `{"error": "failed to `+action+` conversation"}`, http.StatusInternalServerError)
+	}
+}
+
+// MessageAppend handles POST /api/chat/conversations/{id}/messages - adds
+// one message. Body: the message plus an optional expected version.
+func MessageAppend(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		db.Message
+		Version int64 `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" || req.Role == "" {
+		http.Error(w, `{"error": "message id and role required"}`, http.StatusBadRequest)
+		return
+	}
+
+	version, err := db.AppendMessage(id, &req.Message, req.Version)
+	if err != nil {
+		conversationError(w, err, "update", id)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": req.Message,
+		"version": version,
+	})
+}
+
+// MessagePatch handles PATCH /api/chat/conversations/{id}/messages/{messageId}
+// - changes the given fields of one message, e.g. to finalize a streaming
+// reply. Body: the fields plus an optional expected version.
+func MessagePatch(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "messageId")
+	var req struct {
+		db.MessagePatch
+		Version int64 `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	message, version, err := db.PatchMessage(id, messageID, req.MessagePatch, req.Version)
+	if err != nil {
+		conversationError(w, err, "update", id)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"version": version,
+	})
+}
+
+// MessageDelete handles DELETE /api/chat/conversations/{id}/messages/{messageId}
+// with an optional ?version= to check
+func MessageDelete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	messageID := chi.URLParam(r, "messageId")
+	var expected int64
+	if v := r.URL.Query().Get("version"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, `{"error": "invalid version"}`, http.StatusBadRequest)
+			return
+		}
+		expected = parsed
+	}
+
+	version, err := db.DeleteMessage(id, messageID, expected)
+	if err != nil {
+		conversationError(w, err, "update", id)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"version": version,
+	})
+}
+
+// ConversationFork handles POST /api/chat/conversations/{id}/fork - copies
+// the conversation up to and including a message into a new conversation.
+// Body: {"messageId": "...", "id": "..."}, id optional. The fork's Claude
+// session holds only the turns up to the message and never the original's
+// later ones.
+func ConversationFork(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		MessageID string `json:"messageId"`
+		ID        string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if req.MessageID == "" {
+		http.Error(w, `{"error": "messageId required"}`, http.StatusBadRequest)
+		return
+	}
+	if req.ID == "" {
+		req.ID = fmt.Sprintf("conv_%d", time.Now().UnixNano())
+	}
+
+	fork, err := db.ForkConversation(id, req.MessageID, req.ID, forkClaudeSession)
+	if err != nil {
+		conversationError(w, err, "fork", id)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fork)
+}
+
+// ConversationBranches handles GET /api/chat/conversations/{id}/branches -
+// the tree of forks the conversation belongs to, from its oldest ancestor
+func ConversationBranches(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	tree, err := db.ConversationBranches(id)
+	if err != nil {
+		log.Printf("[Conversations] Failed to list branches of %s: %s", id, err)
+		http.Error(w, `{"error": "failed to list branches"}`, http.StatusInternalServerError)
+		return
+	}
+	if tree == nil {
+		http.Error(w, `{"error": "conversation not found"}`, http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(tree)
+}
+
 // ConversationDelete handles DELETE /api/chat/conversations/{id}
 func ConversationDelete(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -112,3 +273,60 @@ func ConversationDelete(w http.ResponseWriter, r *http.Request) {
 		"message": "Conversation deleted",
 	})
 }
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// ChatSearch handles GET /api/chat/search - finds conversations by title and
+// message text, most relevant first, each with the IDs and highlighted
+// snippets of its best matching messages.
+//
+// Query params: q (required), cwd, since and until (RFC 3339 or
+// YYYY-MM-DD, against message times), limit.
+func ChatSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := db.SearchOptions{
+		Query: q.Get("q"),
+		Cwd:   q.Get("cwd"),
+		Limit: defaultSearchLimit,
+	}
+	if opts.Query == "" {
+		http.Error(w, `{"error": "q parameter required"}`, http.StatusBadRequest)
+		return
+	}
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			opts.Limit = min(parsed, maxSearchLimit)
+		}
+	}
+	if s := q.Get("since"); s != "" {
+		since, err := parseDateParam(s, false)
+		if err != nil {
+			http.Error(w, `{"error": "invalid since date"}`, http.StatusBadRequest)
+			return
+		}
+		opts.Since = since.UnixMilli()
+	}
+	if u := q.Get("until"); u != "" {
+		until, err := parseDateParam(u, true)
+		if err != nil {
+			http.Error(w, `{"error": "invalid until date"}`, http.StatusBadRequest)
+			return
+		}
+		opts.Until = until.UnixMilli()
+	}
+
+	results, err := db.SearchConversations(opts)
+	if err != nil {
+		log.Printf("[Conversations] Search for %q failed: %s", opts.Query, err)
+		http.Error(w, `{"error": "search failed"}`, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"fts":     db.FTSEnabled(),
+	})
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/db"
+)
+
+// db.Init opens one database per process, so the tests that need one share
+// it, each using its own conversation IDs
+var (
+	testDBOnce sync.Once
+	testDBDir  string
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testDBDir != "" {
+		os.RemoveAll(testDBDir)
+	}
+	os.Exit(code)
+}
+
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	testDBOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "markdown-themes-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		testDBDir = dir
+		old, had := os.LookupEnv("XDG_DATA_HOME")
+		os.Setenv("XDG_DATA_HOME", dir)
+		_, err = db.Init()
+		if had {
+			os.Setenv("XDG_DATA_HOME", old)
+		} else {
+			os.Unsetenv("XDG_DATA_HOME")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if db.Get() == nil {
+		t.Fatal("test database failed to open")
+	}
+}
+
+// serveConversations sends a request through the conversation routes
+func serveConversations(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Post("/api/chat/conversations", ConversationCreate)
+	r.Get("/api/chat/conversations/{id}", ConversationGet)
+	r.Put("/api/chat/conversations/{id}", ConversationUpdate)
+	r.Post("/api/chat/conversations/{id}/fork", ConversationFork)
+	r.Get("/api/chat/conversations/{id}/branches", ConversationBranches)
+	r.Post("/api/chat/conversations/{id}/messages", MessageAppend)
+	r.Patch("/api/chat/conversations/{id}/messages/{messageId}", MessagePatch)
+	r.Delete("/api/chat/conversations/{id}/messages/{messageId}", MessageDelete)
+	r.Get("/api/chat/search", ChatSearch)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rr
+}
+
+func decodeVersion(t *testing.T, rr *httptest.ResponseRecorder) int64 {
+	t.Helper()
+	var resp struct {
+		Version int64 `json:"version"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Version
+}
+
+func TestConversationUpdate_VersionConflict(t *testing.T) {
+	setupTestDB(t)
+	rr := serveConversations(t, http.MethodPost, "/api/chat/conversations", `{"id": "ver-1", "title": "T", "messages": []}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	v := decodeVersion(t, rr)
+
+	body := `{"title": "Renamed", "version": ` + strconv.FormatInt(v, 10) + `}`
+	rr = serveConversations(t, http.MethodPut, "/api/chat/conversations/ver-1", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := decodeVersion(t, rr); got != v+1 {
+		t.Errorf("got version %d, want %d", got, v+1)
+	}
+
+	// A second client still holding the old version
+	rr = serveConversations(t, http.MethodPut, "/api/chat/conversations/ver-1", body)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a stale version, got %d", rr.Code)
+	}
+	// Version 0 overwrites without checking
+	rr = serveConversations(t, http.MethodPut, "/api/chat/conversations/ver-1", `{"title": "Forced"}`)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 without a version, got %d", rr.Code)
+	}
+	rr = serveConversations(t, http.MethodPut, "/api/chat/conversations/missing", `{"title": "X", "version": 1}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing conversation, got %d", rr.Code)
+	}
+}
+
+func TestMessageAppendPatchDelete(t *testing.T) {
+	setupTestDB(t)
+	serveConversations(t, http.MethodPost, "/api/chat/conversations", `{"id": "msg-1", "title": "T"}`)
+
+	rr := serveConversations(t, http.MethodPost, "/api/chat/conversations/msg-1/messages",
+		`{"id": "msg-1-a", "role": "assistant", "content": "Hel", "isStreaming": true}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	v := decodeVersion(t, rr)
+
+	rr = serveConversations(t, http.MethodPatch, "/api/chat/conversations/msg-1/messages/msg-1-a",
+		`{"content": "stale", "version": `+strconv.FormatInt(v-1, 10)+`}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a stale version, got %d", rr.Code)
+	}
+
+	rr = serveConversations(t, http.MethodPatch, "/api/chat/conversations/msg-1/messages/msg-1-a",
+		`{"content": "Hello", "isStreaming": false, "costUSD": 0.25, "version": `+strconv.FormatInt(v, 10)+`}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var patched struct {
+		Message db.Message `json:"message"`
+		Version int64      `json:"version"`
+	}
+	json.NewDecoder(rr.Body).Decode(&patched)
+	if patched.Message.Content != "Hello" || patched.Message.IsStreaming || patched.Message.CostUSD == nil || *patched.Message.CostUSD != 0.25 {
+		t.Errorf("unexpected patched message %+v", patched.Message)
+	}
+	if patched.Version != v+1 {
+		t.Errorf("got version %d, want %d", patched.Version, v+1)
+	}
+
+	rr = serveConversations(t, http.MethodPatch, "/api/chat/conversations/msg-1/messages/nope", `{"content": "x"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing message, got %d", rr.Code)
+	}
+
+	rr = serveConversations(t, http.MethodDelete, "/api/chat/conversations/msg-1/messages/msg-1-a?version="+strconv.FormatInt(v, 10), "")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 deleting with a stale version, got %d", rr.Code)
+	}
+	rr = serveConversations(t, http.MethodDelete, "/api/chat/conversations/msg-1/messages/msg-1-a?version="+strconv.FormatInt(v+1, 10), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if conv, _ := db.GetConversation("msg-1"); len(conv.Messages) != 0 {
+		t.Errorf("expected the message deleted, got %+v", conv.Messages)
+	}
+}
+
+func TestMessageAppend_RejectsAnotherConversationsMessage(t *testing.T) {
+	setupTestDB(t)
+	serveConversations(t, http.MethodPost, "/api/chat/conversations",
+		`{"id": "own-a", "title": "A", "messages": [{"id": "own-a-1", "conversationId": "own-a", "role": "user", "content": "mine", "timestamp": 1}]}`)
+	serveConversations(t, http.MethodPost, "/api/chat/conversations", `{"id": "own-b", "title": "B"}`)
+
+	rr := serveConversations(t, http.MethodPost, "/api/chat/conversations/own-b/messages",
+		`{"id": "own-a-1", "role": "user", "content": "stolen"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", rr.Code)
+	}
+	rr = serveConversations(t, http.MethodPut, "/api/chat/conversations/own-b",
+		`{"title": "B", "messages": [{"id": "own-a-1", "role": "user", "content": "stolen", "timestamp": 1}]}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 from a PUT, got %d", rr.Code)
+	}
+
+	a, _ := db.GetConversation("own-a")
+	if len(a.Messages) != 1 || a.Messages[0].Content != "mine" {
+		t.Errorf("conversation A's message changed: %+v", a.Messages)
+	}
+}
+
+// createForkSource stores a two-turn conversation whose replies both
+// continued Claude session sess-f
+func createForkSource(t *testing.T, id string) {
+	t.Helper()
+	body := `{"id": "` + id + `", "title": "Root", "claudeSessionId": "sess-f", "messages": [
+		{"id": "` + id + `-u1", "conversationId": "` + id + `", "role": "user", "content": "one", "timestamp": 1},
+		{"id": "` + id + `-a1", "conversationId": "` + id + `", "role": "assistant", "content": "first", "timestamp": 2, "claudeSessionId": "sess-f"},
+		{"id": "` + id + `-u2", "conversationId": "` + id + `", "role": "user", "content": "two", "timestamp": 3},
+		{"id": "` + id + `-a2", "conversationId": "` + id + `", "role": "assistant", "content": "second", "timestamp": 4, "claudeSessionId": "sess-f"}]}`
+	if rr := serveConversations(t, http.MethodPost, "/api/chat/conversations", body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConversationFork_TruncatesContinuedSession(t *testing.T) {
+	setupTestDB(t)
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-work", "sess-f.jsonl")
+	writeTranscript(t, path,
+		`{"type":"user","uuid":"u1","sessionId":"sess-f","message":{"role":"user","content":"one"}}`,
+		`{"type":"assistant","uuid":"a1","sessionId":"sess-f","message":{"content":[{"type":"text","text":"first"}]}}`,
+		`{"type":"user","uuid":"u2","sessionId":"sess-f","message":{"role":"user","content":"two"}}`,
+		`{"type":"assistant","uuid":"a2","sessionId":"sess-f","message":{"content":[{"type":"text","text":"second"}]}}`,
+	)
+	createForkSource(t, "fk-1")
+
+	rr := serveConversations(t, http.MethodPost, "/api/chat/conversations/fk-1/fork", `{"messageId": "fk-1-a1", "id": "fk-1-child"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var fork db.Conversation
+	json.NewDecoder(rr.Body).Decode(&fork)
+	if len(fork.Messages) != 2 || fork.ParentConversationID != "fk-1" || fork.ForkedFromMessageID != "fk-1-a1" {
+		t.Errorf("unexpected fork %+v", fork)
+	}
+	if fork.ClaudeSessionID == "" || fork.ClaudeSessionID == "sess-f" {
+		t.Fatalf("expected a new session, got %q", fork.ClaudeSessionID)
+	}
+	if pending, _ := db.SessionForkPending("fk-1-child"); pending {
+		t.Error("a truncated copy should be resumed, not forked")
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), fork.ClaudeSessionID+".jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || strings.Contains(string(data), "second") {
+		t.Errorf("expected only the first turn, got:\n%s", data)
+	}
+	if strings.Contains(string(data), `"sess-f"`) {
+		t.Errorf("expected the session ID rewritten, got:\n%s", data)
+	}
+}
+
+func TestConversationFork_PendingAtLatestMessage(t *testing.T) {
+	setupTestDB(t)
+	createForkSource(t, "fk-2")
+
+	rr := serveConversations(t, http.MethodPost, "/api/chat/conversations/fk-2/fork", `{"messageId": "fk-2-a2", "id": "fk-2-child"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var fork db.Conversation
+	json.NewDecoder(rr.Body).Decode(&fork)
+	if fork.ClaudeSessionID != "sess-f" || fork.Title != "Root (fork)" {
+		t.Errorf("unexpected fork %+v", fork)
+	}
+	if pending, _ := db.SessionForkPending("fk-2-child"); !pending {
+		t.Error("expected the first turn to fork the shared session")
+	}
+
+	// Recording the fork's first turn clears the flag
+	if err := db.SetConversationClaudeSession("fk-2-child", "sess-new"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := db.SessionForkPending("fk-2-child"); pending {
+		t.Error("expected the flag cleared once the fork has its own session")
+	}
+}
+
+func TestConversationFork_Conflicts(t *testing.T) {
+	setupTestDB(t)
+	setupClaudeProjects(t) // No transcripts
+	createForkSource(t, "fk-3")
+
+	rr := serveConversations(t, http.MethodPost, "/api/chat/conversations/fk-3/fork", `{"messageId": "fk-3-a1"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 when the continued session can't be copied, got %d", rr.Code)
+	}
+	rr = serveConversations(t, http.MethodPost, "/api/chat/conversations/fk-3/fork", `{"messageId": "fk-3-a2", "id": "fk-3"}`)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a taken id, got %d", rr.Code)
+	}
+	rr = serveConversations(t, http.MethodPost, "/api/chat/conversations/fk-3/fork", `{"messageId": "nope"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing message, got %d", rr.Code)
+	}
+}
+
+func TestConversationBranches(t *testing.T) {
+	setupTestDB(t)
+	createForkSource(t, "br-1")
+	serveConversations(t, http.MethodPost, "/api/chat/conversations/br-1/fork", `{"messageId": "br-1-a2", "id": "br-1-a"}`)
+	serveConversations(t, http.MethodPost, "/api/chat/conversations/br-1-a/fork", `{"messageId": "br-1-a_0", "id": "br-1-a-x"}`)
+
+	// Any conversation in the tree returns the whole of it
+	rr := serveConversations(t, http.MethodGet, "/api/chat/conversations/br-1-a-x/branches", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var tree db.ConversationBranch
+	json.NewDecoder(rr.Body).Decode(&tree)
+	if tree.ID != "br-1" || tree.MessageCount != 4 || len(tree.Children) != 1 {
+		t.Fatalf("unexpected root %+v", tree)
+	}
+	child := tree.Children[0]
+	if child.ID != "br-1-a" || child.ForkedFromMessageID != "br-1-a2" || len(child.Children) != 1 {
+		t.Fatalf("unexpected child %+v", child)
+	}
+	if grandchild := child.Children[0]; grandchild.ID != "br-1-a-x" || grandchild.MessageCount != 1 {
+		t.Errorf("unexpected grandchild %+v", grandchild)
+	}
+
+	rr = serveConversations(t, http.MethodGet, "/api/chat/conversations/missing/branches", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rr.Code)
+	}
+}
+
+func TestChatSearch(t *testing.T) {
+	setupTestDB(t)
+	serveConversations(t, http.MethodPost, "/api/chat/conversations", `{"id": "srch-1", "title": "Zebrafish notes", "cwd": "/lab",
+		"messages": [{"id": "srch-1-m", "conversationId": "srch-1", "role": "user", "content": "count the zebrafish", "timestamp": 1700000000000}]}`)
+	serveConversations(t, http.MethodPost, "/api/chat/conversations", `{"id": "srch-2", "title": "Other", "cwd": "/home",
+		"messages": [{"id": "srch-2-m", "conversationId": "srch-2", "role": "user", "content": "a zebrafish aside", "timestamp": 1600000000000}]}`)
+
+	search := func(query string) (int, []db.SearchResult) {
+		rr := serveConversations(t, http.MethodGet, "/api/chat/search?"+query, "")
+		var resp struct {
+			Results []db.SearchResult `json:"results"`
+		}
+		json.NewDecoder(rr.Body).Decode(&resp)
+		return rr.Code, resp.Results
+	}
+
+	code, results := search("q=zebrafish")
+	if code != http.StatusOK || len(results) != 2 || results[0].ConversationID != "srch-1" {
+		t.Fatalf("expected both, title match first; got %d %+v", code, results)
+	}
+	if len(results[0].Matches) != 1 || !strings.Contains(results[0].Matches[0].Snippet, "<mark>") {
+		t.Errorf("expected a marked snippet, got %+v", results[0].Matches)
+	}
+
+	if _, results = search("q=zebrafish&limit=1"); len(results) != 1 {
+		t.Errorf("limit: got %d results", len(results))
+	}
+	if _, results = search("q=zebrafish&cwd=/home"); len(results) != 1 || results[0].ConversationID != "srch-2" {
+		t.Errorf("cwd: got %+v", results)
+	}
+	// Only srch-2's message is from 2020; srch-1's title is dated by its last update, today
+	if _, results = search("q=zebrafish&since=2020-01-01&until=2020-12-31"); len(results) != 1 || results[0].ConversationID != "srch-2" {
+		t.Errorf("dates: got %+v", results)
+	}
+
+	for _, query := range []string{"", "q=zebrafish&since=yesterday", "q=zebrafish&until=2020-13-01"} {
+		if code, _ := search(query); code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, code)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package handlers
+
+import "os"
+
+// dirKeyOf identifies the directory at path by its resolved path, as there
+// are no inode numbers to compare
+func dirKeyOf(path string, info os.FileInfo) dirKey {
+	return dirKey{path: resolvedPath(path)}
+}
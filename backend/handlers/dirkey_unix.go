@@ -0,0 +1,16 @@
+//go:build unix
+
+package handlers
+
+import (
+	"os"
+	"syscall"
+)
+
+// dirKeyOf identifies the directory at path by device and inode
+func dirKeyOf(path string, info os.FileInfo) dirKey {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return dirKey{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	}
+	return dirKey{path: resolvedPath(path)}
+}
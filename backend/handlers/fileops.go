@@ -0,0 +1,644 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"markdown-themes-backend/db"
+)
+
+// workspaceNotifyFunc delivers a message once to every WebSocket client whose
+// watched workspace contains any of paths. Set by the websocket hub (avoids an
+// import cycle).
+var workspaceNotifyFunc func(paths []string, message interface{})
+
+// SetWorkspaceNotifyFunc sets the callback used to push workspace events
+func SetWorkspaceNotifyFunc(fn func(paths []string, message interface{})) {
+	workspaceNotifyFunc = fn
+}
+
+// NotifyTreeChange tells sidebars watching the affected workspace that an
+// entry was created, deleted or renamed. The file watcher reports the same
+// changes from fsnotify, so clients must apply these idempotently.
+func NotifyTreeChange(action, path, oldPath string, isDir bool) {
+	if workspaceNotifyFunc == nil {
+		return
+	}
+	msg := map[string]interface{}{
+		"type":   "workspace-tree-change",
+		"action": action,
+		"path":   path,
+		"isDir":  isDir,
+	}
+	paths := []string{path}
+	if oldPath != "" {
+		// A move between workspaces must reach both
+		msg["oldPath"] = oldPath
+		paths = append(paths, oldPath)
+	}
+	workspaceNotifyFunc(paths, msg)
+}
+
+// isProtectedPath guards against operations on the filesystem root or the
+// home directory itself.
+func isProtectedPath(path string) bool {
+	if path == "/" {
+		return true
+	}
+	home, err := os.UserHomeDir()
+	return err == nil && path == filepath.Clean(home)
+}
+
+// FileMkdir handles POST /api/files/mkdir - creates a directory and any missing parents
+func FileMkdir(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		http.Error(w, `{"error": "path parameter required"}`, http.StatusBadRequest)
+		return
+	}
+
+	path := expandPath(req.Path)
+	if !filepath.IsAbs(path) {
+		http.Error(w, `{"error": "path must be absolute"}`, http.StatusBadRequest)
+		return
+	}
+
+	created := false
+	if info, err := os.Stat(path); err == nil {
+		if !info.IsDir() {
+			http.Error(w, `{"error": "path already exists as a file"}`, http.StatusConflict)
+			return
+		}
+	} else {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to create directory: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		created = true
+		NotifyTreeChange("created", path, "", true)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"path":    path,
+		"created": created,
+	})
+}
+
+// fileTransferRequest is the body for rename/move and copy
+type fileTransferRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// decodeTransferRequest validates a rename/copy body and returns cleaned paths.
+// On failure it writes the error response and returns ok=false.
+func decodeTransferRequest(w http.ResponseWriter, r *http.Request) (from, to string, overwrite bool, ok bool) {
+	var req fileTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.From == "" || req.To == "" {
+		http.Error(w, `{"error": "from and to parameters required"}`, http.StatusBadRequest)
+		return "", "", false, false
+	}
+
+	// expandPath cleans, so the prefix checks below see no trailing or doubled separators
+	from = expandPath(req.From)
+	to = expandPath(req.To)
+	if !filepath.IsAbs(from) || !filepath.IsAbs(to) {
+		http.Error(w, `{"error": "paths must be absolute"}`, http.StatusBadRequest)
+		return "", "", false, false
+	}
+	if from == to {
+		http.Error(w, `{"error": "source and destination are the same"}`, http.StatusBadRequest)
+		return "", "", false, false
+	}
+	if isProtectedPath(from) {
+		http.Error(w, `{"error": "refusing to operate on a protected path"}`, http.StatusForbidden)
+		return "", "", false, false
+	}
+	// Moving or copying a directory into itself would recurse forever
+	if strings.HasPrefix(to, from+string(filepath.Separator)) {
+		http.Error(w, `{"error": "cannot move or copy a directory into itself"}`, http.StatusBadRequest)
+		return "", "", false, false
+	}
+	// Overwriting an ancestor of the source would delete the source first
+	if strings.HasPrefix(from, to+string(filepath.Separator)) || to == "/" {
+		http.Error(w, `{"error": "cannot move or copy onto a directory containing the source"}`, http.StatusBadRequest)
+		return "", "", false, false
+	}
+
+	if _, err := os.Lstat(from); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "source not found: %s"}`, err.Error()), http.StatusNotFound)
+		return "", "", false, false
+	}
+
+	return from, to, req.Overwrite, true
+}
+
+// prepareDestination creates the destination's parent directory and reports
+// whether the destination exists, which is only allowed when overwrite is set.
+// Writes the error response on failure.
+func prepareDestination(w http.ResponseWriter, to string, overwrite bool) (exists, ok bool) {
+	if _, err := os.Lstat(to); err == nil {
+		if !overwrite {
+			http.Error(w, `{"error": "destination already exists"}`, http.StatusConflict)
+			return false, false
+		}
+		if isProtectedPath(to) {
+			http.Error(w, `{"error": "refusing to overwrite a protected path"}`, http.StatusForbidden)
+			return false, false
+		}
+		exists = true
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to create destination directory: %s"}`, err.Error()), http.StatusInternalServerError)
+		return false, false
+	}
+	return exists, true
+}
+
+// overwriteDestination transfers into a temporary name beside to, then moves
+// the existing destination to the trash and renames the transfer over it.
+// transfer cleans up after itself when it fails, and undo reverses a transfer
+// that succeeded; either way the destination is left as it was on error.
+func overwriteDestination(to string, transfer func(dst string) error, undo func(dst string)) error {
+	tmp := filepath.Join(filepath.Dir(to), fmt.Sprintf(".%s.%s.tmp", filepath.Base(to), newTrashID()))
+	if err := transfer(tmp); err != nil {
+		return err
+	}
+
+	item, err := moveToTrash(to)
+	if err != nil {
+		undo(tmp)
+		return fmt.Errorf("failed to move destination to trash: %w", err)
+	}
+	if err := os.Rename(tmp, to); err != nil {
+		itemDir, _, filesDir := trashItemPaths(item.ID)
+		if movePath(filepath.Join(filesDir, item.Name), to) == nil {
+			os.RemoveAll(itemDir)
+		}
+		undo(tmp)
+		return err
+	}
+	return nil
+}
+
+// FileRename handles POST /api/files/rename - renames or moves a file or directory,
+// including across directories and filesystems.
+func FileRename(w http.ResponseWriter, r *http.Request) {
+	from, to, overwrite, ok := decodeTransferRequest(w, r)
+	if !ok {
+		return
+	}
+	exists, ok := prepareDestination(w, to, overwrite)
+	if !ok {
+		return
+	}
+
+	info, _ := os.Lstat(from)
+	var err error
+	if exists {
+		err = overwriteDestination(to,
+			func(dst string) error { return movePath(from, dst) },
+			func(dst string) { movePath(dst, from) })
+	} else {
+		err = movePath(from, to)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to move: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	NotifyTreeChange("renamed", to, from, info != nil && info.IsDir())
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"from":    from,
+		"path":    to,
+	})
+}
+
+// FileCopy handles POST /api/files/copy - copies a file or directory recursively
+func FileCopy(w http.ResponseWriter, r *http.Request) {
+	from, to, overwrite, ok := decodeTransferRequest(w, r)
+	if !ok {
+		return
+	}
+	exists, ok := prepareDestination(w, to, overwrite)
+	if !ok {
+		return
+	}
+
+	copyTo := func(dst string) error {
+		if err := copyPath(from, dst); err != nil {
+			// Don't leave a half-copied tree behind
+			os.RemoveAll(dst)
+			return err
+		}
+		return nil
+	}
+	var err error
+	if exists {
+		err = overwriteDestination(to, copyTo, func(dst string) { os.RemoveAll(dst) })
+	} else {
+		err = copyTo(to)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to copy: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	info, _ := os.Lstat(to)
+	NotifyTreeChange("created", to, "", info != nil && info.IsDir())
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"from":    from,
+		"path":    to,
+	})
+}
+
+// movePath renames src to dst, falling back to copy+remove when the two are
+// on different filesystems (rename returns EXDEV).
+func movePath(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	var linkErr *os.LinkError
+	if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyPath(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyPath copies src to dst recursively, preserving file modes and copying
+// symlinks as symlinks rather than following them.
+func copyPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case info.Mode().IsRegular():
+		return copyFile(src, dst, info.Mode().Perm())
+
+	default:
+		return fmt.Errorf("unsupported file type: %s", src)
+	}
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ---- Trash ----
+
+// TrashItem describes an entry moved to the app-managed trash
+type TrashItem struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	OriginalPath string `json:"originalPath"`
+	DeletedAt    int64  `json:"deletedAt"`
+	IsDir        bool   `json:"isDir"`
+	Size         int64  `json:"size"`
+}
+
+// trashDir returns the trash root under the app data dir.
+// Each item lives in trash/{id}/ with a meta.json and the moved entry in files/.
+func trashDir() string {
+	return filepath.Join(db.DataDir(), "trash")
+}
+
+func trashItemPaths(id string) (itemDir, metaPath, filesDir string) {
+	itemDir = filepath.Join(trashDir(), id)
+	return itemDir, filepath.Join(itemDir, "meta.json"), filepath.Join(itemDir, "files")
+}
+
+func newTrashID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%d-%s", time.Now().UnixMilli(), hex.EncodeToString(b))
+}
+
+// isValidTrashID rejects IDs that could escape the trash directory
+func isValidTrashID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && id != "." && id != ".."
+}
+
+func loadTrashItem(id string) (*TrashItem, error) {
+	_, metaPath, _ := trashItemPaths(id)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	var item TrashItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// pathSize returns the total size of regular files under path
+func pathSize(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// moveToTrash moves path into a new trash item
+func moveToTrash(path string) (TrashItem, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return TrashItem{}, err
+	}
+
+	item := TrashItem{
+		ID:           newTrashID(),
+		Name:         filepath.Base(path),
+		OriginalPath: path,
+		DeletedAt:    time.Now().UnixMilli(),
+		IsDir:        info.IsDir(),
+	}
+	item.Size = pathSize(path)
+
+	itemDir, metaPath, filesDir := trashItemPaths(item.ID)
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return item, fmt.Errorf("failed to create trash directory: %w", err)
+	}
+
+	// Write metadata first so an interrupted move still leaves a restorable entry
+	meta, _ := json.MarshalIndent(item, "", "  ")
+	if err := os.WriteFile(metaPath, meta, 0600); err != nil {
+		os.RemoveAll(itemDir)
+		return item, fmt.Errorf("failed to write trash metadata: %w", err)
+	}
+
+	if err := movePath(path, filepath.Join(filesDir, item.Name)); err != nil {
+		os.RemoveAll(itemDir)
+		return item, fmt.Errorf("failed to move to trash: %w", err)
+	}
+
+	log.Printf("[Trash] Moved %s to trash (%s)", path, item.ID)
+	return item, nil
+}
+
+// FileDelete handles POST /api/files/delete - moves a file or directory into the trash
+func FileDelete(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path string `json:"path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		http.Error(w, `{"error": "path parameter required"}`, http.StatusBadRequest)
+		return
+	}
+
+	path := expandPath(req.Path)
+	if !filepath.IsAbs(path) {
+		http.Error(w, `{"error": "path must be absolute"}`, http.StatusBadRequest)
+		return
+	}
+	if isProtectedPath(path) || path == trashDir() || strings.HasPrefix(path, trashDir()+string(filepath.Separator)) {
+		http.Error(w, `{"error": "refusing to delete a protected path"}`, http.StatusForbidden)
+		return
+	}
+
+	if _, err := os.Lstat(path); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "path not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+
+	item, err := moveToTrash(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	NotifyTreeChange("deleted", path, "", item.IsDir)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"item":    item,
+	})
+}
+
+// TrashList handles GET /api/files/trash - lists trashed items, newest first
+func TrashList(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(trashDir())
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to read trash: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	items := []TrashItem{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		item, err := loadTrashItem(entry.Name())
+		if err != nil {
+			continue
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt > items[j].DeletedAt
+	})
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// TrashRestore handles POST /api/files/trash/{id}/restore - moves an item back
+// to its original location (or to an optional "path" from the body)
+func TrashRestore(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isValidTrashID(id) {
+		http.Error(w, `{"error": "invalid trash id"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Path string `json:"path,omitempty"`
+	}
+	// Body is optional
+	json.NewDecoder(r.Body).Decode(&req)
+
+	item, err := loadTrashItem(id)
+	if err != nil {
+		http.Error(w, `{"error": "trash item not found"}`, http.StatusNotFound)
+		return
+	}
+
+	dest := item.OriginalPath
+	if req.Path != "" {
+		dest = expandPath(req.Path)
+		if !filepath.IsAbs(dest) {
+			http.Error(w, `{"error": "path must be absolute"}`, http.StatusBadRequest)
+			return
+		}
+		if isProtectedPath(dest) || dest == trashDir() || strings.HasPrefix(dest, trashDir()+string(filepath.Separator)) {
+			http.Error(w, `{"error": "refusing to restore to a protected path"}`, http.StatusForbidden)
+			return
+		}
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		http.Error(w, `{"error": "destination already exists"}`, http.StatusConflict)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to create destination directory: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	itemDir, _, filesDir := trashItemPaths(id)
+	if err := movePath(filepath.Join(filesDir, item.Name), dest); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to restore: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	os.RemoveAll(itemDir)
+
+	log.Printf("[Trash] Restored %s to %s", id, dest)
+	NotifyTreeChange("created", dest, "", item.IsDir)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"path":    dest,
+	})
+}
+
+// TrashPurge handles DELETE /api/files/trash/{id} - permanently removes one item
+func TrashPurge(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isValidTrashID(id) {
+		http.Error(w, `{"error": "invalid trash id"}`, http.StatusBadRequest)
+		return
+	}
+
+	itemDir, _, _ := trashItemPaths(id)
+	if _, err := os.Stat(itemDir); err != nil {
+		http.Error(w, `{"error": "trash item not found"}`, http.StatusNotFound)
+		return
+	}
+	if err := os.RemoveAll(itemDir); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to purge: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"purged":  1,
+	})
+}
+
+// TrashPurgeAll handles DELETE /api/files/trash - empties the trash.
+// With ?olderThanDays=N only items deleted more than N days ago are removed.
+func TrashPurgeAll(w http.ResponseWriter, r *http.Request) {
+	var cutoff int64
+	if days := r.URL.Query().Get("olderThanDays"); days != "" {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err != nil || n < 0 {
+			http.Error(w, `{"error": "invalid olderThanDays"}`, http.StatusBadRequest)
+			return
+		}
+		cutoff = time.Now().Add(-time.Duration(n) * 24 * time.Hour).UnixMilli()
+	}
+
+	entries, err := os.ReadDir(trashDir())
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to read trash: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	purged := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if cutoff > 0 {
+			item, err := loadTrashItem(entry.Name())
+			if err == nil && item.DeletedAt > cutoff {
+				continue
+			}
+		}
+		if err := os.RemoveAll(filepath.Join(trashDir(), entry.Name())); err == nil {
+			purged++
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"purged":  purged,
+	})
+}
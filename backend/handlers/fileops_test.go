@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestFileDelete_MovesToTrashAndRestores(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "notes.md")
+	os.WriteFile(path, []byte("keep me"), 0644)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/files/delete", strings.NewReader(`{"path": "`+path+`"}`))
+	rr := httptest.NewRecorder()
+	FileDelete(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("deleted file should no longer exist at its original path")
+	}
+
+	var resp struct {
+		Item TrashItem `json:"item"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/files/trash/"+resp.Item.ID+"/restore", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", resp.Item.ID)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	rr = httptest.NewRecorder()
+	TrashRestore(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 on restore, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "keep me" {
+		t.Errorf("expected restored content, got %q (err %v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(trashDir(), resp.Item.ID)); !os.IsNotExist(err) {
+		t.Error("trash entry should be removed after restore")
+	}
+}
+
+func TestFileCopy_Recursive(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "docs")
+	os.MkdirAll(filepath.Join(src, "nested"), 0755)
+	os.WriteFile(filepath.Join(src, "nested", "a.md"), []byte("a"), 0600)
+
+	dst := filepath.Join(root, "docs-copy")
+	req := httptest.NewRequest(http.MethodPost, "/api/files/copy", strings.NewReader(`{"from": "`+src+`", "to": "`+dst+`"}`))
+	rr := httptest.NewRecorder()
+	FileCopy(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "nested", "a.md"))
+	if err != nil {
+		t.Fatalf("expected copied file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 preserved, got %o", info.Mode().Perm())
+	}
+}
+
+func postTransfer(t *testing.T, handler http.HandlerFunc, from, to string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"from": from, "to": to, "overwrite": true})
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodPost, "/api/files/copy", strings.NewReader(string(body))))
+	return rr
+}
+
+func TestFileRename_OverwriteTrashesDestination(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	root := t.TempDir()
+	src, dst := filepath.Join(root, "new.md"), filepath.Join(root, "old.md")
+	os.WriteFile(src, []byte("new"), 0644)
+	os.WriteFile(dst, []byte("old"), 0644)
+
+	if rr := postTransfer(t, FileRename, src, dst); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "new" {
+		t.Errorf("expected the destination replaced, got %q", data)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("expected only the destination left, got %d entries", len(entries))
+	}
+
+	trashed, _ := os.ReadDir(trashDir())
+	if len(trashed) != 1 {
+		t.Fatalf("expected the old destination in the trash, got %d items", len(trashed))
+	}
+	item, _ := loadTrashItem(trashed[0].Name())
+	_, _, filesDir := trashItemPaths(item.ID)
+	if data, _ := os.ReadFile(filepath.Join(filesDir, item.Name)); item.OriginalPath != dst || string(data) != "old" {
+		t.Errorf("unexpected trash item %+v with %q", item, data)
+	}
+}
+
+func TestFileCopy_FailedOverwriteKeepsDestination(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	root := t.TempDir()
+	src := filepath.Join(root, "src")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "a.md"), []byte("a"), 0644)
+	// Sockets can't be copied, so the copy fails partway
+	listener, err := net.Listen("unix", filepath.Join(src, "s.sock"))
+	if err != nil {
+		t.Skip("unix sockets not supported")
+	}
+	defer listener.Close()
+	dst := filepath.Join(root, "dst")
+	os.MkdirAll(dst, 0755)
+	os.WriteFile(filepath.Join(dst, "keep.md"), []byte("keep"), 0644)
+
+	if rr := postTransfer(t, FileCopy, src, dst); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "keep.md")); string(data) != "keep" {
+		t.Errorf("expected the destination untouched, got %q", data)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 2 {
+		t.Errorf("expected no temporary copy left behind, got %d entries", len(entries))
+	}
+	if trashed, _ := os.ReadDir(trashDir()); len(trashed) != 0 {
+		t.Errorf("expected nothing trashed, got %d items", len(trashed))
+	}
+}
+
+func TestFileRename_RejectsIntoItself(t *testing.T) {
+	src := t.TempDir()
+	req := httptest.NewRequest(http.MethodPost, "/api/files/rename", strings.NewReader(`{"from": "`+src+`", "to": "`+filepath.Join(src, "sub")+`"}`))
+	rr := httptest.NewRecorder()
+	FileRename(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestFileRename_RejectsOntoAncestor(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "b", "c")
+	os.MkdirAll(src, 0755)
+	os.WriteFile(filepath.Join(src, "a.md"), []byte("a"), 0644)
+
+	for _, handler := range []http.HandlerFunc{FileRename, FileCopy} {
+		body := `{"from": "` + src + `", "to": "` + filepath.Join(root, "b") + `/", "overwrite": true}`
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(src, "a.md")); err != nil {
+		t.Errorf("source should be untouched: %v", err)
+	}
+}
+
+func TestTrashRestore_RejectsBadPaths(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), "notes.md")
+	os.WriteFile(path, []byte("keep me"), 0644)
+
+	rr := httptest.NewRecorder()
+	FileDelete(rr, httptest.NewRequest(http.MethodPost, "/api/files/delete", strings.NewReader(`{"path": "`+path+`"}`)))
+	var resp struct {
+		Item TrashItem `json:"item"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+
+	for body, want := range map[string]int{
+		`{"path": "relative/notes.md"}`:                      http.StatusBadRequest,
+		`{"path": "/"}`:                                      http.StatusForbidden,
+		`{"path": "` + filepath.Join(trashDir(), "x") + `"}`: http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/files/trash/"+resp.Item.ID+"/restore", strings.NewReader(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", resp.Item.ID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+		TrashRestore(rr, req)
+		if rr.Code != want {
+			t.Errorf("%s: expected %d, got %d", body, want, rr.Code)
+		}
+	}
+}
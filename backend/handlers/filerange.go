@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"markdown-themes-backend/utils"
+)
+
+const (
+	// FileContent refuses files above this; use FileRange to page through them
+	maxFileContentSize = 10 * 1024 * 1024
+	defaultRangeBytes  = 256 * 1024
+	maxRangeBytes      = 4 * 1024 * 1024
+	defaultRangeLines  = 1000
+	maxRangeLines      = 20000
+	// Number of files whose line-offset index is kept in memory
+	maxLineIndexes      = 16
+	lineIndexScanBuffer = 1024 * 1024
+	// Bytes before the indexed end that must be unchanged to extend an index
+	// in place (append-only logs) rather than rebuilding it
+	lineIndexTailCheck = 64
+	charsetSampleSize  = 64 * 1024
+)
+
+// lineIndex records the byte offset where each line starts. Offsets are into
+// the raw file, so they stay valid whatever the charset.
+type lineIndex struct {
+	charset  string
+	size     int64
+	modTime  time.Time
+	starts   []int64
+	tail     []byte    // the last lineIndexTailCheck bytes indexed
+	lastUsed time.Time // guarded by lineIndexesMu, not mu
+	mu       sync.Mutex
+}
+
+var (
+	lineIndexes   = make(map[string]*lineIndex)
+	lineIndexesMu sync.Mutex
+)
+
+// newlineStep describes how a '\n' byte is laid out in charset: the parity
+// its offset must have (relative to the BOM) and how many bytes it spans.
+func newlineStep(charset string) (parity int64, width int64) {
+	switch charset {
+	case utils.CharsetUTF16LE:
+		return 0, 2
+	case utils.CharsetUTF16BE:
+		return 1, 1 // "\x00\n": the '\n' is the second byte and ends the unit
+	}
+	return -1, 1
+}
+
+// getLineIndex returns an up-to-date line index for path, building it on
+// first use and extending it when an append-only file has grown.
+func getLineIndex(path string, file *os.File, info os.FileInfo) (*lineIndex, error) {
+	lineIndexesMu.Lock()
+	idx, ok := lineIndexes[path]
+	if !ok {
+		idx = &lineIndex{}
+		lineIndexes[path] = idx
+		if len(lineIndexes) > maxLineIndexes {
+			var oldest string
+			var oldestTime time.Time
+			for p, other := range lineIndexes {
+				if p != path && (oldest == "" || other.lastUsed.Before(oldestTime)) {
+					oldest, oldestTime = p, other.lastUsed
+				}
+			}
+			delete(lineIndexes, oldest)
+		}
+	}
+	idx.lastUsed = time.Now()
+	lineIndexesMu.Unlock()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.starts != nil && idx.size == info.Size() && idx.modTime.Equal(info.ModTime()) {
+		return idx, nil
+	}
+	if idx.starts == nil || info.Size() < idx.size || !idx.tailUnchanged(file) {
+		if err := idx.rebuild(file); err != nil {
+			return nil, err
+		}
+	}
+	if err := idx.extend(file, info.Size()); err != nil {
+		return nil, err
+	}
+	idx.modTime = info.ModTime()
+	return idx, nil
+}
+
+func (idx *lineIndex) tailUnchanged(file *os.File) bool {
+	if len(idx.tail) == 0 {
+		return idx.size == 0
+	}
+	buf := make([]byte, len(idx.tail))
+	if _, err := file.ReadAt(buf, idx.size-int64(len(buf))); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, idx.tail)
+}
+
+func (idx *lineIndex) rebuild(file *os.File) error {
+	sample := make([]byte, charsetSampleSize)
+	n, err := file.ReadAt(sample, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	idx.charset = utils.DetectCharset(sample[:n])
+	idx.size = int64(utils.BOMLength(idx.charset))
+	idx.starts = []int64{idx.size}
+	idx.tail = nil
+	return nil
+}
+
+// extend scans from the indexed size to newSize recording line starts
+func (idx *lineIndex) extend(file *os.File, newSize int64) error {
+	parity, width := newlineStep(idx.charset)
+	bom := int64(utils.BOMLength(idx.charset))
+	buf := make([]byte, lineIndexScanBuffer)
+
+	for pos := idx.size; pos < newSize; {
+		n, err := file.ReadAt(buf[:min(int64(len(buf)), newSize-pos)], pos)
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				return err
+			}
+			break
+		}
+		chunk := buf[:n]
+		for i := 0; ; {
+			j := bytes.IndexByte(chunk[i:], '\n')
+			if j < 0 {
+				break
+			}
+			at := pos + int64(i+j)
+			if parity < 0 || ((at-bom)%2 == parity && isUTF16Newline(file, idx.charset, at)) {
+				// May equal newSize; lineCount ignores that until the file grows
+				idx.starts = append(idx.starts, at+width)
+			}
+			i += j + 1
+		}
+		pos += int64(n)
+	}
+
+	// Remember the tail so the next call can tell an append from a rewrite
+	tailLen := min(newSize, lineIndexTailCheck)
+	idx.tail = make([]byte, tailLen)
+	if tailLen > 0 {
+		if _, err := file.ReadAt(idx.tail, newSize-tailLen); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	idx.size = newSize
+	return nil
+}
+
+// isUTF16Newline checks that the other byte of the code unit holding the
+// '\n' at offset is zero, so e.g. U+010A is not taken for a line break
+func isUTF16Newline(file *os.File, charset string, offset int64) bool {
+	other := offset + 1
+	if charset == utils.CharsetUTF16BE {
+		other = offset - 1
+	}
+	b := make([]byte, 1)
+	if _, err := file.ReadAt(b, other); err != nil {
+		return false
+	}
+	return b[0] == 0
+}
+
+// lineCount returns the number of lines, not counting the empty "line"
+// after a trailing newline
+func (idx *lineIndex) lineCount() int {
+	n := len(idx.starts)
+	if n > 0 && idx.starts[n-1] >= idx.size {
+		n--
+	}
+	return n
+}
+
+// alignRange adjusts [start, end) so it does not split a character
+func alignRange(file *os.File, charset string, start, end, size int64) (int64, int64) {
+	bom := int64(utils.BOMLength(charset))
+	start = min(max(start, bom), size)
+	end = min(end, size)
+
+	switch charset {
+	case utils.CharsetUTF16LE, utils.CharsetUTF16BE:
+		// Code units are two bytes from the BOM. A split surrogate pair decodes
+		// to U+FFFD at the edge, which is acceptable for paging.
+		start = bom + (start-bom+1)/2*2
+		end = bom + (end-bom)/2*2
+	case utils.CharsetUTF8, utils.CharsetUTF8BOM:
+		// Move both edges back onto rune starts
+		buf := make([]byte, utf8.UTFMax)
+		for _, edge := range []*int64{&start, &end} {
+			if *edge >= size || *edge <= bom {
+				continue
+			}
+			from := max(bom, *edge-utf8.UTFMax+1)
+			n, _ := file.ReadAt(buf[:*edge-from+1], from)
+			for i := n - 1; i >= 0; i-- {
+				if utf8.RuneStart(buf[i]) {
+					*edge = from + int64(i)
+					break
+				}
+			}
+		}
+	}
+	return start, max(start, end)
+}
+
+// FileRange handles GET /api/files/range - reads part of a (possibly huge)
+// text file, decoded to UTF-8.
+//
+// Byte mode: offset, length (default 256KB). Edges are moved so characters
+// are never split; the response's offset/length report what was read.
+// Line mode: line (1-based; negative counts from the end, so -100 is the
+// last 100 lines), count (default 1000). Served from a cached line-offset
+// index that is extended in place as append-only files grow.
+func FileRange(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		http.Error(w, `{"error": "path parameter required"}`, http.StatusBadRequest)
+		return
+	}
+	path = expandPath(path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "file not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, `{"error": "path is a directory"}`, http.StatusBadRequest)
+		return
+	}
+	size := info.Size()
+
+	intParam := func(name string, def int64) (int64, error) {
+		v := q.Get(name)
+		if v == "" {
+			return def, nil
+		}
+		return strconv.ParseInt(v, 10, 64)
+	}
+
+	resp := map[string]interface{}{
+		"path":     path,
+		"fileSize": size,
+		"modified": info.ModTime().Format(time.RFC3339),
+	}
+
+	var charset string
+	var start, end int64
+	if q.Get("line") != "" {
+		line, err := intParam("line", 1)
+		if err != nil || line == 0 {
+			http.Error(w, `{"error": "line must be a non-zero integer"}`, http.StatusBadRequest)
+			return
+		}
+		count, err := intParam("count", defaultRangeLines)
+		if err != nil || count <= 0 || count > maxRangeLines {
+			http.Error(w, fmt.Sprintf(`{"error": "count must be between 1 and %d"}`, maxRangeLines), http.StatusBadRequest)
+			return
+		}
+
+		idx, err := getLineIndex(path, file, info)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to index file: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		idx.mu.Lock()
+		total := int64(idx.lineCount())
+		if line < 0 {
+			line = max(1, total+line+1)
+		}
+		first := min(line-1, total)
+		last := min(first+count, total)
+		start = idx.size
+		if first < total {
+			start = idx.starts[first]
+		}
+		end = idx.size
+		if last < total {
+			end = idx.starts[last]
+		}
+		charset = idx.charset
+		idx.mu.Unlock()
+
+		resp["startLine"] = first + 1
+		resp["lineCount"] = last - first
+		resp["totalLines"] = total
+		if last < total {
+			resp["nextLine"] = last + 1
+		}
+	} else {
+		offset, err := intParam("offset", 0)
+		if err != nil || offset < 0 {
+			http.Error(w, `{"error": "invalid offset"}`, http.StatusBadRequest)
+			return
+		}
+		length, err := intParam("length", defaultRangeBytes)
+		if err != nil || length <= 0 || length > maxRangeBytes {
+			http.Error(w, fmt.Sprintf(`{"error": "length must be between 1 and %d"}`, maxRangeBytes), http.StatusBadRequest)
+			return
+		}
+
+		sample := make([]byte, min(charsetSampleSize, size))
+		file.ReadAt(sample, 0)
+		charset = utils.DetectCharset(sample)
+		start, end = alignRange(file, charset, offset, offset+length, size)
+	}
+
+	data := make([]byte, end-start)
+	if _, err := file.ReadAt(data, start); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to read file: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	resp["encoding"] = charset
+	resp["content"] = utils.DecodeText(data, charset)
+	resp["offset"] = start
+	resp["length"] = end - start
+	resp["nextOffset"] = end
+	resp["eof"] = end >= size
+
+	json.NewEncoder(w).Encode(resp)
+}
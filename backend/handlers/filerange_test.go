@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type rangeResponse struct {
+	Content    string `json:"content"`
+	Encoding   string `json:"encoding"`
+	Offset     int64  `json:"offset"`
+	Length     int64  `json:"length"`
+	NextOffset int64  `json:"nextOffset"`
+	EOF        bool   `json:"eof"`
+	StartLine  int64  `json:"startLine"`
+	LineCount  int64  `json:"lineCount"`
+	TotalLines int64  `json:"totalLines"`
+	NextLine   int64  `json:"nextLine"`
+}
+
+func getFileRange(t *testing.T, params url.Values) rangeResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/files/range?"+params.Encode(), nil)
+	rr := httptest.NewRecorder()
+	FileRange(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp rangeResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return resp
+}
+
+// ---- FileRange tests ----
+
+func TestFileRange_Lines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0644)
+
+	resp := getFileRange(t, url.Values{"path": {path}, "line": {"2"}, "count": {"2"}})
+	if resp.Content != "two\nthree\n" || resp.TotalLines != 4 || resp.NextLine != 4 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	resp = getFileRange(t, url.Values{"path": {path}, "line": {"-1"}})
+	if resp.Content != "four\n" || resp.StartLine != 4 {
+		t.Errorf("expected last line, got %+v", resp)
+	}
+}
+
+func TestFileRange_IndexExtendsOnAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	os.WriteFile(path, []byte("{\"a\":1}\n"), 0644)
+
+	if resp := getFileRange(t, url.Values{"path": {path}, "line": {"1"}}); resp.TotalLines != 1 {
+		t.Fatalf("expected 1 line, got %d", resp.TotalLines)
+	}
+
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("{\"b\":2}\n{\"c\":3}")
+	f.Close()
+
+	resp := getFileRange(t, url.Values{"path": {path}, "line": {"2"}})
+	if resp.TotalLines != 3 || resp.Content != "{\"b\":2}\n{\"c\":3}" {
+		t.Errorf("index was not extended after append: %+v", resp)
+	}
+
+	// A rewrite that keeps the size growing must not reuse stale offsets
+	os.WriteFile(path, []byte("x\ny\nz\nlonger than before\n"), 0644)
+	resp = getFileRange(t, url.Values{"path": {path}, "line": {"3"}, "count": {"1"}})
+	if resp.Content != "z\n" || resp.TotalLines != 4 {
+		t.Errorf("index was not rebuilt after rewrite: %+v", resp)
+	}
+}
+
+func TestFileRange_BytesDoNotSplitRunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.md")
+	os.WriteFile(path, []byte("aé€b"), 0644) // a(1) é(2) €(3) b(1)
+
+	// Offset 2 is inside é and 5 inside €; both edges move back to rune starts
+	resp := getFileRange(t, url.Values{"path": {path}, "offset": {"2"}, "length": {"3"}})
+	if resp.Content != "é" || resp.Offset != 1 || resp.NextOffset != 3 {
+		t.Errorf("unexpected range %+v", resp)
+	}
+}
+
+func TestFileRange_UTF16(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export.txt")
+	// "hi\nĊ\n" in UTF-16LE with BOM; U+010A contains a 0x0A byte that is not a newline
+	os.WriteFile(path, []byte("\xff\xfeh\x00i\x00\n\x00\x0a\x01\n\x00"), 0644)
+
+	resp := getFileRange(t, url.Values{"path": {path}, "line": {"2"}})
+	if resp.Encoding != "utf-16le" || resp.Content != "Ċ\n" || resp.TotalLines != 2 {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
+func TestFileContent_TooLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "huge.log")
+	os.WriteFile(path, []byte(strings.Repeat("x", maxFileContentSize+1)), 0644)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/files/content?path="+url.QueryEscape(path), nil)
+	rr := httptest.NewRecorder()
+	FileContent(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rr.Body.String(), `"tooLarge":true`) {
+		t.Errorf("expected 413 tooLarge, got %d: %.200s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestFileContent_DecodesWindows1252(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.txt")
+	os.WriteFile(path, []byte("caf\xe9\n"), 0644)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/files/content?path="+url.QueryEscape(path), nil)
+	rr := httptest.NewRecorder()
+	FileContent(rr, req)
+
+	var resp struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Content != "café\n" || resp.Encoding != "windows-1252" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
@@ -4,13 +4,16 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"markdown-themes-backend/auth"
@@ -59,80 +62,72 @@ func FileTree(w http.ResponseWriter, r *http.Request) {
 
 	showHidden := r.URL.Query().Get("showHidden") == "true"
 
-	tree := buildFileTree(path, info.Name(), depth, showHidden)
+	realParent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		realParent = filepath.Dir(path)
+	}
+
+	tree := buildFileTree(path, info.Name(), depth, showHidden, realParent, make(map[dirKey]bool))
 	json.NewEncoder(w).Encode(tree)
 }
 
-func buildFileTree(path string, name string, depth int, showHidden bool) models.FileTreeNode {
-	info, err := os.Lstat(path)
-	if err != nil {
+// buildFileTree eagerly builds the tree below path. realParent is the
+// symlink-resolved parent directory and visited the directories already
+// listed anywhere in the walk; a symlinked directory leading back to either
+// is marked as a loop rather than listed again.
+func buildFileTree(path string, name string, depth int, showHidden bool, realParent string, visited map[dirKey]bool) models.FileTreeNode {
+	node, ok := treeEntryNode(path, realParent)
+	if !ok {
 		return models.FileTreeNode{
 			Name: name,
 			Path: path,
 			Type: "file",
 		}
 	}
+	node.Name = name
 
-	isSymlink := info.Mode()&os.ModeSymlink != 0
-	isDir := info.IsDir()
-
-	// If symlink, resolve to check if it's a directory
-	if isSymlink {
-		resolved, err := os.Stat(path)
-		if err == nil {
-			isDir = resolved.IsDir()
+	// Only recurse if depth > 0
+	if node.Type == "directory" && depth > 0 && !node.SymlinkLoop {
+		if info, err := os.Stat(path); err == nil {
+			key := dirKeyOf(path, info)
+			node.SymlinkLoop = node.IsSymlink && visited[key]
+			visited[key] = true
 		}
 	}
-
-	node := models.FileTreeNode{
-		Name:      name,
-		Path:      path,
-		Type:      "file",
-		IsSymlink: isSymlink,
-		Icon:      utils.GetFileIcon(name, isDir, isSymlink, path),
-	}
-
-	if isDir {
-		node.Type = "directory"
-
-		// Check if git repo
-		if utils.IsGitRepo(path) {
-			node.IsGitRepo = true
-			node.GitBranch = utils.GetGitBranch(path)
-			// Check if dirty (has uncommitted changes)
-			node.GitDirty = isGitDirty(path)
-		}
-
-		// Only recurse if depth > 0
-		if depth > 0 {
-			entries, err := os.ReadDir(path)
-			if err == nil {
-				var children []models.FileTreeNode
-				for _, entry := range entries {
-					// Skip hidden files unless showHidden is true
-					if !showHidden && strings.HasPrefix(entry.Name(), ".") {
-						continue
-					}
-
-					childPath := filepath.Join(path, entry.Name())
-					childNode := buildFileTree(childPath, entry.Name(), depth-1, showHidden)
-					children = append(children, childNode)
+	if node.Type == "directory" && depth > 0 && !node.SymlinkLoop {
+		realPath := resolvedPath(path)
+		entries, err := os.ReadDir(path)
+		if err == nil {
+			// Claim the real subdirectories before descending, so links to
+			// them from deeper in the tree are the ones cut short
+			for _, entry := range entries {
+				if !entry.IsDir() || (!showHidden && strings.HasPrefix(entry.Name(), ".")) {
+					continue
+				}
+				if info, err := entry.Info(); err == nil {
+					visited[dirKeyOf(filepath.Join(path, entry.Name()), info)] = true
 				}
+			}
 
-				// Sort: directories first, then alphabetically
-				sort.Slice(children, func(i, j int) bool {
-					if children[i].Type != children[j].Type {
-						return children[i].Type == "directory"
-					}
-					return strings.ToLower(children[i].Name) < strings.ToLower(children[j].Name)
-				})
+			var children []models.FileTreeNode
+			for _, entry := range entries {
+				// Skip hidden files unless showHidden is true
+				if !showHidden && strings.HasPrefix(entry.Name(), ".") {
+					continue
+				}
 
-				node.Children = children
+				childPath := filepath.Join(path, entry.Name())
+				childNode := buildFileTree(childPath, entry.Name(), depth-1, showHidden, realPath, visited)
+				children = append(children, childNode)
 			}
+
+			sortTreeNodes(children, "name", false)
+			node.Children = children
 		}
-	} else {
-		node.Size = info.Size()
-		node.Modified = info.ModTime().Format(time.RFC3339)
+	}
+	if node.Type == "directory" {
+		// Directory mtimes were never part of this response
+		node.Modified = ""
 	}
 
 	return node
@@ -182,23 +177,259 @@ func FileContent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Huge files would freeze the viewer; they are paged via /api/files/range
+	if info.Size() > maxFileContentSize {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    fmt.Sprintf("file too large to open in full (%d bytes); use /api/files/range", info.Size()),
+			"tooLarge": true,
+			"fileSize": info.Size(),
+			"maxSize":  maxFileContentSize,
+		})
+		return
+	}
+
 	content, err := os.ReadFile(path)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error": "failed to read file: %s"}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
 
+	// Hash stays over the raw bytes so write conflict checks still match
 	response := models.FileContent{
 		Path:     path,
-		Content:  string(content),
 		FileName: filepath.Base(path),
 		FileSize: info.Size(),
 		Modified: info.ModTime().Format(time.RFC3339),
+		Hash:     utils.ContentHash(content),
 	}
+	decodeFileText(&response, content)
+
+	// Boost this file in quick-open results
+	GetPathIndex().MarkOpened(path)
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// decodeFileText sets fc's Content to the file's text as UTF-8, with its
+// charset when not plain UTF-8 and whether it had a byte order mark
+func decodeFileText(fc *models.FileContent, content []byte) {
+	charset := utils.DetectCharset(content)
+	bomLen := utils.BOMLength(charset)
+	fc.Content = utils.DecodeText(content[bomLen:], charset)
+	fc.BOM = bomLen > 0
+	if charset != utils.CharsetUTF8 {
+		fc.Encoding = charset
+	}
+}
+
+// FileWriteRequest is the body for POST /api/files/write.
+// ExpectedHash / ExpectedModified come from the last FileContent read; when
+// either is set and the file on disk no longer matches, the write is rejected.
+// Encoding and BOM, also from FileContent, write the text back as it was
+// stored rather than as UTF-8.
+type FileWriteRequest struct {
+	Path             string `json:"path"`
+	Content          string `json:"content"`
+	Encoding         string `json:"encoding,omitempty"`
+	BOM              bool   `json:"bom,omitempty"`
+	Mode             string `json:"mode,omitempty"` // "overwrite" (default) or "append"
+	ExpectedHash     string `json:"expectedHash,omitempty"`
+	ExpectedModified string `json:"expectedModified,omitempty"`
+	CreateDirs       bool   `json:"createDirs,omitempty"`
+}
+
+// fileWriteLocks serializes writes per path so the conflict check and the
+// rename happen as one step from the point of view of other requests. Entries
+// are reference counted and dropped by the last holder, so the map only
+// holds paths being written.
+var fileWriteLocks = struct {
+	sync.Mutex
+	paths map[string]*fileWriteLock
+}{paths: make(map[string]*fileWriteLock)}
+
+type fileWriteLock struct {
+	mu   sync.Mutex
+	refs int // Holders and waiters
+}
+
+func lockFileForWrite(path string) func() {
+	fileWriteLocks.Lock()
+	l := fileWriteLocks.paths[path]
+	if l == nil {
+		l = &fileWriteLock{}
+		fileWriteLocks.paths[path] = l
+	}
+	l.refs++
+	fileWriteLocks.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		fileWriteLocks.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(fileWriteLocks.paths, path)
+		}
+		fileWriteLocks.Unlock()
+	}
+}
+
+// expandPath expands a leading ~ and cleans the path.
+func expandPath(path string) string {
+	if strings.HasPrefix(path, "~") {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+	return filepath.Clean(path)
+}
+
+// FileWrite handles POST /api/files/write - writes a file atomically (temp file
+// + rename), or appends to it when mode is "append". Returns 409 with the
+// current content if the file changed since the client's last read.
+func FileWrite(w http.ResponseWriter, r *http.Request) {
+	var req FileWriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
+		http.Error(w, `{"error": "path parameter required"}`, http.StatusBadRequest)
+		return
+	}
+
+	path := expandPath(req.Path)
+	if !filepath.IsAbs(path) {
+		http.Error(w, `{"error": "path must be absolute"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Mode != "" && req.Mode != "overwrite" && req.Mode != "append" {
+		http.Error(w, `{"error": "mode must be overwrite or append"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch req.Encoding {
+	case "", utils.CharsetUTF8, utils.CharsetUTF8BOM, utils.CharsetUTF16LE, utils.CharsetUTF16BE, utils.CharsetWindows1252:
+	default:
+		http.Error(w, `{"error": "unsupported encoding"}`, http.StatusBadRequest)
+		return
+	}
+	data, err := utils.EncodeText(req.Content, req.Encoding)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "content cannot be encoded: %s"}`, err.Error()), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if req.CreateDirs {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to create directory: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	unlock := lockFileForWrite(path)
+	defer unlock()
+
+	info, statErr := os.Stat(path)
+	if statErr == nil && info.IsDir() {
+		http.Error(w, `{"error": "path is a directory"}`, http.StatusBadRequest)
+		return
+	}
+
+	if req.Mode == "append" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to open file: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to append to file: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		writeFileResult(w, path)
+		return
+	}
+
+	// Stale-write detection against the version the client last read
+	if req.ExpectedHash != "" || req.ExpectedModified != "" {
+		if statErr != nil {
+			if !os.IsNotExist(statErr) {
+				http.Error(w, fmt.Sprintf(`{"error": "failed to stat file: %s"}`, statErr.Error()), http.StatusInternalServerError)
+				return
+			}
+			// File was deleted since the client read it
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":    "file was deleted since it was last read",
+				"conflict": true,
+			})
+			return
+		}
+
+		current, err := os.ReadFile(path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to read file: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		hash := utils.ContentHash(current)
+		modified := info.ModTime().Format(time.RFC3339)
+
+		if (req.ExpectedHash != "" && req.ExpectedHash != hash) ||
+			(req.ExpectedHash == "" && req.ExpectedModified != modified) {
+			currentContent := models.FileContent{
+				Path:     path,
+				FileName: filepath.Base(path),
+				FileSize: info.Size(),
+				Modified: modified,
+				Hash:     hash,
+			}
+			decodeFileText(&currentContent, current)
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":    "file changed since it was last read",
+				"conflict": true,
+				"current":  currentContent,
+			})
+			return
+		}
+	}
+
+	if req.BOM {
+		data = append(utils.ByteOrderMark(req.Encoding), data...)
+	}
+	if err := utils.WriteFileAtomic(path, data, 0644); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to write file: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	writeFileResult(w, path)
+}
+
+// writeFileResult responds with the post-write metadata so the client can use
+// the new hash as the expected version for its next write.
+func writeFileResult(w http.ResponseWriter, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to read back file: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to stat file: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"path":     path,
+		"fileSize": info.Size(),
+		"modified": info.ModTime().Format(time.RFC3339),
+		"hash":     utils.ContentHash(data),
+	})
+}
+
 // GitStatus handles GET /api/files/git-status
 func GitStatus(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
@@ -218,7 +449,7 @@ func GitStatus(w http.ResponseWriter, r *http.Request) {
 	path = filepath.Clean(path)
 
 	// Find git root
-	gitRoot := findGitRoot(path)
+	gitRoot := FindGitRoot(path)
 	if gitRoot == "" {
 		json.NewEncoder(w).Encode(models.GitStatusResponse{
 			IsGitRepo: false,
@@ -227,26 +458,31 @@ func GitStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Run git status --porcelain
-	cmd := exec.Command("git", "-C", gitRoot, "status", "--porcelain")
+	json.NewEncoder(w).Encode(ComputeGitStatus(gitRoot))
+}
+
+// ComputeGitStatus runs git status --porcelain in the repository at gitRoot.
+// Also used by the file watcher to push status when the repo changes, so it
+// must not refresh the index itself: that write would trigger another run.
+func ComputeGitStatus(gitRoot string) models.GitStatusResponse {
+	cmd := exec.Command("git", "--no-optional-locks", "-C", gitRoot, "status", "--porcelain")
 	output, err := cmd.Output()
 	if err != nil {
-		json.NewEncoder(w).Encode(models.GitStatusResponse{
+		return models.GitStatusResponse{
 			IsGitRepo: true,
 			Files:     make(map[string]models.GitStatusInfo),
-		})
-		return
+		}
 	}
 
-	files := parseGitStatus(string(output), gitRoot)
-
-	json.NewEncoder(w).Encode(models.GitStatusResponse{
+	return models.GitStatusResponse{
 		IsGitRepo: true,
-		Files:     files,
-	})
+		Files:     parseGitStatus(string(output), gitRoot),
+	}
 }
 
-func findGitRoot(path string) string {
+// FindGitRoot returns the nearest directory at or above path containing a
+// .git directory, or "" when path is not inside a repository
+func FindGitRoot(path string) string {
 	current := path
 	for {
 		if utils.IsGitRepo(current) {
@@ -369,20 +605,46 @@ func FileRaw(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read file and write bytes directly (avoid http.ServeFile redirect behavior)
-	data, err := os.ReadFile(path)
+	if r.URL.Query().Get("download") == "true" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(path)}))
+	}
+	serveFileContent(w, r, path, "public, max-age=3600")
+}
+
+// serveFileContent streams a file from disk via http.ServeContent, which
+// handles Range (206), If-None-Match/If-Modified-Since (304) and HEAD. The
+// ETag is derived from size and mtime, so it changes whenever the file does.
+// Used instead of http.ServeFile to avoid its index.html redirect behavior.
+func serveFileContent(w http.ResponseWriter, r *http.Request, path, cacheControl string) {
+	file, err := os.Open(path)
 	if err != nil {
 		http.Error(w, "failed to read file", http.StatusInternalServerError)
 		return
 	}
+	defer file.Close()
 
-	ext := filepath.Ext(path)
-	mime := mimeTypeFromExt(ext)
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
 
-	w.Header().Set("Content-Type", mime)
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-	w.Write(data)
+	w.Header().Set("Content-Type", detectContentType(path, file))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	w.Header().Set("Cache-Control", cacheControl)
+	http.ServeContent(w, r, filepath.Base(path), info.ModTime(), file)
+}
+
+// detectContentType uses the extension when known and otherwise sniffs the
+// first 512 bytes. The file offset is restored afterwards.
+func detectContentType(path string, file *os.File) string {
+	if ct := mimeTypeFromExt(filepath.Ext(path)); ct != "application/octet-stream" {
+		return ct
+	}
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	file.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
 }
 
 // mimeTypeFromExt returns the MIME type for common media file extensions.
@@ -404,6 +666,13 @@ func mimeTypeFromExt(ext string) string {
 		".wav":  "audio/wav",
 		".ogg":  "audio/ogg",
 		".flac": "audio/flac",
+		".m4a":  "audio/mp4",
+		".aac":  "audio/aac",
+		".opus": "audio/ogg",
+		".mkv":  "video/x-matroska",
+		".m4v":  "video/mp4",
+		".ogv":  "video/ogg",
+		".pdf":  "application/pdf",
 		// Web content types
 		".html": "text/html",
 		".htm":  "text/html",
@@ -462,22 +731,27 @@ func ServeFile(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		http.Error(w, "failed to read file", http.StatusInternalServerError)
-		return
-	}
+	serveFileContent(w, r, filePath, "no-cache")
+}
 
-	ext := filepath.Ext(filePath)
-	mime := mimeTypeFromExt(ext)
+// maxMediaDataURISize caps the files FileMedia still inlines as data URIs.
+// Anything larger (and all video/audio) should be streamed from rawUrl.
+const maxMediaDataURISize = 2 * 1024 * 1024
 
-	w.Header().Set("Content-Type", mime)
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Write(data)
+// requestOrigin returns the scheme and host the request was addressed to, so
+// URLs handed back to clients on another origin (the Vite dev server) still
+// reach this server
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
 }
 
-// FileMedia handles GET /api/files/media - serves images, video, audio as base64 data URIs
+// FileMedia handles GET /api/files/media - describes images, video and audio.
+// Returns rawUrl (an absolute, Range-capable streaming URL) and, for small
+// images only, a base64 dataUri for backwards compatibility.
 func FileMedia(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Query().Get("path")
 	if path == "" {
@@ -506,19 +780,29 @@ func FileMedia(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read file
-	data, err := os.ReadFile(path)
+	file, err := os.Open(path)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error": "failed to read file: %s"}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
+	defer file.Close()
+	contentType := detectContentType(path, file)
 
-	// Build data URI
-	ext := filepath.Ext(path)
-	mime := mimeTypeFromExt(ext)
-	dataUri := fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
+	response := map[string]interface{}{
+		"rawUrl":   requestOrigin(r) + "/api/files/raw?path=" + url.QueryEscape(path),
+		"mimeType": contentType,
+		"size":     info.Size(),
+		"modified": info.ModTime().Format(time.RFC3339),
+	}
 
-	json.NewEncoder(w).Encode(map[string]string{
-		"dataUri": dataUri,
-	})
+	if strings.HasPrefix(contentType, "image/") && info.Size() <= maxMediaDataURISize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, fmt.Sprintf(`{"error": "failed to read file: %s"}`, err.Error()), http.StatusInternalServerError)
+			return
+		}
+		response["dataUri"] = fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(data))
+	}
+
+	json.NewEncoder(w).Encode(response)
 }
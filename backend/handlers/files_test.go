@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"markdown-themes-backend/utils"
+)
+
+func postFileWrite(t *testing.T, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/files/write", strings.NewReader(string(data)))
+	rr := httptest.NewRecorder()
+	FileWrite(rr, req)
+	return rr
+}
+
+// ---- FileWrite tests ----
+
+func TestFileWrite_CreatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "note.md")
+
+	rr := postFileWrite(t, map[string]interface{}{"path": path, "content": "# hello\n"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "# hello\n" {
+		t.Errorf("unexpected file content %q (err %v)", data, err)
+	}
+}
+
+func TestFileWrite_PreservesMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.sh")
+	os.WriteFile(path, []byte("echo old\n"), 0755)
+
+	rr := postFileWrite(t, map[string]interface{}{"path": path, "content": "echo new\n"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("expected mode 0755 to be preserved, got %o", info.Mode().Perm())
+	}
+}
+
+func TestFileWrite_ConflictOnStaleHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	os.WriteFile(path, []byte("original"), 0644)
+	staleHash := utils.ContentHash([]byte("original"))
+
+	// Someone else edits the file after our read
+	os.WriteFile(path, []byte("edited by claude"), 0644)
+
+	rr := postFileWrite(t, map[string]interface{}{
+		"path":         path,
+		"content":      "my edit",
+		"expectedHash": staleHash,
+	})
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rr.Code)
+	}
+
+	var resp struct {
+		Current struct {
+			Content string `json:"content"`
+		} `json:"current"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+	if resp.Current.Content != "edited by claude" {
+		t.Errorf("conflict response should carry current content, got %q", resp.Current.Content)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "edited by claude" {
+		t.Error("conflicting write must not modify the file")
+	}
+}
+
+func TestFileWrite_MatchingHashSucceeds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	os.WriteFile(path, []byte("original"), 0644)
+
+	rr := postFileWrite(t, map[string]interface{}{
+		"path":         path,
+		"content":      "updated",
+		"expectedHash": utils.ContentHash([]byte("original")),
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+}
+
+func TestFileWrite_AppendMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	os.WriteFile(path, []byte("a\n"), 0644)
+
+	for _, line := range []string{"b\n", "c\n"} {
+		rr := postFileWrite(t, map[string]interface{}{"path": path, "content": line, "mode": "append"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "a\nb\nc\n" {
+		t.Errorf("expected appended content, got %q", data)
+	}
+}
+
+func TestFileWrite_ConcurrentAppendsReleaseLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	os.WriteFile(path, nil, 0644)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			postFileWrite(t, map[string]interface{}{"path": path, "content": "line\n", "mode": "append"})
+		}()
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(path)
+	if strings.Count(string(data), "line\n") != 20 {
+		t.Errorf("expected 20 appended lines, got %q", data)
+	}
+	fileWriteLocks.Lock()
+	_, held := fileWriteLocks.paths[path]
+	fileWriteLocks.Unlock()
+	if held {
+		t.Error("expected the write lock to be dropped once released")
+	}
+}
+
+// ---- FileRaw tests ----
+
+func getFileRaw(t *testing.T, path string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/files/raw?path="+url.QueryEscape(path), nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	FileRaw(rr, req)
+	return rr
+}
+
+func TestFileWrite_RoundTripsEncoding(t *testing.T) {
+	cases := []struct {
+		name     string
+		original []byte
+		want     []byte
+	}{
+		{"utf-16le", []byte("\xff\xfe\xe9\x00h\x00"), []byte("\xff\xfe\xe9\x00h\x00!\x00")},
+		{"utf-8 bom", []byte("\xef\xbb\xbf\xc3\xa9h"), []byte("\xef\xbb\xbf\xc3\xa9h!")},
+		{"windows-1252", []byte("\xe9h"), []byte("\xe9h!")},
+	}
+	for _, c := range cases {
+		path := filepath.Join(t.TempDir(), "legacy.txt")
+		os.WriteFile(path, c.original, 0644)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/files/content?path="+url.QueryEscape(path), nil)
+		rr := httptest.NewRecorder()
+		FileContent(rr, req)
+		var read struct {
+			Content  string `json:"content"`
+			Encoding string `json:"encoding"`
+			BOM      bool   `json:"bom"`
+			Hash     string `json:"hash"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &read)
+		if read.Content != "éh" {
+			t.Errorf("%s: read %q", c.name, read.Content)
+		}
+
+		rr = postFileWrite(t, map[string]interface{}{
+			"path":         path,
+			"content":      read.Content + "!",
+			"encoding":     read.Encoding,
+			"bom":          read.BOM,
+			"expectedHash": read.Hash,
+		})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", c.name, rr.Code, rr.Body.String())
+		}
+		if data, _ := os.ReadFile(path); string(data) != string(c.want) {
+			t.Errorf("%s: wrote %q, want %q", c.name, data, c.want)
+		}
+	}
+}
+
+func TestFileWrite_RejectsUnencodableContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.txt")
+	os.WriteFile(path, []byte("h\xe9"), 0644)
+
+	rr := postFileWrite(t, map[string]interface{}{"path": path, "content": "h😀", "encoding": "windows-1252"})
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", rr.Code)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "h\xe9" {
+		t.Errorf("file changed to %q", data)
+	}
+}
+
+func TestFileRaw_RangeRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	os.WriteFile(path, []byte("0123456789"), 0644)
+
+	rr := getFileRaw(t, path, map[string]string{"Range": "bytes=2-5"})
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("expected 206, got %d", rr.Code)
+	}
+	if rr.Body.String() != "2345" {
+		t.Errorf("expected body 2345, got %q", rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("unexpected Content-Range %q", got)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "video/mp4" {
+		t.Errorf("unexpected Content-Type %q", got)
+	}
+}
+
+func TestFileRaw_ConditionalGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.png")
+	os.WriteFile(path, []byte("not really a png"), 0644)
+
+	first := getFileRaw(t, path, nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("expected 200 with ETag and Last-Modified, got %d %v", first.Code, first.Header())
+	}
+
+	second := getFileRaw(t, path, map[string]string{"If-None-Match": etag})
+	if second.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %d", second.Code)
+	}
+}
+
+func TestFileRaw_SniffsUnknownExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.blob")
+	os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n0000"), 0644)
+
+	rr := getFileRaw(t, path, nil)
+	if got := rr.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("expected sniffed image/png, got %q", got)
+	}
+	if !strings.HasPrefix(rr.Body.String(), "\x89PNG") {
+		t.Errorf("body should be served from the start after sniffing")
+	}
+}
+
+// ---- FileMedia tests ----
+
+func TestFileMedia_ReturnsAbsoluteRawURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	os.WriteFile(path, []byte("not really a video"), 0644)
+
+	for _, base := range []string{"http://localhost:8130", "https://notes.example.com"} {
+		req := httptest.NewRequest(http.MethodGet, base+"/api/files/media?path="+url.QueryEscape(path), nil)
+		rr := httptest.NewRecorder()
+		FileMedia(rr, req)
+
+		var resp map[string]interface{}
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if want := base + "/api/files/raw?path=" + url.QueryEscape(path); resp["rawUrl"] != want {
+			t.Errorf("got rawUrl %v, want %s", resp["rawUrl"], want)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"markdown-themes-backend/models"
+	"markdown-themes-backend/utils"
+)
+
+const (
+	defaultChildrenLimit = 500
+	maxChildrenLimit     = 5000
+	// How long a computed git dirty flag is served from cache
+	gitDirtyCacheTTL = 15 * time.Second
+	// Concurrent background `git status` runs
+	gitDirtyWorkers = 4
+)
+
+// gitDirtyEntry caches the result of a background `git status --porcelain`
+type gitDirtyEntry struct {
+	dirty     bool
+	checkedAt time.Time
+}
+
+var (
+	gitDirtyCache    = make(map[string]gitDirtyEntry)
+	gitDirtyInFlight = make(map[string]bool)
+	gitDirtyMu       sync.Mutex
+	gitDirtySem      = make(chan struct{}, gitDirtyWorkers)
+)
+
+// gitDirtyStatus returns the cached dirty flag for a repo. When there is no
+// fresh value it queues a background check, whose result is pushed to
+// watching clients as a "git-dirty" message, and returns known=false.
+func gitDirtyStatus(repoPath string) (dirty bool, known bool) {
+	gitDirtyMu.Lock()
+	defer gitDirtyMu.Unlock()
+
+	entry, ok := gitDirtyCache[repoPath]
+	if ok && time.Since(entry.checkedAt) < gitDirtyCacheTTL {
+		return entry.dirty, true
+	}
+	if !gitDirtyInFlight[repoPath] {
+		gitDirtyInFlight[repoPath] = true
+		go refreshGitDirty(repoPath)
+	}
+	// A stale value is still better than nothing while the refresh runs
+	return entry.dirty, false
+}
+
+func refreshGitDirty(repoPath string) {
+	gitDirtySem <- struct{}{}
+	dirty := isGitDirty(repoPath)
+	<-gitDirtySem
+
+	gitDirtyMu.Lock()
+	prev, hadPrev := gitDirtyCache[repoPath]
+	now := time.Now()
+	gitDirtyCache[repoPath] = gitDirtyEntry{dirty: dirty, checkedAt: now}
+	delete(gitDirtyInFlight, repoPath)
+	evictStaleGitDirty(now)
+	gitDirtyMu.Unlock()
+
+	// Clients already showed the stale value; only push when it changed or is new
+	if hadPrev && prev.dirty == dirty {
+		return
+	}
+	if workspaceNotifyFunc != nil {
+		workspaceNotifyFunc([]string{repoPath}, map[string]interface{}{
+			"type":  "git-dirty",
+			"path":  repoPath,
+			"dirty": dirty,
+		})
+	}
+}
+
+// evictStaleGitDirty drops cached flags past their TTL, so repositories no
+// longer being browsed don't stay in the cache. Caller holds gitDirtyMu.
+func evictStaleGitDirty(now time.Time) {
+	for path, entry := range gitDirtyCache {
+		if now.Sub(entry.checkedAt) >= gitDirtyCacheTTL && !gitDirtyInFlight[path] {
+			delete(gitDirtyCache, path)
+		}
+	}
+}
+
+// symlinkLoops reports whether the symlinked directory at path resolves to
+// dir itself or one of its ancestors, which would recurse forever when
+// expanded. realDir is dir with symlinks already resolved.
+func symlinkLoops(path, realDir string) (target string, loop bool) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", false
+	}
+	if target == realDir || strings.HasPrefix(realDir, target+string(filepath.Separator)) || target == "/" {
+		return target, true
+	}
+	return target, false
+}
+
+// dirKey identifies a directory however it was reached, so a walk can
+// remember where it has been. path is only set where there are no inodes.
+type dirKey struct {
+	dev, ino uint64
+	path     string
+}
+
+// resolvedPath returns path with symlinks resolved, or path itself on error
+func resolvedPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// treeEntryNode builds the node for one directory entry without descending
+// into it. realDir is the resolved parent directory, used for loop detection.
+func treeEntryNode(path, realDir string) (models.FileTreeNode, bool) {
+	name := filepath.Base(path)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return models.FileTreeNode{}, false
+	}
+
+	isSymlink := info.Mode()&os.ModeSymlink != 0
+	isDir := info.IsDir()
+	node := models.FileTreeNode{
+		Name:      name,
+		Path:      path,
+		Type:      "file",
+		IsSymlink: isSymlink,
+		Modified:  info.ModTime().Format(time.RFC3339),
+	}
+
+	if isSymlink {
+		if resolved, err := os.Stat(path); err == nil {
+			isDir = resolved.IsDir()
+			info = resolved
+			node.Modified = resolved.ModTime().Format(time.RFC3339)
+		}
+		if isDir {
+			node.SymlinkTarget, node.SymlinkLoop = symlinkLoops(path, realDir)
+		}
+	}
+	node.Icon = utils.GetFileIcon(name, isDir, isSymlink, path)
+
+	if isDir {
+		node.Type = "directory"
+		if !node.SymlinkLoop && utils.IsGitRepo(path) {
+			node.IsGitRepo = true
+			node.GitBranch = utils.GetGitBranch(path)
+			dirty, known := gitDirtyStatus(path)
+			node.GitDirty = dirty
+			node.GitDirtyPending = !known
+		}
+	} else {
+		node.Size = info.Size()
+	}
+	return node, true
+}
+
+// sortTreeNodes orders nodes directories-first, then by mode ("name",
+// "mtime", "size" or "type"), falling back to name for ties.
+func sortTreeNodes(nodes []models.FileTreeNode, mode string, desc bool) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Type != b.Type {
+			return a.Type == "directory"
+		}
+
+		var cmp int
+		switch mode {
+		case "mtime":
+			cmp = strings.Compare(a.Modified, b.Modified)
+		case "size":
+			switch {
+			case a.Size < b.Size:
+				cmp = -1
+			case a.Size > b.Size:
+				cmp = 1
+			}
+		case "type":
+			cmp = strings.Compare(strings.ToLower(filepath.Ext(a.Name)), strings.ToLower(filepath.Ext(b.Name)))
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		}
+		if desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+// FileChildren handles GET /api/files/children - lists one directory level
+// for the expand-on-demand tree.
+//
+// Query params: path (required), root (workspace root for .gitignore
+// lookup, defaults to path), showHidden, gitignore ("true" hides ignored
+// entries), sort (name|mtime|size|type), order (asc|desc), limit, cursor.
+// The response's nextCursor is passed back as cursor for the next page.
+func FileChildren(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		http.Error(w, `{"error": "path parameter required"}`, http.StatusBadRequest)
+		return
+	}
+	path = expandPath(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "path not found: %s"}`, err.Error()), http.StatusNotFound)
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, `{"error": "path is not a directory"}`, http.StatusBadRequest)
+		return
+	}
+
+	sortMode := q.Get("sort")
+	switch sortMode {
+	case "":
+		sortMode = "name"
+	case "name", "mtime", "size", "type":
+	default:
+		http.Error(w, `{"error": "sort must be name, mtime, size or type"}`, http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultChildrenLimit
+	if l := q.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = min(parsed, maxChildrenLimit)
+		}
+	}
+	offset := 0
+	if c := q.Get("cursor"); c != "" {
+		parsed, err := strconv.Atoi(c)
+		if err != nil || parsed < 0 {
+			http.Error(w, `{"error": "invalid cursor"}`, http.StatusBadRequest)
+			return
+		}
+		offset = parsed
+	}
+
+	showHidden := q.Get("showHidden") == "true"
+	var ignore *utils.IgnoreMatcher
+	if q.Get("gitignore") == "true" {
+		root := path
+		if rt := q.Get("root"); rt != "" {
+			root = expandPath(rt)
+		}
+		ignore = utils.NewIgnoreMatcher(root)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "failed to read directory: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	realDir, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		realDir = path
+	}
+
+	// Filter on names first so only the requested page pays for Lstat, unless
+	// the sort key needs metadata for every entry
+	needsInfo := sortMode == "mtime" || sortMode == "size"
+	kept := make([]os.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !showHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ignore != nil && ignore.IsIgnored(filepath.Join(path, name), entry.IsDir()) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	var children []models.FileTreeNode
+	total := len(kept)
+	if needsInfo {
+		all := make([]models.FileTreeNode, 0, len(kept))
+		for _, entry := range kept {
+			if node, ok := treeEntryNode(filepath.Join(path, entry.Name()), realDir); ok {
+				all = append(all, node)
+			}
+		}
+		sortTreeNodes(all, sortMode, q.Get("order") == "desc")
+		total = len(all)
+		if offset < len(all) {
+			children = all[offset:min(offset+limit, len(all))]
+		}
+	} else {
+		// Name and type order only need the entry type, which ReadDir already has
+		light := make([]models.FileTreeNode, 0, len(kept))
+		for _, entry := range kept {
+			name := entry.Name()
+			nodeType := "file"
+			if entry.IsDir() {
+				nodeType = "directory"
+			} else if entry.Type()&os.ModeSymlink != 0 {
+				if resolved, err := os.Stat(filepath.Join(path, name)); err == nil && resolved.IsDir() {
+					nodeType = "directory"
+				}
+			}
+			light = append(light, models.FileTreeNode{Name: name, Type: nodeType})
+		}
+		sortTreeNodes(light, sortMode, q.Get("order") == "desc")
+		if offset < len(light) {
+			for _, l := range light[offset:min(offset+limit, len(light))] {
+				if node, ok := treeEntryNode(filepath.Join(path, l.Name), realDir); ok {
+					children = append(children, node)
+				}
+			}
+		}
+	}
+	if children == nil {
+		children = []models.FileTreeNode{}
+	}
+
+	resp := map[string]interface{}{
+		"path":     path,
+		"children": children,
+		"total":    total,
+	}
+	if next := offset + limit; next < total {
+		resp["nextCursor"] = strconv.Itoa(next)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"markdown-themes-backend/models"
+)
+
+type childrenResponse struct {
+	Children   []models.FileTreeNode `json:"children"`
+	Total      int                   `json:"total"`
+	NextCursor string                `json:"nextCursor"`
+}
+
+func getChildren(t *testing.T, params url.Values) childrenResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/files/children?"+params.Encode(), nil)
+	rr := httptest.NewRecorder()
+	FileChildren(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp childrenResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return resp
+}
+
+func childNames(nodes []models.FileTreeNode) []string {
+	names := make([]string, len(nodes))
+	for i, n := range nodes {
+		names[i] = n.Name
+	}
+	return names
+}
+
+// ---- FileChildren tests ----
+
+func TestFileChildren_PaginatesWithCursor(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.md", "d.md", "e.md"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "zdir"), 0755)
+
+	var all []string
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		params := url.Values{"path": {dir}, "limit": {"2"}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		resp := getChildren(t, params)
+		if resp.Total != 6 {
+			t.Fatalf("expected total 6, got %d", resp.Total)
+		}
+		all = append(all, childNames(resp.Children)...)
+		cursor = resp.NextCursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	want := []string{"zdir", "a.md", "b.md", "c.md", "d.md", "e.md"}
+	if len(all) != len(want) {
+		t.Fatalf("expected %v, got %v", want, all)
+	}
+	for i := range want {
+		if all[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, all)
+		}
+	}
+}
+
+func TestFileChildren_SortBySizeDesc(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "small.txt"), []byte("1"), 0644)
+	os.WriteFile(filepath.Join(dir, "large.txt"), []byte("1234567890"), 0644)
+	os.WriteFile(filepath.Join(dir, "medium.txt"), []byte("12345"), 0644)
+
+	resp := getChildren(t, url.Values{"path": {dir}, "sort": {"size"}, "order": {"desc"}})
+	names := childNames(resp.Children)
+	if len(names) != 3 || names[0] != "large.txt" || names[2] != "small.txt" {
+		t.Errorf("unexpected order %v", names)
+	}
+}
+
+func TestFileChildren_Gitignore(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("dist/\n*.log\n"), 0644)
+	os.Mkdir(filepath.Join(dir, "dist"), 0755)
+	os.WriteFile(filepath.Join(dir, "debug.log"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("x"), 0644)
+
+	resp := getChildren(t, url.Values{"path": {dir}, "gitignore": {"true"}})
+	names := childNames(resp.Children)
+	if len(names) != 1 || names[0] != "README.md" {
+		t.Errorf("expected only README.md, got %v", names)
+	}
+
+	resp = getChildren(t, url.Values{"path": {dir}})
+	if resp.Total != 3 {
+		t.Errorf("expected 3 entries without gitignore filtering, got %d", resp.Total)
+	}
+}
+
+func TestFileChildren_DetectsSymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	os.Mkdir(sub, 0755)
+	if err := os.Symlink(dir, filepath.Join(sub, "back")); err != nil {
+		t.Skip("symlinks not supported")
+	}
+	os.Symlink(filepath.Join(dir, "other"), filepath.Join(sub, "dangling"))
+
+	resp := getChildren(t, url.Values{"path": {sub}})
+	for _, n := range resp.Children {
+		switch n.Name {
+		case "back":
+			if !n.SymlinkLoop || n.Type != "directory" {
+				t.Errorf("expected back to be a looping directory, got %+v", n)
+			}
+		case "dangling":
+			if n.SymlinkLoop {
+				t.Errorf("dangling link should not be marked as a loop")
+			}
+		}
+	}
+
+	// The eager tree must stop at the loop instead of recursing to depth
+	tree := buildFileTree(dir, "root", 10, false, filepath.Dir(dir), make(map[dirKey]bool))
+	for _, child := range tree.Children {
+		if child.Name != "sub" {
+			continue
+		}
+		for _, grandchild := range child.Children {
+			if grandchild.Name == "back" && len(grandchild.Children) > 0 {
+				t.Errorf("expected looping symlink to have no children")
+			}
+		}
+	}
+}
+
+func TestBuildFileTree_StopsAtCyclesBetweenSiblings(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "a"), 0755)
+	os.MkdirAll(filepath.Join(dir, "b"), 0755)
+	os.WriteFile(filepath.Join(dir, "b", "file.txt"), []byte("x"), 0644)
+	// Neither link points at an ancestor of itself, but together they cycle
+	if err := os.Symlink(filepath.Join(dir, "b"), filepath.Join(dir, "a", "to-b")); err != nil {
+		t.Skip("symlinks not supported")
+	}
+	os.Symlink(filepath.Join(dir, "a"), filepath.Join(dir, "b", "to-a"))
+	os.Symlink(filepath.Join(dir, "b"), filepath.Join(dir, "current"))
+
+	var count func(n models.FileTreeNode) int
+	count = func(n models.FileTreeNode) int {
+		total := 1
+		for _, c := range n.Children {
+			total += count(c)
+		}
+		return total
+	}
+	tree := buildFileTree(dir, "root", 10, false, filepath.Dir(dir), make(map[dirKey]bool))
+
+	// root, a, a/to-b, b, b/file.txt, b/to-a and current, each listed once
+	if got := count(tree); got != 7 {
+		t.Errorf("expected 7 nodes, got %d", got)
+	}
+	for _, child := range tree.Children {
+		switch child.Name {
+		case "b":
+			if child.SymlinkLoop || len(child.Children) != 2 {
+				t.Errorf("expected the real directory b to be listed, got %+v", child)
+			}
+		case "current":
+			if !child.SymlinkLoop || len(child.Children) != 0 {
+				t.Errorf("expected the link to b to be cut short, got %+v", child)
+			}
+		}
+	}
+}
+
+func TestRefreshGitDirty_EvictsStaleEntries(t *testing.T) {
+	repo := t.TempDir()
+	gitDirtyMu.Lock()
+	gitDirtyCache["/stale-repo"] = gitDirtyEntry{checkedAt: time.Now().Add(-2 * gitDirtyCacheTTL)}
+	gitDirtyCache["/fresh-repo"] = gitDirtyEntry{dirty: true, checkedAt: time.Now()}
+	gitDirtyMu.Unlock()
+	t.Cleanup(func() {
+		gitDirtyMu.Lock()
+		delete(gitDirtyCache, "/fresh-repo")
+		delete(gitDirtyCache, repo)
+		gitDirtyMu.Unlock()
+	})
+
+	refreshGitDirty(repo)
+
+	gitDirtyMu.Lock()
+	defer gitDirtyMu.Unlock()
+	if _, ok := gitDirtyCache["/stale-repo"]; ok {
+		t.Error("expected the stale entry to be evicted")
+	}
+	if _, ok := gitDirtyCache["/fresh-repo"]; !ok {
+		t.Error("expected the fresh entry to be kept")
+	}
+	if _, ok := gitDirtyCache[repo]; !ok {
+		t.Error("expected the refreshed repo to be cached")
+	}
+}
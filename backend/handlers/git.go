@@ -275,7 +275,7 @@ func GitGraph(w http.ResponseWriter, r *http.Request) {
 	path = filepath.Clean(path)
 
 	// Find git root
-	gitRoot := findGitRoot(path)
+	gitRoot := FindGitRoot(path)
 	if gitRoot == "" {
 		http.Error(w, `{"error": "not a git repository"}`, http.StatusBadRequest)
 		return
@@ -398,7 +398,7 @@ func GitCommitDetails(w http.ResponseWriter, r *http.Request) {
 
 	path = filepath.Clean(path)
 
-	gitRoot := findGitRoot(path)
+	gitRoot := FindGitRoot(path)
 	if gitRoot == "" {
 		http.Error(w, `{"error": "not a git repository"}`, http.StatusBadRequest)
 		return
@@ -563,14 +563,14 @@ func GitDiff(w http.ResponseWriter, r *http.Request) {
 	base := r.URL.Query().Get("base") // Commit hash or "HEAD"
 	file := r.URL.Query().Get("file") // Optional specific file
 
-	gitRoot := findGitRoot(path)
+	gitRoot := FindGitRoot(path)
 
 	// If path itself isn't inside a git repo but a file param was given,
 	// try finding the git root from the full file path (handles workspace
 	// roots that contain multiple sub-repos).
 	if gitRoot == "" && file != "" {
 		fullFilePath := filepath.Join(path, file)
-		gitRoot = findGitRoot(fullFilePath)
+		gitRoot = FindGitRoot(fullFilePath)
 		if gitRoot != "" {
 			// Recalculate the relative file path from the discovered git root
 			rel, err := filepath.Rel(gitRoot, fullFilePath)
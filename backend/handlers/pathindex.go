@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"markdown-themes-backend/utils"
+)
+
+const (
+	// Indexes for roots that no workspace watch keeps current are rebuilt
+	// when older than this
+	pathIndexStaleAfter = 30 * time.Second
+	// Roots no workspace watch keeps current are dropped when unused for
+	// this long, and the least recently used beyond the cap
+	pathIndexIdleAfter  = 10 * time.Minute
+	pathIndexEvictEvery = time.Minute
+	pathIndexMaxRoots   = 16
+	// Cap per root so a stray index of / can't eat all memory
+	pathIndexMaxFiles   = 500000
+	pathIndexMaxRecent  = 200
+	defaultFindLimit    = 50
+	recentOpenBoostSpan = 24 * time.Hour
+	recentOpenMaxBoost  = 40
+	basenameMatchBonus  = 24
+)
+
+// rootIndex holds the relative paths of all files under one root
+type rootIndex struct {
+	root     string
+	files    map[string]struct{}
+	live     bool // kept current by FileWatcher events
+	builtAt  time.Time
+	lastUsed time.Time
+	ignore   *utils.IgnoreMatcher
+	ready    chan struct{} // closed once the initial build finishes
+	stop     chan struct{} // closed on eviction, ending a build in progress
+}
+
+// PathIndex is an in-memory index of file paths per workspace root, used by
+// the quick-open fuzzy finder. Roots are indexed on first use; watched
+// workspaces are kept current from fsnotify events instead of re-walking.
+// Other roots are evicted once idle; a watched root's fsnotify watches stop
+// with its last workspace client (FileWatcher calls Unwatch), after which it
+// ages out like any other.
+type PathIndex struct {
+	roots  map[string]*rootIndex
+	recent map[string]time.Time // absolute path -> last opened
+	mu     sync.RWMutex
+}
+
+// FindResult is a ranked match from the path index
+type FindResult struct {
+	Path      string `json:"path"`
+	RelPath   string `json:"relPath"`
+	Name      string `json:"name"`
+	Score     int    `json:"score"`
+	Positions []int  `json:"positions"` // matched rune indices into RelPath
+}
+
+var (
+	pathIndex     *PathIndex
+	pathIndexOnce sync.Once
+)
+
+// GetPathIndex returns the singleton PathIndex
+func GetPathIndex() *PathIndex {
+	pathIndexOnce.Do(func() {
+		pathIndex = &PathIndex{
+			roots:  make(map[string]*rootIndex),
+			recent: make(map[string]time.Time),
+		}
+		go pathIndex.evictLoop()
+	})
+	return pathIndex
+}
+
+// Watch marks root as kept current by fsnotify events and builds its index in
+// the background if needed. Called when a workspace watch starts.
+func (pi *PathIndex) Watch(root string) {
+	idx := pi.ensureRoot(root, false)
+	pi.mu.Lock()
+	idx.live = true
+	pi.mu.Unlock()
+}
+
+// Unwatch marks root as no longer receiving events, so the next lookup
+// rebuilds it if stale and it is evicted once idle.
+func (pi *PathIndex) Unwatch(root string) {
+	pi.mu.Lock()
+	if idx, ok := pi.roots[root]; ok {
+		idx.live = false
+		idx.lastUsed = time.Now()
+	}
+	pi.mu.Unlock()
+}
+
+// evictLoop periodically drops roots that have been idle too long
+func (pi *PathIndex) evictLoop() {
+	ticker := time.NewTicker(pathIndexEvictEvery)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		pi.mu.Lock()
+		pi.evictIdle(time.Now(), "")
+		pi.mu.Unlock()
+	}
+}
+
+// evictIdle drops unwatched roots unused since pathIndexIdleAfter, then the
+// least recently used ones beyond pathIndexMaxRoots, never keep. Caller holds
+// pi.mu for writing.
+func (pi *PathIndex) evictIdle(now time.Time, keep string) {
+	for root, idx := range pi.roots {
+		if root != keep && !idx.live && now.Sub(idx.lastUsed) > pathIndexIdleAfter {
+			pi.evict(idx)
+		}
+	}
+	for len(pi.roots) > pathIndexMaxRoots {
+		var oldest *rootIndex
+		for root, idx := range pi.roots {
+			if root != keep && !idx.live && (oldest == nil || idx.lastUsed.Before(oldest.lastUsed)) {
+				oldest = idx
+			}
+		}
+		if oldest == nil {
+			return // Everything left is watched
+		}
+		pi.evict(oldest)
+	}
+}
+
+// evict removes idx and stops its build if one is running. Caller holds pi.mu.
+func (pi *PathIndex) evict(idx *rootIndex) {
+	delete(pi.roots, idx.root)
+	close(idx.stop)
+	log.Printf("[PathIndex] Evicted idle index for %s", idx.root)
+}
+
+// ensureRoot returns the index for root, starting a build when missing or
+// stale. With wait=true it blocks until the build completes.
+func (pi *PathIndex) ensureRoot(root string, wait bool) *rootIndex {
+	pi.mu.Lock()
+	idx, ok := pi.roots[root]
+	rebuild := !ok
+	if ok && !idx.live && time.Since(idx.builtAt) > pathIndexStaleAfter {
+		select {
+		case <-idx.ready:
+			rebuild = true
+		default:
+			// Already building
+		}
+	}
+	if rebuild {
+		idx = &rootIndex{
+			root:   root,
+			files:  make(map[string]struct{}),
+			ignore: utils.NewIgnoreMatcher(root),
+			ready:  make(chan struct{}),
+			stop:   make(chan struct{}),
+		}
+		pi.roots[root] = idx
+		go pi.build(idx)
+	}
+	idx.lastUsed = time.Now()
+	if rebuild {
+		pi.evictIdle(idx.lastUsed, root)
+	}
+	pi.mu.Unlock()
+
+	if wait {
+		<-idx.ready
+	}
+	return idx
+}
+
+func (pi *PathIndex) build(idx *rootIndex) {
+	start := time.Now()
+	files := make(map[string]struct{})
+	walkIndexable(idx.root, idx.root, idx.ignore, func(rel string) bool {
+		select {
+		case <-idx.stop:
+			return false
+		default:
+		}
+		files[rel] = struct{}{}
+		return len(files) < pathIndexMaxFiles
+	})
+
+	pi.mu.Lock()
+	// Merge rather than replace: events may have arrived during the walk
+	for rel := range files {
+		idx.files[rel] = struct{}{}
+	}
+	idx.builtAt = time.Now()
+	count := len(idx.files)
+	pi.mu.Unlock()
+	close(idx.ready)
+
+	log.Printf("[PathIndex] Indexed %d files under %s in %v", count, idx.root, time.Since(start).Round(time.Millisecond))
+}
+
+// walkIndexable walks dir (inside root) calling fn with each indexable file's
+// path relative to root. fn returns false to stop.
+func walkIndexable(root, dir string, ignore *utils.IgnoreMatcher, fn func(rel string) bool) {
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		if d.IsDir() {
+			if utils.ShouldIgnoreDir(d.Name()) || ignore.IsIgnored(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignore.IsIgnored(path, false) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		if !fn(filepath.ToSlash(rel)) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+}
+
+// indexesContaining returns the root indexes that cover path. Caller holds pi.mu.
+func (pi *PathIndex) indexesContaining(path string) []*rootIndex {
+	var result []*rootIndex
+	for root, idx := range pi.roots {
+		if strings.HasPrefix(path, root+string(filepath.Separator)) {
+			result = append(result, idx)
+		}
+	}
+	return result
+}
+
+// AddPath records a created file, or every file under a created directory
+func (pi *PathIndex) AddPath(path string, isDir bool) {
+	pi.mu.RLock()
+	targets := pi.indexesContaining(path)
+	pi.mu.RUnlock()
+
+	for _, idx := range targets {
+		rel, err := filepath.Rel(idx.root, path)
+		if err != nil || pathHasIgnoredDir(rel) || idx.ignore.IsIgnored(path, isDir) {
+			continue
+		}
+
+		var added []string
+		if isDir {
+			walkIndexable(idx.root, path, idx.ignore, func(r string) bool {
+				added = append(added, r)
+				return true
+			})
+		} else {
+			added = append(added, filepath.ToSlash(rel))
+		}
+
+		pi.mu.Lock()
+		for _, r := range added {
+			idx.files[r] = struct{}{}
+		}
+		pi.mu.Unlock()
+	}
+}
+
+// RemovePath drops a deleted or renamed-away file, or everything under a directory
+func (pi *PathIndex) RemovePath(path string) {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	for _, idx := range pi.indexesContaining(path) {
+		rel, err := filepath.Rel(idx.root, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if _, ok := idx.files[rel]; ok {
+			delete(idx.files, rel)
+			continue
+		}
+		// Not a file we know about, so it may have been a directory
+		prefix := rel + "/"
+		for f := range idx.files {
+			if strings.HasPrefix(f, prefix) {
+				delete(idx.files, f)
+			}
+		}
+	}
+}
+
+// pathHasIgnoredDir reports whether any directory component of rel is one
+// utils.ShouldIgnoreDir skips (e.g. a file created inside node_modules)
+func pathHasIgnoredDir(rel string) bool {
+	parts := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+	for _, part := range parts {
+		if utils.ShouldIgnoreDir(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkOpened records that a file was opened so quick-open ranks it higher
+func (pi *PathIndex) MarkOpened(path string) {
+	pi.mu.Lock()
+	defer pi.mu.Unlock()
+
+	pi.recent[path] = time.Now()
+	if len(pi.recent) > pathIndexMaxRecent {
+		var oldest string
+		var oldestTime time.Time
+		for p, t := range pi.recent {
+			if oldest == "" || t.Before(oldestTime) {
+				oldest, oldestTime = p, t
+			}
+		}
+		delete(pi.recent, oldest)
+	}
+}
+
+// recentBoost gives recently opened files a bonus that decays linearly over a day
+func recentBoost(openedAt time.Time) int {
+	age := time.Since(openedAt)
+	if age >= recentOpenBoostSpan {
+		return 0
+	}
+	return int(float64(recentOpenMaxBoost) * (1 - float64(age)/float64(recentOpenBoostSpan)))
+}
+
+// Find returns up to limit files under root ranked by fuzzy score. An empty
+// query lists recently opened files.
+func (pi *PathIndex) Find(root, query string, limit int) ([]FindResult, int) {
+	idx := pi.ensureRoot(root, true)
+
+	pi.mu.RLock()
+	files := make([]string, 0, len(idx.files))
+	for rel := range idx.files {
+		files = append(files, rel)
+	}
+	recent := make(map[string]time.Time, len(pi.recent))
+	for p, t := range pi.recent {
+		recent[p] = t
+	}
+	pi.mu.RUnlock()
+
+	query = strings.ReplaceAll(query, " ", "")
+	results := make([]FindResult, 0, limit)
+	for _, rel := range files {
+		path := filepath.Join(root, rel)
+		name := rel[strings.LastIndex(rel, "/")+1:]
+
+		var score int
+		var positions []int
+		if query == "" {
+			if _, ok := recent[path]; !ok {
+				continue
+			}
+		} else {
+			pathScore, pathPos, ok := utils.FuzzyMatch(query, rel)
+			if !ok {
+				continue
+			}
+			score, positions = pathScore, pathPos
+
+			// Prefer matches that fall entirely within the file name
+			if !strings.Contains(query, "/") {
+				if baseScore, basePos, ok := utils.FuzzyMatch(query, name); ok && baseScore+basenameMatchBonus > score {
+					offset := len([]rune(rel)) - len([]rune(name))
+					score = baseScore + basenameMatchBonus
+					positions = make([]int, len(basePos))
+					for i, p := range basePos {
+						positions[i] = p + offset
+					}
+				}
+			}
+		}
+
+		if openedAt, ok := recent[path]; ok {
+			score += recentBoost(openedAt)
+		}
+
+		results = append(results, FindResult{
+			Path:      path,
+			RelPath:   rel,
+			Name:      name,
+			Score:     score,
+			Positions: positions,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if len(results[i].RelPath) != len(results[j].RelPath) {
+			return len(results[i].RelPath) < len(results[j].RelPath)
+		}
+		return results[i].RelPath < results[j].RelPath
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, len(files)
+}
+
+// FileFind handles GET /api/files/find?root=&q=&limit= - quick-open fuzzy file finder
+func FileFind(w http.ResponseWriter, r *http.Request) {
+	root := r.URL.Query().Get("root")
+	if root == "" {
+		http.Error(w, `{"error": "root parameter required"}`, http.StatusBadRequest)
+		return
+	}
+	root = expandPath(root)
+
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		http.Error(w, `{"error": "root must be an existing directory"}`, http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultFindLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 && parsed <= 1000 {
+			limit = parsed
+		}
+	}
+
+	results, total := GetPathIndex().Find(root, r.URL.Query().Get("q"), limit)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"total":   total,
+	})
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestPathIndex() *PathIndex {
+	return &PathIndex{
+		roots:  make(map[string]*rootIndex),
+		recent: make(map[string]time.Time),
+	}
+}
+
+func TestPathIndex_Find(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "src", "components"), 0755)
+	os.WriteFile(filepath.Join(root, "src", "components", "FileTree.tsx"), []byte(""), 0644)
+	os.WriteFile(filepath.Join(root, "README.md"), []byte(""), 0644)
+
+	results, total := newTestPathIndex().Find(root, "ftree", 10)
+	if total != 2 || len(results) != 1 || results[0].RelPath != "src/components/FileTree.tsx" {
+		t.Errorf("got %d total, results %+v", total, results)
+	}
+}
+
+func TestPathIndex_EvictsIdleRoots(t *testing.T) {
+	pi := newTestPathIndex()
+	idle := pi.ensureRoot(t.TempDir(), true)
+	watched := pi.ensureRoot(t.TempDir(), true)
+	watched.live = true
+	current := pi.ensureRoot(t.TempDir(), true)
+
+	old := time.Now().Add(-2 * pathIndexIdleAfter)
+	idle.lastUsed, watched.lastUsed = old, old
+	pi.mu.Lock()
+	pi.evictIdle(time.Now(), "")
+	pi.mu.Unlock()
+
+	if _, ok := pi.roots[idle.root]; ok {
+		t.Error("expected the idle root to be evicted")
+	}
+	select {
+	case <-idle.stop:
+	default:
+		t.Error("expected the evicted root to be stopped")
+	}
+	if pi.roots[watched.root] != watched || pi.roots[current.root] != current {
+		t.Error("expected the watched and recently used roots to be kept")
+	}
+}
+
+func TestPathIndex_EvictsLeastRecentlyUsedBeyondCap(t *testing.T) {
+	pi := newTestPathIndex()
+	first := pi.ensureRoot(t.TempDir(), true)
+	first.lastUsed = time.Now().Add(-time.Minute)
+	for i := 0; i < pathIndexMaxRoots; i++ {
+		pi.ensureRoot(t.TempDir(), true)
+	}
+
+	if len(pi.roots) != pathIndexMaxRoots {
+		t.Errorf("got %d roots, want %d", len(pi.roots), pathIndexMaxRoots)
+	}
+	if _, ok := pi.roots[first.root]; ok {
+		t.Error("expected the least recently used root to be evicted")
+	}
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"markdown-themes-backend/utils"
+)
+
+const maxReplaceFiles = 5000
+
+// ReplaceRequest is the body for the replace preview and apply endpoints
+type ReplaceRequest struct {
+	Root          string   `json:"root"`
+	Query         string   `json:"query"`
+	Replacement   string   `json:"replacement"`
+	Regex         bool     `json:"regex,omitempty"`
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+	WholeWord     bool     `json:"wholeWord,omitempty"`
+	ShowHidden    bool     `json:"showHidden,omitempty"`
+	NoGitignore   bool     `json:"noGitignore,omitempty"`
+	Include       []string `json:"include,omitempty"`
+	Exclude       []string `json:"exclude,omitempty"`
+	AllowSecrets  bool     `json:"allowSecrets,omitempty"`
+
+	// Apply only: the files (and optionally edit indices) chosen from the preview
+	Files []ReplaceFileSelection `json:"files,omitempty"`
+}
+
+// ReplaceFileSelection selects edits in one file by their preview index.
+// A nil Edits list applies every edit in the file.
+type ReplaceFileSelection struct {
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Edits []int  `json:"edits,omitempty"`
+}
+
+// ReplaceEdit is a single proposed replacement. Line/Column are 1-based.
+type ReplaceEdit struct {
+	Index       int    `json:"index"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	Match       string `json:"match"`
+	Replacement string `json:"replacement"`
+	Before      string `json:"before"`
+	After       string `json:"after"`
+}
+
+// ReplaceFilePreview lists the proposed edits for one file along with the
+// content hash the apply request must echo back.
+type ReplaceFilePreview struct {
+	Path    string        `json:"path"`
+	RelPath string        `json:"relPath"`
+	Hash    string        `json:"hash"`
+	Edits   []ReplaceEdit `json:"edits"`
+}
+
+// ReplaceFileResult reports the outcome of applying edits to one file
+type ReplaceFileResult struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"` // "applied", "conflict", "refused", "error"
+	Replaced int    `json:"replaced"`
+	Hash     string `json:"hash,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (req *ReplaceRequest) searchOptions() SearchOptions {
+	return SearchOptions{
+		Root:          expandPath(req.Root),
+		Query:         req.Query,
+		Regex:         req.Regex,
+		CaseSensitive: req.CaseSensitive,
+		WholeWord:     req.WholeWord,
+		ShowHidden:    req.ShowHidden,
+		UseGitignore:  !req.NoGitignore,
+		Include:       utils.NewGlobSet(req.Include),
+		Exclude:       utils.NewGlobSet(req.Exclude),
+		MaxFileSize:   defaultSearchMaxFileSize,
+	}
+}
+
+// decodeReplaceRequest parses and validates the body, returning the compiled
+// pattern. Writes the error response and returns ok=false on failure.
+func decodeReplaceRequest(w http.ResponseWriter, r *http.Request) (req ReplaceRequest, re *regexp.Regexp, ok bool) {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		return req, nil, false
+	}
+	if req.Root == "" || req.Query == "" {
+		http.Error(w, `{"error": "root and query parameters required"}`, http.StatusBadRequest)
+		return req, nil, false
+	}
+
+	re, err := compileSearchPattern(req.searchOptions())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "invalid pattern: %s"}`, err.Error()), http.StatusBadRequest)
+		return req, nil, false
+	}
+	return req, re, true
+}
+
+// computeReplacements finds every match in content, line by line (the same
+// semantics as Search), and returns the edits plus the fully replaced content
+// restricted to the selected indices (nil selects all).
+func computeReplacements(content string, re *regexp.Regexp, replacement string, expand bool, selected map[int]bool) ([]ReplaceEdit, string) {
+	var edits []ReplaceEdit
+	var out strings.Builder
+	out.Grow(len(content))
+
+	index := 0
+	lineNo := 0
+	for _, raw := range strings.SplitAfter(content, "\n") {
+		if raw == "" {
+			continue
+		}
+		lineNo++
+
+		// Match against the line without its terminator, then restore it
+		line := strings.TrimSuffix(raw, "\n")
+		ending := raw[len(line):]
+		if strings.HasSuffix(line, "\r") {
+			line = line[:len(line)-1]
+			ending = "\r" + ending
+		}
+
+		var newLine strings.Builder
+		var preview strings.Builder
+		last := 0
+		lineEditStart := len(edits)
+		for _, loc := range re.FindAllStringSubmatchIndex(line, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			var repl string
+			if expand {
+				repl = string(re.ExpandString(nil, replacement, line, loc))
+			} else {
+				repl = replacement
+			}
+
+			edits = append(edits, ReplaceEdit{
+				Index:       index,
+				Line:        lineNo,
+				Column:      utf8.RuneCountInString(line[:loc[0]]) + 1,
+				Match:       line[loc[0]:loc[1]],
+				Replacement: repl,
+				Before:      truncatePreview(line, loc[0]),
+			})
+
+			// preview shows every edit on the line applied; newLine only the selected ones
+			preview.WriteString(line[last:loc[0]])
+			preview.WriteString(repl)
+			newLine.WriteString(line[last:loc[0]])
+			if selected == nil || selected[index] {
+				newLine.WriteString(repl)
+			} else {
+				newLine.WriteString(line[loc[0]:loc[1]])
+			}
+			last = loc[1]
+			index++
+		}
+		preview.WriteString(line[last:])
+		newLine.WriteString(line[last:])
+
+		after := truncatePreview(preview.String(), 0)
+		for i := lineEditStart; i < len(edits); i++ {
+			edits[i].After = after
+		}
+
+		out.WriteString(newLine.String())
+		out.WriteString(ending)
+	}
+
+	return edits, out.String()
+}
+
+// ReplacePreview handles POST /api/search/replace/preview - a dry run that
+// returns every proposed edit per file along with each file's content hash.
+func ReplacePreview(w http.ResponseWriter, r *http.Request) {
+	req, re, ok := decodeReplaceRequest(w, r)
+	if !ok {
+		return
+	}
+
+	opts := req.searchOptions()
+	if info, err := os.Stat(opts.Root); err != nil || !info.IsDir() {
+		http.Error(w, `{"error": "root must be an existing directory"}`, http.StatusBadRequest)
+		return
+	}
+
+	files := []ReplaceFilePreview{}
+	skippedSecrets := []string{}
+	editCount := 0
+	truncated := false
+
+	err := walkSearchableFiles(r.Context(), opts, func(path, relPath string) error {
+		data, err := os.ReadFile(path)
+		if err != nil || !re.Match(data) {
+			return nil
+		}
+
+		if utils.IsSecretsFile(filepath.Base(path)) && !req.AllowSecrets {
+			skippedSecrets = append(skippedSecrets, path)
+			return nil
+		}
+
+		edits, _ := computeReplacements(string(data), re, req.Replacement, req.Regex, nil)
+		if len(edits) == 0 {
+			return nil
+		}
+
+		files = append(files, ReplaceFilePreview{
+			Path:    path,
+			RelPath: relPath,
+			Hash:    utils.ContentHash(data),
+			Edits:   edits,
+		})
+		editCount += len(edits)
+
+		if len(files) >= maxReplaceFiles {
+			truncated = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		http.Error(w, fmt.Sprintf(`{"error": "search failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"files":          files,
+		"fileCount":      len(files),
+		"editCount":      editCount,
+		"skippedSecrets": skippedSecrets,
+		"truncated":      truncated,
+	})
+}
+
+// ReplaceApply handles POST /api/search/replace/apply - applies the selected
+// edits from a preview. Each file is only rewritten (atomically) if it is
+// inside root and its hash still matches the preview; otherwise it is
+// refused or reported as a conflict. Any conflict makes the response a 409,
+// though the other files are still applied.
+func ReplaceApply(w http.ResponseWriter, r *http.Request) {
+	req, re, ok := decodeReplaceRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(req.Files) == 0 {
+		http.Error(w, `{"error": "files parameter required"}`, http.StatusBadRequest)
+		return
+	}
+
+	root := expandPath(req.Root)
+	results := make([]ReplaceFileResult, 0, len(req.Files))
+	applied, conflicts := 0, 0
+	for _, sel := range req.Files {
+		result := applyReplaceToFile(root, sel, re, req.Replacement, req.Regex, req.AllowSecrets)
+		switch result.Status {
+		case "applied":
+			applied++
+		case "conflict":
+			conflicts++
+		}
+		results = append(results, result)
+	}
+
+	log.Printf("[Replace] %q -> %q: %d files applied, %d conflicts", req.Query, req.Replacement, applied, conflicts)
+
+	if conflicts > 0 {
+		w.WriteHeader(http.StatusConflict)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   conflicts == 0,
+		"results":   results,
+		"applied":   applied,
+		"conflicts": conflicts,
+	})
+}
+
+func applyReplaceToFile(root string, sel ReplaceFileSelection, re *regexp.Regexp, replacement string, expand, allowSecrets bool) ReplaceFileResult {
+	path := expandPath(sel.Path)
+	result := ReplaceFileResult{Path: path}
+
+	if !filepath.IsAbs(path) || sel.Hash == "" {
+		result.Status = "error"
+		result.Error = "absolute path and hash required"
+		return result
+	}
+	if !withinRoot(root, path) {
+		result.Status = "refused"
+		result.Error = "file is outside root"
+		return result
+	}
+	if utils.IsSecretsFile(filepath.Base(path)) && !allowSecrets {
+		result.Status = "refused"
+		result.Error = "file looks like it contains secrets; set allowSecrets to modify it"
+		return result
+	}
+
+	unlock := lockFileForWrite(path)
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+	if utils.ContentHash(data) != sel.Hash {
+		result.Status = "conflict"
+		result.Error = "file changed since preview"
+		return result
+	}
+
+	var selected map[int]bool
+	if sel.Edits != nil {
+		selected = make(map[int]bool, len(sel.Edits))
+		for _, i := range sel.Edits {
+			selected[i] = true
+		}
+	}
+
+	edits, newContent := computeReplacements(string(data), re, replacement, expand, selected)
+	for _, e := range edits {
+		if selected == nil || selected[e.Index] {
+			result.Replaced++
+		}
+	}
+	if result.Replaced == 0 || newContent == string(data) {
+		result.Status = "applied"
+		result.Hash = sel.Hash
+		return result
+	}
+
+	if err := utils.WriteFileAtomic(path, []byte(newContent), 0644); err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = "applied"
+	result.Hash = utils.ContentHash([]byte(newContent))
+	return result
+}
+
+// withinRoot reports whether path is inside root once symlinks in either are
+// resolved, so an apply can't be pointed, or linked, outside the search
+func withinRoot(root, path string) bool {
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return root == "/" || strings.HasPrefix(path, root+string(filepath.Separator))
+}
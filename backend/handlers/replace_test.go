@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"markdown-themes-backend/utils"
+)
+
+func TestComputeReplacements_CaptureGroups(t *testing.T) {
+	re := regexp.MustCompile(`(\w+)@example\.com`)
+	content := "alice@example.com\r\nnone here\nbob@example.com and carol@example.com"
+
+	edits, out := computeReplacements(content, re, "${1}@example.org", true, nil)
+	if len(edits) != 3 {
+		t.Fatalf("expected 3 edits, got %d", len(edits))
+	}
+	want := "alice@example.org\r\nnone here\nbob@example.org and carol@example.org"
+	if out != want {
+		t.Errorf("unexpected output:\n got %q\nwant %q", out, want)
+	}
+	if edits[2].Line != 3 || edits[2].Column != 21 {
+		t.Errorf("expected third edit at 3:21, got %d:%d", edits[2].Line, edits[2].Column)
+	}
+	if edits[1].After != "bob@example.org and carol@example.org" {
+		t.Errorf("after-preview should show the whole line replaced, got %q", edits[1].After)
+	}
+}
+
+func TestComputeReplacements_SelectedOnly(t *testing.T) {
+	re := regexp.MustCompile(`foo`)
+	_, out := computeReplacements("foo foo\nfoo\n", re, "bar", false, map[int]bool{1: true})
+	if out != "foo bar\nfoo\n" {
+		t.Errorf("expected only edit 1 applied, got %q", out)
+	}
+}
+
+func TestComputeReplacements_LiteralDollar(t *testing.T) {
+	re := regexp.MustCompile(regexp.QuoteMeta("price"))
+	_, out := computeReplacements("price", re, "$1", false, nil)
+	if out != "$1" {
+		t.Errorf("literal mode must not expand $1, got %q", out)
+	}
+}
+
+func postReplace(t *testing.T, handler http.HandlerFunc, body map[string]interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/search/replace", strings.NewReader(string(data)))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+type replaceApplyResponse struct {
+	Results   []ReplaceFileResult `json:"results"`
+	Applied   int                 `json:"applied"`
+	Conflicts int                 `json:"conflicts"`
+}
+
+func applyReplace(t *testing.T, root string, files ...ReplaceFileSelection) (int, replaceApplyResponse) {
+	t.Helper()
+	rr := postReplace(t, ReplaceApply, map[string]interface{}{
+		"root": root, "query": "foo", "replacement": "bar", "files": files, "allowSecrets": false,
+	})
+	var resp replaceApplyResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return rr.Code, resp
+}
+
+// ---- ReplaceApply tests ----
+
+func TestReplaceApply_MultipleFiles(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("foo foo\n"), 0644)
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("one foo\n"), 0644)
+
+	rr := postReplace(t, ReplacePreview, map[string]interface{}{"root": root, "query": "foo", "replacement": "bar"})
+	var preview struct {
+		Files []ReplaceFilePreview `json:"files"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &preview)
+	if len(preview.Files) != 2 {
+		t.Fatalf("expected 2 files in the preview, got %s", rr.Body.String())
+	}
+
+	var selections []ReplaceFileSelection
+	for _, f := range preview.Files {
+		sel := ReplaceFileSelection{Path: f.Path, Hash: f.Hash}
+		if filepath.Base(f.Path) == "a.txt" {
+			sel.Edits = []int{1} // Only the second foo
+		}
+		selections = append(selections, sel)
+	}
+	code, resp := applyReplace(t, root, selections...)
+	if code != http.StatusOK || resp.Applied != 2 || resp.Conflicts != 0 {
+		t.Fatalf("expected both applied, got %d %+v", code, resp)
+	}
+
+	a, _ := os.ReadFile(filepath.Join(root, "a.txt"))
+	b, _ := os.ReadFile(filepath.Join(root, "sub", "b.txt"))
+	if string(a) != "foo bar\n" || string(b) != "one bar\n" {
+		t.Errorf("got a %q, b %q", a, b)
+	}
+	for _, r := range resp.Results {
+		data, _ := os.ReadFile(r.Path)
+		if r.Hash != utils.ContentHash(data) {
+			t.Errorf("%s: expected the new hash, got %s", r.Path, r.Hash)
+		}
+	}
+}
+
+func TestReplaceApply_HashMismatch(t *testing.T) {
+	root := t.TempDir()
+	changed := filepath.Join(root, "changed.txt")
+	os.WriteFile(changed, []byte("foo\n"), 0644)
+	staleHash := utils.ContentHash([]byte("foo\n"))
+	os.WriteFile(changed, []byte("foo edited\n"), 0644)
+	other := filepath.Join(root, "other.txt")
+	os.WriteFile(other, []byte("foo\n"), 0644)
+
+	code, resp := applyReplace(t, root,
+		ReplaceFileSelection{Path: changed, Hash: staleHash},
+		ReplaceFileSelection{Path: other, Hash: utils.ContentHash([]byte("foo\n"))})
+	if code != http.StatusConflict || resp.Conflicts != 1 || resp.Results[0].Status != "conflict" {
+		t.Fatalf("expected a 409 conflict, got %d %+v", code, resp)
+	}
+	if data, _ := os.ReadFile(changed); string(data) != "foo edited\n" {
+		t.Errorf("conflicting file was modified: %q", data)
+	}
+	if data, _ := os.ReadFile(other); string(data) != "bar\n" {
+		t.Errorf("expected the other file still applied, got %q", data)
+	}
+}
+
+func TestReplaceApply_RefusesSecretsAndOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	env := filepath.Join(root, ".env")
+	os.WriteFile(env, []byte("TOKEN=foo\n"), 0644)
+	outside := filepath.Join(t.TempDir(), "outside.txt")
+	os.WriteFile(outside, []byte("foo\n"), 0644)
+	link := filepath.Join(root, "link.txt")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+	hash := utils.ContentHash([]byte("foo\n"))
+
+	_, resp := applyReplace(t, root,
+		ReplaceFileSelection{Path: env, Hash: utils.ContentHash([]byte("TOKEN=foo\n"))},
+		ReplaceFileSelection{Path: outside, Hash: hash},
+		ReplaceFileSelection{Path: link, Hash: hash},
+		ReplaceFileSelection{Path: filepath.Join(root, "..", filepath.Base(filepath.Dir(outside)), "outside.txt"), Hash: hash})
+	for _, r := range resp.Results {
+		if r.Status != "refused" {
+			t.Errorf("%s: expected refused, got %+v", r.Path, r)
+		}
+	}
+	if data, _ := os.ReadFile(env); string(data) != "TOKEN=foo\n" {
+		t.Errorf("secrets file was modified: %q", data)
+	}
+	if data, _ := os.ReadFile(outside); string(data) != "foo\n" {
+		t.Errorf("file outside root was modified: %q", data)
+	}
+}
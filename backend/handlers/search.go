@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"markdown-themes-backend/utils"
+)
+
+const (
+	defaultSearchMaxResults  = 2000
+	defaultSearchMaxFileSize = 5 * 1024 * 1024
+	searchPreviewMaxLen      = 400
+	searchProgressEvery      = 250 * time.Millisecond
+)
+
+// SearchOptions controls a workspace text search
+type SearchOptions struct {
+	Root          string
+	Query         string
+	Regex         bool
+	CaseSensitive bool
+	WholeWord     bool
+	ShowHidden    bool
+	UseGitignore  bool
+	Include       utils.GlobSet
+	Exclude       utils.GlobSet
+	ContextLines  int
+	MaxResults    int
+	MaxFileSize   int64
+}
+
+// SearchMatch is a single match within a file. Line and Column are 1-based;
+// Column counts runes, not bytes.
+type SearchMatch struct {
+	Line    int      `json:"line"`
+	Column  int      `json:"column"`
+	Length  int      `json:"length"`
+	Preview string   `json:"preview"`
+	Before  []string `json:"before,omitempty"`
+	After   []string `json:"after,omitempty"`
+}
+
+// SearchFileResult groups the matches found in one file
+type SearchFileResult struct {
+	Path    string        `json:"path"`
+	RelPath string        `json:"relPath"`
+	Matches []SearchMatch `json:"matches"`
+}
+
+// compileSearchPattern turns the query and flags into a regexp
+func compileSearchPattern(opts SearchOptions) (*regexp.Regexp, error) {
+	expr := opts.Query
+	if !opts.Regex {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if opts.WholeWord {
+		expr = `\b(?:` + expr + `)\b`
+	}
+	if !opts.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// parseSearchOptions reads search options from query parameters
+func parseSearchOptions(r *http.Request) (SearchOptions, error) {
+	q := r.URL.Query()
+	opts := SearchOptions{
+		Root:          q.Get("root"),
+		Query:         q.Get("q"),
+		Regex:         q.Get("regex") == "true",
+		CaseSensitive: q.Get("caseSensitive") == "true",
+		WholeWord:     q.Get("wholeWord") == "true",
+		ShowHidden:    q.Get("showHidden") == "true",
+		UseGitignore:  q.Get("gitignore") != "false",
+		Include:       utils.NewGlobSet(strings.Split(q.Get("include"), ",")),
+		Exclude:       utils.NewGlobSet(strings.Split(q.Get("exclude"), ",")),
+		MaxResults:    defaultSearchMaxResults,
+		MaxFileSize:   defaultSearchMaxFileSize,
+	}
+
+	if opts.Root == "" || opts.Query == "" {
+		return opts, fmt.Errorf("root and q parameters required")
+	}
+	opts.Root = expandPath(opts.Root)
+
+	if v := q.Get("context"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 10 {
+			return opts, fmt.Errorf("context must be between 0 and 10")
+		}
+		opts.ContextLines = n
+	}
+	if v := q.Get("maxResults"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return opts, fmt.Errorf("invalid maxResults")
+		}
+		opts.MaxResults = n
+	}
+	return opts, nil
+}
+
+// walkSearchableFiles calls fn for every regular text file under opts.Root that
+// passes the ignore, hidden-file and glob filters. Stops early when ctx is
+// cancelled or fn returns an error.
+func walkSearchableFiles(ctx context.Context, opts SearchOptions, fn func(path, relPath string) error) error {
+	var ignore *utils.IgnoreMatcher
+	if opts.UseGitignore {
+		ignore = utils.NewIgnoreMatcher(opts.Root)
+	}
+
+	return filepath.WalkDir(opts.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip unreadable entries
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if path == opts.Root {
+			return nil
+		}
+
+		name := d.Name()
+		hidden := strings.HasPrefix(name, ".")
+
+		if d.IsDir() {
+			if utils.ShouldIgnoreDir(name) || (hidden && !opts.ShowHidden) {
+				return filepath.SkipDir
+			}
+			if ignore != nil && ignore.IsIgnored(path, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || (hidden && !opts.ShowHidden) {
+			return nil
+		}
+		if ignore != nil && ignore.IsIgnored(path, false) {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(opts.Root, path)
+		if len(opts.Include) > 0 && !opts.Include.Match(relPath) {
+			return nil
+		}
+		if opts.Exclude.Match(relPath) {
+			return nil
+		}
+
+		if info, err := d.Info(); err != nil || info.Size() > opts.MaxFileSize {
+			return nil
+		}
+		if utils.IsBinaryFile(path) {
+			return nil
+		}
+
+		return fn(path, relPath)
+	})
+}
+
+// searchFile returns up to limit matches of re in the file at path
+func searchFile(path string, re *regexp.Regexp, contextLines, limit int) ([]SearchMatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := splitLines(data)
+	var matches []SearchMatch
+	for i, line := range lines {
+		locs := re.FindAllStringIndex(line, -1)
+		for _, loc := range locs {
+			if loc[0] == loc[1] {
+				continue // Skip empty matches (e.g. "^" or "a*")
+			}
+			m := SearchMatch{
+				Line:    i + 1,
+				Column:  utf8.RuneCountInString(line[:loc[0]]) + 1,
+				Length:  utf8.RuneCountInString(line[loc[0]:loc[1]]),
+				Preview: truncatePreview(line, loc[0]),
+			}
+			if contextLines > 0 {
+				for j := max(0, i-contextLines); j < i; j++ {
+					m.Before = append(m.Before, truncatePreview(lines[j], 0))
+				}
+				for j := i + 1; j < len(lines) && j <= i+contextLines; j++ {
+					m.After = append(m.After, truncatePreview(lines[j], 0))
+				}
+			}
+			matches = append(matches, m)
+			if len(matches) >= limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// splitLines splits file content into lines without their terminators
+func splitLines(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	return lines
+}
+
+// truncatePreview shortens very long lines (minified files) while keeping the
+// text around offset visible
+func truncatePreview(line string, offset int) string {
+	if len(line) <= searchPreviewMaxLen {
+		return line
+	}
+	start := max(0, offset-searchPreviewMaxLen/4)
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start--
+	}
+	end := min(len(line), start+searchPreviewMaxLen)
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end++
+	}
+	preview := line[start:end]
+	if start > 0 {
+		preview = "…" + preview
+	}
+	if end < len(line) {
+		preview += "…"
+	}
+	return preview
+}
+
+// Search handles GET /api/search - full-text search across a workspace,
+// streamed as SSE so results appear progressively. Closing the connection
+// (e.g. EventSource.close()) cancels the search.
+//
+// Events: {"type":"file", ...SearchFileResult}, {"type":"progress"},
+// {"type":"done"} or {"type":"error"}.
+func Search(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseSearchOptions(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	info, err := os.Stat(opts.Root)
+	if err != nil || !info.IsDir() {
+		http.Error(w, `{"error": "root must be an existing directory"}`, http.StatusBadRequest)
+		return
+	}
+
+	re, err := compileSearchPattern(opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"error": "invalid pattern: %s"}`, err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error": "streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	ctx := r.Context()
+	start := time.Now()
+	lastProgress := start
+	var eventID int64
+	send := func(data map[string]interface{}) {
+		writeSSEWithID(w, flusher, eventID, data)
+		eventID++
+	}
+
+	filesSearched, filesMatched, matchCount := 0, 0, 0
+	truncated := false
+	errLimitReached := fmt.Errorf("result limit reached")
+
+	walkErr := walkSearchableFiles(ctx, opts, func(path, relPath string) error {
+		filesSearched++
+
+		matches, err := searchFile(path, re, opts.ContextLines, opts.MaxResults-matchCount)
+		if err == nil && len(matches) > 0 {
+			filesMatched++
+			matchCount += len(matches)
+			send(map[string]interface{}{
+				"type":    "file",
+				"path":    path,
+				"relPath": relPath,
+				"matches": matches,
+			})
+		}
+
+		if matchCount >= opts.MaxResults {
+			truncated = true
+			return errLimitReached
+		}
+
+		if time.Since(lastProgress) >= searchProgressEvery {
+			lastProgress = time.Now()
+			send(map[string]interface{}{
+				"type":          "progress",
+				"filesSearched": filesSearched,
+				"matchCount":    matchCount,
+			})
+		}
+		return nil
+	})
+
+	if ctx.Err() != nil {
+		log.Printf("[Search] Cancelled after %d files: %q in %s", filesSearched, opts.Query, opts.Root)
+		return
+	}
+	if walkErr != nil && walkErr != errLimitReached {
+		send(map[string]interface{}{
+			"type":  "error",
+			"error": walkErr.Error(),
+		})
+		return
+	}
+
+	send(map[string]interface{}{
+		"type":          "done",
+		"filesSearched": filesSearched,
+		"filesMatched":  filesMatched,
+		"matchCount":    matchCount,
+		"truncated":     truncated,
+		"durationMs":    time.Since(start).Milliseconds(),
+	})
+}
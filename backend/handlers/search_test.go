@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type searchEvent struct {
+	ID   int
+	Data map[string]interface{}
+}
+
+func searchRequest(params map[string]string) *http.Request {
+	q := url.Values{}
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	return httptest.NewRequest(http.MethodGet, "/api/search?"+q.Encode(), nil)
+}
+
+// parseSSE splits a Search response body into its events, failing on frames
+// that aren't an id line followed by a data line
+func parseSSE(t *testing.T, body string) []searchEvent {
+	t.Helper()
+	var events []searchEvent
+	for _, frame := range strings.Split(strings.TrimSuffix(body, "\n\n"), "\n\n") {
+		lines := strings.Split(frame, "\n")
+		var ev searchEvent
+		if len(lines) != 2 || !strings.HasPrefix(lines[1], "data: ") {
+			t.Fatalf("malformed SSE frame %q", frame)
+		}
+		if _, err := fmt.Sscanf(lines[0], "id: %d", &ev.ID); err != nil {
+			t.Fatalf("malformed SSE id in %q", frame)
+		}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &ev.Data); err != nil {
+			t.Fatalf("malformed SSE data in %q: %v", frame, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func runSearch(t *testing.T, params map[string]string) []searchEvent {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	Search(rr, searchRequest(params))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+	return parseSSE(t, rr.Body.String())
+}
+
+// matchedFiles returns the relPaths of the file events, sorted
+func matchedFiles(events []searchEvent) []string {
+	var paths []string
+	for _, ev := range events {
+		if ev.Data["type"] == "file" {
+			paths = append(paths, ev.Data["relPath"].(string))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSearch_StreamsFilesThenDone(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.md"), []byte("needle\nhay\nneedle again"), 0644)
+	os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	os.WriteFile(filepath.Join(root, "docs", "b.md"), []byte("hay NEEDLE"), 0644)
+	os.WriteFile(filepath.Join(root, "c.md"), []byte("nothing here"), 0644)
+
+	events := runSearch(t, map[string]string{"root": root, "q": "needle"})
+
+	for i, ev := range events {
+		if ev.ID != i {
+			t.Errorf("event %d has id %d", i, ev.ID)
+		}
+	}
+	if got := matchedFiles(events); strings.Join(got, ",") != "a.md,docs/b.md" {
+		t.Errorf("unexpected matched files %v", got)
+	}
+	done := events[len(events)-1].Data
+	if done["type"] != "done" || done["filesSearched"] != float64(3) || done["filesMatched"] != float64(2) ||
+		done["matchCount"] != float64(3) || done["truncated"] != false {
+		t.Errorf("unexpected done event %v", done)
+	}
+
+	for _, ev := range events {
+		if ev.Data["relPath"] != "docs/b.md" {
+			continue
+		}
+		m := ev.Data["matches"].([]interface{})[0].(map[string]interface{})
+		if m["line"] != float64(1) || m["column"] != float64(5) || m["length"] != float64(6) || m["preview"] != "hay NEEDLE" {
+			t.Errorf("unexpected match %v", m)
+		}
+	}
+}
+
+func TestSearch_TruncatesAtMaxResults(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "c.md"} {
+		os.WriteFile(filepath.Join(root, name), []byte("foo foo"), 0644)
+	}
+
+	events := runSearch(t, map[string]string{"root": root, "q": "foo", "maxResults": "3"})
+
+	total := 0
+	for _, ev := range events {
+		if ev.Data["type"] == "file" {
+			total += len(ev.Data["matches"].([]interface{}))
+		}
+	}
+	done := events[len(events)-1].Data
+	if total != 3 || done["matchCount"] != float64(3) || done["truncated"] != true {
+		t.Errorf("got %d matches, done %v", total, done)
+	}
+	if len(matchedFiles(events)) != 2 {
+		t.Errorf("expected the search to stop in the second file, got %v", matchedFiles(events))
+	}
+}
+
+func TestSearch_ContextLines(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.md"), []byte("one\ntwo\nthree\nfour\nfive"), 0644)
+
+	events := runSearch(t, map[string]string{"root": root, "q": "three", "context": "1"})
+
+	m := events[0].Data["matches"].([]interface{})[0].(map[string]interface{})
+	before, _ := json.Marshal(m["before"])
+	after, _ := json.Marshal(m["after"])
+	if string(before) != `["two"]` || string(after) != `["four"]` {
+		t.Errorf("expected one line of context, got before %s after %s", before, after)
+	}
+
+	rr := httptest.NewRecorder()
+	Search(rr, searchRequest(map[string]string{"root": root, "q": "three", "context": "11"}))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too much context, got %d", rr.Code)
+	}
+}
+
+func TestSearch_HiddenAndGitignoreFilters(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "visible.md"), []byte("token"), 0644)
+	os.WriteFile(filepath.Join(root, ".hidden.md"), []byte("token"), 0644)
+	os.MkdirAll(filepath.Join(root, ".config"), 0755)
+	os.WriteFile(filepath.Join(root, ".config", "settings.md"), []byte("token"), 0644)
+	os.MkdirAll(filepath.Join(root, "generated"), 0755)
+	os.WriteFile(filepath.Join(root, "generated", "out.md"), []byte("token"), 0644)
+	os.WriteFile(filepath.Join(root, "debug.log"), []byte("token"), 0644)
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("generated/\n*.log\n"), 0644)
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   string
+	}{
+		{"defaults", nil, "visible.md"},
+		{"hidden", map[string]string{"showHidden": "true"}, ".config/settings.md,.hidden.md,visible.md"},
+		{"no gitignore", map[string]string{"gitignore": "false"}, "debug.log,generated/out.md,visible.md"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := map[string]string{"root": root, "q": "token"}
+			for k, v := range tt.params {
+				params[k] = v
+			}
+			if got := strings.Join(matchedFiles(runSearch(t, params)), ","); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// cancellingRecorder cancels the request once the first file result is written
+type cancellingRecorder struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (c *cancellingRecorder) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), `"type":"file"`) {
+		c.cancel()
+	}
+	return c.ResponseRecorder.Write(p)
+}
+
+func TestSearch_StopsWhenCancelled(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < 20; i++ {
+		os.WriteFile(filepath.Join(root, fmt.Sprintf("f%02d.md", i)), []byte("match"), 0644)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rr := &cancellingRecorder{httptest.NewRecorder(), cancel}
+	Search(rr, searchRequest(map[string]string{"root": root, "q": "match"}).WithContext(ctx))
+
+	events := parseSSE(t, rr.Body.String())
+	if len(events) != 1 || events[0].Data["type"] != "file" {
+		t.Errorf("expected the search to stop after the first result, got %d events", len(events))
+	}
+}
+
+func TestSearch_RejectsBadRequests(t *testing.T) {
+	root := t.TempDir()
+	tests := []map[string]string{
+		{"root": root},
+		{"root": filepath.Join(root, "missing"), "q": "x"},
+		{"root": root, "q": "(", "regex": "true"},
+		{"root": root, "q": "x", "maxResults": "0"},
+	}
+	for _, params := range tests {
+		rr := httptest.NewRecorder()
+		Search(rr, searchRequest(params))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400, got %d", params, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/webp"
+
+	"markdown-themes-backend/db"
+	"markdown-themes-backend/utils"
+)
+
+const (
+	defaultThumbnailSize = 256
+	minThumbnailSize     = 16
+	maxThumbnailSize     = 1024
+	// Total bytes of cached thumbnails kept on disk before LRU eviction
+	thumbnailCacheBudget = 256 * 1024 * 1024
+	// Refuse to decode anything larger; the original is served instead
+	maxThumbnailSourcePixels = 80 * 1000 * 1000
+	thumbnailJPEGQuality     = 85
+)
+
+// thumbnailDecodable lists the formats thumbnails can be made from: the
+// standard library's plus WebP (golang.org/x/image/webp, pure Go, which also
+// registers it with image.DecodeConfig). Others (SVG, BMP, etc.) fall back
+// to serving the original file.
+var thumbnailDecodable = map[string]bool{
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".gif":  true,
+	".webp": true,
+}
+
+type thumbnailEntry struct {
+	size     int64
+	lastUsed time.Time
+}
+
+// ThumbnailCache stores generated thumbnails under the data dir. Entries are
+// keyed by source path, mtime, size and thumbnail size, so an edited image
+// gets a new thumbnail and the stale one ages out via LRU eviction.
+type ThumbnailCache struct {
+	dir     string
+	budget  int64
+	entries map[string]*thumbnailEntry // file name -> entry
+	total   int64
+	loaded  bool
+	mu      sync.Mutex
+}
+
+var (
+	thumbnailCache     *ThumbnailCache
+	thumbnailCacheOnce sync.Once
+)
+
+// GetThumbnailCache returns the singleton ThumbnailCache
+func GetThumbnailCache() *ThumbnailCache {
+	thumbnailCacheOnce.Do(func() {
+		thumbnailCache = newThumbnailCache(filepath.Join(db.DataDir(), "thumbnails"), thumbnailCacheBudget)
+	})
+	return thumbnailCache
+}
+
+func newThumbnailCache(dir string, budget int64) *ThumbnailCache {
+	return &ThumbnailCache{
+		dir:     dir,
+		budget:  budget,
+		entries: make(map[string]*thumbnailEntry),
+	}
+}
+
+// load indexes thumbnails left by previous runs, using mtime as last use.
+// Caller holds c.mu.
+func (c *ThumbnailCache) load() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		c.entries[entry.Name()] = &thumbnailEntry{size: info.Size(), lastUsed: info.ModTime()}
+		c.total += info.Size()
+	}
+}
+
+// thumbnailKey derives the cache file name (without extension)
+func thumbnailKey(path string, info os.FileInfo, size int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d", path, info.ModTime().UnixNano(), info.Size(), size)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Lookup returns the cached thumbnail path for key, if present
+func (c *ThumbnailCache) Lookup(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+
+	for _, ext := range []string{".jpg", ".png"} {
+		name := key + ext
+		if entry, ok := c.entries[name]; ok {
+			path := filepath.Join(c.dir, name)
+			if _, err := os.Stat(path); err != nil {
+				// Removed behind our back
+				c.total -= entry.size
+				delete(c.entries, name)
+				continue
+			}
+			entry.lastUsed = time.Now()
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// Store writes a thumbnail and evicts least recently used entries until the
+// cache fits its budget again.
+func (c *ThumbnailCache) Store(key, ext string, data []byte) (string, error) {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", err
+	}
+	name := key + ext
+	path := filepath.Join(c.dir, name)
+	if err := utils.WriteFileAtomic(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.load()
+
+	if old, ok := c.entries[name]; ok {
+		c.total -= old.size
+	}
+	c.entries[name] = &thumbnailEntry{size: int64(len(data)), lastUsed: time.Now()}
+	c.total += int64(len(data))
+	c.evict(name)
+	return path, nil
+}
+
+// evict removes least recently used thumbnails while over budget, never
+// removing keep. Caller holds c.mu.
+func (c *ThumbnailCache) evict(keep string) {
+	if c.total <= c.budget {
+		return
+	}
+
+	names := make([]string, 0, len(c.entries))
+	for name := range c.entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return c.entries[names[i]].lastUsed.Before(c.entries[names[j]].lastUsed)
+	})
+
+	removed := 0
+	for _, name := range names {
+		if c.total <= c.budget {
+			break
+		}
+		if name == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		c.total -= c.entries[name].size
+		delete(c.entries, name)
+		removed++
+	}
+	log.Printf("[Thumbnail] Evicted %d thumbnails, cache now %d bytes", removed, c.total)
+}
+
+// generateThumbnail decodes the image at path and encodes a scaled copy:
+// JPEG when fully opaque, PNG when transparency must be kept.
+func generateThumbnail(path string, size int) (data []byte, ext string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	var src image.Image
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		src, err = png.Decode(file)
+	case ".jpg", ".jpeg":
+		src, err = jpeg.Decode(file)
+	case ".gif":
+		src, err = gif.Decode(file) // First frame only
+	case ".webp":
+		src, err = webp.Decode(file)
+	default:
+		return nil, "", fmt.Errorf("unsupported image format")
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	thumb := utils.ScaleImage(src, size)
+	var buf bytes.Buffer
+	if utils.IsOpaque(thumb) {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: thumbnailJPEGQuality})
+		ext = ".jpg"
+	} else {
+		err = png.Encode(&buf, thumb)
+		ext = ".png"
+	}
+	return buf.Bytes(), ext, err
+}
+
+// FileThumbnail handles GET /api/files/thumbnail?path=&size= - serves a
+// scaled copy of an image fitting a size x size box, generated on first
+// request and cached on disk. Images that are already small enough, are too
+// large to decode safely, or are in a format that can't be decoded (SVG,
+// BMP, ...) are served as-is. The X-Thumbnail header reports
+// "cached", "generated" or "original".
+func FileThumbnail(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "path parameter required", http.StatusBadRequest)
+		return
+	}
+	path = expandPath(path)
+
+	size := defaultThumbnailSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		parsed, err := strconv.Atoi(s)
+		if err != nil || parsed < minThumbnailSize || parsed > maxThumbnailSize {
+			http.Error(w, fmt.Sprintf("size must be between %d and %d", minThumbnailSize, maxThumbnailSize), http.StatusBadRequest)
+			return
+		}
+		size = parsed
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	}
+	if info.IsDir() {
+		http.Error(w, "path is a directory", http.StatusBadRequest)
+		return
+	}
+
+	serveOriginal := func() {
+		w.Header().Set("X-Thumbnail", "original")
+		serveFileContent(w, r, path, "public, max-age=3600")
+	}
+
+	if !thumbnailDecodable[strings.ToLower(filepath.Ext(path))] {
+		serveOriginal()
+		return
+	}
+
+	cache := GetThumbnailCache()
+	key := thumbnailKey(path, info, size)
+	if cached, ok := cache.Lookup(key); ok {
+		w.Header().Set("X-Thumbnail", "cached")
+		serveFileContent(w, r, cached, "public, max-age=3600")
+		return
+	}
+
+	// Check dimensions before paying for a full decode
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusInternalServerError)
+		return
+	}
+	cfg, _, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil || (cfg.Width <= size && cfg.Height <= size) || cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		serveOriginal()
+		return
+	}
+
+	// Concurrent requests for the same thumbnail (a grid of previews) wait
+	// for the first one instead of all decoding
+	unlock := lockFileForWrite(filepath.Join(cache.dir, key))
+	defer unlock()
+	if cached, ok := cache.Lookup(key); ok {
+		w.Header().Set("X-Thumbnail", "cached")
+		serveFileContent(w, r, cached, "public, max-age=3600")
+		return
+	}
+
+	data, ext, err := generateThumbnail(path, size)
+	if err != nil {
+		log.Printf("[Thumbnail] Failed to generate for %s: %v", path, err)
+		serveOriginal()
+		return
+	}
+	cached, err := cache.Store(key, ext, data)
+	if err != nil {
+		log.Printf("[Thumbnail] Failed to cache thumbnail for %s: %v", path, err)
+		serveOriginal()
+		return
+	}
+
+	w.Header().Set("X-Thumbnail", "generated")
+	serveFileContent(w, r, cached, "public, max-age=3600")
+}
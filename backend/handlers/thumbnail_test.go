@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestPNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getThumbnail(t *testing.T, path, size string) *httptest.ResponseRecorder {
+	t.Helper()
+	params := url.Values{"path": {path}, "size": {size}}
+	req := httptest.NewRequest(http.MethodGet, "/api/files/thumbnail?"+params.Encode(), nil)
+	rr := httptest.NewRecorder()
+	FileThumbnail(rr, req)
+	return rr
+}
+
+// ---- FileThumbnail tests ----
+
+func TestFileThumbnail_GeneratesThenCaches(t *testing.T) {
+	GetThumbnailCache()
+	thumbnailCache = newThumbnailCache(t.TempDir(), thumbnailCacheBudget)
+
+	path := filepath.Join(t.TempDir(), "photo.png")
+	writeTestPNG(t, path, 400, 200)
+
+	rr := getThumbnail(t, path, "100")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Thumbnail") != "generated" {
+		t.Fatalf("expected generated thumbnail, got %d %q", rr.Code, rr.Header().Get("X-Thumbnail"))
+	}
+	img, _, err := image.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("thumbnail does not decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("expected 100x50, got %dx%d", b.Dx(), b.Dy())
+	}
+
+	rr = getThumbnail(t, path, "100")
+	if rr.Header().Get("X-Thumbnail") != "cached" {
+		t.Errorf("expected second request to hit the cache, got %q", rr.Header().Get("X-Thumbnail"))
+	}
+}
+
+func TestFileThumbnail_DecodesWebP(t *testing.T) {
+	GetThumbnailCache()
+	thumbnailCache = newThumbnailCache(t.TempDir(), thumbnailCacheBudget)
+
+	path, err := filepath.Abs(filepath.Join("testdata", "blue-purple-pink.webp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := getThumbnail(t, path, "64")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Thumbnail") != "generated" {
+		t.Fatalf("expected generated thumbnail, got %d %q", rr.Code, rr.Header().Get("X-Thumbnail"))
+	}
+	img, _, err := image.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("thumbnail does not decode: %v", err)
+	}
+	if b := img.Bounds(); max(b.Dx(), b.Dy()) != 64 {
+		t.Errorf("expected the image scaled to fit 64px, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestFileThumbnail_SmallImageServedAsOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "icon.png")
+	writeTestPNG(t, path, 32, 32)
+
+	rr := getThumbnail(t, path, "256")
+	if rr.Header().Get("X-Thumbnail") != "original" {
+		t.Errorf("expected original for an image already within bounds, got %q", rr.Header().Get("X-Thumbnail"))
+	}
+}
+
+func TestThumbnailCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newThumbnailCache(t.TempDir(), 25)
+
+	cache.Store("a", ".jpg", make([]byte, 10))
+	time.Sleep(time.Millisecond)
+	cache.Store("b", ".jpg", make([]byte, 10))
+	time.Sleep(time.Millisecond)
+	cache.Lookup("a") // a is now more recent than b
+	time.Sleep(time.Millisecond)
+	cache.Store("c", ".jpg", make([]byte, 10))
+
+	if _, ok := cache.Lookup("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.Lookup(key); !ok {
+			t.Errorf("expected %s to remain cached", key)
+		}
+	}
+}
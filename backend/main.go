@@ -21,6 +21,16 @@ import (
 	"markdown-themes-backend/websocket"
 )
 
+// corsOptions lets the Vite dev server and other local origins call the API
+var corsOptions = cors.Options{
+	AllowedOrigins:   []string{"http://localhost:*", "http://127.0.0.1:*"},
+	AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+	AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Auth-Token"},
+	ExposedHeaders:   []string{"Link", "X-Output-File"},
+	AllowCredentials: true,
+	MaxAge:           300,
+}
+
 func main() {
 	// Generate per-startup auth token
 	if err := auth.Init(); err != nil {
@@ -46,19 +56,12 @@ func main() {
 	// Middleware
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:*", "http://127.0.0.1:*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Auth-Token"},
-		ExposedHeaders:   []string{"Link", "X-Output-File"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	}))
+	r.Use(cors.Handler(corsOptions))
 
 	// JSON content type for API responses (except WebSocket, SSE, and file-serving endpoints)
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path != "/ws" && r.URL.Path != "/api/files/raw" && !strings.HasPrefix(r.URL.Path, "/api/files/serve/") && !strings.HasPrefix(r.URL.Path, "/api/tts/") && !(r.URL.Path == "/api/chat" && r.Method == "POST") {
+			if r.URL.Path != "/ws" && r.URL.Path != "/api/files/raw" && r.URL.Path != "/api/files/thumbnail" && !strings.HasPrefix(r.URL.Path, "/api/files/serve/") && !strings.HasPrefix(r.URL.Path, "/api/tts/") && r.URL.Path != "/api/search" && !(r.URL.Path == "/api/chat" && r.Method == "POST") {
 				w.Header().Set("Content-Type", "application/json")
 			}
 			next.ServeHTTP(w, r)
@@ -76,18 +79,42 @@ func main() {
 
 		// Files
 		r.Get("/files/tree", handlers.FileTree)
+		r.Get("/files/children", handlers.FileChildren)
 		r.Get("/files/content", handlers.FileContent)
+		r.Get("/files/range", handlers.FileRange)
+		r.Get("/files/find", handlers.FileFind)
+		r.Post("/files/write", handlers.FileWrite)
 		r.Get("/files/git-status", handlers.GitStatus)
 		r.Get("/files/image", handlers.FileMedia)
 		r.Get("/files/video", handlers.FileMedia)
 		r.Get("/files/audio", handlers.FileMedia)
 		r.Get("/files/raw", handlers.FileRaw)
+		r.Get("/files/thumbnail", handlers.FileThumbnail)
 		r.Get("/files/serve/*", handlers.ServeFile)
 		r.Post("/files/open", handlers.FileOpen)
+		r.Get("/files/watch-status", hub.HandleWatchStatus)
+
+		// File operations
+		r.Post("/files/mkdir", handlers.FileMkdir)
+		r.Post("/files/rename", handlers.FileRename)
+		r.Post("/files/copy", handlers.FileCopy)
+		r.Post("/files/delete", handlers.FileDelete)
+		r.Get("/files/trash", handlers.TrashList)
+		r.Delete("/files/trash", handlers.TrashPurgeAll)
+		r.Post("/files/trash/{id}/restore", handlers.TrashRestore)
+		r.Delete("/files/trash/{id}", handlers.TrashPurge)
+
+		// Search
+		r.Get("/search", handlers.Search)
+		r.Post("/search/replace/preview", handlers.ReplacePreview)
+		r.Post("/search/replace/apply", handlers.ReplaceApply)
 
 		// Claude
 		r.Get("/claude/session", handlers.ClaudeSession)
 		r.Get("/claude/session/{sessionId}", handlers.ClaudeSessionByID)
+		r.Get("/claude/sessions", handlers.ClaudeSessions)
+		r.Get("/claude/projects", handlers.ClaudeProjects)
+		r.Get("/claude/panes", handlers.ClaudePanes)
 
 		// Notepad (lightweight non-streaming Claude CLI)
 		r.Post("/notepad", handlers.NotepadSend)
@@ -101,9 +128,17 @@ func main() {
 		// Conversation persistence (SQLite)
 		r.Get("/chat/conversations", handlers.ConversationsList)
 		r.Post("/chat/conversations", handlers.ConversationCreate)
+		r.Post("/chat/conversations/import", handlers.ConversationsImport)
+		r.Get("/chat/search", handlers.ChatSearch)
 		r.Get("/chat/conversations/{id}", handlers.ConversationGet)
 		r.Put("/chat/conversations/{id}", handlers.ConversationUpdate)
 		r.Delete("/chat/conversations/{id}", handlers.ConversationDelete)
+		r.Post("/chat/conversations/{id}/sync", handlers.ConversationSync)
+		r.Post("/chat/conversations/{id}/fork", handlers.ConversationFork)
+		r.Get("/chat/conversations/{id}/branches", handlers.ConversationBranches)
+		r.Post("/chat/conversations/{id}/messages", handlers.MessageAppend)
+		r.Patch("/chat/conversations/{id}/messages/{messageId}", handlers.MessagePatch)
+		r.Delete("/chat/conversations/{id}/messages/{messageId}", handlers.MessageDelete)
 
 		// Git
 		r.Get("/git/repos", handlers.GitRepos)
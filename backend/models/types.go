@@ -1,5 +1,7 @@
 package models
 
+import "encoding/json"
+
 // FileTreeNode represents a file or directory in the tree
 type FileTreeNode struct {
 	Name      string         `json:"name"`
@@ -13,6 +15,14 @@ type FileTreeNode struct {
 	GitBranch string         `json:"gitBranch,omitempty"`
 	GitDirty  bool           `json:"gitDirty,omitempty"`
 	Icon      string         `json:"icon,omitempty"`
+	// GitDirtyPending means GitDirty is not yet known; a "git-dirty"
+	// WebSocket message follows once the background check finishes
+	GitDirtyPending bool   `json:"gitDirtyPending,omitempty"`
+	SymlinkTarget   string `json:"symlinkTarget,omitempty"`
+	// SymlinkLoop marks a symlinked directory that points at one of its own
+	// ancestors, or in the eager tree at a directory listed elsewhere; its
+	// children are never listed
+	SymlinkLoop bool `json:"symlinkLoop,omitempty"`
 }
 
 // FileContent represents the content response for a single file
@@ -22,6 +32,9 @@ type FileContent struct {
 	FileName string `json:"fileName"`
 	FileSize int64  `json:"fileSize"`
 	Modified string `json:"modified"`
+	Hash     string `json:"hash,omitempty"`     // SHA-256 of content, echoed back on write for conflict detection
+	Encoding string `json:"encoding,omitempty"` // set when not plain UTF-8 (e.g. "utf-16le", "windows-1252")
+	BOM      bool   `json:"bom,omitempty"`      // file starts with a byte order mark, stripped from Content
 }
 
 // GitStatusInfo represents the status of a single file in git
@@ -109,10 +122,58 @@ type ClaudeSessionInfo struct {
 	SessionID        string `json:"sessionId"`
 	WorkingDir       string `json:"workingDir"`
 	ConversationPath string `json:"conversationPath"`
-	Pane             string `json:"pane"`
+	Pane             string `json:"pane"`                 // tmux pane ID of the claude process, if found
+	TerminalID       string `json:"terminalId,omitempty"` // mt-* terminal running it
 	Status           string `json:"status"`
 }
 
+// ClaudeSessionEvent is one normalized item from a Claude Code transcript.
+// Kind is "user", "text", "thinking", "tool_use", "tool_result" or "usage".
+type ClaudeSessionEvent struct {
+	Kind        string          `json:"kind"`
+	Offset      int64           `json:"offset"` // Byte offset of the transcript line
+	UUID        string          `json:"uuid,omitempty"`
+	Timestamp   string          `json:"timestamp,omitempty"`
+	MessageID   string          `json:"messageId,omitempty"`
+	IsSidechain bool            `json:"isSidechain,omitempty"`
+	Text        string          `json:"text,omitempty"`
+	Truncated   bool            `json:"truncated,omitempty"`
+	ToolUseID   string          `json:"toolUseId,omitempty"`
+	ToolName    string          `json:"toolName,omitempty"`
+	Input       json.RawMessage `json:"input,omitempty"`
+	IsError     bool            `json:"isError,omitempty"`
+	Model       string          `json:"model,omitempty"`
+	Usage       *ClaudeUsage    `json:"usage,omitempty"`
+}
+
+// ClaudeUsage is the token usage of one assistant message, or a session's total
+type ClaudeUsage struct {
+	InputTokens              int `json:"inputTokens"`
+	OutputTokens             int `json:"outputTokens"`
+	CacheCreationInputTokens int `json:"cacheCreationInputTokens"`
+	CacheReadInputTokens     int `json:"cacheReadInputTokens"`
+}
+
+// ClaudeSessionSummary describes one Claude Code session for the session browser
+type ClaudeSessionSummary struct {
+	SessionID        string      `json:"sessionId"`
+	ProjectDir       string      `json:"projectDir"` // Encoded directory name under ~/.claude/projects
+	WorkingDir       string      `json:"workingDir"`
+	ConversationPath string      `json:"conversationPath"`
+	Summary          string      `json:"summary,omitempty"` // Title Claude Code generated, if any
+	FirstPrompt      string      `json:"firstPrompt,omitempty"`
+	MessageCount     int         `json:"messageCount"`
+	Models           []string    `json:"models"`
+	Usage            ClaudeUsage `json:"usage"`
+	TotalTokens      int         `json:"totalTokens"`
+	CostUSD          float64     `json:"costUSD"` // Estimated from list prices
+	StartTime        string      `json:"startTime,omitempty"`
+	EndTime          string      `json:"endTime,omitempty"`
+	GitBranch        string      `json:"gitBranch,omitempty"`
+	Size             int64       `json:"size"`
+	Modified         string      `json:"modified"`
+}
+
 // GitDiffResponse represents a file diff
 type GitDiffResponse struct {
 	Diff     string `json:"diff"`
@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Charset names reported by DetectCharset
+const (
+	CharsetUTF8        = "utf-8"
+	CharsetUTF8BOM     = "utf-8-bom"
+	CharsetUTF16LE     = "utf-16le"
+	CharsetUTF16BE     = "utf-16be"
+	CharsetWindows1252 = "windows-1252"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// windows1252High maps bytes 0x80-0x9F to Unicode; the rest of the code
+// page matches Latin-1. Undefined positions map to U+FFFD.
+var windows1252High = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// DetectCharset guesses the encoding of a text sample from its byte order
+// mark, falling back to windows-1252 when the sample is not valid UTF-8.
+// A sample cut mid-character at the end is still treated as UTF-8.
+func DetectCharset(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return CharsetUTF8BOM
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return CharsetUTF16LE
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return CharsetUTF16BE
+	}
+
+	// Ignore a truncated rune at the end of the sample
+	trimmed := sample
+	for i := 0; i < utf8.UTFMax && len(trimmed) > 0; i++ {
+		if r, _ := utf8.DecodeLastRune(trimmed); r != utf8.RuneError {
+			break
+		}
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	if utf8.Valid(trimmed) {
+		return CharsetUTF8
+	}
+	return CharsetWindows1252
+}
+
+// BOMLength returns the size of the byte order mark for charset
+func BOMLength(charset string) int {
+	switch charset {
+	case CharsetUTF8BOM:
+		return len(bomUTF8)
+	case CharsetUTF16LE, CharsetUTF16BE:
+		return 2
+	}
+	return 0
+}
+
+// DecodeText converts data in the given charset to a UTF-8 string. data must
+// not include the BOM. Invalid sequences become U+FFFD.
+func DecodeText(data []byte, charset string) string {
+	switch charset {
+	case CharsetUTF16LE, CharsetUTF16BE:
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			if charset == CharsetUTF16LE {
+				units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+			} else {
+				units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+			}
+		}
+		return string(utf16.Decode(units))
+	case CharsetWindows1252:
+		var b strings.Builder
+		b.Grow(len(data))
+		for _, c := range data {
+			if c >= 0x80 && c < 0xA0 {
+				b.WriteRune(windows1252High[c-0x80])
+			} else {
+				b.WriteRune(rune(c))
+			}
+		}
+		return b.String()
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// ByteOrderMark returns the byte order mark written at the start of a file
+// in charset, or nil for charsets without one
+func ByteOrderMark(charset string) []byte {
+	switch charset {
+	case CharsetUTF8BOM:
+		return bomUTF8
+	case CharsetUTF16LE:
+		return bomUTF16LE
+	case CharsetUTF16BE:
+		return bomUTF16BE
+	}
+	return nil
+}
+
+// EncodeText converts a UTF-8 string to charset, the reverse of DecodeText.
+// The result has no BOM. It fails for characters windows-1252 lacks.
+func EncodeText(text, charset string) ([]byte, error) {
+	switch charset {
+	case CharsetUTF16LE, CharsetUTF16BE:
+		units := utf16.Encode([]rune(text))
+		data := make([]byte, 2*len(units))
+		for i, u := range units {
+			if charset == CharsetUTF16LE {
+				data[2*i], data[2*i+1] = byte(u), byte(u>>8)
+			} else {
+				data[2*i], data[2*i+1] = byte(u>>8), byte(u)
+			}
+		}
+		return data, nil
+	case CharsetWindows1252:
+		data := make([]byte, 0, len(text))
+		for _, r := range text {
+			c, ok := windows1252Byte(r)
+			if !ok {
+				return nil, fmt.Errorf("%q cannot be written as windows-1252", r)
+			}
+			data = append(data, c)
+		}
+		return data, nil
+	}
+	return []byte(text), nil
+}
+
+func windows1252Byte(r rune) (byte, bool) {
+	if r < 0x80 || (r >= 0xA0 && r <= 0xFF) {
+		return byte(r), true
+	}
+	if r != '�' {
+		for i, high := range windows1252High {
+			if high == r {
+				return byte(0x80 + i), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// HasUTF16BOM reports whether data starts with a UTF-16 byte order mark
+func HasUTF16BOM(data []byte) bool {
+	return bytes.HasPrefix(data, bomUTF16LE) || bytes.HasPrefix(data, bomUTF16BE)
+}
@@ -0,0 +1,57 @@
+package utils
+
+import "testing"
+
+func TestDetectCharset(t *testing.T) {
+	cases := []struct {
+		name   string
+		sample []byte
+		want   string
+	}{
+		{"ascii", []byte("hello"), CharsetUTF8},
+		{"utf8", []byte("héllo"), CharsetUTF8},
+		{"utf8 truncated rune", []byte("h\xc3"), CharsetUTF8},
+		{"utf8 bom", []byte("\xef\xbb\xbfhi"), CharsetUTF8BOM},
+		{"utf16le bom", []byte("\xff\xfeh\x00"), CharsetUTF16LE},
+		{"utf16be bom", []byte("\xfe\xff\x00h"), CharsetUTF16BE},
+		{"latin", []byte("caf\xe9 \x93quoted\x94"), CharsetWindows1252},
+	}
+	for _, c := range cases {
+		if got := DetectCharset(c.sample); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	if got := DecodeText([]byte("caf\xe9 \x93q\x94 \x80"), CharsetWindows1252); got != "café “q” €" {
+		t.Errorf("windows-1252: got %q", got)
+	}
+	if got := DecodeText([]byte("h\x00\xe9\x00\n\x00"), CharsetUTF16LE); got != "hé\n" {
+		t.Errorf("utf-16le: got %q", got)
+	}
+	if got := DecodeText([]byte("\x00h\xd8\x3d\xde\x00"), CharsetUTF16BE); got != "h😀" {
+		t.Errorf("utf-16be surrogate pair: got %q", got)
+	}
+}
+
+func TestEncodeText_RoundTrips(t *testing.T) {
+	text := "café “q” € h😀\n"
+	for _, charset := range []string{CharsetUTF8, CharsetUTF16LE, CharsetUTF16BE} {
+		data, err := EncodeText(text, charset)
+		if err != nil {
+			t.Fatalf("%s: %v", charset, err)
+		}
+		if got := DecodeText(data, charset); got != text {
+			t.Errorf("%s: got %q", charset, got)
+		}
+	}
+
+	data, err := EncodeText("café “q” €", CharsetWindows1252)
+	if err != nil || string(data) != "caf\xe9 \x93q\x94 \x80" {
+		t.Errorf("windows-1252: got %q (err %v)", data, err)
+	}
+	if _, err := EncodeText("h😀", CharsetWindows1252); err == nil {
+		t.Error("expected an error for a character windows-1252 lacks")
+	}
+}
@@ -0,0 +1,163 @@
+package utils
+
+import "strings"
+
+// LineHunk replaces OldLines lines starting at OldStart (0-based, in the old
+// text) with Lines. Lines keep their "\n" terminators, so applying hunks and
+// concatenating reproduces the new text exactly.
+type LineHunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	Lines    []string `json:"lines"`
+}
+
+// Bound on Myers trace memory (ints); larger diffs are reported as too big
+const maxDiffTraceCells = 20_000_000
+
+// SplitLinesKeepEnds splits text after each "\n", keeping the terminators
+func SplitLinesKeepEnds(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// DiffLines computes line hunks turning oldText into newText using Myers'
+// algorithm after trimming the common prefix and suffix. ok is false when
+// the texts differ by more than maxEdits inserted/deleted lines, in which
+// case sending the full text is cheaper anyway.
+func DiffLines(oldText, newText string, maxEdits int) (hunks []LineHunk, ok bool) {
+	a := SplitLinesKeepEnds(oldText)
+	b := SplitLinesKeepEnds(newText)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil, true
+	}
+	if n == 0 || m == 0 {
+		if n+m > maxEdits {
+			return nil, false
+		}
+		return []LineHunk{{OldStart: prefix, OldLines: n, Lines: append([]string{}, b...)}}, true
+	}
+
+	maxD := min(n+m, maxEdits)
+	if width := 2*(n+m) + 2; maxD*width > maxDiffTraceCells {
+		maxD = maxDiffTraceCells / width
+	}
+
+	offset := n + m + 1
+	v := make([]int, 2*(n+m)+3)
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Down: insertion from b
+			} else {
+				x = v[offset+k-1] + 1 // Right: deletion from a
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return myersHunks(trace, offset, a, b, d, prefix), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// myersHunks walks the Myers trace back from (len(a), len(b)) and groups the
+// edits into hunks in ascending order
+func myersHunks(trace [][]int, offset int, a, b []string, d, base int) []LineHunk {
+	type edit struct {
+		insert bool
+		x, y   int // position in a / b before the edit
+	}
+	var edits []edit
+
+	x, y := len(a), len(b)
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, edit{insert: true, x: prevX, y: prevY})
+		} else {
+			edits = append(edits, edit{insert: false, x: prevX, y: prevY})
+		}
+		x, y = prevX, prevY
+	}
+
+	// edits are newest-first; group adjacent ones into hunks
+	var hunks []LineHunk
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		var h *LineHunk
+		if len(hunks) > 0 {
+			last := &hunks[len(hunks)-1]
+			if last.OldStart-base+last.OldLines == e.x {
+				h = last
+			}
+		}
+		if h == nil {
+			hunks = append(hunks, LineHunk{OldStart: base + e.x, Lines: []string{}})
+			h = &hunks[len(hunks)-1]
+		}
+		if e.insert {
+			h.Lines = append(h.Lines, b[e.y])
+		} else {
+			h.OldLines++
+		}
+	}
+	return hunks
+}
+
+// ApplyLineHunks applies hunks produced by DiffLines to oldText
+func ApplyLineHunks(oldText string, hunks []LineHunk) string {
+	lines := SplitLinesKeepEnds(oldText)
+	var out strings.Builder
+	out.Grow(len(oldText))
+	pos := 0
+	for _, h := range hunks {
+		for ; pos < h.OldStart && pos < len(lines); pos++ {
+			out.WriteString(lines[pos])
+		}
+		for _, line := range h.Lines {
+			out.WriteString(line)
+		}
+		pos += h.OldLines
+	}
+	for ; pos < len(lines); pos++ {
+		out.WriteString(lines[pos])
+	}
+	return out.String()
+}
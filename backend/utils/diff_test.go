@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines_RoundTrip(t *testing.T) {
+	cases := []struct{ old, new string }{
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nB\nc\n"},
+		{"a\nb\nc\n", "a\nb\nc\nd\n"},
+		{"a\nb\nc", "a\nb\nc and more"},
+		{"x\na\nb\nc\ny\n", "a\nc\nz\n"},
+		{"# Title\n\nold para\n\n- item\n", "# Title\n\nnew para\nsecond line\n\n- item\n- item 2\n"},
+	}
+	for _, c := range cases {
+		hunks, ok := DiffLines(c.old, c.new, 1000)
+		if !ok {
+			t.Fatalf("diff of %q -> %q gave up", c.old, c.new)
+		}
+		if got := ApplyLineHunks(c.old, hunks); got != c.new {
+			t.Errorf("apply(%q, %+v) = %q, want %q", c.old, hunks, got, c.new)
+		}
+	}
+}
+
+func TestDiffLines_MinimalHunk(t *testing.T) {
+	hunks, _ := DiffLines("a\nb\nc\nd\n", "a\nb\nX\nd\n", 100)
+	if len(hunks) != 1 || hunks[0].OldStart != 2 || hunks[0].OldLines != 1 || len(hunks[0].Lines) != 1 || hunks[0].Lines[0] != "X\n" {
+		t.Errorf("unexpected hunks %+v", hunks)
+	}
+}
+
+func TestDiffLines_Random(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a\n", "b\n", "c\n", "d\n", "e\n"}
+	gen := func() string {
+		var b strings.Builder
+		for i := rng.Intn(30); i > 0; i-- {
+			b.WriteString(words[rng.Intn(len(words))])
+		}
+		return b.String()
+	}
+	for i := 0; i < 500; i++ {
+		old, new := gen(), gen()
+		hunks, ok := DiffLines(old, new, 1000)
+		if !ok {
+			t.Fatalf("diff gave up")
+		}
+		if got := ApplyLineHunks(old, hunks); got != new {
+			t.Fatalf("round trip failed:\nold %q\nnew %q\ngot %q\nhunks %+v", old, new, got, hunks)
+		}
+	}
+}
+
+func TestDiffLines_GivesUpOnLargeRewrites(t *testing.T) {
+	old := strings.Repeat("old line\n", 50)
+	new := strings.Repeat("new line\n", 50)
+	if _, ok := DiffLines(old, new, 20); ok {
+		t.Errorf("expected diff to give up beyond maxEdits")
+	}
+}
@@ -2,6 +2,9 @@ package utils
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -309,6 +312,11 @@ func IsBinaryFile(path string) bool {
 		return false
 	}
 
+	// UTF-16 text is full of null bytes but is still text
+	if HasUTF16BOM(buf[:n]) {
+		return false
+	}
+
 	// Check for null bytes
 	for i := 0; i < n; i++ {
 		if buf[i] == 0 {
@@ -369,3 +377,96 @@ func ShouldIgnoreDir(name string) bool {
 	}
 	return false
 }
+
+// WriteFileAtomic writes data to a temp file in the same directory and renames
+// it over path, so readers never observe a partially written file. The mode of
+// an existing file is preserved; perm is only used when creating a new one.
+// When path is a symlink the file it points at is replaced, not the link.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Remove the temp file on any failure before the rename
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	ok = true
+	return nil
+}
+
+// ContentHash returns the hex-encoded SHA-256 of data. Used as a version
+// token for stale-write detection.
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// TailOffset returns the offset where the last n lines of a file of the given
+// size begin, scanning backwards so huge files are not read in full. A
+// trailing newline does not count as an extra (empty) line.
+func TailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n <= 0 || size == 0 {
+		return size, nil
+	}
+
+	const chunkSize = 64 * 1024
+	buf := make([]byte, chunkSize)
+	end := size
+	newlines := 0
+	skipFinal := true
+	for end > 0 {
+		start := max(0, end-chunkSize)
+		chunk := buf[:end-start]
+		if _, err := r.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] != '\n' {
+				skipFinal = false
+				continue
+			}
+			if skipFinal {
+				// Newline terminating the last line
+				skipFinal = false
+				continue
+			}
+			newlines++
+			if newlines == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTailOffset(t *testing.T) {
+	cases := []struct {
+		content string
+		n       int
+		want    string
+	}{
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\nc\n", 10, "a\nb\nc\n"},
+		{"a\nb\nc\n", 0, ""},
+		{"", 3, ""},
+		{"\n\n", 1, "\n"},
+	}
+	for _, c := range cases {
+		r := strings.NewReader(c.content)
+		off, err := TailOffset(r, int64(len(c.content)), c.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.content[off:]; got != c.want {
+			t.Errorf("TailOffset(%q, %d) = %q, want %q", c.content, c.n, got, c.want)
+		}
+	}
+}
+
+func TestTailOffset_SpansChunks(t *testing.T) {
+	line := strings.Repeat("x", 50*1024) + "\n"
+	content := line + line + line
+	off, _ := TailOffset(strings.NewReader(content), int64(len(content)), 2)
+	if off != int64(len(line)) {
+		t.Errorf("expected offset %d, got %d", len(line), off)
+	}
+}
+
+func TestWriteFileAtomic_FollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real", "notes.md")
+	os.MkdirAll(filepath.Dir(target), 0755)
+	os.WriteFile(target, []byte("old"), 0600)
+	link := filepath.Join(dir, "notes.md")
+	if err := os.Symlink(filepath.Join("real", "notes.md"), link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected the link kept, got %v (err %v)", info, err)
+	}
+	data, _ := os.ReadFile(target)
+	if string(data) != "new" {
+		t.Errorf("expected the target written, got %q", data)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0600 {
+		t.Errorf("expected the target's mode kept, got %o", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected no temp files left beside the link, got %v", entries)
+	}
+}
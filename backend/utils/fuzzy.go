@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"unicode"
+)
+
+// Fuzzy scoring constants, modelled on fzf's v1 algorithm: every matched
+// character earns a base score, matches at word boundaries and in runs earn
+// bonuses (a run keeps the bonus of its first character), and gaps between
+// matched characters are penalized.
+const (
+	fuzzyScoreMatch        = 16
+	fuzzyScoreGapStart     = -3
+	fuzzyScoreGapExtension = -1
+	fuzzyBonusBoundary     = 8
+	fuzzyBonusCamel        = 7
+	fuzzyBonusConsecutive  = 4
+	fuzzyBonusFirstChar    = 2 // multiplier for a boundary bonus on the first query char
+)
+
+// FuzzyMatch scores how well query matches target as a subsequence.
+// Matching is case-insensitive unless the query contains an uppercase letter
+// (smart case). Returns ok=false when query is not a subsequence of target;
+// positions holds the matched rune indices into target.
+//
+// Like fzf's v1 this is greedy, not optimal: it scores the shortest window
+// ending at the earliest full match, taking the first occurrence of each
+// query character in it, so a later, better-aligned match (say on a word
+// boundary further right) is not considered.
+func FuzzyMatch(query, target string) (score int, positions []int, ok bool) {
+	q := []rune(query)
+	t := []rune(target)
+	if len(q) == 0 {
+		return 0, nil, true
+	}
+	if len(q) > len(t) {
+		return 0, nil, false
+	}
+
+	caseSensitive := false
+	for _, r := range q {
+		if unicode.IsUpper(r) {
+			caseSensitive = true
+			break
+		}
+	}
+	eq := func(a, b rune) bool {
+		if caseSensitive {
+			return a == b
+		}
+		return unicode.ToLower(a) == unicode.ToLower(b)
+	}
+
+	// Forward pass: find the earliest position where the whole query matches
+	qi := 0
+	end := -1
+	for ti := 0; ti < len(t); ti++ {
+		if eq(t[ti], q[qi]) {
+			qi++
+			if qi == len(q) {
+				end = ti
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	// Backward pass: walk back from the end to find the tightest window
+	qi = len(q) - 1
+	start := end
+	for ti := end; ti >= 0; ti-- {
+		if eq(t[ti], q[qi]) {
+			qi--
+			if qi < 0 {
+				start = ti
+				break
+			}
+		}
+	}
+
+	// Score the window, matching each query character at its first occurrence
+	positions = make([]int, 0, len(q))
+	qi = 0
+	inGap := false
+	consecutive := 0
+	runBonus := 0
+	for ti := start; ti <= end && qi < len(q); ti++ {
+		if !eq(t[ti], q[qi]) {
+			if len(positions) > 0 {
+				if inGap {
+					score += fuzzyScoreGapExtension
+				} else {
+					score += fuzzyScoreGapStart
+				}
+			}
+			inGap = true
+			consecutive = 0
+			continue
+		}
+
+		bonus := fuzzyCharBonus(t, ti)
+		if consecutive == 0 {
+			runBonus = bonus
+		} else {
+			// Characters in a run inherit the bonus of the run's first character
+			bonus = max(bonus, runBonus, fuzzyBonusConsecutive)
+		}
+		if qi == 0 {
+			bonus *= fuzzyBonusFirstChar
+		}
+		score += fuzzyScoreMatch + bonus
+		positions = append(positions, ti)
+		inGap = false
+		consecutive++
+		qi++
+	}
+
+	return score, positions, true
+}
+
+// fuzzyCharBonus rewards matches at the start of a word or path segment
+func fuzzyCharBonus(t []rune, i int) int {
+	if i == 0 {
+		return fuzzyBonusBoundary
+	}
+	prev, cur := t[i-1], t[i]
+	switch prev {
+	case '/', '\\', '-', '_', '.', ' ':
+		return fuzzyBonusBoundary
+	}
+	if unicode.IsLower(prev) && unicode.IsUpper(cur) {
+		return fuzzyBonusCamel
+	}
+	if !unicode.IsDigit(prev) && unicode.IsDigit(cur) {
+		return fuzzyBonusCamel
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package utils
+
+import "testing"
+
+func TestFuzzyMatch_Subsequence(t *testing.T) {
+	if _, _, ok := FuzzyMatch("fw", "websocket/filewatcher.go"); !ok {
+		t.Error("expected fw to match filewatcher")
+	}
+	if _, _, ok := FuzzyMatch("xyz", "websocket/filewatcher.go"); ok {
+		t.Error("expected xyz not to match")
+	}
+}
+
+func TestFuzzyMatch_PrefersBoundaries(t *testing.T) {
+	boundary, _, _ := FuzzyMatch("fw", "file_watcher.go")
+	inner, _, _ := FuzzyMatch("fw", "leftwing.go")
+	if boundary <= inner {
+		t.Errorf("boundary match (%d) should outscore mid-word match (%d)", boundary, inner)
+	}
+}
+
+func TestFuzzyMatch_PrefersConsecutive(t *testing.T) {
+	tight, _, _ := FuzzyMatch("hub", "hub.go")
+	loose, _, _ := FuzzyMatch("hub", "h_u_b.go")
+	if tight <= loose {
+		t.Errorf("consecutive match (%d) should outscore scattered match (%d)", tight, loose)
+	}
+}
+
+func TestFuzzyMatch_SmartCase(t *testing.T) {
+	if _, _, ok := FuzzyMatch("readme", "README.md"); !ok {
+		t.Error("lowercase query should match case-insensitively")
+	}
+	if _, _, ok := FuzzyMatch("ReadMe", "README.md"); ok {
+		t.Error("query with uppercase should match case-sensitively")
+	}
+}
+
+func TestFuzzyMatch_Positions(t *testing.T) {
+	_, pos, ok := FuzzyMatch("mdv", "src/MarkdownViewer.tsx")
+	if !ok {
+		t.Fatal("expected match")
+	}
+	want := []int{4, 8, 12}
+	for i := range want {
+		if pos[i] != want[i] {
+			t.Fatalf("positions = %v, want %v", pos, want)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ignoreFileNames are the per-directory ignore files honored by IgnoreMatcher
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+// ignoreRule is a single compiled line from a .gitignore file
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreMatcher evaluates .gitignore / .ignore rules for paths below a root.
+// Ignore files are loaded lazily per directory and cached, so one matcher can
+// be shared across a whole walk (and across goroutines).
+type IgnoreMatcher struct {
+	root  string
+	cache map[string][]ignoreRule // dir -> rules from that dir's ignore files
+	mu    sync.Mutex
+}
+
+// NewIgnoreMatcher creates a matcher rooted at root. Ignore files above root
+// are not consulted.
+func NewIgnoreMatcher(root string) *IgnoreMatcher {
+	return &IgnoreMatcher{
+		root:  filepath.Clean(root),
+		cache: make(map[string][]ignoreRule),
+	}
+}
+
+// IsIgnored reports whether path is excluded by the ignore files between the
+// matcher's root and the path's parent directory. Callers walking a tree are
+// expected to skip ignored directories, so parents are not re-checked here.
+func (m *IgnoreMatcher) IsIgnored(path string, isDir bool) bool {
+	path = filepath.Clean(path)
+	if path == m.root || !strings.HasPrefix(path, m.root+string(filepath.Separator)) {
+		return false
+	}
+
+	// Collect directories from root down to the path's parent
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == m.root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	// Deeper ignore files take precedence, so evaluate root first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range m.rulesFor(dir) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.re.MatchString(rel) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (m *IgnoreMatcher) rulesFor(dir string) []ignoreRule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rules, ok := m.cache[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	for _, name := range ignoreFileNames {
+		rules = append(rules, parseIgnoreFile(filepath.Join(dir, name))...)
+	}
+	m.cache[dir] = rules
+	return rules
+}
+
+func parseIgnoreFile(path string) []ignoreRule {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to the ignore file's dir;
+	// otherwise it matches the name at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	// A matched directory also covers everything beneath it
+	re, err := regexp.Compile("^" + expr + "(?:/.*)?$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// globToRegexp converts a gitignore-style glob (supporting *, ?, [...] and **)
+// to an unanchored regular expression over slash-separated paths.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				// "**/" matches zero or more directories; a trailing "**" matches everything
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					b.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					b.WriteString(".*")
+					i++
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// GlobSet is a compiled list of include/exclude globs such as "*.md",
+// "docs/**" or "src/**/*.ts". Patterns without a slash match against the file
+// name at any depth.
+type GlobSet []*regexp.Regexp
+
+// NewGlobSet compiles patterns, skipping empty or invalid ones
+func NewGlobSet(patterns []string) GlobSet {
+	var set GlobSet
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "./")
+		if pattern == "" {
+			continue
+		}
+		expr := globToRegexp(strings.Trim(pattern, "/"))
+		if !strings.Contains(strings.Trim(pattern, "/"), "/") {
+			expr = "(?:.*/)?" + expr
+		}
+		if re, err := regexp.Compile("^" + expr + "(?:/.*)?$"); err == nil {
+			set = append(set, re)
+		}
+	}
+	return set
+}
+
+// Match reports whether relPath (relative to the search root) matches any glob
+func (g GlobSet) Match(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, re := range g {
+		if re.MatchString(relPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreMatcher_Rules(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, ".gitignore"), []byte("# comment\n*.log\n!keep.log\n/build\ncache/\ndocs/**/draft-*.md\n"), 0644)
+	os.MkdirAll(filepath.Join(root, "pkg"), 0755)
+	os.WriteFile(filepath.Join(root, "pkg", ".gitignore"), []byte("local.txt\n"), 0644)
+
+	m := NewIgnoreMatcher(root)
+	cases := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"nested/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, false},
+		{"cache", true, true},
+		{"cache", false, false},
+		{"docs/a/b/draft-1.md", false, true},
+		{"docs/final.md", false, false},
+		{"pkg/local.txt", false, true},
+		{"local.txt", false, false},
+	}
+	for _, c := range cases {
+		got := m.IsIgnored(filepath.Join(root, c.rel), c.isDir)
+		if got != c.ignored {
+			t.Errorf("IsIgnored(%q, dir=%v) = %v, want %v", c.rel, c.isDir, got, c.ignored)
+		}
+	}
+}
+
+func TestGlobSet_Match(t *testing.T) {
+	set := NewGlobSet([]string{"*.md", "src/**/*.ts", " "})
+	cases := map[string]bool{
+		"README.md":         true,
+		"docs/guide.md":     true,
+		"src/a/b/index.ts":  true,
+		"src/index.ts":      true,
+		"lib/index.ts":      false,
+		"src/a/b/index.tsx": false,
+	}
+	for rel, want := range cases {
+		if got := set.Match(rel); got != want {
+			t.Errorf("Match(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
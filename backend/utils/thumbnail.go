@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ThumbnailBounds returns the dimensions of w x h scaled to fit inside a
+// maxSize x maxSize box, preserving aspect ratio. Images that already fit
+// are returned unchanged (never upscaled).
+func ThumbnailBounds(w, h, maxSize int) (int, int) {
+	if w <= maxSize && h <= maxSize {
+		return w, h
+	}
+	if w >= h {
+		return maxSize, max(1, h*maxSize/w)
+	}
+	return max(1, w*maxSize/h), maxSize
+}
+
+// ScaleImage downscales src to fit within maxSize using an area-averaging
+// (box) filter, which avoids the aliasing of nearest-neighbour sampling
+// without needing golang.org/x/image/draw.
+func ScaleImage(src image.Image, maxSize int) *image.NRGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dw, dh := ThumbnailBounds(sw, sh, maxSize)
+
+	// Work on a flat NRGBA copy so pixel access is cheap
+	flat, ok := src.(*image.NRGBA)
+	if !ok || sb.Min != (image.Point{}) {
+		flat = image.NewNRGBA(image.Rect(0, 0, sw, sh))
+		draw.Draw(flat, flat.Bounds(), src, sb.Min, draw.Src)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	if dw == sw && dh == sh {
+		copy(dst.Pix, flat.Pix)
+		return dst
+	}
+
+	for y := 0; y < dh; y++ {
+		y0 := y * sh / dh
+		y1 := max(y0+1, (y+1)*sh/dh)
+		for x := 0; x < dw; x++ {
+			x0 := x * sw / dw
+			x1 := max(x0+1, (x+1)*sw/dw)
+
+			// Weight colour by alpha so transparent pixels don't darken edges
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := flat.Pix[sy*flat.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					pa := uint64(p[3])
+					r += uint64(p[0]) * pa
+					g += uint64(p[1]) * pa
+					b += uint64(p[2]) * pa
+					a += pa
+					n++
+				}
+			}
+
+			var c color.NRGBA
+			if a > 0 {
+				c = color.NRGBA{R: uint8(r / a), G: uint8(g / a), B: uint8(b / a), A: uint8(a / n)}
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst
+}
+
+// IsOpaque reports whether every pixel of img is fully opaque
+func IsOpaque(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThumbnailBounds(t *testing.T) {
+	cases := []struct{ w, h, max, ww, wh int }{
+		{400, 200, 100, 100, 50},
+		{200, 400, 100, 50, 100},
+		{50, 40, 100, 50, 40}, // never upscaled
+		{10000, 1, 100, 100, 1},
+	}
+	for _, c := range cases {
+		if w, h := ThumbnailBounds(c.w, c.h, c.max); w != c.ww || h != c.wh {
+			t.Errorf("ThumbnailBounds(%d, %d, %d) = %dx%d, want %dx%d", c.w, c.h, c.max, w, h, c.ww, c.wh)
+		}
+	}
+}
+
+func TestScaleImage_AveragesPixels(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	src.SetNRGBA(1, 0, color.NRGBA{R: 255, A: 255})
+	src.SetNRGBA(0, 1, color.NRGBA{A: 255})
+	src.SetNRGBA(1, 1, color.NRGBA{A: 255})
+
+	dst := ScaleImage(src, 1)
+	if got := dst.NRGBAAt(0, 0); got.R < 120 || got.R > 135 || got.A != 255 {
+		t.Errorf("expected averaged half-red pixel, got %+v", got)
+	}
+	if !IsOpaque(dst) {
+		t.Errorf("expected opaque result")
+	}
+}
+
+func TestScaleImage_TransparentPixelsDoNotDarken(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	// (1,0) stays fully transparent black
+
+	got := ScaleImage(src, 1).NRGBAAt(0, 0)
+	if got.R != 255 || got.A != 127 {
+		t.Errorf("expected white at half alpha, got %+v", got)
+	}
+}
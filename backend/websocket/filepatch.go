@@ -0,0 +1,136 @@
+package websocket
+
+import (
+	"markdown-themes-backend/utils"
+)
+
+const (
+	// Files larger than this are always sent in full
+	maxPatchableSize = 2 * 1024 * 1024
+	// Line edits beyond which a diff is abandoned for a full resend
+	maxPatchEdits = 2000
+)
+
+// fileVersion is the content last sent for a watched file
+type fileVersion struct {
+	content string
+	version int
+}
+
+// contentUpdate describes how the content of a watched file moved from
+// baseVersion to version
+type contentUpdate struct {
+	baseVersion int
+	version     int
+	changed     bool
+	patchable   bool // hunks are valid; otherwise clients need the full content
+	hunks       []utils.LineHunk
+}
+
+// recordContent stores content as the latest version of path and diffs it
+// against the previous one. Caller holds fw.versionMu, and keeps holding it
+// while sending so messages go out in version order.
+func (fw *FileWatcher) recordContent(path, content string) contentUpdate {
+	fw.mu.Lock()
+	fv, ok := fw.fileVersions[path]
+	if !ok {
+		fv = &fileVersion{}
+		fw.fileVersions[path] = fv
+	}
+	fw.mu.Unlock()
+
+	if ok && fv.content == content {
+		return contentUpdate{baseVersion: fv.version, version: fv.version}
+	}
+
+	update := contentUpdate{
+		baseVersion: fv.version,
+		version:     fv.version + 1,
+		changed:     true,
+	}
+	if ok && len(content) <= maxPatchableSize && len(fv.content) <= maxPatchableSize {
+		if hunks, diffOK := utils.DiffLines(fv.content, content, maxPatchEdits); diffOK {
+			// A patch carrying most of the document saves nothing
+			inserted := 0
+			for _, h := range hunks {
+				for _, line := range h.Lines {
+					inserted += len(line)
+				}
+			}
+			if inserted <= len(content)/2 || len(content) < 1024 {
+				update.hunks = hunks
+				update.patchable = true
+			}
+		}
+	}
+
+	fv.content = content
+	fv.version = update.version
+	return update
+}
+
+// patchClientsFor returns the clients of path that opted into file-patch
+func (fw *FileWatcher) patchClientsFor(path string) map[*Client]bool {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	clients := make(map[*Client]bool, len(fw.patchWatchers[path]))
+	for client := range fw.patchWatchers[path] {
+		clients[client] = true
+	}
+	return clients
+}
+
+// sendPatch delivers an update to patch clients (except skip): a file-patch
+// when a diff is available, otherwise a file-change with the full content
+// taken from full.
+func (fw *FileWatcher) sendPatch(path string, clients map[*Client]bool, update contentUpdate, full map[string]interface{}, skip *Client) {
+	if !update.changed {
+		return
+	}
+
+	var message map[string]interface{}
+	if update.patchable {
+		message = map[string]interface{}{
+			"type":        "file-patch",
+			"path":        path,
+			"baseVersion": update.baseVersion,
+			"version":     update.version,
+			"hunks":       update.hunks,
+		}
+		for _, key := range []string{"modified", "size", "timestamp", "timeSinceLastChange"} {
+			if v, ok := full[key]; ok {
+				message[key] = v
+			}
+		}
+	} else {
+		message = make(map[string]interface{}, len(full))
+		for k, v := range full {
+			message[k] = v
+		}
+		message["type"] = "file-change"
+	}
+
+	for client := range clients {
+		if client != skip {
+			fw.hub.SendToClient(client, message)
+		}
+	}
+}
+
+// ResyncFile resends the full current content and version of a watched file
+// to one client, e.g. after it received a patch whose baseVersion it lacks.
+func (fw *FileWatcher) ResyncFile(path string, client *Client) {
+	fw.mu.RLock()
+	_, watching := fw.fileWatches[path][client]
+	fw.mu.RUnlock()
+	if !watching {
+		fw.hub.SendToClient(client, map[string]interface{}{
+			"type":  "file-watch-error",
+			"path":  path,
+			"error": "not watching this file",
+		})
+		return
+	}
+	go fw.sendInitialContent(path, client)
+}
@@ -0,0 +1,223 @@
+package websocket
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"markdown-themes-backend/utils"
+)
+
+const (
+	// Largest chunk sent in one file-tail-data message
+	maxTailChunk = 1024 * 1024
+	// Cap on what a reset or initial snapshot sends; older content is skipped
+	maxTailSnapshot = 4 * 1024 * 1024
+	// Bytes just before the sent offset remembered to detect rewrites
+	tailCheckLen = 64
+)
+
+// tailState tracks how much of a file one client has received
+type tailState struct {
+	offset int64
+	check  []byte // the tailCheckLen bytes before offset, as last sent
+	mu     sync.Mutex
+}
+
+// AddFileTail subscribes a client to appended data for path. The client first
+// receives the last `lines` lines (or nothing, when lines is 0 and resume is
+// nil), or everything from *resume onwards when resuming a previous tail.
+func (fw *FileWatcher) AddFileTail(path string, client *Client, lines int, resume *int64) {
+	fw.mu.Lock()
+	if fw.tails[path] == nil {
+		fw.tails[path] = make(map[*Client]*tailState)
+		if err := fw.watchPath(path, false); err != nil {
+			delete(fw.tails, path)
+			fw.mu.Unlock()
+			log.Printf("[FileWatcher] Error tailing file %s: %v", path, err)
+			fw.hub.SendToClient(client, map[string]interface{}{
+				"type":  "file-tail-error",
+				"path":  path,
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	// Locked until startTail has sent the initial range, so a change event
+	// arriving first waits rather than sending from offset 0
+	state := &tailState{}
+	state.mu.Lock()
+	fw.tails[path][client] = state
+	fw.mu.Unlock()
+
+	go fw.startTail(path, client, state, lines, resume)
+}
+
+// startTail sends a new tail's initial range. The caller locked state.mu;
+// startTail unlocks it.
+func (fw *FileWatcher) startTail(path string, client *Client, state *tailState, lines int, resume *int64) {
+	defer state.mu.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		fw.sendTailError(path, client, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		fw.sendTailError(path, client, err)
+		return
+	}
+	size := info.Size()
+
+	start := size
+	reset := true
+	if resume != nil && *resume <= size {
+		start = *resume
+		reset = false
+	} else if lines > 0 {
+		if start, err = utils.TailOffset(file, size, lines); err != nil {
+			fw.sendTailError(path, client, err)
+			return
+		}
+	}
+	start = max(start, size-maxTailSnapshot)
+
+	fw.sendTailRange(path, client, state, file, start, size, reset)
+}
+
+// handleTailChange pushes newly appended bytes to every client tailing path,
+// or a full reset when the file shrank or its already-sent bytes changed.
+func (fw *FileWatcher) handleTailChange(path string) {
+	fw.mu.RLock()
+	states := make(map[*Client]*tailState, len(fw.tails[path]))
+	for client, state := range fw.tails[path] {
+		states[client] = state
+	}
+	fw.mu.RUnlock()
+	if len(states) == 0 {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return // Removed; the remove handler reports it
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	size := info.Size()
+
+	for client, state := range states {
+		state.mu.Lock()
+		if size < state.offset || !tailCheckMatches(file, state) {
+			log.Printf("[FileWatcher] %s was truncated or rewritten, resending", path)
+			fw.sendTailRange(path, client, state, file, max(0, size-maxTailSnapshot), size, true)
+		} else if size > state.offset {
+			fw.sendTailRange(path, client, state, file, state.offset, size, false)
+		}
+		state.mu.Unlock()
+	}
+}
+
+// tailCheckMatches reports whether the bytes just before the client's offset
+// are still the ones it was sent
+func tailCheckMatches(file *os.File, state *tailState) bool {
+	if len(state.check) == 0 {
+		return true
+	}
+	buf := make([]byte, len(state.check))
+	if _, err := file.ReadAt(buf, state.offset-int64(len(buf))); err != nil {
+		return false
+	}
+	return bytes.Equal(buf, state.check)
+}
+
+// sendTailRange sends [start, end) in chunks and advances the client's
+// offset. A trailing partial UTF-8 character is held back until the rest of
+// it is written. Caller holds state.mu.
+func (fw *FileWatcher) sendTailRange(path string, client *Client, state *tailState, file *os.File, start, end int64, reset bool) {
+	for first := true; start < end || (first && reset); first = false {
+		chunkEnd := min(end, start+maxTailChunk)
+		data := make([]byte, chunkEnd-start)
+		n, err := file.ReadAt(data, start)
+		if err != nil && err != io.EOF {
+			fw.sendTailError(path, client, err)
+			return
+		}
+		data = trimPartialRune(data[:n])
+		if len(data) == 0 && !(first && reset) {
+			break
+		}
+
+		fw.hub.SendToClient(client, map[string]interface{}{
+			"type":      "file-tail-data",
+			"path":      path,
+			"offset":    start,
+			"data":      string(data),
+			"reset":     first && reset,
+			"size":      end,
+			"timestamp": time.Now().UnixMilli(),
+		})
+		start += int64(len(data))
+		state.offset = start
+	}
+
+	checkLen := min(state.offset, tailCheckLen)
+	state.check = make([]byte, checkLen)
+	file.ReadAt(state.check, state.offset-checkLen)
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(data); i++ {
+		c := data[len(data)-i]
+		if !utf8.RuneStart(c) {
+			continue
+		}
+		if !utf8.FullRune(data[len(data)-i:]) {
+			return data[:len(data)-i]
+		}
+		break
+	}
+	return data
+}
+
+func (fw *FileWatcher) sendTailError(path string, client *Client, err error) {
+	fw.hub.SendToClient(client, map[string]interface{}{
+		"type":  "file-tail-error",
+		"path":  path,
+		"error": err.Error(),
+	})
+}
+
+// RemoveFileTail ends a client's tail of path
+func (fw *FileWatcher) RemoveFileTail(path string, client *Client) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if clients, ok := fw.tails[path]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(fw.tails, path)
+			fw.unwatchFileIfUnused(path)
+		}
+	}
+}
+
+// unwatchFileIfUnused drops the fsnotify watch on a file once no file-watch,
+// file-tail or session follow needs it. Caller holds fw.mu.
+func (fw *FileWatcher) unwatchFileIfUnused(path string) {
+	if fw.fileWatches[path] == nil && fw.tails[path] == nil && fw.follows[path] == nil {
+		fw.unwatchPath(path)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"markdown-themes-backend/handlers"
 	"markdown-themes-backend/utils"
 )
 
@@ -21,12 +22,45 @@ type FileWatcher struct {
 	fileWatches map[string]map[*Client]bool
 	// Track last change time per file for streaming detection
 	lastChangeTime map[string]time.Time
-
-	// Workspace watches: path -> clients watching this workspace
-	workspaceWatches map[string]map[*Client]bool
+	// File tails: path -> per-client offsets of data already sent
+	tails map[string]map[*Client]*tailState
+	// Claude session follows: transcript path -> per-client parse offsets
+	follows map[string]map[*Client]*followState
+	// Last content sent per watched file, the base for file-patch diffs
+	fileVersions map[string]*fileVersion
+	// Clients that asked for file-patch messages instead of full file-change
+	patchWatchers map[string]map[*Client]bool
+	// Serializes recording and sending of versions so patches stay in order
+	versionMu sync.Mutex
+
+	// Identity of each watched file when last read, to find it after a rename
+	fileIdentities map[string]os.FileInfo
+
+	// Workspace watches: path -> clients watching this workspace, with the
+	// extensions each wants workspace-file-change events for
+	workspaceWatches map[string]map[*Client]extensionFilter
 	// Track watched workspace directories (recursive)
 	watchedDirs map[string]string // dir -> workspace root
 
+	// Raw events coalesced per path until their debounce window closes
+	pending map[string]*pendingEvent
+	// Source of the most recent rename, awaiting its destination's create
+	lastRename string
+	pendingMu  sync.Mutex
+	// Pending events whose window closed, processed in order by run
+	ready chan *pendingEvent
+
+	// Paths polled because the inotify watch limit was reached
+	polled   map[string]*polledPath
+	pollOnce sync.Once
+	// Workspace root -> polled directory count its clients were last told of
+	degradedRoots map[string]int
+
+	// Repositories in watched workspaces whose status is pushed on change
+	gitRepos map[string]*gitRepoWatch
+	// Watched .git and refs directories -> repository root
+	gitDirs map[string]string
+
 	mu sync.RWMutex
 }
 
@@ -42,8 +76,19 @@ func NewFileWatcher(hub *Hub) *FileWatcher {
 		watcher:          watcher,
 		fileWatches:      make(map[string]map[*Client]bool),
 		lastChangeTime:   make(map[string]time.Time),
-		workspaceWatches: make(map[string]map[*Client]bool),
+		tails:            make(map[string]map[*Client]*tailState),
+		follows:          make(map[string]map[*Client]*followState),
+		fileVersions:     make(map[string]*fileVersion),
+		patchWatchers:    make(map[string]map[*Client]bool),
+		fileIdentities:   make(map[string]os.FileInfo),
+		workspaceWatches: make(map[string]map[*Client]extensionFilter),
 		watchedDirs:      make(map[string]string),
+		pending:          make(map[string]*pendingEvent),
+		ready:            make(chan *pendingEvent, 256),
+		polled:           make(map[string]*polledPath),
+		degradedRoots:    make(map[string]int),
+		gitRepos:         make(map[string]*gitRepoWatch),
+		gitDirs:          make(map[string]string),
 	}
 
 	go fw.run()
@@ -57,7 +102,10 @@ func (fw *FileWatcher) run() {
 			if !ok {
 				return
 			}
-			fw.handleEvent(event)
+			fw.queueEvent(event)
+
+		case pe := <-fw.ready:
+			fw.flushEvent(pe)
 
 		case err, ok := <-fw.watcher.Errors:
 			if !ok {
@@ -68,83 +116,7 @@ func (fw *FileWatcher) run() {
 	}
 }
 
-func (fw *FileWatcher) handleEvent(event fsnotify.Event) {
-	path := event.Name
-
-	// Handle file-specific watches
-	fw.mu.RLock()
-	clients, hasFileWatch := fw.fileWatches[path]
-	fw.mu.RUnlock()
-
-	if hasFileWatch && (event.Op&fsnotify.Write != 0 || event.Op&fsnotify.Remove != 0) {
-		fw.handleFileChange(path, clients, event.Op)
-	}
-
-	// Handle workspace watches
-	fw.mu.RLock()
-	workspaceRoot, isInWorkspace := fw.watchedDirs[filepath.Dir(path)]
-	fw.mu.RUnlock()
-
-	if isInWorkspace && (event.Op&fsnotify.Write != 0 || event.Op&fsnotify.Create != 0) {
-		// Skip non-relevant files
-		ext := strings.ToLower(filepath.Ext(path))
-		if isWatchableFile(ext) {
-			fw.handleWorkspaceChange(path, workspaceRoot)
-		}
-	}
-
-	// Handle new directories being created in watched workspaces
-	if event.Op&fsnotify.Create != 0 {
-		fw.mu.RLock()
-		wsRoot, isInWs := fw.watchedDirs[filepath.Dir(path)]
-		fw.mu.RUnlock()
-
-		if isInWs {
-			info, err := os.Stat(path)
-			if err == nil && info.IsDir() && !utils.ShouldIgnoreDir(info.Name()) {
-				fw.addDirToWatcher(path, wsRoot)
-			}
-		}
-	}
-}
-
-func isWatchableFile(ext string) bool {
-	watchableExts := map[string]bool{
-		".md": true, ".mdx": true, ".txt": true,
-		".ts": true, ".tsx": true, ".js": true, ".jsx": true,
-		".go": true, ".py": true, ".rs": true, ".rb": true,
-		".java": true, ".c": true, ".cpp": true, ".h": true,
-		".json": true, ".yaml": true, ".yml": true, ".toml": true,
-		".css": true, ".scss": true, ".html": true,
-		".prompty": true,
-	}
-	return watchableExts[ext]
-}
-
-func (fw *FileWatcher) handleFileChange(path string, clients map[*Client]bool, op fsnotify.Op) {
-	if op&fsnotify.Remove != 0 {
-		// File deleted - but wait briefly for atomic writes (editors often delete then recreate)
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-
-			// Check if file came back (atomic write)
-			if _, err := os.Stat(path); err == nil {
-				// File exists again, treat as a write instead
-				fw.handleFileChange(path, clients, fsnotify.Write)
-				return
-			}
-
-			// File is really gone
-			for client := range clients {
-				fw.hub.SendToClient(client, map[string]interface{}{
-					"type": "file-deleted",
-					"path": path,
-				})
-			}
-		}()
-		return
-	}
-
+func (fw *FileWatcher) handleFileChange(path string, clients map[*Client]bool) {
 	// File modified - read content
 	content, err := os.ReadFile(path)
 	if err != nil {
@@ -166,8 +138,13 @@ func (fw *FileWatcher) handleFileChange(path string, clients map[*Client]bool, o
 		timeSinceLastChange = now.Sub(lastChange).Milliseconds()
 	}
 	fw.lastChangeTime[path] = now
+	fw.fileIdentities[path] = info
 	fw.mu.Unlock()
 
+	fw.versionMu.Lock()
+	defer fw.versionMu.Unlock()
+	update := fw.recordContent(path, string(content))
+
 	// Send to all watching clients
 	message := map[string]interface{}{
 		"type":                "file-change",
@@ -177,17 +154,27 @@ func (fw *FileWatcher) handleFileChange(path string, clients map[*Client]bool, o
 		"size":                info.Size(),
 		"timestamp":           now.UnixMilli(),
 		"timeSinceLastChange": timeSinceLastChange,
+		"version":             update.version,
 	}
 
+	patchClients := fw.patchClientsFor(path)
 	for client := range clients {
-		fw.hub.SendToClient(client, message)
+		if !patchClients[client] {
+			fw.hub.SendToClient(client, message)
+		}
 	}
+	fw.sendPatch(path, patchClients, update, message, nil)
 }
 
 func (fw *FileWatcher) handleWorkspaceChange(path string, workspaceRoot string) {
 	fw.mu.RLock()
-	clients, ok := fw.workspaceWatches[workspaceRoot]
-	if !ok {
+	clients := make([]*Client, 0, len(fw.workspaceWatches[workspaceRoot]))
+	for client, filter := range fw.workspaceWatches[workspaceRoot] {
+		if filter.allows(path) {
+			clients = append(clients, client)
+		}
+	}
+	if len(clients) == 0 {
 		fw.mu.RUnlock()
 		return
 	}
@@ -220,13 +207,15 @@ func (fw *FileWatcher) handleWorkspaceChange(path string, workspaceRoot string)
 		"timeSinceLastChange": timeSinceLastChange,
 	}
 
-	for client := range clients {
+	for _, client := range clients {
 		fw.hub.SendToClient(client, message)
 	}
 }
 
-// AddFileWatch adds a file watch for a client
-func (fw *FileWatcher) AddFileWatch(path string, client *Client) {
+// AddFileWatch adds a file watch for a client. With patches set the client
+// receives file-patch messages (diffs against the previous version) instead
+// of the full content on every change.
+func (fw *FileWatcher) AddFileWatch(path string, client *Client, patches bool) {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
 
@@ -235,7 +224,8 @@ func (fw *FileWatcher) AddFileWatch(path string, client *Client) {
 		fw.fileWatches[path] = make(map[*Client]bool)
 
 		// Add to fsnotify watcher
-		if err := fw.watcher.Add(path); err != nil {
+		if err := fw.watchPath(path, false); err != nil {
+			delete(fw.fileWatches, path)
 			log.Printf("[FileWatcher] Error watching file %s: %v", path, err)
 			fw.hub.SendToClient(client, map[string]interface{}{
 				"type":  "file-watch-error",
@@ -247,6 +237,14 @@ func (fw *FileWatcher) AddFileWatch(path string, client *Client) {
 	}
 
 	fw.fileWatches[path][client] = true
+	if patches {
+		if fw.patchWatchers[path] == nil {
+			fw.patchWatchers[path] = make(map[*Client]bool)
+		}
+		fw.patchWatchers[path][client] = true
+	} else if fw.patchWatchers[path] != nil {
+		delete(fw.patchWatchers[path], client)
+	}
 
 	// Send initial content
 	go fw.sendInitialContent(path, client)
@@ -273,13 +271,25 @@ func (fw *FileWatcher) sendInitialContent(path string, client *Client) {
 		return
 	}
 
-	fw.hub.SendToClient(client, map[string]interface{}{
+	fw.mu.Lock()
+	fw.fileIdentities[path] = info
+	fw.mu.Unlock()
+
+	// If the file changed since the last event, bring other patch clients up
+	// to date too, or their next patch would skip a version
+	fw.versionMu.Lock()
+	defer fw.versionMu.Unlock()
+	update := fw.recordContent(path, string(content))
+	message := map[string]interface{}{
 		"type":     "file-content",
 		"path":     path,
 		"content":  string(content),
 		"modified": info.ModTime().Format(time.RFC3339),
 		"size":     info.Size(),
-	})
+		"version":  update.version,
+	}
+	fw.hub.SendToClient(client, message)
+	fw.sendPatch(path, fw.patchClientsFor(path), update, message, client)
 }
 
 // RemoveFileWatch removes a file watch for a client
@@ -289,35 +299,58 @@ func (fw *FileWatcher) RemoveFileWatch(path string, client *Client) {
 
 	if clients, ok := fw.fileWatches[path]; ok {
 		delete(clients, client)
+		if patchClients, ok := fw.patchWatchers[path]; ok {
+			delete(patchClients, client)
+			if len(patchClients) == 0 {
+				delete(fw.patchWatchers, path)
+			}
+		}
 
 		// If no more clients watching, remove from watcher
 		if len(clients) == 0 {
-			fw.watcher.Remove(path)
 			delete(fw.fileWatches, path)
 			delete(fw.lastChangeTime, path)
+			delete(fw.fileVersions, path)
+			delete(fw.fileIdentities, path)
+			fw.unwatchFileIfUnused(path)
 		}
 	}
 }
 
-// AddWorkspaceWatch adds a workspace watch for a client
-func (fw *FileWatcher) AddWorkspaceWatch(path string, client *Client) {
+// AddWorkspaceWatch adds a workspace watch for a client. Tree changes are
+// reported for every file; workspace-file-change only for files matching
+// extensions (the MDT_WATCH_EXTENSIONS default when empty, "*" for all).
+func (fw *FileWatcher) AddWorkspaceWatch(path string, client *Client, extensions []string) {
 	fw.mu.Lock()
 	defer fw.mu.Unlock()
 
 	// Create client set if needed
 	if fw.workspaceWatches[path] == nil {
-		fw.workspaceWatches[path] = make(map[*Client]bool)
+		fw.workspaceWatches[path] = make(map[*Client]extensionFilter)
 
 		// Walk directory and add all subdirs to watcher
-		go fw.watchWorkspaceRecursive(path)
+		go func() {
+			if repo := handlers.FindGitRoot(path); repo != "" {
+				fw.registerGitRepo(repo, path)
+			}
+			fw.watchDirRecursive(path, path)
+		}()
+
+		// Build the quick-open index and keep it current from our events
+		handlers.GetPathIndex().Watch(path)
 	}
 
-	fw.workspaceWatches[path][client] = true
+	fw.workspaceWatches[path][client] = newExtensionFilter(extensions)
+	if native, polled := fw.workspaceWatchCounts(path); polled > 0 {
+		fw.hub.SendToClient(client, degradedMessage(path, native, polled))
+	}
 	log.Printf("[FileWatcher] Added workspace watch: %s", path)
 }
 
-func (fw *FileWatcher) watchWorkspaceRecursive(root string) {
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+// watchDirRecursive adds dir and its subdirectories to the watcher as part of
+// the workspace at root
+func (fw *FileWatcher) watchDirRecursive(dir, root string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Continue on error
 		}
@@ -329,9 +362,13 @@ func (fw *FileWatcher) watchWorkspaceRecursive(root string) {
 			}
 
 			fw.addDirToWatcher(path, root)
+			if path != root && utils.IsGitRepo(path) {
+				fw.registerGitRepo(path, root)
+			}
 		}
 		return nil
 	})
+	fw.reportDegraded(root)
 }
 
 func (fw *FileWatcher) addDirToWatcher(dir, workspaceRoot string) {
@@ -342,7 +379,7 @@ func (fw *FileWatcher) addDirToWatcher(dir, workspaceRoot string) {
 		return
 	}
 
-	if err := fw.watcher.Add(dir); err != nil {
+	if err := fw.watchPath(dir, true); err != nil {
 		log.Printf("[FileWatcher] Error watching dir %s: %v", dir, err)
 		return
 	}
@@ -363,11 +400,37 @@ func (fw *FileWatcher) RemoveWorkspaceWatch(path string, client *Client) {
 			// Remove all directories associated with this workspace
 			for dir, root := range fw.watchedDirs {
 				if root == path {
-					fw.watcher.Remove(dir)
+					fw.unwatchPath(dir)
 					delete(fw.watchedDirs, dir)
 				}
 			}
 			delete(fw.workspaceWatches, path)
+			delete(fw.degradedRoots, path)
+			fw.unregisterGitRepos(path)
+			handlers.GetPathIndex().Unwatch(path)
 		}
 	}
 }
+
+// NotifyWorkspace sends message once to each client watching a workspace that
+// contains any of paths. Used for events originating outside fsnotify, such
+// as file operations performed through the API.
+func (fw *FileWatcher) NotifyWorkspace(paths []string, message interface{}) {
+	fw.mu.RLock()
+	targets := make(map[*Client]bool)
+	for root, clients := range fw.workspaceWatches {
+		for _, p := range paths {
+			if p == root || strings.HasPrefix(p, root+string(filepath.Separator)) {
+				for client := range clients {
+					targets[client] = true
+				}
+				break
+			}
+		}
+	}
+	fw.mu.RUnlock()
+
+	for client := range targets {
+		fw.hub.SendToClient(client, message)
+	}
+}
@@ -0,0 +1,346 @@
+package websocket
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"markdown-themes-backend/handlers"
+	"markdown-themes-backend/utils"
+)
+
+const (
+	// Quiet period after a path's last raw event before it is processed
+	eventDebounce = 50 * time.Millisecond
+	// Longest a continuously written file is held back, so streaming output
+	// still arrives several times a second
+	eventMaxDelay = 200 * time.Millisecond
+	// Removes and renames wait longer: editors delete and recreate on save,
+	// and the destination of a rename arrives as a separate event
+	eventRemoveDelay = 100 * time.Millisecond
+)
+
+// Ops that may mean the content at a path changed; Chmod alone does not
+const contentOps = fsnotify.Write | fsnotify.Create | fsnotify.Remove | fsnotify.Rename
+
+// pendingEvent accumulates the raw fsnotify ops seen for one path during its
+// debounce window
+type pendingEvent struct {
+	path        string
+	ops         fsnotify.Op
+	first       time.Time
+	timer       *time.Timer
+	renamedTo   string // Rename source: where the entry went
+	renamedFrom string // Rename destination: where the entry came from
+}
+
+// queueEvent merges a raw event into its path's pending event and restarts
+// the debounce timer
+func (fw *FileWatcher) queueEvent(event fsnotify.Event) {
+	path := event.Name
+	now := time.Now()
+
+	fw.pendingMu.Lock()
+	defer fw.pendingMu.Unlock()
+
+	pe := fw.pending[path]
+	if pe == nil {
+		pe = &pendingEvent{path: path, first: now}
+		fw.pending[path] = pe
+	}
+	pe.ops |= event.Op
+
+	// inotify reports a move as a rename of the source immediately followed
+	// by a create of the destination. A source that only appeared during its
+	// window (an editor's temp file renamed into place) is not paired.
+	switch {
+	case event.Op&fsnotify.Create != 0 && fw.lastRename != "" && fw.lastRename != path:
+		if src := fw.pending[fw.lastRename]; src != nil && src.renamedTo == "" && src.ops&fsnotify.Create == 0 {
+			src.renamedTo = path
+			pe.renamedFrom = src.path
+		}
+		fw.lastRename = ""
+	case event.Op&fsnotify.Rename != 0:
+		fw.lastRename = path
+	case path != fw.lastRename:
+		fw.lastRename = ""
+	}
+
+	delay := eventDebounce
+	if pe.ops&(fsnotify.Remove|fsnotify.Rename) != 0 || pe.renamedFrom != "" {
+		delay = eventRemoveDelay
+	}
+	if deadline := pe.first.Add(eventMaxDelay); now.Add(delay).After(deadline) {
+		delay = max(0, deadline.Sub(now))
+	}
+
+	if pe.timer == nil {
+		pe.timer = time.AfterFunc(delay, func() { fw.ready <- pe })
+	} else {
+		pe.timer.Reset(delay)
+	}
+}
+
+// flushEvent processes a path's coalesced events once its window closed
+func (fw *FileWatcher) flushEvent(pe *pendingEvent) {
+	fw.pendingMu.Lock()
+	if fw.pending[pe.path] != pe {
+		// Already flushed by an earlier firing of a reset timer
+		fw.pendingMu.Unlock()
+		return
+	}
+	delete(fw.pending, pe.path)
+	path, ops, renamedTo, renamedFrom := pe.path, pe.ops, pe.renamedTo, pe.renamedFrom
+	fw.pendingMu.Unlock()
+
+	if info, err := os.Stat(path); err == nil {
+		fw.handlePathUpdated(path, info, ops, renamedFrom)
+	} else {
+		fw.handlePathGone(path, ops, renamedTo)
+	}
+	if ops&contentOps != 0 {
+		fw.gitPathChanged(path)
+	}
+}
+
+// handlePathUpdated handles a path that exists after its window: written,
+// created, replaced by an atomic save, or the destination of a rename.
+func (fw *FileWatcher) handlePathUpdated(path string, info os.FileInfo, ops fsnotify.Op, renamedFrom string) {
+	fw.mu.RLock()
+	clients, hasFileWatch := fw.fileWatches[path]
+	_, hasTail := fw.tails[path]
+	_, hasFollow := fw.follows[path]
+	workspaceRoot, inWorkspace := fw.watchedDirs[filepath.Dir(path)]
+	_, isPolled := fw.polled[path]
+	fw.mu.RUnlock()
+
+	if (hasFileWatch || hasTail || hasFollow) && !isPolled && ops&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 {
+		// A new inode sits at the path, so fsnotify dropped the old watch
+		fw.watcher.Add(path)
+	}
+	if hasFileWatch && ops&contentOps != 0 {
+		fw.handleFileChange(path, clients)
+	}
+	if hasTail && ops&contentOps != 0 {
+		fw.handleTailChange(path)
+	}
+	if hasFollow && ops&contentOps != 0 {
+		fw.handleFollowChange(path)
+	}
+
+	if renamedFrom != "" {
+		if _, err := os.Stat(renamedFrom); err != nil {
+			fw.handleRenamed(renamedFrom, path, info.IsDir())
+			return
+		}
+		// The source was recreated (log rotation), so this is a new entry
+		ops |= fsnotify.Create
+		ops &^= fsnotify.Remove | fsnotify.Rename
+	}
+
+	if !inWorkspace {
+		return
+	}
+	if ops&fsnotify.Create != 0 && ops&(fsnotify.Remove|fsnotify.Rename) == 0 {
+		if info.IsDir() && !utils.ShouldIgnoreDir(info.Name()) {
+			fw.watchDirRecursive(path, workspaceRoot)
+		}
+		handlers.GetPathIndex().AddPath(path, info.IsDir())
+		handlers.NotifyTreeChange("created", path, "", info.IsDir())
+	}
+	if !info.IsDir() && ops&(fsnotify.Write|fsnotify.Create) != 0 {
+		fw.handleWorkspaceChange(path, workspaceRoot)
+	}
+}
+
+// handlePathGone handles a path that no longer exists after its window
+func (fw *FileWatcher) handlePathGone(path string, ops fsnotify.Op, renamedTo string) {
+	if renamedTo != "" {
+		if _, err := os.Stat(renamedTo); err == nil {
+			return // The destination's flush reports the rename
+		}
+	}
+
+	fw.mu.RLock()
+	_, wasDir := fw.watchedDirs[path]
+	_, inWorkspace := fw.watchedDirs[filepath.Dir(path)]
+	identity := fw.fileIdentities[path]
+	fw.mu.RUnlock()
+
+	// A file watched on its own reports a rename without the destination;
+	// look for the same inode next to where it was
+	if identity != nil {
+		if newPath := findMovedFile(path, identity); newPath != "" {
+			fw.handleRenamed(path, newPath, false)
+			return
+		}
+	}
+
+	fw.notifyWatchers(path, map[string]interface{}{
+		"type": "file-deleted",
+		"path": path,
+	})
+
+	if wasDir {
+		fw.removeDirWatches(path)
+	}
+	if inWorkspace || wasDir {
+		handlers.GetPathIndex().RemovePath(path)
+		if ops&fsnotify.Create == 0 {
+			// Created and gone within one window: nobody saw it appear
+			handlers.NotifyTreeChange("deleted", path, "", wasDir)
+		}
+	}
+}
+
+// handleRenamed reports a move from oldPath to newPath to file watchers of
+// the entry (and, for a directory, of everything under it) and to the
+// workspace trees, and moves directory watches to the new location.
+func (fw *FileWatcher) handleRenamed(oldPath, newPath string, isDir bool) {
+	fw.mu.RLock()
+	moved := make(map[string]string)
+	match := func(p string) {
+		if p == oldPath {
+			moved[p] = newPath
+		} else if isDir && strings.HasPrefix(p, oldPath+string(filepath.Separator)) {
+			moved[p] = newPath + p[len(oldPath):]
+		}
+	}
+	for p := range fw.fileWatches {
+		match(p)
+	}
+	for p := range fw.tails {
+		match(p)
+	}
+	newRoot, newInWorkspace := fw.watchedDirs[filepath.Dir(newPath)]
+	fw.mu.RUnlock()
+
+	for from, to := range moved {
+		fw.notifyWatchers(from, map[string]interface{}{
+			"type":    "file-renamed",
+			"path":    to,
+			"oldPath": from,
+		})
+	}
+
+	if isDir {
+		// inotify keeps watching the moved directories, but fsnotify would
+		// keep reporting their events under the old paths
+		fw.removeDirWatches(oldPath)
+		if newInWorkspace {
+			fw.watchDirRecursive(newPath, newRoot)
+		}
+	}
+
+	index := handlers.GetPathIndex()
+	index.RemovePath(oldPath)
+	index.AddPath(newPath, isDir)
+	handlers.NotifyTreeChange("renamed", newPath, oldPath, isDir)
+}
+
+// notifyWatchers sends message to every client watching, tailing or
+// following path
+func (fw *FileWatcher) notifyWatchers(path string, message map[string]interface{}) {
+	fw.mu.RLock()
+	targets := make(map[*Client]bool)
+	for client := range fw.fileWatches[path] {
+		targets[client] = true
+	}
+	for client := range fw.tails[path] {
+		targets[client] = true
+	}
+	for client := range fw.follows[path] {
+		targets[client] = true
+	}
+	fw.mu.RUnlock()
+
+	for client := range targets {
+		fw.hub.SendToClient(client, message)
+	}
+}
+
+// removeDirWatches drops the watches on dir and every directory under it
+func (fw *FileWatcher) removeDirWatches(dir string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	prefix := dir + string(filepath.Separator)
+	for d := range fw.watchedDirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			fw.unwatchPath(d)
+			delete(fw.watchedDirs, d)
+		}
+	}
+}
+
+// findMovedFile looks in the directory that held oldPath for the file with
+// identity, returning its new path or "" when it left the directory
+func findMovedFile(oldPath string, identity os.FileInfo) string {
+	dir := filepath.Dir(oldPath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && os.SameFile(identity, info) {
+			return filepath.Join(dir, entry.Name())
+		}
+	}
+	return ""
+}
+
+// extensionFilter selects the files a workspace watch reports
+// workspace-file-change for. nil uses the default, "*" matches everything.
+type extensionFilter map[string]bool
+
+// defaultWatchExtensions is used when MDT_WATCH_EXTENSIONS is unset
+var defaultWatchExtensions = []string{
+	".md", ".mdx", ".txt",
+	".ts", ".tsx", ".js", ".jsx",
+	".go", ".py", ".rs", ".rb",
+	".java", ".c", ".cpp", ".h",
+	".json", ".yaml", ".yml", ".toml",
+	".css", ".scss", ".html",
+	".prompty",
+}
+
+// watchExtensions is the default filter: a comma-separated list from
+// MDT_WATCH_EXTENSIONS (e.g. "md,ts,.go" or "*"), else defaultWatchExtensions
+var watchExtensions = func() extensionFilter {
+	if env := os.Getenv("MDT_WATCH_EXTENSIONS"); env != "" {
+		if filter := newExtensionFilter(strings.Split(env, ",")); filter != nil {
+			return filter
+		}
+	}
+	return newExtensionFilter(defaultWatchExtensions)
+}()
+
+// newExtensionFilter builds a filter from extensions with or without the
+// leading dot, returning nil (the default) when none are given
+func newExtensionFilter(extensions []string) extensionFilter {
+	var filter extensionFilter
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if ext != "*" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if filter == nil {
+			filter = make(extensionFilter)
+		}
+		filter[ext] = true
+	}
+	return filter
+}
+
+func (f extensionFilter) allows(path string) bool {
+	if f == nil {
+		f = watchExtensions
+	}
+	return f["*"] || f[strings.ToLower(filepath.Ext(path))]
+}
@@ -0,0 +1,186 @@
+package websocket
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// newTestCoalescer returns a FileWatcher with only the coalescing state, so
+// its pending events can be read from fw.ready instead of being processed
+func newTestCoalescer() *FileWatcher {
+	return &FileWatcher{
+		pending: make(map[string]*pendingEvent),
+		ready:   make(chan *pendingEvent, 64),
+	}
+}
+
+// collectReady returns the events flushed until none arrives for quiet
+func collectReady(fw *FileWatcher, quiet time.Duration) map[string]*pendingEvent {
+	flushed := make(map[string]*pendingEvent)
+	for {
+		select {
+		case pe := <-fw.ready:
+			flushed[pe.path] = pe
+		case <-time.After(quiet):
+			return flushed
+		}
+	}
+}
+
+func TestQueueEvent_Coalesces(t *testing.T) {
+	type flushed struct {
+		ops         fsnotify.Op
+		renamedTo   string
+		renamedFrom string
+	}
+	tests := []struct {
+		name   string
+		events []fsnotify.Event
+		want   map[string]flushed
+	}{
+		{
+			name: "writes to one path merge",
+			events: []fsnotify.Event{
+				{Name: "/w/a.md", Op: fsnotify.Write},
+				{Name: "/w/a.md", Op: fsnotify.Write},
+				{Name: "/w/a.md", Op: fsnotify.Chmod},
+			},
+			want: map[string]flushed{"/w/a.md": {ops: fsnotify.Write | fsnotify.Chmod}},
+		},
+		{
+			name: "rename then create pairs source and destination",
+			events: []fsnotify.Event{
+				{Name: "/w/old.md", Op: fsnotify.Rename},
+				{Name: "/w/new.md", Op: fsnotify.Create},
+			},
+			want: map[string]flushed{
+				"/w/old.md": {ops: fsnotify.Rename, renamedTo: "/w/new.md"},
+				"/w/new.md": {ops: fsnotify.Create, renamedFrom: "/w/old.md"},
+			},
+		},
+		{
+			name: "atomic save's temp file is not paired",
+			events: []fsnotify.Event{
+				{Name: "/w/.a.md.tmp", Op: fsnotify.Create},
+				{Name: "/w/.a.md.tmp", Op: fsnotify.Write},
+				{Name: "/w/.a.md.tmp", Op: fsnotify.Rename},
+				{Name: "/w/a.md", Op: fsnotify.Create},
+			},
+			want: map[string]flushed{
+				"/w/.a.md.tmp": {ops: fsnotify.Create | fsnotify.Write | fsnotify.Rename},
+				"/w/a.md":      {ops: fsnotify.Create},
+			},
+		},
+		{
+			name: "an event in between breaks the pairing",
+			events: []fsnotify.Event{
+				{Name: "/w/old.md", Op: fsnotify.Rename},
+				{Name: "/w/other.md", Op: fsnotify.Write},
+				{Name: "/w/new.md", Op: fsnotify.Create},
+			},
+			want: map[string]flushed{
+				"/w/old.md":   {ops: fsnotify.Rename},
+				"/w/other.md": {ops: fsnotify.Write},
+				"/w/new.md":   {ops: fsnotify.Create},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := newTestCoalescer()
+			for _, event := range tt.events {
+				fw.queueEvent(event)
+			}
+			got := collectReady(fw, 2*eventMaxDelay)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d flushed paths, want %d", len(got), len(tt.want))
+			}
+			for path, want := range tt.want {
+				pe := got[path]
+				if pe == nil {
+					t.Errorf("%s was not flushed", path)
+					continue
+				}
+				if (flushed{pe.ops, pe.renamedTo, pe.renamedFrom}) != want {
+					t.Errorf("%s: got ops %v to %q from %q, want %+v", path, pe.ops, pe.renamedTo, pe.renamedFrom, want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueEvent_DebounceAndMaxDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		op       fsnotify.Op
+		every    time.Duration // Gap between repeated events, 0 for one event
+		span     time.Duration
+		earliest time.Duration // Since the first event
+		latest   time.Duration
+	}{
+		{name: "single write", op: fsnotify.Write, earliest: eventDebounce, latest: eventMaxDelay},
+		{name: "remove waits longer", op: fsnotify.Remove, earliest: eventRemoveDelay, latest: eventMaxDelay},
+		{name: "continuous writes flush by the max delay", op: fsnotify.Write, every: 20 * time.Millisecond, span: 3 * eventMaxDelay, earliest: eventMaxDelay - 20*time.Millisecond, latest: eventMaxDelay + 50*time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fw := newTestCoalescer()
+			start := time.Now()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					fw.queueEvent(fsnotify.Event{Name: "/w/a.log", Op: tt.op})
+					if tt.every == 0 || time.Since(start) > tt.span {
+						return
+					}
+					time.Sleep(tt.every)
+				}
+			}()
+			defer func() { <-done }()
+
+			select {
+			case <-fw.ready:
+				if elapsed := time.Since(start); elapsed < tt.earliest || elapsed > tt.latest {
+					t.Errorf("flushed after %v, want between %v and %v", elapsed, tt.earliest, tt.latest)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("never flushed")
+			}
+		})
+	}
+}
+
+func TestFileWatcher_ReportsRenameOfWatchedFile(t *testing.T) {
+	fw, client := newTestWatcher(t)
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")
+	os.WriteFile(oldPath, []byte("hello"), 0644)
+
+	fw.AddFileWatch(oldPath, client, false)
+	if msg := recv(t, client); msg["type"] != "file-content" {
+		t.Fatalf("expected the initial content, got %v", msg)
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		msg := recv(t, client)
+		if msg["type"] == "file-renamed" {
+			if msg["path"] != newPath || msg["oldPath"] != oldPath {
+				t.Errorf("unexpected rename %v", msg)
+			}
+			return
+		}
+		if msg["type"] == "file-deleted" {
+			t.Fatalf("rename reported as a delete: %v", msg)
+		}
+	}
+}
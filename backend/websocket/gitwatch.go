@@ -0,0 +1,223 @@
+package websocket
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"markdown-themes-backend/handlers"
+)
+
+const (
+	// Quiet period after the last repository change before git status runs
+	gitStatusDebounce = 300 * time.Millisecond
+	// Longest a busy repository (a build writing files) waits for a refresh
+	gitStatusMaxDelay = 2 * time.Second
+)
+
+// gitRepoWatch tracks a repository inside (or containing) watched workspaces
+type gitRepoWatch struct {
+	root       string
+	workspaces map[string]bool // Workspace roots that registered the repo
+	gitDirs    []string        // .git and its refs directories being watched
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	first    time.Time // First change not yet reflected in a refresh
+	running  bool
+	rerun    bool   // A change arrived while git status was running
+	lastSent []byte // Last status pushed, to skip unchanged results
+}
+
+// registerGitRepo starts watching the metadata of the repository at root on
+// behalf of a workspace: .git itself (index, HEAD, packed-refs) and every
+// directory under .git/refs.
+func (fw *FileWatcher) registerGitRepo(root, workspace string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if repo, ok := fw.gitRepos[root]; ok {
+		repo.workspaces[workspace] = true
+		return
+	}
+
+	repo := &gitRepoWatch{root: root, workspaces: map[string]bool{workspace: true}}
+	gitDir := filepath.Join(root, ".git")
+	dirs := []string{gitDir}
+	filepath.Walk(filepath.Join(gitDir, "refs"), func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for _, dir := range dirs {
+		if err := fw.watchPath(dir, true); err == nil {
+			repo.gitDirs = append(repo.gitDirs, dir)
+			fw.gitDirs[dir] = root
+		}
+	}
+	fw.gitRepos[root] = repo
+}
+
+// unregisterGitRepos drops a workspace's claim on its repositories and stops
+// watching any that no workspace needs. Caller holds fw.mu.
+func (fw *FileWatcher) unregisterGitRepos(workspace string) {
+	for root, repo := range fw.gitRepos {
+		delete(repo.workspaces, workspace)
+		if len(repo.workspaces) > 0 {
+			continue
+		}
+		for _, dir := range repo.gitDirs {
+			fw.unwatchPath(dir)
+			delete(fw.gitDirs, dir)
+		}
+		repo.mu.Lock()
+		if repo.timer != nil {
+			repo.timer.Stop()
+		}
+		repo.mu.Unlock()
+		delete(fw.gitRepos, root)
+	}
+}
+
+// gitPathChanged schedules a status refresh for the repository affected by
+// a change at path: a metadata file under .git, or a worktree file.
+func (fw *FileWatcher) gitPathChanged(path string) {
+	name := filepath.Base(path)
+	if strings.HasSuffix(name, ".lock") {
+		return // The rename onto the real name follows
+	}
+
+	fw.mu.RLock()
+	var repo *gitRepoWatch
+	if root, ok := fw.gitDirs[filepath.Dir(path)]; ok {
+		if filepath.Dir(path) == filepath.Join(root, ".git") && !gitMetadataFiles[name] {
+			fw.mu.RUnlock()
+			return
+		}
+		repo = fw.gitRepos[root]
+		if _, watched := fw.gitDirs[path]; !watched && repo != nil {
+			fw.mu.RUnlock()
+			fw.watchNewRefDir(repo, path)
+			fw.mu.RLock()
+		}
+	} else if !strings.Contains(path, string(filepath.Separator)+".git"+string(filepath.Separator)) {
+		// The innermost repository holding the file
+		for root, r := range fw.gitRepos {
+			if strings.HasPrefix(path, root+string(filepath.Separator)) && (repo == nil || len(root) > len(repo.root)) {
+				repo = r
+			}
+		}
+	}
+	fw.mu.RUnlock()
+
+	if repo != nil {
+		fw.scheduleGitStatus(repo)
+	}
+}
+
+// watchNewRefDir adds a directory created under .git/refs (a branch named
+// "feature/x" creates refs/heads/feature)
+func (fw *FileWatcher) watchNewRefDir(repo *gitRepoWatch, path string) {
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if _, watched := fw.gitDirs[path]; watched || fw.gitRepos[repo.root] != repo {
+		return
+	}
+	if err := fw.watchPath(path, true); err == nil {
+		repo.gitDirs = append(repo.gitDirs, path)
+		fw.gitDirs[path] = repo.root
+	}
+}
+
+// Files directly in .git whose changes affect git status
+var gitMetadataFiles = map[string]bool{
+	"index":       true,
+	"HEAD":        true,
+	"packed-refs": true,
+	"MERGE_HEAD":  true,
+}
+
+func (fw *FileWatcher) scheduleGitStatus(repo *gitRepoWatch) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if repo.running {
+		repo.rerun = true
+		return
+	}
+
+	now := time.Now()
+	if repo.first.IsZero() {
+		repo.first = now
+	}
+	delay := gitStatusDebounce
+	if deadline := repo.first.Add(gitStatusMaxDelay); now.Add(delay).After(deadline) {
+		delay = max(0, deadline.Sub(now))
+	}
+
+	if repo.timer == nil {
+		repo.timer = time.AfterFunc(delay, func() { fw.refreshGitStatus(repo) })
+	} else {
+		repo.timer.Reset(delay)
+	}
+}
+
+// refreshGitStatus runs git status and pushes a git-status-changed message
+// when the result differs from the last one sent
+func (fw *FileWatcher) refreshGitStatus(repo *gitRepoWatch) {
+	repo.mu.Lock()
+	repo.running = true
+	repo.first = time.Time{}
+	repo.mu.Unlock()
+
+	status := handlers.ComputeGitStatus(repo.root)
+	data, _ := json.Marshal(status.Files)
+
+	repo.mu.Lock()
+	changed := string(data) != string(repo.lastSent)
+	repo.lastSent = data
+	repo.running = false
+	rerun := repo.rerun
+	repo.rerun = false
+	repo.mu.Unlock()
+
+	if changed {
+		fw.notifyRepoWatchers(repo.root, map[string]interface{}{
+			"type":      "git-status-changed",
+			"repo":      repo.root,
+			"isGitRepo": status.IsGitRepo,
+			"files":     status.Files,
+		})
+	}
+	if rerun {
+		fw.scheduleGitStatus(repo)
+	}
+}
+
+// notifyRepoWatchers sends message to clients whose workspace contains the
+// repository or lies inside it
+func (fw *FileWatcher) notifyRepoWatchers(root string, message interface{}) {
+	fw.mu.RLock()
+	targets := make(map[*Client]bool)
+	for workspace, clients := range fw.workspaceWatches {
+		if workspace == root ||
+			strings.HasPrefix(workspace, root+string(filepath.Separator)) ||
+			strings.HasPrefix(root, workspace+string(filepath.Separator)) {
+			for client := range clients {
+				targets[client] = true
+			}
+		}
+	}
+	fw.mu.RUnlock()
+
+	for client := range targets {
+		fw.hub.SendToClient(client, message)
+	}
+}
@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watchTestRepo registers client as watching a fresh repository's workspace
+// without the directory walk AddWorkspaceWatch starts
+func watchTestRepo(t *testing.T, fw *FileWatcher, client *Client) string {
+	t.Helper()
+	root := t.TempDir()
+	if out, err := exec.Command("git", "init", "-q", root).CombinedOutput(); err != nil {
+		t.Skipf("git init: %v %s", err, out)
+	}
+	fw.mu.Lock()
+	fw.workspaceWatches[root] = map[*Client]extensionFilter{client: newExtensionFilter(nil)}
+	fw.mu.Unlock()
+	fw.registerGitRepo(root, root)
+	return root
+}
+
+func TestGitPathChanged_PushesStatus(t *testing.T) {
+	fw, client := newTestWatcher(t)
+	root := watchTestRepo(t, fw, client)
+
+	os.WriteFile(filepath.Join(root, "notes.md"), []byte("# Notes"), 0644)
+	fw.gitPathChanged(filepath.Join(root, "notes.md"))
+
+	msg := recv(t, client)
+	if msg["type"] != "git-status-changed" || msg["repo"] != root {
+		t.Fatalf("got %v", msg)
+	}
+	files, _ := msg["files"].(map[string]interface{})
+	found := false
+	for path := range files {
+		found = found || strings.HasSuffix(path, "notes.md")
+	}
+	if !found {
+		t.Errorf("expected notes.md in %v", files)
+	}
+
+	// A refresh with the same result is not pushed again
+	fw.gitPathChanged(filepath.Join(root, "notes.md"))
+	expectNoMessage(t, client, gitStatusDebounce+200*time.Millisecond)
+}
+
+func TestGitPathChanged_IgnoresIrrelevantPaths(t *testing.T) {
+	fw, client := newTestWatcher(t)
+	root := watchTestRepo(t, fw, client)
+	gitDir := filepath.Join(root, ".git")
+
+	for _, path := range []string{
+		filepath.Join(gitDir, "index.lock"),
+		filepath.Join(gitDir, "config"),
+		filepath.Join(gitDir, "objects", "ab", "cdef"),
+		filepath.Join(t.TempDir(), "elsewhere.md"),
+	} {
+		fw.gitPathChanged(path)
+	}
+
+	repo := fw.gitRepos[root]
+	repo.mu.Lock()
+	scheduled := repo.timer != nil
+	repo.mu.Unlock()
+	if scheduled {
+		t.Error("expected no git status refresh to be scheduled")
+	}
+}
+
+func TestScheduleGitStatus_MaxDelay(t *testing.T) {
+	fw, client := newTestWatcher(t)
+	root := watchTestRepo(t, fw, client)
+	repo := fw.gitRepos[root]
+
+	// Changes arriving faster than the debounce still refresh by the deadline
+	start := time.Now()
+	ticker := time.NewTicker(gitStatusDebounce / 3)
+	defer ticker.Stop()
+	deadline := time.After(gitStatusMaxDelay + time.Second)
+	for {
+		select {
+		case <-ticker.C:
+			fw.scheduleGitStatus(repo)
+			continue
+		case <-client.send:
+		case <-deadline:
+			t.Fatal("timed out waiting for git-status-changed")
+		}
+		break
+	}
+
+	if elapsed := time.Since(start); elapsed < gitStatusMaxDelay-100*time.Millisecond || elapsed > gitStatusMaxDelay+500*time.Millisecond {
+		t.Errorf("refreshed after %v, want about %v", elapsed, gitStatusMaxDelay)
+	}
+}
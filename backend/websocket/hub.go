@@ -3,6 +3,7 @@ package websocket
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -22,6 +23,22 @@ func isValidPath(p string) bool {
 	return len(p) <= 4096 && !strings.ContainsAny(p, "\n\r") && filepath.IsAbs(p)
 }
 
+// resolveSessionTranscript finds the transcript a claude-session-follow asks
+// for: the session's file under ~/.claude/projects, or an explicit .jsonl path
+func resolveSessionTranscript(msg IncomingMessage) (path, sessionID string, err error) {
+	if msg.SessionID != "" {
+		transcript, err := handlers.FindClaudeTranscript(msg.SessionID)
+		if err != nil {
+			return "", "", errors.New("session not found")
+		}
+		return transcript.Path, msg.SessionID, nil
+	}
+	if msg.Path == "" || !isValidPath(msg.Path) || filepath.Ext(msg.Path) != ".jsonl" {
+		return "", "", errors.New("invalid path")
+	}
+	return msg.Path, strings.TrimSuffix(filepath.Base(msg.Path), ".jsonl"), nil
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins for local dev
@@ -37,6 +54,8 @@ type Client struct {
 	// Subscriptions
 	watchedFiles      map[string]bool
 	watchedWorkspaces map[string]bool
+	tailedFiles       map[string]bool
+	followedSessions  map[string]string // transcript path -> sessionId
 	mu                sync.Mutex
 }
 
@@ -52,6 +71,9 @@ type Hub struct {
 	// File watcher
 	watcher *FileWatcher
 
+	// Claude session and subagent lifecycle watcher
+	subagents *SubagentWatcher
+
 	mu sync.RWMutex
 }
 
@@ -63,6 +85,7 @@ func NewHub() *Hub {
 		unregister: make(chan *Client),
 	}
 	h.watcher = NewFileWatcher(h)
+	h.subagents = NewSubagentWatcher(h)
 
 	// Wire up terminal manager broadcast: PTY output → subscribed WS clients
 	tm := handlers.GetTerminalManager()
@@ -96,6 +119,9 @@ func NewHub() *Hub {
 		h.BroadcastAll(message)
 	})
 
+	// Wire up workspace notifications for API-driven file operations
+	handlers.SetWorkspaceNotifyFunc(h.watcher.NotifyWorkspace)
+
 	return h
 }
 
@@ -120,7 +146,14 @@ func (h *Hub) Run() {
 				for path := range client.watchedWorkspaces {
 					h.watcher.RemoveWorkspaceWatch(path, client)
 				}
+				for path := range client.tailedFiles {
+					h.watcher.RemoveFileTail(path, client)
+				}
+				for path := range client.followedSessions {
+					h.watcher.RemoveSessionFollow(path, client)
+				}
 				client.mu.Unlock()
+				h.subagents.RemoveClient(client)
 
 				// Clean up terminal subscriptions
 				handlers.GetTerminalManager().RemoveAllClientSessions(client)
@@ -177,6 +210,23 @@ func (h *Hub) BroadcastAll(message interface{}) {
 type IncomingMessage struct {
 	Type string `json:"type"`
 	Path string `json:"path,omitempty"`
+
+	// file-watch: receive file-patch diffs instead of full file-change content
+	Patches bool `json:"patches,omitempty"`
+
+	// claude-session-follow: the session to follow, by ID or transcript Path
+	SessionID string `json:"sessionId,omitempty"`
+
+	// file-tail: start from the last Lines lines, or resume from Offset
+	// (claude-session-follow: resume parsing from Offset)
+	Lines  int    `json:"lines,omitempty"`
+	Offset *int64 `json:"offset,omitempty"`
+
+	// workspace-watch: extensions reported by workspace-file-change ("*" for all)
+	Extensions []string `json:"extensions,omitempty"`
+
+	// subagent-watch: subscribe (true) or unsubscribe (false)
+	Enabled bool `json:"enabled,omitempty"`
 }
 
 // HandleWebSocket upgrades HTTP connection to WebSocket
@@ -200,6 +250,8 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		send:              make(chan []byte, 256),
 		watchedFiles:      make(map[string]bool),
 		watchedWorkspaces: make(map[string]bool),
+		tailedFiles:       make(map[string]bool),
+		followedSessions:  make(map[string]string),
 	}
 
 	h.register <- client
@@ -270,7 +322,7 @@ func (c *Client) handleMessage(msg IncomingMessage) {
 		c.mu.Lock()
 		c.watchedFiles[msg.Path] = true
 		c.mu.Unlock()
-		c.hub.watcher.AddFileWatch(msg.Path, c)
+		c.hub.watcher.AddFileWatch(msg.Path, c, msg.Patches)
 
 	case "file-unwatch":
 		if msg.Path == "" {
@@ -281,6 +333,64 @@ func (c *Client) handleMessage(msg IncomingMessage) {
 		c.mu.Unlock()
 		c.hub.watcher.RemoveFileWatch(msg.Path, c)
 
+	case "file-resync":
+		if msg.Path == "" {
+			return
+		}
+		c.hub.watcher.ResyncFile(msg.Path, c)
+
+	case "file-tail":
+		if msg.Path == "" || !isValidPath(msg.Path) {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":  "file-tail-error",
+				"error": "invalid path",
+			})
+			return
+		}
+		c.mu.Lock()
+		c.tailedFiles[msg.Path] = true
+		c.mu.Unlock()
+		c.hub.watcher.AddFileTail(msg.Path, c, msg.Lines, msg.Offset)
+
+	case "file-untail":
+		if msg.Path == "" {
+			return
+		}
+		c.mu.Lock()
+		delete(c.tailedFiles, msg.Path)
+		c.mu.Unlock()
+		c.hub.watcher.RemoveFileTail(msg.Path, c)
+
+	case "claude-session-follow":
+		path, sessionID, err := resolveSessionTranscript(msg)
+		if err != nil {
+			c.hub.SendToClient(c, map[string]interface{}{
+				"type":      "claude-session-error",
+				"sessionId": msg.SessionID,
+				"path":      msg.Path,
+				"error":     err.Error(),
+			})
+			return
+		}
+		c.mu.Lock()
+		c.followedSessions[path] = sessionID
+		c.mu.Unlock()
+		c.hub.watcher.AddSessionFollow(path, sessionID, c, msg.Offset)
+
+	case "claude-session-unfollow":
+		c.mu.Lock()
+		var paths []string
+		for path, sessionID := range c.followedSessions {
+			if (msg.Path != "" && path == msg.Path) || (msg.SessionID != "" && sessionID == msg.SessionID) {
+				paths = append(paths, path)
+				delete(c.followedSessions, path)
+			}
+		}
+		c.mu.Unlock()
+		for _, path := range paths {
+			c.hub.watcher.RemoveSessionFollow(path, c)
+		}
+
 	case "workspace-watch":
 		if msg.Path == "" || !isValidPath(msg.Path) {
 			c.hub.SendToClient(c, map[string]interface{}{
@@ -292,7 +402,7 @@ func (c *Client) handleMessage(msg IncomingMessage) {
 		c.mu.Lock()
 		c.watchedWorkspaces[msg.Path] = true
 		c.mu.Unlock()
-		c.hub.watcher.AddWorkspaceWatch(msg.Path, c)
+		c.hub.watcher.AddWorkspaceWatch(msg.Path, c, msg.Extensions)
 
 	case "workspace-unwatch":
 		if msg.Path == "" {
@@ -303,6 +413,13 @@ func (c *Client) handleMessage(msg IncomingMessage) {
 		c.mu.Unlock()
 		c.hub.watcher.RemoveWorkspaceWatch(msg.Path, c)
 
+	case "subagent-watch":
+		if msg.Enabled {
+			c.hub.subagents.AddClient(c)
+		} else {
+			c.hub.subagents.RemoveClient(c)
+		}
+
 	case "ping":
 		c.hub.SendToClient(c, map[string]string{"type": "pong"})
 
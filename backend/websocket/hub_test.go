@@ -0,0 +1,48 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTestWatcher returns a FileWatcher on a hub with one client, whose
+// messages recv reads
+func newTestWatcher(t *testing.T) (*FileWatcher, *Client) {
+	t.Helper()
+	hub := &Hub{clients: make(map[*Client]bool)}
+	hub.watcher = NewFileWatcher(hub)
+	t.Cleanup(func() { hub.watcher.watcher.Close() })
+	client := &Client{hub: hub, send: make(chan []byte, 256)}
+	hub.clients[client] = true
+	return hub.watcher, client
+}
+
+// recv returns the client's next message, failing after a second
+func recv(t *testing.T, client *Client) map[string]interface{} {
+	t.Helper()
+	select {
+	case data, ok := <-client.send:
+		if !ok {
+			t.Fatal("client was closed")
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+// expectNoMessage fails if the client receives anything within wait
+func expectNoMessage(t *testing.T, client *Client, wait time.Duration) {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		t.Fatalf("unexpected message %s", data)
+	case <-time.After(wait):
+	}
+}
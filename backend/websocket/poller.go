@@ -0,0 +1,278 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const defaultPollInterval = 2 * time.Second
+
+// pollInterval is how often paths fsnotify could not watch are rescanned:
+// MDT_WATCH_POLL_INTERVAL as a Go duration ("500ms", "5s") or whole seconds
+var pollInterval = func() time.Duration {
+	env := os.Getenv("MDT_WATCH_POLL_INTERVAL")
+	if env == "" {
+		return defaultPollInterval
+	}
+	if d, err := time.ParseDuration(env); err == nil && d > 0 {
+		return d
+	}
+	if secs, err := strconv.Atoi(env); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	log.Printf("[FileWatcher] Invalid MDT_WATCH_POLL_INTERVAL %q, using %v", env, defaultPollInterval)
+	return defaultPollInterval
+}()
+
+// pollStat is what the poller compares between scans
+type pollStat struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+// polledPath is a directory or file that fsnotify could not watch because
+// the inotify watch limit is exhausted. Directories are scanned one level
+// deep; their subdirectories are polled entries of their own.
+type polledPath struct {
+	isDir   bool
+	entries map[string]pollStat // Children by name, or the file itself under ""
+}
+
+// isWatchLimitError reports whether err means the kernel refused another
+// inotify watch (fs.inotify.max_user_watches) rather than a bad path
+func isWatchLimitError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EMFILE)
+}
+
+// watchPath adds path to fsnotify, falling back to polling it when the
+// inotify watch limit is exhausted. Caller holds fw.mu.
+func (fw *FileWatcher) watchPath(path string, isDir bool) error {
+	err := fw.watcher.Add(path)
+	if err == nil || !isWatchLimitError(err) {
+		return err
+	}
+	if _, ok := fw.polled[path]; !ok {
+		fw.polled[path] = &polledPath{isDir: isDir, entries: scanPolledPath(path, isDir)}
+		fw.pollOnce.Do(func() { go fw.pollLoop() })
+	}
+	return nil
+}
+
+// unwatchPath stops watching or polling path. Caller holds fw.mu.
+func (fw *FileWatcher) unwatchPath(path string) {
+	if _, ok := fw.polled[path]; ok {
+		delete(fw.polled, path)
+		return
+	}
+	fw.watcher.Remove(path)
+}
+
+func scanPolledPath(path string, isDir bool) map[string]pollStat {
+	entries := make(map[string]pollStat)
+	if !isDir {
+		if info, err := os.Stat(path); err == nil {
+			entries[""] = pollStat{modTime: info.ModTime(), size: info.Size()}
+		}
+		return entries
+	}
+
+	dirEntries, err := os.ReadDir(path)
+	if err != nil {
+		return entries
+	}
+	for _, entry := range dirEntries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		entries[entry.Name()] = pollStat{modTime: info.ModTime(), size: info.Size(), isDir: info.IsDir()}
+	}
+	return entries
+}
+
+// pollLoop rescans polled paths every pollInterval
+func (fw *FileWatcher) pollLoop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fw.pollPaths()
+	}
+}
+
+// pollPaths rescans polled paths and feeds the differences into the event
+// pipeline as synthetic fsnotify events. Renames show up as a remove and a
+// create, since there is no way to pair them.
+func (fw *FileWatcher) pollPaths() {
+	fw.mu.RLock()
+	targets := make(map[string]*polledPath, len(fw.polled))
+	for path, p := range fw.polled {
+		targets[path] = p
+	}
+	fw.mu.RUnlock()
+
+	for path, p := range targets {
+		current := scanPolledPath(path, p.isDir)
+		for name, now := range current {
+			before, existed := p.entries[name]
+			switch {
+			case !existed:
+				fw.queueEvent(fsnotify.Event{Name: filepath.Join(path, name), Op: fsnotify.Create})
+			case before.isDir != now.isDir:
+				fw.queueEvent(fsnotify.Event{Name: filepath.Join(path, name), Op: fsnotify.Remove | fsnotify.Create})
+			case !now.isDir && (!before.modTime.Equal(now.modTime) || before.size != now.size):
+				fw.queueEvent(fsnotify.Event{Name: filepath.Join(path, name), Op: fsnotify.Write})
+			}
+		}
+		for name := range p.entries {
+			if _, ok := current[name]; !ok {
+				fw.queueEvent(fsnotify.Event{Name: filepath.Join(path, name), Op: fsnotify.Remove})
+			}
+		}
+		// Only the poll loop touches entries once the path is registered
+		p.entries = current
+	}
+}
+
+// workspaceWatchCounts returns how many directories of the workspace at
+// root are watched natively and how many are polled. Caller holds fw.mu.
+func (fw *FileWatcher) workspaceWatchCounts(root string) (native, polled int) {
+	for dir, r := range fw.watchedDirs {
+		if r != root {
+			continue
+		}
+		if _, ok := fw.polled[dir]; ok {
+			polled++
+		} else {
+			native++
+		}
+	}
+	return native, polled
+}
+
+// reportDegraded tells the clients of a workspace that part of it is now
+// polled, when more of it has fallen back since they were last told
+func (fw *FileWatcher) reportDegraded(root string) {
+	fw.mu.Lock()
+	native, polled := fw.workspaceWatchCounts(root)
+	if polled == 0 || polled <= fw.degradedRoots[root] {
+		fw.mu.Unlock()
+		return
+	}
+	fw.degradedRoots[root] = polled
+	clients := make([]*Client, 0, len(fw.workspaceWatches[root]))
+	for client := range fw.workspaceWatches[root] {
+		clients = append(clients, client)
+	}
+	fw.mu.Unlock()
+
+	log.Printf("[FileWatcher] inotify watch limit reached in %s: polling %d of %d directories every %v", root, polled, native+polled, pollInterval)
+	message := degradedMessage(root, native, polled)
+	for _, client := range clients {
+		fw.hub.SendToClient(client, message)
+	}
+}
+
+func degradedMessage(root string, native, polled int) map[string]interface{} {
+	return map[string]interface{}{
+		"type":           "workspace-watch-degraded",
+		"path":           root,
+		"error":          "inotify watch limit reached (fs.inotify.max_user_watches)",
+		"nativeDirs":     native,
+		"polledDirs":     polled,
+		"pollInterval":   pollInterval.Milliseconds(),
+		"maxUserWatches": maxUserWatches(),
+	}
+}
+
+// maxUserWatches reads the kernel's per-user inotify watch limit (0 if unknown)
+func maxUserWatches() int {
+	data, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return n
+}
+
+// WatchWorkspaceStatus reports how one watched workspace is being watched
+type WatchWorkspaceStatus struct {
+	Path       string `json:"path"`
+	NativeDirs int    `json:"nativeDirs"`
+	PolledDirs int    `json:"polledDirs"`
+	Clients    int    `json:"clients"`
+}
+
+// WatchStatus reports how many paths are watched through inotify versus
+// polled after the watch limit was hit
+type WatchStatus struct {
+	NativeDirs     int                    `json:"nativeDirs"`
+	PolledDirs     int                    `json:"polledDirs"`
+	NativeFiles    int                    `json:"nativeFiles"`
+	PolledFiles    int                    `json:"polledFiles"`
+	PollInterval   int64                  `json:"pollInterval"`
+	MaxUserWatches int                    `json:"maxUserWatches"`
+	Workspaces     []WatchWorkspaceStatus `json:"workspaces"`
+}
+
+// Status summarizes native and polled watches
+func (fw *FileWatcher) Status() WatchStatus {
+	fw.mu.RLock()
+	defer fw.mu.RUnlock()
+
+	status := WatchStatus{
+		PollInterval:   pollInterval.Milliseconds(),
+		MaxUserWatches: maxUserWatches(),
+		Workspaces:     []WatchWorkspaceStatus{},
+	}
+	for root, clients := range fw.workspaceWatches {
+		native, polled := fw.workspaceWatchCounts(root)
+		status.NativeDirs += native
+		status.PolledDirs += polled
+		status.Workspaces = append(status.Workspaces, WatchWorkspaceStatus{
+			Path:       root,
+			NativeDirs: native,
+			PolledDirs: polled,
+			Clients:    len(clients),
+		})
+	}
+	sort.Slice(status.Workspaces, func(i, j int) bool {
+		return status.Workspaces[i].Path < status.Workspaces[j].Path
+	})
+
+	files := make(map[string]bool)
+	for path := range fw.fileWatches {
+		files[path] = true
+	}
+	for path := range fw.tails {
+		files[path] = true
+	}
+	for path := range fw.follows {
+		files[path] = true
+	}
+	for path := range files {
+		if _, ok := fw.polled[path]; ok {
+			status.PolledFiles++
+		} else {
+			status.NativeFiles++
+		}
+	}
+	return status
+}
+
+// HandleWatchStatus handles GET /api/files/watch-status
+func (h *Hub) HandleWatchStatus(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(h.watcher.Status())
+}
@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestPollPaths_ReportsDifferences(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	write("same.md", "same")
+	write("grown.md", "a")
+	write("gone.md", "bye")
+	write("became-dir", "file")
+	file := filepath.Join(t.TempDir(), "single.log")
+	os.WriteFile(file, []byte("one"), 0644)
+
+	fw := newTestCoalescer()
+	fw.polled = map[string]*polledPath{
+		dir:  {isDir: true, entries: scanPolledPath(dir, true)},
+		file: {entries: scanPolledPath(file, false)},
+	}
+
+	write("grown.md", "abc")
+	write("new.md", "new")
+	os.Remove(filepath.Join(dir, "gone.md"))
+	os.Remove(filepath.Join(dir, "became-dir"))
+	os.Mkdir(filepath.Join(dir, "became-dir"), 0755)
+	os.WriteFile(file, []byte("one two"), 0644)
+
+	fw.pollPaths()
+	got := collectReady(fw, 2*eventMaxDelay)
+
+	want := map[string]fsnotify.Op{
+		filepath.Join(dir, "grown.md"):   fsnotify.Write,
+		filepath.Join(dir, "new.md"):     fsnotify.Create,
+		filepath.Join(dir, "gone.md"):    fsnotify.Remove,
+		filepath.Join(dir, "became-dir"): fsnotify.Remove | fsnotify.Create,
+		file:                             fsnotify.Write,
+	}
+	if len(got) != len(want) {
+		var paths []string
+		for p := range got {
+			paths = append(paths, p)
+		}
+		t.Fatalf("got events for %v, want %d paths", paths, len(want))
+	}
+	for path, op := range want {
+		if pe := got[path]; pe == nil || pe.ops != op {
+			t.Errorf("%s: got %v, want %v", path, pe, op)
+		}
+	}
+
+	// Nothing changed since, so the next scan is quiet
+	fw.pollPaths()
+	if got := collectReady(fw, eventMaxDelay); len(got) != 0 {
+		t.Errorf("expected no events on an unchanged rescan, got %d", len(got))
+	}
+}
+
+func TestIsWatchLimitError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{syscall.ENOSPC, true},
+		{fmt.Errorf("add /w: %w", syscall.EMFILE), true},
+		{os.ErrNotExist, false},
+		{syscall.EACCES, false},
+	}
+	for _, tt := range tests {
+		if got := isWatchLimitError(tt.err); got != tt.want {
+			t.Errorf("isWatchLimitError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"markdown-themes-backend/handlers"
+	"markdown-themes-backend/models"
+)
+
+const (
+	// Most events sent in one claude-session-events message
+	maxFollowBatch = 500
+	// Cap on the transcript a new or reset follow replays; older lines are
+	// skipped so the replay fits in the client's send buffer
+	maxFollowSnapshot = 4 * 1024 * 1024
+)
+
+// followState tracks how much of a transcript one client has received
+type followState struct {
+	sessionID string
+	offset    int64 // Start of the first line not yet parsed
+	mu        sync.Mutex
+}
+
+// AddSessionFollow subscribes a client to the normalized events of the
+// Claude transcript at path. The client first receives the events of the last
+// maxFollowSnapshot bytes, or from *resume onwards when resuming a previous
+// follow that is not further behind than that.
+func (fw *FileWatcher) AddSessionFollow(path, sessionID string, client *Client, resume *int64) {
+	fw.mu.Lock()
+	if fw.follows[path] == nil {
+		fw.follows[path] = make(map[*Client]*followState)
+		if err := fw.watchPath(path, false); err != nil {
+			delete(fw.follows, path)
+			fw.mu.Unlock()
+			log.Printf("[FileWatcher] Error following session %s: %v", path, err)
+			fw.sendFollowError(path, sessionID, client, err)
+			return
+		}
+	}
+	// Locked until startFollow has sent the initial events, so a change event
+	// arriving first waits rather than sending from offset 0
+	state := &followState{sessionID: sessionID}
+	state.mu.Lock()
+	fw.follows[path][client] = state
+	fw.mu.Unlock()
+
+	go fw.startFollow(path, client, state, resume)
+}
+
+// startFollow sends a new follow's initial events. The caller locked
+// state.mu; startFollow unlocks it.
+func (fw *FileWatcher) startFollow(path string, client *Client, state *followState, resume *int64) {
+	defer state.mu.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		fw.sendFollowError(path, state.sessionID, client, err)
+		return
+	}
+	defer file.Close()
+
+	reset := true
+	if resume != nil && *resume > 0 && followOffsetValid(file, *resume) {
+		state.offset = *resume
+		reset = false
+	}
+	fw.sendFollowEvents(path, client, state, file, reset)
+}
+
+// followOffsetValid reports whether offset is the start of a line in file
+func followOffsetValid(file *os.File, offset int64) bool {
+	buf := make([]byte, 1)
+	_, err := file.ReadAt(buf, offset-1)
+	return err == nil && buf[0] == '\n'
+}
+
+// handleFollowChange pushes the events of lines appended to path to every
+// client following it, starting over when the file shrank.
+func (fw *FileWatcher) handleFollowChange(path string) {
+	fw.mu.RLock()
+	states := make(map[*Client]*followState, len(fw.follows[path]))
+	for client, state := range fw.follows[path] {
+		states[client] = state
+	}
+	fw.mu.RUnlock()
+	if len(states) == 0 {
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return // Removed; the remove handler reports it
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	for client, state := range states {
+		state.mu.Lock()
+		reset := false
+		if info.Size() < state.offset {
+			log.Printf("[FileWatcher] %s was truncated, resending session", path)
+			state.offset = 0
+			reset = true
+		}
+		if reset || info.Size() > state.offset {
+			fw.sendFollowEvents(path, client, state, file, reset)
+		}
+		state.mu.Unlock()
+	}
+}
+
+// sendFollowEvents parses the complete lines after the client's offset and
+// sends their events in batches. A trailing line without its newline is left
+// for the next change. A client more than maxFollowSnapshot behind is reset
+// to the first line within that many bytes of the end; skippedBytes says how
+// much was left out. Caller holds state.mu.
+func (fw *FileWatcher) sendFollowEvents(path string, client *Client, state *followState, file *os.File, reset bool) {
+	var skipped int64
+	if info, err := file.Stat(); err == nil && info.Size()-state.offset > maxFollowSnapshot {
+		reset = true
+	}
+	if reset {
+		skipped = followSnapshotStart(file)
+		state.offset = skipped
+	}
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, state.offset, 1<<62), 64*1024)
+
+	events := []models.ClaudeSessionEvent{}
+	flush := func() {
+		message := map[string]interface{}{
+			"type":      "claude-session-events",
+			"sessionId": state.sessionID,
+			"path":      path,
+			"events":    events,
+			"offset":    state.offset,
+			"reset":     reset,
+		}
+		if reset && skipped > 0 {
+			message["skippedBytes"] = skipped
+		}
+		fw.hub.SendToClient(client, message)
+		events = []models.ClaudeSessionEvent{}
+		reset = false
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			break // EOF, possibly mid-line
+		}
+		events = append(events, handlers.ParseClaudeEvents(bytes.TrimSpace(line), state.offset)...)
+		state.offset += int64(len(line))
+		if len(events) >= maxFollowBatch {
+			flush()
+		}
+	}
+	if len(events) > 0 || reset {
+		flush()
+	}
+}
+
+// followSnapshotStart returns where a replay of file starts: 0, or the first
+// line starting within maxFollowSnapshot bytes of the end
+func followSnapshotStart(file *os.File) int64 {
+	info, err := file.Stat()
+	if err != nil || info.Size() <= maxFollowSnapshot {
+		return 0
+	}
+	start := info.Size() - maxFollowSnapshot
+	reader := bufio.NewReaderSize(io.NewSectionReader(file, start-1, maxFollowSnapshot+1), 64*1024)
+	// Starting one byte early finds start itself when a line begins there
+	skip, err := reader.ReadBytes('\n')
+	if err != nil {
+		return info.Size() // No line starts in the window
+	}
+	return start - 1 + int64(len(skip))
+}
+
+func (fw *FileWatcher) sendFollowError(path, sessionID string, client *Client, err error) {
+	fw.hub.SendToClient(client, map[string]interface{}{
+		"type":      "claude-session-error",
+		"sessionId": sessionID,
+		"path":      path,
+		"error":     err.Error(),
+	})
+}
+
+// RemoveSessionFollow ends a client's follow of the transcript at path
+func (fw *FileWatcher) RemoveSessionFollow(path string, client *Client) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if clients, ok := fw.follows[path]; ok {
+		delete(clients, client)
+		if len(clients) == 0 {
+			delete(fw.follows, path)
+			fw.unwatchFileIfUnused(path)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func transcriptLine(i int) string {
+	return fmt.Sprintf(`{"type":"user","uuid":"u%d","message":{"role":"user","content":"prompt %d %s"}}`, i, i, strings.Repeat("x", 1000))
+}
+
+func TestSessionFollow_ReplaysBoundedSnapshot(t *testing.T) {
+	fw, client := newTestWatcher(t)
+	path := filepath.Join(t.TempDir(), "sess.jsonl")
+	var b strings.Builder
+	lines := maxFollowSnapshot/1000 + 1000
+	for i := 0; i < lines; i++ {
+		b.WriteString(transcriptLine(i) + "\n")
+	}
+	os.WriteFile(path, []byte(b.String()), 0644)
+	size := int64(b.Len())
+
+	fw.AddSessionFollow(path, "sess", client, nil)
+
+	first := recv(t, client)
+	skipped, _ := first["skippedBytes"].(float64)
+	if first["reset"] != true || skipped <= 0 || size-int64(skipped) > maxFollowSnapshot {
+		t.Fatalf("expected a reset skipping to within the snapshot, got reset %v skipped %v", first["reset"], first["skippedBytes"])
+	}
+	if b.String()[int(skipped)-1] != '\n' {
+		t.Errorf("snapshot starts mid-line at %d", int(skipped))
+	}
+	firstEvent := first["events"].([]interface{})[0].(map[string]interface{})
+	if firstEvent["offset"] != skipped {
+		t.Errorf("expected the first event at %v, got %v", skipped, firstEvent["offset"])
+	}
+
+	offset, messages := first["offset"].(float64), 1
+	for int64(offset) < size {
+		msg := recv(t, client)
+		if msg["reset"] != false || msg["skippedBytes"] != nil {
+			t.Fatalf("only the first batch should reset, got %v", msg["reset"])
+		}
+		offset = msg["offset"].(float64)
+		messages++
+	}
+	if messages >= cap(client.send) {
+		t.Errorf("replay took %d messages, more than the send buffer holds", messages)
+	}
+}
+
+func TestSessionFollow_ResumesFromOffset(t *testing.T) {
+	fw, client := newTestWatcher(t)
+	path := filepath.Join(t.TempDir(), "sess.jsonl")
+	first, second := transcriptLine(1)+"\n", transcriptLine(2)+"\n"
+	os.WriteFile(path, []byte(first+second), 0644)
+
+	resume := int64(len(first))
+	fw.AddSessionFollow(path, "sess", client, &resume)
+
+	msg := recv(t, client)
+	events := msg["events"].([]interface{})
+	if msg["reset"] != false || len(events) != 1 || msg["offset"] != float64(len(first)+len(second)) {
+		t.Fatalf("expected only the second line's event, got %v", msg)
+	}
+	if e := events[0].(map[string]interface{}); e["uuid"] != "u2" {
+		t.Errorf("expected u2, got %v", e["uuid"])
+	}
+
+	// An offset inside a line can't be resumed from
+	fw2, client2 := newTestWatcher(t)
+	resume = 5
+	fw2.AddSessionFollow(path, "sess", client2, &resume)
+	if msg := recv(t, client2); msg["reset"] != true || len(msg["events"].([]interface{})) != 2 {
+		t.Errorf("expected a full reset, got %v", msg)
+	}
+}
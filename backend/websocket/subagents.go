@@ -0,0 +1,370 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"markdown-themes-backend/handlers"
+)
+
+const (
+	// How often ~/.claude/projects is rescanned while anyone subscribes
+	subagentScanInterval = time.Second
+	// A transcript left unwritten this long is reported as finished. Sessions
+	// sit idle while waiting for the user, so they get much longer.
+	subagentIdleTimeout = 2 * time.Minute
+	sessionIdleTimeout  = 10 * time.Minute
+	// Transcripts written this recently when watching starts count as running
+	subagentStartWindow = 30 * time.Second
+	// How far back a parent transcript is searched for a subagent's result
+	subagentResultLookback = 1024 * 1024
+	// Longest taskDescription sent, in characters
+	maxTaskDescription = 200
+)
+
+// trackedTranscript is the watcher's view of one session or subagent
+type trackedTranscript struct {
+	transcript handlers.ClaudeTranscript
+	active     bool
+	agentID    string
+	pane       string
+	parentPath string                 // Parent session transcript, for subagents
+	start      map[string]interface{} // subagent-start, replayed to new subscribers
+}
+
+// SubagentWatcher reports Claude Code sessions and Task subagents starting
+// and finishing, judged from their transcripts under ~/.claude/projects. A
+// subagent finishes when its result lands in the parent transcript; anything
+// else finishes when its transcript goes idle.
+type SubagentWatcher struct {
+	hub           *Hub
+	clients       map[*Client]bool
+	transcripts   map[string]*trackedTranscript // By transcript path
+	parentOffsets map[string]int64              // Parent transcript bytes searched for results
+	stop          chan struct{}
+	mu            sync.Mutex
+}
+
+// NewSubagentWatcher creates a watcher that scans only while subscribed to
+func NewSubagentWatcher(hub *Hub) *SubagentWatcher {
+	return &SubagentWatcher{
+		hub:     hub,
+		clients: make(map[*Client]bool),
+	}
+}
+
+// AddClient subscribes a client, replaying the sessions already running
+func (sw *SubagentWatcher) AddClient(client *Client) {
+	sw.mu.Lock()
+	sw.clients[client] = true
+	var running []map[string]interface{}
+	if sw.stop == nil {
+		sw.transcripts = make(map[string]*trackedTranscript)
+		sw.parentOffsets = make(map[string]int64)
+		sw.stop = make(chan struct{})
+		go sw.run(sw.stop)
+	} else {
+		for _, tr := range sw.transcripts {
+			if tr.active {
+				running = append(running, tr.start)
+			}
+		}
+	}
+	sw.mu.Unlock()
+
+	for _, message := range running {
+		sw.hub.SendToClient(client, message)
+	}
+}
+
+// RemoveClient unsubscribes a client, stopping the scans after the last one
+func (sw *SubagentWatcher) RemoveClient(client *Client) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	delete(sw.clients, client)
+	if len(sw.clients) == 0 && sw.stop != nil {
+		close(sw.stop)
+		sw.stop = nil
+	}
+}
+
+func (sw *SubagentWatcher) run(stop chan struct{}) {
+	sw.scan(stop, true)
+
+	ticker := time.NewTicker(subagentScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			sw.scan(stop, false)
+		}
+	}
+}
+
+// scan compares the transcripts on disk with the tracked ones and sends
+// start and end messages for the differences. On the first scan only
+// transcripts written within subagentStartWindow count as running. Files and
+// tmux are read without holding sw.mu, so a slow scan can't hold up
+// subscribers coming and going.
+func (sw *SubagentWatcher) scan(stop chan struct{}, baseline bool) {
+	now := time.Now()
+	transcripts, err := handlers.ListClaudeTranscripts(now.Add(-sessionIdleTimeout))
+	if err != nil {
+		return // No ~/.claude/projects yet
+	}
+
+	sw.mu.Lock()
+	if sw.stop != stop {
+		sw.mu.Unlock()
+		return
+	}
+	var starting []*trackedTranscript
+	seen := make(map[string]bool, len(transcripts))
+	for _, t := range transcripts {
+		if t.Size == 0 {
+			continue // Nothing to read the working dir or task from yet
+		}
+		seen[t.Path] = true
+		tr := sw.transcripts[t.Path]
+		if tr == nil {
+			tr = &trackedTranscript{transcript: t}
+			sw.transcripts[t.Path] = tr
+			if !baseline || now.Sub(t.ModTime) <= subagentStartWindow {
+				starting = append(starting, tr)
+			}
+			continue
+		}
+		written := t.Size != tr.transcript.Size || !t.ModTime.Equal(tr.transcript.ModTime)
+		tr.transcript = t
+		if written && !tr.active {
+			starting = append(starting, tr)
+		}
+	}
+	startingTranscripts := make([]handlers.ClaudeTranscript, len(starting))
+	for i, tr := range starting {
+		startingTranscripts[i] = tr.transcript
+	}
+	offsets := make(map[string]int64)
+	for _, tr := range sw.transcripts {
+		if tr.active && tr.parentPath != "" {
+			offsets[tr.parentPath] = -1
+		}
+	}
+	for path := range offsets {
+		if offset, ok := sw.parentOffsets[path]; ok {
+			offsets[path] = offset
+		}
+	}
+	sw.mu.Unlock()
+
+	starts := make([]transcriptStart, len(startingTranscripts))
+	for i, t := range startingTranscripts {
+		starts[i] = readTranscriptStart(t)
+		if parent := starts[i].parentPath; parent != "" {
+			if _, ok := offsets[parent]; !ok {
+				offsets[parent] = -1
+			}
+		}
+	}
+	results := make(map[string]int)
+	for path, offset := range offsets {
+		offsets[path] = readAgentResults(path, offset, results)
+	}
+
+	sw.mu.Lock()
+	if sw.stop != stop {
+		sw.mu.Unlock()
+		return
+	}
+	var messages []map[string]interface{}
+	for i, tr := range starting {
+		messages = append(messages, sw.startTranscript(tr, starts[i]))
+	}
+	sw.parentOffsets = offsets
+
+	for path, tr := range sw.transcripts {
+		if !tr.active {
+			if !seen[path] {
+				delete(sw.transcripts, path)
+			}
+			continue
+		}
+		timeout := sessionIdleTimeout
+		if tr.transcript.IsSubagent() {
+			timeout = subagentIdleTimeout
+		}
+		if exitCode, ok := results[tr.agentID]; ok && tr.agentID != "" {
+			messages = append(messages, sw.endTranscript(tr, &exitCode))
+		} else if !seen[path] || now.Sub(tr.transcript.ModTime) > timeout {
+			messages = append(messages, sw.endTranscript(tr, nil))
+		}
+	}
+
+	clients := make([]*Client, 0, len(sw.clients))
+	for client := range sw.clients {
+		clients = append(clients, client)
+	}
+	sw.mu.Unlock()
+
+	for _, message := range messages {
+		for _, client := range clients {
+			sw.hub.SendToClient(client, message)
+		}
+	}
+}
+
+// transcriptStart is what reporting a transcript as started needs from its
+// header and tmux
+type transcriptStart struct {
+	message    map[string]interface{}
+	agentID    string
+	parentPath string
+	pane       string
+}
+
+// readTranscriptStart builds the subagent-start message for a transcript
+func readTranscriptStart(t handlers.ClaudeTranscript) transcriptStart {
+	header := handlers.ReadClaudeTranscriptHeader(t)
+
+	st := transcriptStart{message: map[string]interface{}{
+		"type":             "subagent-start",
+		"sessionId":        t.SessionID,
+		"workingDir":       header.WorkingDir,
+		"conversationPath": t.Path,
+		"pane":             "",
+	}}
+	paneSession := t.SessionID
+	if t.IsSubagent() {
+		st.agentID = header.AgentID
+		if st.agentID == "" {
+			st.agentID = strings.TrimPrefix(t.SessionID, "agent-")
+		}
+		if header.SessionID != "" {
+			st.parentPath = filepath.Join(t.ProjectDir, header.SessionID+".jsonl")
+			st.message["parentSessionId"] = header.SessionID
+			paneSession = header.SessionID
+		}
+	}
+	// Subagents run inside their parent's claude process
+	if p, ok := handlers.ClaudePaneForSession(paneSession); ok {
+		st.pane = p.Pane
+		st.message["pane"] = p.Pane
+		st.message["terminalId"] = p.TerminalID
+	}
+	if header.FirstPrompt != "" {
+		st.message["taskDescription"] = truncateTask(header.FirstPrompt)
+	}
+	return st
+}
+
+// startTranscript marks a transcript running and returns its subagent-start
+// message. Caller holds sw.mu.
+func (sw *SubagentWatcher) startTranscript(tr *trackedTranscript, st transcriptStart) map[string]interface{} {
+	tr.agentID = st.agentID
+	tr.parentPath = st.parentPath
+	tr.pane = st.pane
+	tr.active = true
+	tr.start = st.message
+	return st.message
+}
+
+// endTranscript marks a transcript finished and builds its subagent-end
+// message. Caller holds sw.mu.
+func (sw *SubagentWatcher) endTranscript(tr *trackedTranscript, exitCode *int) map[string]interface{} {
+	tr.active = false
+	tr.start = nil
+	message := map[string]interface{}{
+		"type":      "subagent-end",
+		"sessionId": tr.transcript.SessionID,
+		"pane":      tr.pane,
+	}
+	if exitCode != nil {
+		message["exitCode"] = *exitCode
+	}
+	return message
+}
+
+// readAgentResults scans the complete lines of a transcript from offset (or
+// the last subagentResultLookback bytes, for -1) for Task results naming a
+// subagent, and returns the offset to continue from
+func readAgentResults(path string, offset int64, results map[string]int) int64 {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return offset
+	}
+	size := info.Size()
+	if offset < 0 || offset > size {
+		offset = max(0, size-subagentResultLookback)
+	}
+	if offset == size {
+		return offset
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, size-offset))
+	if err != nil {
+		return offset
+	}
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return offset // Wait for the line to be finished
+	}
+
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		if !bytes.Contains(line, []byte(`"agentId"`)) {
+			continue
+		}
+		var entry struct {
+			Message struct {
+				Content json.RawMessage `json:"content"`
+			} `json:"message"`
+			ToolUseResult json.RawMessage `json:"toolUseResult"`
+		}
+		var result struct {
+			AgentID string `json:"agentId"`
+			Status  string `json:"status"`
+		}
+		if json.Unmarshal(line, &entry) != nil || json.Unmarshal(entry.ToolUseResult, &result) != nil || result.AgentID == "" {
+			continue
+		}
+		if result.Status == "async_launched" {
+			continue // Background agents return before they finish
+		}
+		var blocks []struct {
+			Type    string `json:"type"`
+			IsError bool   `json:"is_error"`
+		}
+		json.Unmarshal(entry.Message.Content, &blocks)
+		exitCode := 0
+		for _, block := range blocks {
+			if block.Type == "tool_result" && block.IsError {
+				exitCode = 1
+			}
+		}
+		results[result.AgentID] = exitCode
+	}
+	return offset + int64(end) + 1
+}
+
+// truncateTask shortens a prompt to maxTaskDescription characters
+func truncateTask(prompt string) string {
+	if utf8.RuneCountInString(prompt) <= maxTaskDescription {
+		return prompt
+	}
+	runes := []rune(prompt)
+	return strings.TrimSpace(string(runes[:maxTaskDescription])) + "…"
+}
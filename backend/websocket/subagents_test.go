@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupClaudeProjects(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := filepath.Join(home, ".claude", "projects")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeTranscript(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func appendTranscript(t *testing.T, path, line string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(line + "\n")
+}
+
+// newTestSubagentWatcher returns a subscribed watcher whose scans the test
+// drives itself
+func newTestSubagentWatcher(t *testing.T) (*SubagentWatcher, *Client) {
+	t.Helper()
+	_, client := newTestWatcher(t)
+	sw := NewSubagentWatcher(client.hub)
+	sw.clients[client] = true
+	sw.transcripts = make(map[string]*trackedTranscript)
+	sw.parentOffsets = make(map[string]int64)
+	sw.stop = make(chan struct{})
+	return sw, client
+}
+
+// recvBySession collects n messages keyed by sessionId
+func recvBySession(t *testing.T, client *Client, n int) map[string]map[string]interface{} {
+	t.Helper()
+	messages := make(map[string]map[string]interface{})
+	for i := 0; i < n; i++ {
+		msg := recv(t, client)
+		messages[msg["sessionId"].(string)] = msg
+	}
+	return messages
+}
+
+func TestSubagentWatcher_ReportsSubagentLifecycle(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	project := filepath.Join(projects, "-home-user-app")
+	parent := filepath.Join(project, "sess-1.jsonl")
+	writeTranscript(t, parent,
+		`{"type":"user","sessionId":"sess-1","cwd":"/home/user/app","message":{"role":"user","content":"Fix the build"}}`)
+	writeTranscript(t, filepath.Join(project, "sess-1", "subagents", "agent-abc.jsonl"),
+		`{"type":"user","sessionId":"sess-1","agentId":"abc","cwd":"/home/user/app","message":{"role":"user","content":"Find the failing test"}}`)
+
+	sw, client := newTestSubagentWatcher(t)
+	sw.scan(sw.stop, true)
+
+	started := recvBySession(t, client, 2)
+	session, agent := started["sess-1"], started["agent-abc"]
+	if session["type"] != "subagent-start" || session["workingDir"] != "/home/user/app" || session["taskDescription"] != "Fix the build" {
+		t.Errorf("unexpected session start %v", session)
+	}
+	if agent["type"] != "subagent-start" || agent["parentSessionId"] != "sess-1" || agent["taskDescription"] != "Find the failing test" {
+		t.Errorf("unexpected subagent start %v", agent)
+	}
+
+	// Nothing written since, so nothing to report
+	sw.scan(sw.stop, false)
+	expectNoMessage(t, client, 50*time.Millisecond)
+
+	// The Task result in the parent finishes the subagent
+	appendTranscript(t, parent, `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","is_error":true}]},"toolUseResult":{"agentId":"abc","status":"completed"}}`)
+	sw.scan(sw.stop, false)
+
+	end := recv(t, client)
+	if end["type"] != "subagent-end" || end["sessionId"] != "agent-abc" || end["exitCode"] != float64(1) {
+		t.Errorf("unexpected end %v", end)
+	}
+	expectNoMessage(t, client, 50*time.Millisecond)
+}
+
+func TestSubagentWatcher_IgnoresBackgroundLaunches(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	project := filepath.Join(projects, "-p")
+	parent := filepath.Join(project, "sess-1.jsonl")
+	writeTranscript(t, parent, `{"type":"user","sessionId":"sess-1","message":{"role":"user","content":"Go"}}`)
+	writeTranscript(t, filepath.Join(project, "sess-1", "subagents", "agent-bg.jsonl"),
+		`{"type":"user","sessionId":"sess-1","agentId":"bg","message":{"role":"user","content":"Watch the logs"}}`)
+
+	sw, client := newTestSubagentWatcher(t)
+	sw.scan(sw.stop, true)
+	recvBySession(t, client, 2)
+
+	appendTranscript(t, parent, `{"type":"user","toolUseResult":{"agentId":"bg","status":"async_launched"}}`)
+	sw.scan(sw.stop, false)
+	expectNoMessage(t, client, 50*time.Millisecond)
+}
+
+func TestSubagentWatcher_BaselineAndIdle(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	path := filepath.Join(projects, "-p", "sess-old.jsonl")
+	writeTranscript(t, path, `{"type":"user","sessionId":"sess-old","message":{"role":"user","content":"Earlier"}}`)
+	stale := time.Now().Add(-2 * subagentStartWindow)
+	os.Chtimes(path, stale, stale)
+
+	// Written before the watcher started, so not running
+	sw, client := newTestSubagentWatcher(t)
+	sw.scan(sw.stop, true)
+	expectNoMessage(t, client, 50*time.Millisecond)
+
+	// Written again, so running now
+	appendTranscript(t, path, `{"type":"assistant"}`)
+	sw.scan(sw.stop, false)
+	if msg := recv(t, client); msg["type"] != "subagent-start" || msg["sessionId"] != "sess-old" {
+		t.Fatalf("unexpected message %v", msg)
+	}
+
+	// Idle past the session timeout, so finished
+	idle := time.Now().Add(-sessionIdleTimeout - time.Minute)
+	os.Chtimes(path, idle, idle)
+	sw.scan(sw.stop, false)
+	msg := recv(t, client)
+	if msg["type"] != "subagent-end" || msg["sessionId"] != "sess-old" {
+		t.Fatalf("unexpected message %v", msg)
+	}
+	if _, ok := msg["exitCode"]; ok {
+		t.Errorf("expected no exit code for an idle session, got %v", msg["exitCode"])
+	}
+}
+
+func TestSubagentWatcher_StoppedScanSendsNothing(t *testing.T) {
+	projects := setupClaudeProjects(t)
+	writeTranscript(t, filepath.Join(projects, "-p", "sess.jsonl"), `{"type":"user","sessionId":"sess"}`)
+
+	sw, client := newTestSubagentWatcher(t)
+	stale := sw.stop
+	sw.stop = make(chan struct{})
+	sw.scan(stale, true)
+	expectNoMessage(t, client, 50*time.Millisecond)
+}
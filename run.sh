@@ -31,7 +31,7 @@ usage() {
 build_backend() {
     echo -e "${BLUE}Building Go backend...${NC}"
     cd backend
-    go build -o markdown-themes-backend .
+    go build -tags sqlite_fts5 -o markdown-themes-backend .
     echo -e "${GREEN}Built: backend/markdown-themes-backend${NC}"
     cd ..
 }
@@ -43,7 +43,7 @@ run_backend() {
     if [[ -f markdown-themes-backend ]]; then
         ./markdown-themes-backend
     else
-        go run .
+        go run -tags sqlite_fts5 .
     fi
 }
 
@@ -7,7 +7,7 @@ import { getFileIconInfo } from '../utils/fileIcons';
 import { useAppStore, type FavoriteItem } from '../context/AppStoreContext';
 import { FileContextMenu } from './FileContextMenu';
 import { ProjectSelector } from './ProjectSelector';
-import { fetchFileContent, fetchGitStatus, type GitStatusMap, type GitStatus } from '../lib/api';
+import { fetchFileContent, fetchGitStatus, type GitStatusMap, type GitStatus, type GitStatusResponse } from '../lib/api';
 import { themes, type ThemeId } from '../themes';
 
 /**
@@ -58,6 +58,8 @@ interface SidebarProps {
   changedFiles?: Set<string>;
   /** Counter that increments after git operations (commit, stage, etc.) to trigger git status refresh */
   gitStatusVersion?: number;
+  /** Git status pushed over WebSocket; replaces the fetched status when it arrives */
+  liveGitStatus?: GitStatusResponse | null;
   /** Callback to send content to AI Chat */
   onSendToChat?: (content: string) => void;
   /** Callback when archive is requested from context menu */
@@ -627,7 +629,7 @@ function formatFileSize(bytes: number): string {
 const MIN_SIDEBAR_WIDTH = 150;
 const MAX_SIDEBAR_WIDTH = 400;
 
-export function Sidebar({ fileTree, currentFile, workspacePath, homePath, isSplit, width = 250, onWidthChange, onWidthChangeEnd, onFileSelect, onFileDoubleClick, onRightFileSelect, favorites, toggleFavorite, isFavorite, searchInputRef, changedFiles, gitStatusVersion, onSendToChat, onArchiveFile, onResumeInChat, recentFolders, onFolderSelect, onCloseWorkspace, currentTheme, onThemeChange }: SidebarProps) {
+export function Sidebar({ fileTree, currentFile, workspacePath, homePath, isSplit, width = 250, onWidthChange, onWidthChangeEnd, onFileSelect, onFileDoubleClick, onRightFileSelect, favorites, toggleFavorite, isFavorite, searchInputRef, changedFiles, gitStatusVersion, liveGitStatus, onSendToChat, onArchiveFile, onResumeInChat, recentFolders, onFolderSelect, onCloseWorkspace, currentTheme, onThemeChange }: SidebarProps) {
   const workspaceName = workspacePath?.split('/').pop() ?? workspacePath?.split('\\').pop() ?? 'Workspace';
 
   // Get lazy loading state from workspace context
@@ -678,6 +680,13 @@ export function Sidebar({ fileTree, currentFile, workspacePath, homePath, isSpli
     });
   }, [workspacePath, fileTree, gitStatusVersion]); // Re-fetch when fileTree changes (file added/removed) or after git operations
 
+  // Apply pushed updates (git run from Claude or a terminal)
+  useEffect(() => {
+    if (liveGitStatus) {
+      setGitStatus(liveGitStatus.isGitRepo ? liveGitStatus.files : {});
+    }
+  }, [liveGitStatus]);
+
   // Get the most important git status for files under a folder
   const getFolderGitStatus = useCallback((folderPath: string): GitStatus | null => {
     // Check for staged files first (highest priority)
@@ -76,7 +76,7 @@ export function AudioViewer({ filePath }: AudioViewerProps) {
   // Stable random heights - only regenerate when filePath changes
   const waveformHeights = useMemo(() => generateWaveformHeights(), [filePath]);
 
-  // Fetch audio as base64 data URI from TabzChrome API
+  // Point the audio element at the streamed file
   useEffect(() => {
     setLoading(true);
     setError(null);
@@ -85,20 +85,9 @@ export function AudioViewer({ filePath }: AudioViewerProps) {
     setCurrentTime(0);
     setIsPlaying(false);
 
-    fetch(`${API_BASE}/api/files/audio?path=${encodeURIComponent(filePath)}`)
-      .then((res) => {
-        if (!res.ok) throw new Error(`Failed to load audio: ${res.status}`);
-        return res.json();
-      })
-      .then((data) => {
-        if (data.error) throw new Error(data.error);
-        setAudioUrl(data.dataUri);
-        setLoading(false);
-      })
-      .catch((err) => {
-        setError(err.message || 'Failed to load audio file');
-        setLoading(false);
-      });
+    // Stream straight from the raw endpoint so seeking uses Range requests
+    setAudioUrl(`${API_BASE}/api/files/raw?path=${encodeURIComponent(filePath)}`);
+    setLoading(false);
   }, [filePath]);
 
   const handleLoadedMetadata = () => {
@@ -170,7 +159,7 @@ export function AudioViewer({ filePath }: AudioViewerProps) {
   const handleDownload = () => {
     if (!audioUrl) return;
     const link = document.createElement('a');
-    link.href = audioUrl;
+    link.href = `${audioUrl}&download=true`;
     link.download = fileName;
     document.body.appendChild(link);
     link.click();
@@ -7,7 +7,7 @@ const API_BASE = 'http://localhost:8130';
 
 export function PdfViewer({ filePath }: PdfViewerProps) {
   const fileName = filePath.split('/').pop() || 'Document';
-  const pdfUrl = `${API_BASE}/api/files/content?path=${encodeURIComponent(filePath)}&raw=true`;
+  const pdfUrl = `${API_BASE}/api/files/raw?path=${encodeURIComponent(filePath)}`;
 
   const handleOpenInNewTab = () => {
     window.open(pdfUrl, '_blank');
@@ -15,24 +15,11 @@ export function VideoViewer({ filePath, fontSize = 100 }: VideoViewerProps) {
   const fileName = filePath.split('/').pop() || 'Video file';
 
   useEffect(() => {
-    // Reset state and fetch video when file changes
-    setLoading(true);
+    // Stream straight from the raw endpoint so the browser can issue Range
+    // requests and seek without downloading the whole file
     setError(null);
-    setVideoUrl(null);
-
-    fetch(`${API_BASE}/api/files/video?path=${encodeURIComponent(filePath)}`)
-      .then((res) => {
-        if (!res.ok) throw new Error('Failed to load video');
-        return res.json();
-      })
-      .then((data) => {
-        setVideoUrl(data.dataUri);
-        setLoading(false);
-      })
-      .catch((err) => {
-        setError(err.message || 'Failed to load video file');
-        setLoading(false);
-      });
+    setVideoUrl(`${API_BASE}/api/files/raw?path=${encodeURIComponent(filePath)}`);
+    setLoading(false);
   }, [filePath]);
 
   if (loading) {
@@ -91,6 +78,7 @@ export function VideoViewer({ filePath, fontSize = 100 }: VideoViewerProps) {
           key={filePath}
           src={videoUrl}
           controls
+          onError={() => setError('Failed to load video file')}
           className="max-w-full max-h-full"
           style={{
             borderRadius: 'var(--radius)',
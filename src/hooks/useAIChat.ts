@@ -4,8 +4,12 @@ import {
   fetchConversation,
   createConversation as createConversationAPI,
   updateConversation as updateConversationAPI,
+  appendMessage as appendMessageAPI,
+  patchMessage as patchMessageAPI,
   deleteConversationAPI,
+  ConversationConflictError,
   type StoredConversation,
+  type StoredConversationMetadata,
   type StoredMessage,
 } from '../lib/api';
 
@@ -54,6 +58,7 @@ export interface ToolUseEvent {
   type: 'start' | 'end';
   name?: string;
   id?: string;
+  input?: string; // JSON text; set on sessions imported from Claude Code
 }
 
 export interface ChatSettings {
@@ -133,8 +138,8 @@ function generateTitle(content: string): string {
   return firstLine.length > 50 ? firstLine.slice(0, 47) + '...' : firstLine;
 }
 
-/** Convert a Conversation to the StoredConversation format for the API */
-function toStoredConversation(conv: Conversation): StoredConversation {
+/** Convert a Conversation's metadata (not its messages) for the API */
+function toStoredMetadata(conv: Conversation): StoredConversationMetadata {
   return {
     id: conv.id,
     title: conv.title,
@@ -143,6 +148,13 @@ function toStoredConversation(conv: Conversation): StoredConversation {
     cwd: conv.cwd,
     claudeSessionId: conv.claudeSessionId,
     settings: conv.settings as Record<string, unknown> | undefined,
+  };
+}
+
+/** Convert a Conversation to the StoredConversation format for the API */
+function toStoredConversation(conv: Conversation): StoredConversation {
+  return {
+    ...toStoredMetadata(conv),
     messages: conv.messages.map(m => toStoredMessage(conv.id, m)),
   };
 }
@@ -239,22 +251,81 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
   const saveTimerRef = useRef<ReturnType<typeof setTimeout> | null>(null);
   const saveDirtyRef = useRef(false);
 
-  /** Save a conversation to the backend (non-blocking) */
-  const saveToBackend = useCallback(async (conv: Conversation) => {
+  // Version of each conversation as this tab last read or wrote it, sent with
+  // updates so a stale tab gets a conflict instead of overwriting another's changes
+  const versionsRef = useRef(new Map<string, number>());
+
+  // Backend writes for a conversation run one at a time, in order, so a
+  // message is never appended before its conversation is created
+  const writeQueueRef = useRef(new Map<string, Promise<void>>());
+
+  const enqueueWrite = useCallback((convId: string, write: () => Promise<void>) => {
     if (!backendAvailableRef.current) return;
-    try {
-      const stored = toStoredConversation(conv);
-      if (persistedIdsRef.current.has(conv.id)) {
-        await updateConversationAPI(conv.id, stored);
-      } else {
-        await createConversationAPI(stored);
-        persistedIdsRef.current.add(conv.id);
-      }
-    } catch (err) {
+    const prev = writeQueueRef.current.get(convId) ?? Promise.resolve();
+    const next = prev.then(write).catch(err => {
       console.warn('[useAIChat] Failed to save to backend:', err);
-    }
+    });
+    writeQueueRef.current.set(convId, next);
   }, []);
 
+  /** Create a conversation on the backend (non-blocking) */
+  const createOnBackend = useCallback((conv: Conversation) => {
+    enqueueWrite(conv.id, async () => {
+      const stored = await createConversationAPI(toStoredConversation(conv));
+      persistedIdsRef.current.add(conv.id);
+      if (stored.version) versionsRef.current.set(conv.id, stored.version);
+    });
+  }, [enqueueWrite]);
+
+  /**
+   * Save changed metadata (not messages) to the backend. If another tab changed
+   * the conversation since this one read it, load the latest copy, apply just
+   * these changes to it and save again.
+   */
+  const updateOnBackend = useCallback((id: string, changes: Partial<Omit<Conversation, 'id' | 'messages'>>) => {
+    enqueueWrite(id, async () => {
+      const conv = conversationsRef.current.find(c => c.id === id);
+      if (!conv) return;
+      try {
+        const saved = await updateConversationAPI(id, {
+          ...toStoredMetadata({ ...conv, ...changes }),
+          version: versionsRef.current.get(id),
+        });
+        if (saved.version) versionsRef.current.set(id, saved.version);
+      } catch (err) {
+        if (!(err instanceof ConversationConflictError)) throw err;
+        const latest = await fetchConversation(id);
+        const merged = { ...fromStoredConversation(latest), ...changes };
+        setConversations(prev => prev.map(c => (c.id === id ? merged : c)));
+        const saved = await updateConversationAPI(id, { ...toStoredMetadata(merged), version: latest.version });
+        if (saved.version) versionsRef.current.set(id, saved.version);
+      }
+    });
+  }, [enqueueWrite]);
+
+  /** Save one message (added or replaced) without touching the rest of the conversation */
+  const saveMessageOnBackend = useCallback((convId: string, msg: ChatMessage) => {
+    enqueueWrite(convId, async () => {
+      await appendMessageAPI(convId, toStoredMessage(convId, msg));
+    });
+  }, [enqueueWrite]);
+
+  /** Save a finished reply's content, tools and usage */
+  const finishMessageOnBackend = useCallback((convId: string, msg: ChatMessage) => {
+    enqueueWrite(convId, async () => {
+      await patchMessageAPI(convId, msg.id, {
+        content: msg.content,
+        isStreaming: false,
+        toolUse: msg.toolUse as unknown[] | undefined,
+        usage: msg.usage as Record<string, unknown> | undefined,
+        modelUsage: msg.modelUsage as Record<string, unknown> | undefined,
+        claudeSessionId: msg.claudeSessionId,
+        costUSD: msg.costUSD,
+        durationMs: msg.durationMs,
+      });
+    });
+  }, [enqueueWrite]);
+
   const flushSave = useCallback(() => {
     if (saveTimerRef.current) {
       clearTimeout(saveTimerRef.current);
@@ -320,8 +391,9 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
             // Persist each to backend
             for (const conv of localConvs) {
               try {
-                await createConversationAPI(toStoredConversation(conv));
+                const stored = await createConversationAPI(toStoredConversation(conv));
                 persistedIdsRef.current.add(conv.id);
+                if (stored.version) versionsRef.current.set(conv.id, stored.version);
               } catch (err) {
                 console.warn('[useAIChat] Failed to migrate conversation %s:', conv.id, err);
               }
@@ -338,6 +410,7 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
             const stored = await fetchConversation(item.id);
             fullConversations.push(fromStoredConversation(stored));
             persistedIdsRef.current.add(item.id);
+            if (stored.version) versionsRef.current.set(item.id, stored.version);
           } catch (err) {
             console.warn('[useAIChat] Failed to load conversation %s:', item.id, err);
           }
@@ -381,9 +454,9 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
     setConversations(prev => [conv, ...prev]);
     setActiveConversationId(conv.id);
     // Persist to backend
-    saveToBackend(conv);
+    createOnBackend(conv);
     return conv;
-  }, [saveToBackend]);
+  }, [createOnBackend]);
 
   const resumeConversation = useCallback((sessionId: string) => {
     const conv: Conversation = {
@@ -397,9 +470,9 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
     };
     setConversations(prev => [conv, ...prev]);
     setActiveConversationId(conv.id);
-    saveToBackend(conv);
+    createOnBackend(conv);
     return conv;
-  }, [saveToBackend]);
+  }, [createOnBackend]);
 
   const setActiveConversation = useCallback((id: string) => {
     setActiveConversationId(id);
@@ -413,6 +486,7 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
       console.warn('[useAIChat] Failed to delete from backend:', err);
     });
     persistedIdsRef.current.delete(id);
+    versionsRef.current.delete(id);
   }, []);
 
   const endConversation = useCallback(async (id: string) => {
@@ -445,11 +519,8 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
       )
     );
     // Persist settings update to backend
-    const conv = conversationsRef.current.find(c => c.id === id);
-    if (conv) {
-      saveToBackend({ ...conv, settings, updatedAt: Date.now() });
-    }
-  }, [saveToBackend]);
+    updateOnBackend(id, { settings, updatedAt: Date.now() });
+  }, [updateOnBackend]);
 
   const clearError = useCallback(() => setError(null), []);
 
@@ -510,7 +581,7 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
       setConversations(prev => [newConv, ...prev]);
       setActiveConversationId(newConv.id);
       // Persist new conversation to backend immediately
-      saveToBackend(newConv);
+      createOnBackend(newConv);
     }
 
     const userMessage: ChatMessage = {
@@ -524,7 +595,8 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
       id: generateId(),
       role: 'assistant',
       content: '',
-      timestamp: Date.now(),
+      // Always after the prompt, so the two sort in order when reloaded
+      timestamp: Math.max(Date.now(), userMessage.timestamp + 1),
       isStreaming: true,
       toolUse: [],
       segments: [],
@@ -533,6 +605,11 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
     const currentConvId = convId!;
     const assistantMsgId = assistantMessage.id;
 
+    // Save the prompt and the empty reply now. The backend also records the
+    // reply as it streams, under the same IDs.
+    saveMessageOnBackend(currentConvId, userMessage);
+    saveMessageOnBackend(currentConvId, assistantMessage);
+
     setConversations(prev =>
       prev.map(c =>
         c.id === currentConvId
@@ -570,6 +647,9 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
       return JSON.stringify({
         messages: allMessages,
         conversationId: currentConvId,
+        // The backend saves the turn as it streams under these same IDs
+        userMessageId: userMessage.id,
+        assistantMessageId: assistantMsgId,
         claudeSessionId: conv?.claudeSessionId,
         cwd: currentSettings?.cwdOverride || (cwdRef.current ?? undefined),
         ...(reconnectEventId && reconnectEventId > 0 && { lastEventId: reconnectEventId }),
@@ -736,11 +816,12 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
           saveDirtyRef.current = true;
           flushSave();
 
-          // Persist completed conversation to backend using the
+          // Persist the completed reply to backend using the
           // snapshot captured inside the state updater, since
           // conversationsRef may be stale before the next render.
-          if (updatedConvSnapshot) {
-            saveToBackend(updatedConvSnapshot);
+          const doneMsg = updatedConvSnapshot?.messages.find(m => m.id === assistantMsgId);
+          if (doneMsg) {
+            finishMessageOnBackend(currentConvId, doneMsg);
           }
           break;
         }
@@ -916,13 +997,18 @@ export function useAIChat(options: UseAIChatOptions = {}): UseAIChatResult {
       // Flush localStorage save when streaming ends
       saveDirtyRef.current = true;
       flushSave();
-      // Persist final state to backend
-      const updatedConv = conversationsRef.current.find(c => c.id === currentConvId);
-      if (updatedConv) {
-        saveToBackend(updatedConv);
+      // Persist the reply's final state (cancelled, failed or done) to backend,
+      // read inside a state updater so it includes the updates made above
+      let finalMsg: ChatMessage | undefined;
+      setConversations(prev => {
+        finalMsg = prev.find(c => c.id === currentConvId)?.messages.find(m => m.id === assistantMsgId);
+        return prev;
+      });
+      if (finalMsg) {
+        finishMessageOnBackend(currentConvId, finalMsg);
       }
     }
-  }, [updateMessage, flushSave, saveToBackend]);
+  }, [updateMessage, flushSave, createOnBackend, saveMessageOnBackend, finishMessageOnBackend]);
 
   const sendToChat = useCallback((content: string) => {
     const conv = newConversation();
@@ -11,6 +11,8 @@ export interface ConversationInfo {
   workingDir: string;
   conversationPath: string;
   pane: string;
+  /** mt-* terminal running the session, when known */
+  terminalId?: string;
   status: string;
 }
 
@@ -1,6 +1,6 @@
 import { useState, useMemo, useCallback, useEffect } from 'react';
 import type { FileTreeNode } from '../context/WorkspaceContext';
-import { fetchFileTree, fetchFileContent, type FileTreeNode as APIFileTreeNode } from '../lib/api';
+import { fetchFileTree, fetchFileContent, fetchClaudeProjects, type FileTreeNode as APIFileTreeNode } from '../lib/api';
 import { FILTERS, filterFiles, countMatches, type FilterId, type FileScope } from '../lib/filters';
 
 /**
@@ -160,8 +160,9 @@ function sortTreeByRecency(nodes: FileTreeNode[]): FileTreeNode[] {
 
 /**
  * Decode a Claude projects directory name to a readable project path.
- * Uses projectPath from sessions-index.json when available (accurate),
- * falls back to stripping the home prefix from the encoded name.
+ * Uses projectPath from sessions-index.json or the backend's resolver when
+ * available (accurate), falls back to stripping the home prefix from the
+ * encoded name.
  */
 function decodeProjectDirName(name: string, homePath: string, projectPath?: string): string {
   // Best: use the actual project path from sessions-index.json
@@ -210,10 +211,21 @@ async function enrichConversationNodes(
   projectDirs: FileTreeNode[],
   homePath: string
 ): Promise<FileTreeNode[]> {
+  // Working dirs the backend resolved from transcripts and the filesystem
+  const resolvedPaths = new Map<string, string>();
+  try {
+    for (const project of await fetchClaudeProjects()) {
+      resolvedPaths.set(project.projectDir, project.workingDir);
+    }
+  } catch {
+    // Fall back to decoding names
+  }
+
   const results = await Promise.all(projectDirs.map(async (dir): Promise<FileTreeNode> => {
     if (!dir.isDirectory || !dir.children) {
       return dir;
     }
+    const resolvedPath = resolvedPaths.get(dir.name);
 
     // Check if sessions-index.json exists in the tree (already fetched at depth=2)
     const hasIndex = dir.children.some((c) => c.name === 'sessions-index.json');
@@ -221,7 +233,7 @@ async function enrichConversationNodes(
       // No index - just decode dir name with fallback
       return {
         ...dir,
-        name: decodeProjectDirName(dir.name, homePath),
+        name: decodeProjectDirName(dir.name, homePath, resolvedPath),
       };
     }
 
@@ -230,7 +242,7 @@ async function enrichConversationNodes(
       const { content } = await fetchFileContent(indexPath);
       const index: SessionsIndex = JSON.parse(content);
       if (!index.entries) {
-        return { ...dir, name: decodeProjectDirName(dir.name, homePath) };
+        return { ...dir, name: decodeProjectDirName(dir.name, homePath, resolvedPath) };
       }
 
       // Build lookup: sessionId -> entry
@@ -240,7 +252,7 @@ async function enrichConversationNodes(
       }
 
       // Extract projectPath from first entry for accurate dir name decoding
-      const projectPath = index.entries[0]?.projectPath;
+      const projectPath = index.entries[0]?.projectPath ?? resolvedPath;
 
       // Build new children array with enriched names (immutable)
       const enrichedChildren = dir.children.map((child) => {
@@ -265,7 +277,7 @@ async function enrichConversationNodes(
         children: enrichedChildren,
       };
     } catch {
-      return { ...dir, name: decodeProjectDirName(dir.name, homePath) };
+      return { ...dir, name: decodeProjectDirName(dir.name, homePath, resolvedPath) };
     }
   }));
 
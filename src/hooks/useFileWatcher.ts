@@ -4,10 +4,13 @@ import {
   clearAuthToken,
   type FileWatcherMessage,
 } from '../lib/api';
+import { applyLineHunks } from '../lib/filePatch';
 
 interface UseFileWatcherOptions {
   path: string | null;
   streamingTimeout?: number;
+  /** Called when the watched file is moved, so the caller can follow it */
+  onRenamed?: (oldPath: string, newPath: string) => void;
 }
 
 interface UseFileWatcherResult {
@@ -26,7 +29,7 @@ const IGNORED_MESSAGE_TYPES = new Set(['memory-stats', 'pong', 'connected']);
 function isFileWatcherMessage(data: unknown): data is FileWatcherMessage {
   if (typeof data !== 'object' || data === null) return false;
   const msg = data as Record<string, unknown>;
-  return ['file-content', 'file-change', 'file-deleted', 'file-watch-error'].includes(msg.type as string);
+  return ['file-content', 'file-change', 'file-patch', 'file-deleted', 'file-renamed', 'file-watch-error'].includes(msg.type as string);
 }
 
 // Check if message should be silently ignored
@@ -39,6 +42,7 @@ function shouldIgnoreMessage(data: unknown): boolean {
 export function useFileWatcher({
   path,
   streamingTimeout = 3000,
+  onRenamed,
 }: UseFileWatcherOptions): UseFileWatcherResult {
   const [content, setContent] = useState<string>('');
   const [contentPath, setContentPath] = useState<string | null>(null); // Track which path content belongs to
@@ -54,6 +58,11 @@ export function useFileWatcher({
   const streamingTimerRef = useRef<ReturnType<typeof setTimeout> | null>(null);
   const reconnectAttemptRef = useRef(0);
   const currentPathRef = useRef<string | null>(null);
+  // Content and version the next file-patch applies to
+  const contentRef = useRef('');
+  const versionRef = useRef<number | null>(null);
+  const onRenamedRef = useRef(onRenamed);
+  onRenamedRef.current = onRenamed;
   const maxReconnectAttempts = 5;
   const mountedRef = useRef(true);
 
@@ -68,10 +77,13 @@ export function useFileWatcher({
   // Subscribe to a file path on the existing connection
   const subscribeTo = useCallback((ws: WebSocket, filePath: string) => {
     if (ws.readyState === WebSocket.OPEN && filePath.startsWith('/') && !filePath.includes('\n')) {
+      // Patches are ignored until the initial file-content arrives
+      versionRef.current = null;
       ws.send(
         JSON.stringify({
           type: 'file-watch',
           path: filePath,
+          patches: true,
         })
       );
     }
@@ -89,6 +101,14 @@ export function useFileWatcher({
     }
   }, []);
 
+  // Record the latest content along with the version it corresponds to
+  const applyContent = useCallback((next: string, version: number | undefined) => {
+    contentRef.current = next;
+    versionRef.current = version ?? null;
+    setContent(next);
+    setContentPath(currentPathRef.current);
+  }, []);
+
   // Handle incoming WebSocket messages
   const handleMessage = useCallback(
     (event: MessageEvent) => {
@@ -114,9 +134,8 @@ export function useFileWatcher({
 
         switch (message.type) {
           case 'file-content':
-            // Initial file content
-            setContent(message.content);
-            setContentPath(currentPathRef.current);
+            // Initial file content (or a resync)
+            applyContent(message.content, message.version);
             setPendingLoad(false);
             setError(null);
             break;
@@ -130,8 +149,7 @@ export function useFileWatcher({
               break;
             }
 
-            setContent(message.content);
-            setContentPath(currentPathRef.current);
+            applyContent(message.content, message.version);
             setError(null);
 
             // Detect streaming based on time between changes
@@ -148,6 +166,32 @@ export function useFileWatcher({
             }, streamingTimeout);
             break;
 
+          case 'file-patch':
+            // Diff against the version we hold; on a gap ask for everything again
+            if (versionRef.current === null || message.path !== currentPathRef.current) {
+              break;
+            }
+            if (versionRef.current !== message.baseVersion) {
+              if (wsRef.current?.readyState === WebSocket.OPEN) {
+                wsRef.current.send(JSON.stringify({ type: 'file-resync', path: message.path }));
+              }
+              break;
+            }
+
+            applyContent(applyLineHunks(contentRef.current, message.hunks), message.version);
+            setError(null);
+
+            if (message.timeSinceLastChange < streamingTimeout) {
+              setIsStreaming(true);
+            }
+            clearStreamingTimer();
+            streamingTimerRef.current = setTimeout(() => {
+              if (mountedRef.current) {
+                setIsStreaming(false);
+              }
+            }, streamingTimeout);
+            break;
+
           case 'file-deleted':
             setContent('');
             setContentPath(currentPathRef.current);
@@ -156,6 +200,13 @@ export function useFileWatcher({
             clearStreamingTimer();
             break;
 
+          case 'file-renamed':
+            // The caller switches path, which resubscribes at the new location
+            if (message.oldPath === currentPathRef.current) {
+              onRenamedRef.current?.(message.oldPath, message.path);
+            }
+            break;
+
           case 'file-watch-error':
             setError(message.error);
             setContentPath(currentPathRef.current); // Mark as "loaded" even on error
@@ -166,7 +217,7 @@ export function useFileWatcher({
         console.error('Failed to parse WebSocket message:', err);
       }
     },
-    [streamingTimeout, clearStreamingTimer]
+    [streamingTimeout, clearStreamingTimer, applyContent]
   );
 
   // Connect to WebSocket (only called once, maintains connection)
@@ -23,6 +23,7 @@ interface UseRightPaneTabsResult {
   closeTab: (id: string) => void;
   setActiveTab: (id: string) => void;
   clearAllTabs: () => void;
+  renameTabPath: (oldPath: string, newPath: string) => void;
   reorderTab: (fromId: string, toId: string) => void;
 }
 
@@ -185,6 +186,25 @@ export function useRightPaneTabs(options: UseRightPaneTabsOptions = {}): UseRigh
     setActiveTabId(null);
   }, []);
 
+  // Point tabs at a file's (or a parent directory's) new location after a move
+  const renameTabPath = useCallback((oldPath: string, newPath: string) => {
+    setTabs((prevTabs) => {
+      let changed = false;
+      const newTabs = prevTabs.map((tab) => {
+        if (tab.path === oldPath) {
+          changed = true;
+          return { ...tab, path: newPath };
+        }
+        if (tab.path.startsWith(oldPath + '/')) {
+          changed = true;
+          return { ...tab, path: newPath + tab.path.slice(oldPath.length) };
+        }
+        return tab;
+      });
+      return changed ? newTabs : prevTabs;
+    });
+  }, []);
+
   const reorderTab = useCallback((fromId: string, toId: string) => {
     if (fromId === toId) return;
     setTabs((prevTabs) => {
@@ -208,6 +228,7 @@ export function useRightPaneTabs(options: UseRightPaneTabsOptions = {}): UseRigh
     closeTab,
     setActiveTab,
     clearAllTabs,
+    renameTabPath,
     reorderTab,
   };
 }
@@ -11,6 +11,7 @@ export interface ActiveSubagent {
   workingDir: string;
   pane: string;
   conversationPath: string;
+  parentSessionId?: string;
   taskDescription?: string;
   startTime: number;
 }
@@ -21,7 +22,7 @@ interface UseSubagentWatcherOptions {
   /** Callback when a subagent starts */
   onSubagentStart?: (subagent: ActiveSubagent) => void;
   /** Callback when a subagent ends */
-  onSubagentEnd?: (sessionId: string) => void;
+  onSubagentEnd?: (sessionId: string, exitCode?: number) => void;
 }
 
 interface UseSubagentWatcherResult {
@@ -44,34 +45,6 @@ function isSubagentMessage(data: unknown): data is SubagentMessage {
   return msg.type === 'subagent-start' || msg.type === 'subagent-end';
 }
 
-/**
- * Construct the conversation file path from session info.
- * Claude Code stores conversations at ~/.claude/projects/{projectHash}/conversations/{sessionId}.jsonl
- */
-function buildConversationPath(workingDir: string, sessionId: string): string {
-  // The workingDir is the project directory, but we need the ~/.claude/projects/{hash} path
-  // For now, we'll use a pattern that matches the standard Claude Code layout
-  const home = workingDir.match(/^(\/home\/[^/]+)/)?.[1] || '/home';
-
-  // Claude Code uses a hash of the project path for the directory name
-  // We'll need to match the actual path structure
-  // Format: ~/.claude/projects/{projectDir}/conversations/{sessionId}.jsonl
-  // The projectDir is typically the base64-encoded or hashed project path
-
-  // For now, return a path that the user can configure or that matches common patterns
-  return `${home}/.claude/projects/${encodeProjectPath(workingDir)}/conversations/${sessionId}.jsonl`;
-}
-
-/**
- * Encode project path to match Claude Code's directory naming.
- * Claude uses the project path with slashes replaced by dashes.
- */
-function encodeProjectPath(projectPath: string): string {
-  // Remove leading slash and replace remaining slashes with dashes
-  // e.g., /home/user/projects/myapp -> home-user-projects-myapp
-  return projectPath.replace(/^\//, '').replace(/\//g, '-');
-}
-
 /**
  * Hook to monitor Claude Code subagent lifecycle events.
  *
@@ -141,13 +114,12 @@ export function useSubagentWatcher({
       const message = parsed;
 
       if (message.type === 'subagent-start') {
-        const conversationPath = buildConversationPath(message.workingDir, message.sessionId);
-
         const newSubagent: ActiveSubagent = {
           sessionId: message.sessionId,
           workingDir: message.workingDir,
           pane: message.pane,
-          conversationPath,
+          conversationPath: message.conversationPath,
+          parentSessionId: message.parentSessionId,
           taskDescription: message.taskDescription,
           startTime: Date.now(),
         };
@@ -170,7 +142,7 @@ export function useSubagentWatcher({
         );
 
         // Notify callback
-        onSubagentEndRef.current?.(message.sessionId);
+        onSubagentEndRef.current?.(message.sessionId, message.exitCode);
       }
     } catch {
       // Ignore parse errors for non-subagent messages
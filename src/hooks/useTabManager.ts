@@ -446,6 +446,26 @@ export function useTabManager(options: UseTabManagerOptions = {}): UseTabManager
     });
   }, []);
 
+  // Point tabs at a file's (or a parent directory's) new location after a move
+  const renameTabPath = useCallback((oldPath: string, newPath: string) => {
+    setTabs((prevTabs) => {
+      let changed = false;
+      const newTabs = prevTabs.map((tab) => {
+        if (tab.type !== 'file') return tab;
+        if (tab.path === oldPath) {
+          changed = true;
+          return { ...tab, path: newPath };
+        }
+        if (tab.path.startsWith(oldPath + '/')) {
+          changed = true;
+          return { ...tab, path: newPath + tab.path.slice(oldPath.length) };
+        }
+        return tab;
+      });
+      return changed ? newTabs : prevTabs;
+    });
+  }, []);
+
   const reorderTab = useCallback((fromId: string, toId: string) => {
     if (fromId === toId) return;
     setTabs((prevTabs) => {
@@ -475,6 +495,7 @@ export function useTabManager(options: UseTabManagerOptions = {}): UseTabManager
     closeTab,
     closeTabsWithMetadata,
     setActiveTab,
+    renameTabPath,
     reorderTab,
   };
 }
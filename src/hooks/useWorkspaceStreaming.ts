@@ -1,5 +1,12 @@
 import { useState, useEffect, useRef, useCallback } from 'react';
-import { createWebSocket, clearAuthToken } from '../lib/api';
+import {
+  createWebSocket,
+  clearAuthToken,
+  type GitDirtyMessage,
+  type GitStatusChangedMessage,
+  type WorkspaceTreeChangeMessage,
+  type WorkspaceWatchDegradedMessage,
+} from '../lib/api';
 
 interface UseWorkspaceStreamingOptions {
   workspacePath: string | null;
@@ -18,6 +25,12 @@ interface UseWorkspaceStreamingResult {
   clearChangedFiles: () => void;
   /** Remove specific files from the changed files set (e.g., after commit) */
   removeChangedFiles: (paths: string[]) => void;
+  /** Set when part of the workspace is polled because inotify ran out of watches */
+  watchDegraded: WorkspaceWatchDegradedMessage | null;
+  /** Latest pushed git status of the repository containing the workspace */
+  gitStatus: GitStatusChangedMessage | null;
+  /** Dirty flags pushed for repositories in the tree (resolving gitDirtyPending), by repository path */
+  gitDirtyRepos: Record<string, boolean>;
 }
 
 interface WorkspaceFileChangeMessage {
@@ -31,7 +44,13 @@ interface WorkspaceWatchErrorMessage {
   error: string;
 }
 
-type WorkspaceMessage = WorkspaceFileChangeMessage | WorkspaceWatchErrorMessage;
+type WorkspaceMessage =
+  | WorkspaceFileChangeMessage
+  | WorkspaceTreeChangeMessage
+  | WorkspaceWatchDegradedMessage
+  | GitStatusChangedMessage
+  | GitDirtyMessage
+  | WorkspaceWatchErrorMessage;
 
 /**
  * Hook to monitor workspace-wide file changes and detect streaming files.
@@ -47,6 +66,9 @@ export function useWorkspaceStreaming({
   const [streamingFile, setStreamingFile] = useState<string | null>(null);
   const [connected, setConnected] = useState(false);
   const [changedFiles, setChangedFiles] = useState<Set<string>>(new Set());
+  const [watchDegraded, setWatchDegraded] = useState<WorkspaceWatchDegradedMessage | null>(null);
+  const [gitStatus, setGitStatus] = useState<GitStatusChangedMessage | null>(null);
+  const [gitDirtyRepos, setGitDirtyRepos] = useState<Record<string, boolean>>({});
 
   const wsRef = useRef<WebSocket | null>(null);
   const streamingTimerRef = useRef<ReturnType<typeof setTimeout> | null>(null);
@@ -128,6 +150,41 @@ export function useWorkspaceStreaming({
               setStreamingFile(null);
             }
           }, streamingTimeout);
+        } else if (message.type === 'git-status-changed') {
+          // Nested repositories are not part of the workspace's status
+          const workspace = currentPathRef.current;
+          if (workspace && (workspace === message.repo || workspace.startsWith(message.repo + '/'))) {
+            setGitStatus(message);
+          }
+        } else if (message.type === 'git-dirty') {
+          setGitDirtyRepos((prev) =>
+            prev[message.path] === message.dirty ? prev : { ...prev, [message.path]: message.dirty }
+          );
+        } else if (message.type === 'workspace-watch-degraded') {
+          if (message.path === currentPathRef.current) {
+            console.warn(
+              `[WorkspaceStreaming] ${message.error}: polling ${message.polledDirs} of ` +
+                `${message.nativeDirs + message.polledDirs} directories`
+            );
+            setWatchDegraded(message);
+          }
+        } else if (message.type === 'workspace-tree-change' && message.action !== 'created') {
+          // Keep the changed set pointing at files that still exist
+          const from = message.action === 'renamed' ? message.oldPath : message.path;
+          if (!from) return;
+          setChangedFiles((prev) => {
+            let changed = false;
+            const next = new Set<string>();
+            for (const p of prev) {
+              if (p === from || p.startsWith(from + '/')) {
+                changed = true;
+                if (message.action === 'renamed') next.add(message.path + p.slice(from.length));
+              } else {
+                next.add(p);
+              }
+            }
+            return changed ? next : prev;
+          });
         }
       } catch (err) {
         // Ignore parse errors for non-workspace messages
@@ -244,10 +301,19 @@ export function useWorkspaceStreaming({
         unsubscribeFrom(wsRef.current, previousPath);
       }
       setStreamingFile(null);
+      setWatchDegraded(null);
+      setGitStatus(null);
+      setGitDirtyRepos({});
       // Don't fully disconnect - just unsubscribe
       return;
     }
 
+    if (previousPath !== workspacePath) {
+      setWatchDegraded(null);
+      setGitStatus(null);
+      setGitDirtyRepos({});
+    }
+
     // If we have a connection, switch subscription
     if (wsRef.current?.readyState === WebSocket.OPEN) {
       if (previousPath && previousPath !== workspacePath) {
@@ -299,5 +365,8 @@ export function useWorkspaceStreaming({
     changedFiles,
     clearChangedFiles,
     removeChangedFiles,
+    watchDegraded,
+    gitStatus,
+    gitDirtyRepos,
   };
 }
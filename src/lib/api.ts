@@ -73,6 +73,58 @@ export interface FileTreeNode {
   modified?: string;
   size?: number;
   isGitRepo?: boolean;
+  gitBranch?: string;
+  gitDirty?: boolean;
+  /** gitDirty is still being computed; a `git-dirty` WebSocket message follows */
+  gitDirtyPending?: boolean;
+  isSymlink?: boolean;
+  symlinkTarget?: string;
+  /** Symlinked directory pointing at one of its own ancestors - do not expand */
+  symlinkLoop?: boolean;
+}
+
+export type FileTreeSort = 'name' | 'mtime' | 'size' | 'type';
+
+export interface DirectoryChildrenPage {
+  path: string;
+  children: FileTreeNode[];
+  total: number;
+  nextCursor?: string;
+}
+
+/**
+ * Fetch one page of a directory's children for the lazily expanded tree.
+ * Pass the returned nextCursor back as `cursor` to load the next page.
+ */
+export async function fetchDirectoryChildren(
+  path: string,
+  options: {
+    root?: string;
+    showHidden?: boolean;
+    gitignore?: boolean;
+    sort?: FileTreeSort;
+    order?: 'asc' | 'desc';
+    limit?: number;
+    cursor?: string;
+  } = {}
+): Promise<DirectoryChildrenPage> {
+  const params = new URLSearchParams({ path });
+  if (options.root) params.set('root', options.root);
+  if (options.showHidden) params.set('showHidden', 'true');
+  if (options.gitignore) params.set('gitignore', 'true');
+  if (options.sort) params.set('sort', options.sort);
+  if (options.order) params.set('order', options.order);
+  if (options.limit) params.set('limit', options.limit.toString());
+  if (options.cursor) params.set('cursor', options.cursor);
+
+  const response = await fetch(`${API_BASE}/api/files/children?${params}`);
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fetch directory: ${response.status}`);
+  }
+
+  return response.json();
 }
 
 /**
@@ -99,6 +151,15 @@ export async function fetchFileTree(
   return response.json();
 }
 
+/**
+ * URL of a cached, downscaled copy of an image fitting a size x size box.
+ * Formats the backend cannot decode (WebP, SVG) come back unscaled.
+ */
+export function thumbnailUrl(path: string, size: number = 256): string {
+  const params = new URLSearchParams({ path, size: size.toString() });
+  return `${API_BASE}/api/files/thumbnail?${params}`;
+}
+
 /**
  * File content response from TabzChrome API
  */
@@ -108,6 +169,11 @@ export interface FileContent {
   fileName: string;
   fileSize: number;
   modified: string;
+  hash?: string;
+  /** Source encoding when not plain UTF-8, e.g. 'utf-16le' or 'windows-1252' */
+  encoding?: string;
+  /** The file starts with a byte order mark (not included in content) */
+  bom?: boolean;
 }
 
 /**
@@ -120,12 +186,70 @@ export async function fetchFileContent(path: string): Promise<FileContent> {
 
   if (!response.ok) {
     const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    if (error.tooLarge) {
+      throw new FileTooLargeError(error.error, error.fileSize, error.maxSize);
+    }
     throw new Error(error.error || `Failed to fetch file: ${response.status}`);
   }
 
   return response.json();
 }
 
+/**
+ * Thrown by fetchFileContent for files above the backend's size limit;
+ * page through them with fetchFileRange instead.
+ */
+export class FileTooLargeError extends Error {
+  constructor(message: string, public fileSize: number, public maxSize: number) {
+    super(message);
+    this.name = 'FileTooLargeError';
+  }
+}
+
+/**
+ * A chunk of a large text file, decoded to UTF-8
+ */
+export interface FileRange {
+  path: string;
+  fileSize: number;
+  modified: string;
+  encoding: string;
+  content: string;
+  /** Byte range actually read (edges never split a character) */
+  offset: number;
+  length: number;
+  nextOffset: number;
+  eof: boolean;
+  /** Line mode only */
+  startLine?: number;
+  lineCount?: number;
+  totalLines?: number;
+  nextLine?: number;
+}
+
+/**
+ * Read part of a file, either by byte range ({ offset, length }) or by
+ * lines ({ line, count }; a negative line counts from the end).
+ */
+export async function fetchFileRange(
+  path: string,
+  range: { offset?: number; length?: number; line?: number; count?: number }
+): Promise<FileRange> {
+  const params = new URLSearchParams({ path });
+  for (const [key, value] of Object.entries(range)) {
+    if (value !== undefined) params.set(key, value.toString());
+  }
+
+  const response = await fetch(`${API_BASE}/api/files/range?${params}`);
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to read file range: ${response.status}`);
+  }
+
+  return response.json();
+}
+
 /**
  * Check if backend is available
  */
@@ -161,6 +285,14 @@ export async function openInEditor(path: string): Promise<void> {
 export interface FileWatchMessage {
   type: 'file-watch';
   path: string;
+  /** Receive file-patch diffs instead of the full content on every change */
+  patches?: boolean;
+}
+
+/** Ask for the full content again, e.g. after a file-patch version gap */
+export interface FileResyncMessage {
+  type: 'file-resync';
+  path: string;
 }
 
 export interface FileUnwatchMessage {
@@ -174,6 +306,7 @@ export interface FileContentMessage {
   content: string;
   modified: string;
   size: number;
+  version?: number;
 }
 
 export interface FileChangeMessage {
@@ -184,6 +317,30 @@ export interface FileChangeMessage {
   size: number;
   timestamp: number;
   timeSinceLastChange: number;
+  version?: number;
+}
+
+/**
+ * Replaces oldLines lines starting at oldStart (0-based, in the previous
+ * content) with lines, which keep their newline terminators.
+ */
+export interface LineHunk {
+  oldStart: number;
+  oldLines: number;
+  lines: string[];
+}
+
+export interface FilePatchMessage {
+  type: 'file-patch';
+  path: string;
+  /** Version the hunks apply to; resync if it is not the one you have */
+  baseVersion: number;
+  version: number;
+  hunks: LineHunk[];
+  modified: string;
+  size: number;
+  timestamp: number;
+  timeSinceLastChange: number;
 }
 
 export interface FileDeletedMessage {
@@ -191,6 +348,13 @@ export interface FileDeletedMessage {
   path: string;
 }
 
+/** The watched file (or a directory above it) was moved to path */
+export interface FileRenamedMessage {
+  type: 'file-renamed';
+  path: string;
+  oldPath: string;
+}
+
 export interface FileWatchErrorMessage {
   type: 'file-watch-error';
   path?: string;
@@ -200,9 +364,287 @@ export interface FileWatchErrorMessage {
 export type FileWatcherMessage =
   | FileContentMessage
   | FileChangeMessage
+  | FilePatchMessage
   | FileDeletedMessage
+  | FileRenamedMessage
   | FileWatchErrorMessage;
 
+/**
+ * Sent to workspace watchers when an entry of any type is created, deleted
+ * or renamed. The same change may be reported more than once (API operation
+ * and filesystem event), so apply these idempotently.
+ */
+export interface WorkspaceTreeChangeMessage {
+  type: 'workspace-tree-change';
+  action: 'created' | 'deleted' | 'renamed';
+  path: string;
+  /** Previous path, for renamed */
+  oldPath?: string;
+  isDir: boolean;
+}
+
+/**
+ * Sent to workspace watchers when the inotify watch limit is reached and
+ * some directories are polled for changes instead (slower, renames arrive
+ * as delete + create). Sent again if more directories fall back.
+ */
+export interface WorkspaceWatchDegradedMessage {
+  type: 'workspace-watch-degraded';
+  path: string;
+  error: string;
+  nativeDirs: number;
+  polledDirs: number;
+  /** Poll interval in milliseconds */
+  pollInterval: number;
+  maxUserWatches: number;
+}
+
+export interface WatchStatus {
+  nativeDirs: number;
+  polledDirs: number;
+  nativeFiles: number;
+  polledFiles: number;
+  pollInterval: number;
+  maxUserWatches: number;
+  workspaces: {
+    path: string;
+    nativeDirs: number;
+    polledDirs: number;
+    clients: number;
+  }[];
+}
+
+/**
+ * Fetch how many watched paths use inotify versus polling
+ */
+export async function fetchWatchStatus(): Promise<WatchStatus> {
+  const response = await fetch(`${API_BASE}/api/files/watch-status`);
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fetch watch status: ${response.status}`);
+  }
+
+  return response.json();
+}
+
+/**
+ * WebSocket message types for tailing growing files (logs, transcripts).
+ * Only appended bytes are sent; `reset: true` means discard what you have
+ * (initial snapshot, or the file was truncated/rewritten).
+ */
+export interface FileTailMessage {
+  type: 'file-tail';
+  path: string;
+  /** Start from the last N lines (0 = only new data) */
+  lines?: number;
+  /** Resume from a byte offset received earlier */
+  offset?: number;
+}
+
+export interface FileUntailMessage {
+  type: 'file-untail';
+  path: string;
+}
+
+export interface FileTailDataMessage {
+  type: 'file-tail-data';
+  path: string;
+  /** Byte offset of data within the file; next offset is offset + byte length */
+  offset: number;
+  data: string;
+  reset: boolean;
+  size: number;
+  timestamp: number;
+}
+
+export interface FileTailErrorMessage {
+  type: 'file-tail-error';
+  path?: string;
+  error: string;
+}
+
+/**
+ * WebSocket message types for following a Claude Code session transcript.
+ * Each complete JSONL line is normalized into events; `reset: true` means
+ * discard earlier events (initial load, or the transcript was truncated).
+ */
+export interface ClaudeSessionFollowMessage {
+  type: 'claude-session-follow';
+  /** Session (or "agent-<id>" subagent) to find under ~/.claude/projects */
+  sessionId?: string;
+  /** Transcript path, when not following by sessionId */
+  path?: string;
+  /** Resume from the `offset` of the last claude-session-events received */
+  offset?: number;
+}
+
+export interface ClaudeSessionUnfollowMessage {
+  type: 'claude-session-unfollow';
+  sessionId?: string;
+  path?: string;
+}
+
+export interface ClaudeUsage {
+  inputTokens: number;
+  outputTokens: number;
+  cacheCreationInputTokens: number;
+  cacheReadInputTokens: number;
+}
+
+export interface ClaudeSessionEvent {
+  kind: 'user' | 'text' | 'thinking' | 'tool_use' | 'tool_result' | 'usage';
+  /** Byte offset of the transcript line the event came from */
+  offset: number;
+  uuid?: string;
+  timestamp?: string;
+  /** Assistant message id; a later usage event for the same id replaces earlier ones */
+  messageId?: string;
+  isSidechain?: boolean;
+  text?: string;
+  /** Text was cut to 64KB */
+  truncated?: boolean;
+  toolUseId?: string;
+  toolName?: string;
+  input?: unknown;
+  isError?: boolean;
+  model?: string;
+  usage?: ClaudeUsage;
+}
+
+export interface ClaudeSessionEventsMessage {
+  type: 'claude-session-events';
+  sessionId: string;
+  path: string;
+  events: ClaudeSessionEvent[];
+  /** Byte offset after the last parsed line; send it back to resume */
+  offset: number;
+  reset: boolean;
+  /** On a reset of a long transcript, the bytes before the replayed part */
+  skippedBytes?: number;
+}
+
+export interface ClaudeSessionErrorMessage {
+  type: 'claude-session-error';
+  sessionId?: string;
+  path?: string;
+  error: string;
+}
+
+export interface ClaudeSessionSummary {
+  sessionId: string;
+  /** Encoded directory name under ~/.claude/projects */
+  projectDir: string;
+  workingDir: string;
+  conversationPath: string;
+  /** Title Claude Code generated, if any */
+  summary?: string;
+  firstPrompt?: string;
+  messageCount: number;
+  models: string[];
+  usage: ClaudeUsage;
+  totalTokens: number;
+  /** Estimated from list prices */
+  costUSD: number;
+  startTime?: string;
+  endTime?: string;
+  gitBranch?: string;
+  size: number;
+  modified: string;
+}
+
+export interface ClaudeSessionsResponse {
+  sessions: ClaudeSessionSummary[];
+  total: number;
+  nextCursor?: string;
+}
+
+export interface ClaudeSessionsQuery {
+  /** Working directory or encoded project dir name */
+  project?: string;
+  /** RFC 3339 or YYYY-MM-DD */
+  since?: string;
+  until?: string;
+  /** Text in the summary, first prompt, working dir, branch or session ID */
+  q?: string;
+  subagents?: boolean;
+  limit?: number;
+  cursor?: string;
+}
+
+/**
+ * List Claude Code sessions across all projects, most recently active first
+ */
+export async function fetchClaudeSessions(query: ClaudeSessionsQuery = {}): Promise<ClaudeSessionsResponse> {
+  const params = new URLSearchParams();
+  for (const [key, value] of Object.entries(query)) {
+    if (value !== undefined && value !== '') params.set(key, String(value));
+  }
+  const response = await fetch(`${API_BASE}/api/claude/sessions?${params}`);
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fetch Claude sessions: ${response.status}`);
+  }
+
+  return response.json();
+}
+
+export interface ClaudeProject {
+  /** Encoded directory name under ~/.claude/projects */
+  projectDir: string;
+  /** Working directory the project belongs to */
+  workingDir: string;
+  exists: boolean;
+}
+
+/**
+ * List Claude project directories with their resolved working directories
+ */
+export async function fetchClaudeProjects(): Promise<ClaudeProject[]> {
+  const response = await fetch(`${API_BASE}/api/claude/projects`);
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fetch Claude projects: ${response.status}`);
+  }
+
+  const data: { projects: ClaudeProject[] } = await response.json();
+  return data.projects;
+}
+
+/**
+ * A claude process running in an mt-* terminal
+ */
+export interface ClaudePane {
+  /** mt-* terminal (tmux session) the process runs in */
+  terminalId: string;
+  /** tmux pane ID, e.g. "%3" */
+  pane: string;
+  pid: number;
+  cwd: string;
+  startedAt: string;
+  /** Set when the transcript the process writes could be determined */
+  sessionId?: string;
+  conversationPath?: string;
+}
+
+/**
+ * List claude processes in terminals with their sessions, for jumping
+ * between a terminal and its transcript
+ */
+export async function fetchClaudePanes(): Promise<ClaudePane[]> {
+  const response = await fetch(`${API_BASE}/api/claude/panes`);
+
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fetch Claude panes: ${response.status}`);
+  }
+
+  const data: { panes: ClaudePane[] } = await response.json();
+  return data.panes;
+}
+
 /**
  * WebSocket message types for subagent monitoring
  */
@@ -210,7 +652,11 @@ export interface SubagentStartMessage {
   type: 'subagent-start';
   sessionId: string;
   workingDir: string;
+  /** Transcript under ~/.claude/projects */
+  conversationPath: string;
+  /** tmux pane running the session (the parent's, for subagents); empty if unknown */
   pane: string;
+  terminalId?: string;
   parentSessionId?: string;
   taskDescription?: string;
 }
@@ -219,6 +665,7 @@ export interface SubagentEndMessage {
   type: 'subagent-end';
   sessionId: string;
   pane: string;
+  /** Set for subagents whose Task result was seen: 0 on success, 1 on error */
   exitCode?: number;
 }
 
@@ -230,13 +677,18 @@ export interface SubagentWatchMessage {
 export type SubagentMessage = SubagentStartMessage | SubagentEndMessage;
 
 /**
- * Write content to a file via TabzChrome API
+ * Write content to a file via TabzChrome API. Pass the encoding and bom
+ * fetchFileContent returned to keep a non-UTF-8 file in its encoding.
  */
-export async function writeFile(path: string, content: string): Promise<void> {
+export async function writeFile(
+  path: string,
+  content: string,
+  options: { encoding?: string; bom?: boolean } = {}
+): Promise<void> {
   const response = await fetch(`${API_BASE}/api/files/write`, {
     method: 'POST',
     headers: { 'Content-Type': 'application/json' },
-    body: JSON.stringify({ path, content }),
+    body: JSON.stringify({ path, content, ...options }),
   });
 
   if (!response.ok) {
@@ -246,24 +698,20 @@ export async function writeFile(path: string, content: string): Promise<void> {
 }
 
 /**
- * Append a line to a file (creates file if it doesn't exist)
+ * Append a line to a file (creates file if it doesn't exist).
+ * Uses the backend's append mode so concurrent appends don't clobber each other.
  */
 export async function appendToFile(path: string, line: string): Promise<void> {
-  let currentContent = '';
+  const response = await fetch(`${API_BASE}/api/files/write`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ path, content: line + '\n', mode: 'append' }),
+  });
 
-  try {
-    const file = await fetchFileContent(path);
-    currentContent = file.content;
-  } catch {
-    // File doesn't exist, start fresh
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to append to file: ${response.status}`);
   }
-
-  // Ensure content ends with newline, then append new line
-  const newContent = currentContent.endsWith('\n') || currentContent === ''
-    ? currentContent + line + '\n'
-    : currentContent + '\n' + line + '\n';
-
-  await writeFile(path, newContent);
 }
 
 /**
@@ -286,6 +734,27 @@ export interface GitStatusResponse {
   files: GitStatusMap;
 }
 
+/**
+ * Pushed to workspace watchers when the status of a repository containing
+ * (or inside) the workspace changes: index, HEAD, refs or worktree files.
+ */
+export interface GitStatusChangedMessage extends GitStatusResponse {
+  type: 'git-status-changed';
+  /** Repository root */
+  repo: string;
+}
+
+/**
+ * Resolves a tree node's gitDirtyPending: the background `git status` for
+ * the repository at path finished, or its dirty flag changed.
+ */
+export interface GitDirtyMessage {
+  type: 'git-dirty';
+  /** Repository root, matching the tree node's path */
+  path: string;
+  dirty: boolean;
+}
+
 /**
  * Fetch git status for files in a directory
  */
@@ -323,7 +792,10 @@ export async function archiveConversation(
     : `${destPath}/${archivedFileName}`;
 
   // Write the content to the archive location
-  await writeFile(fullDestPath, fileContent.content);
+  await writeFile(fullDestPath, fileContent.content, {
+    encoding: fileContent.encoding,
+    bom: fileContent.bom,
+  });
 
   return fullDestPath;
 }
@@ -362,8 +834,11 @@ export interface ConversationListItem {
   cwd?: string;
   claudeSessionId?: string;
   settings?: Record<string, unknown>;
+  version: number;
   messageCount: number;
   lastMessage?: string;
+  /** Set on a fork: the conversation it was forked from */
+  parentConversationId?: string;
 }
 
 /**
@@ -377,6 +852,11 @@ export interface StoredConversation {
   cwd?: string;
   claudeSessionId?: string;
   settings?: Record<string, unknown>;
+  /** Increments on every change; send it back to detect concurrent edits, or omit to overwrite */
+  version?: number;
+  /** Set on a fork: the conversation and message it was forked from */
+  parentConversationId?: string;
+  forkedFromMessageId?: string;
   messages: StoredMessage[];
 }
 
@@ -442,20 +922,255 @@ export async function createConversation(conv: StoredConversation): Promise<Stor
 }
 
 /**
- * Update an existing conversation
+ * Thrown when a conversation changed since the version the client sent
  */
-export async function updateConversation(id: string, conv: StoredConversation): Promise<StoredConversation> {
+export class ConversationConflictError extends Error {
+  constructor(id: string) {
+    super(`Conversation ${id} was changed by another client`);
+    this.name = 'ConversationConflictError';
+  }
+}
+
+/** A conversation's fields other than its messages */
+export type StoredConversationMetadata = Omit<StoredConversation, 'messages'>;
+
+/**
+ * Update an existing conversation. Without messages only its metadata changes;
+ * with them the stored messages become exactly that list. With conv.version
+ * set, throws ConversationConflictError if it was changed elsewhere in the
+ * meantime.
+ */
+export async function updateConversation(
+  id: string,
+  conv: StoredConversationMetadata & { messages?: StoredMessage[] }
+): Promise<StoredConversation> {
   const response = await fetch(`${API_BASE}/api/chat/conversations/${encodeURIComponent(id)}`, {
     method: 'PUT',
     headers: { 'Content-Type': 'application/json' },
     body: JSON.stringify(conv),
   });
+  if (response.status === 409) {
+    throw new ConversationConflictError(id);
+  }
   if (!response.ok) {
     throw new Error(`Failed to update conversation: ${response.status}`);
   }
   return response.json();
 }
 
+/** Fields of a message that patchMessage can change */
+export type StoredMessagePatch = Partial<
+  Pick<StoredMessage, 'content' | 'isStreaming' | 'toolUse' | 'usage' | 'modelUsage' | 'claudeSessionId' | 'costUSD' | 'durationMs'>
+>;
+
+async function messageRequest<T>(id: string, path: string, init: RequestInit, action: string): Promise<T> {
+  const response = await fetch(`${API_BASE}/api/chat/conversations/${encodeURIComponent(id)}/messages${path}`, init);
+  if (response.status === 409) {
+    throw new ConversationConflictError(id);
+  }
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to ${action} message: ${response.status}`);
+  }
+  return response.json();
+}
+
+/**
+ * Append one message to a conversation (replacing one with the same ID).
+ * Returns the new conversation version.
+ */
+export async function appendMessage(
+  conversationId: string,
+  message: StoredMessage,
+  version?: number
+): Promise<{ message: StoredMessage; version: number }> {
+  return messageRequest(conversationId, '', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ ...message, version }),
+  }, 'append');
+}
+
+/**
+ * Change some fields of one message, e.g. to finalize a streaming reply
+ */
+export async function patchMessage(
+  conversationId: string,
+  messageId: string,
+  patch: StoredMessagePatch,
+  version?: number
+): Promise<{ message: StoredMessage; version: number }> {
+  return messageRequest(conversationId, `/${encodeURIComponent(messageId)}`, {
+    method: 'PATCH',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ ...patch, version }),
+  }, 'update');
+}
+
+/**
+ * Delete one message. Returns the new conversation version.
+ */
+export async function deleteMessage(
+  conversationId: string,
+  messageId: string,
+  version?: number
+): Promise<{ version: number }> {
+  const query = version ? `?version=${version}` : '';
+  return messageRequest(conversationId, `/${encodeURIComponent(messageId)}${query}`, { method: 'DELETE' }, 'delete');
+}
+
+export interface ChatSearchMatch {
+  messageId: string;
+  role: string;
+  timestamp: number;
+  /** HTML: text escaped, matches wrapped in <mark> */
+  snippet: string;
+}
+
+export interface ChatSearchResult {
+  conversationId: string;
+  title: string;
+  /** HTML like snippet, set when the title matched */
+  titleHighlight?: string;
+  cwd?: string;
+  updatedAt: number;
+  matchCount: number;
+  /** Best matching messages, up to 3 */
+  matches: ChatSearchMatch[];
+  score: number;
+}
+
+export interface ChatSearchQuery {
+  q: string;
+  cwd?: string;
+  /** RFC 3339 or YYYY-MM-DD */
+  since?: string;
+  until?: string;
+  limit?: number;
+}
+
+/**
+ * Search conversation titles and messages, most relevant first
+ */
+export async function searchConversations(
+  query: ChatSearchQuery
+): Promise<{ results: ChatSearchResult[]; fts: boolean }> {
+  const params = new URLSearchParams({ q: query.q });
+  if (query.cwd) params.set('cwd', query.cwd);
+  if (query.since) params.set('since', query.since);
+  if (query.until) params.set('until', query.until);
+  if (query.limit) params.set('limit', String(query.limit));
+
+  const response = await fetch(`${API_BASE}/api/chat/search?${params}`);
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to search conversations: ${response.status}`);
+  }
+  return response.json();
+}
+
+export type ClaudeImportStatus = 'imported' | 'updated' | 'unchanged' | 'exists' | 'failed';
+
+export interface ClaudeImportResult {
+  sessionId: string;
+  conversationId?: string;
+  /** 'exists' means a chat panel conversation already uses the session */
+  status: ClaudeImportStatus;
+  error?: string;
+}
+
+export interface ClaudeImportRequest {
+  /** Sessions to import; when empty every session (filtered below) is */
+  sessionIds?: string[];
+  /** Working directory or encoded project dir name */
+  project?: string;
+  /** RFC 3339 or YYYY-MM-DD */
+  since?: string;
+}
+
+/**
+ * Import Claude Code CLI sessions as conversations. Sessions imported before
+ * are re-synced if their transcript changed.
+ */
+export async function importClaudeSessions(
+  request: ClaudeImportRequest = {}
+): Promise<{ results: ClaudeImportResult[]; counts: Partial<Record<ClaudeImportStatus, number>> }> {
+  const response = await fetch(`${API_BASE}/api/chat/conversations/import`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(request),
+  });
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to import sessions: ${response.status}`);
+  }
+  return response.json();
+}
+
+/**
+ * Re-sync a conversation imported from Claude Code with its transcript
+ */
+export async function syncConversation(
+  id: string
+): Promise<{ status: ClaudeImportStatus; conversation: StoredConversation }> {
+  const response = await fetch(`${API_BASE}/api/chat/conversations/${encodeURIComponent(id)}/sync`, {
+    method: 'POST',
+  });
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to sync conversation: ${response.status}`);
+  }
+  return response.json();
+}
+
+/**
+ * A conversation in a tree of forks, from GET /api/chat/conversations/:id/branches
+ */
+export interface ConversationBranch {
+  id: string;
+  title: string;
+  createdAt: number;
+  updatedAt: number;
+  forkedFromMessageId?: string;
+  messageCount: number;
+  children: ConversationBranch[];
+}
+
+/**
+ * Fork a conversation: copy it up to and including a message into a new
+ * conversation. The fork's Claude session holds only the turns up to that
+ * message; the original thread's is left untouched. Fails with 409 if newId
+ * is taken or the session continues past the message and can't be copied.
+ */
+export async function forkConversation(
+  id: string,
+  messageId: string,
+  newId?: string
+): Promise<StoredConversation> {
+  const response = await fetch(`${API_BASE}/api/chat/conversations/${encodeURIComponent(id)}/fork`, {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ messageId, ...(newId && { id: newId }) }),
+  });
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fork conversation: ${response.status}`);
+  }
+  return response.json();
+}
+
+/**
+ * Fetch the tree of forks a conversation belongs to, rooted at its oldest ancestor
+ */
+export async function fetchConversationBranches(id: string): Promise<ConversationBranch> {
+  const response = await fetch(`${API_BASE}/api/chat/conversations/${encodeURIComponent(id)}/branches`);
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({ error: 'Unknown error' }));
+    throw new Error(error.error || `Failed to fetch branches: ${response.status}`);
+  }
+  return response.json();
+}
+
 /**
  * Delete a conversation
  */
@@ -0,0 +1,26 @@
+import { describe, it, expect } from 'vitest';
+import { applyLineHunks } from './filePatch';
+
+describe('applyLineHunks', () => {
+  it('replaces a line in the middle', () => {
+    const result = applyLineHunks('a\nb\nc\n', [{ oldStart: 1, oldLines: 1, lines: ['B\n'] }]);
+    expect(result).toBe('a\nB\nc\n');
+  });
+
+  it('appends to a document without a trailing newline', () => {
+    const result = applyLineHunks('a\nb', [{ oldStart: 1, oldLines: 1, lines: ['b\n', 'c'] }]);
+    expect(result).toBe('a\nb\nc');
+  });
+
+  it('applies several hunks in old-text coordinates', () => {
+    const result = applyLineHunks('1\n2\n3\n4\n5\n', [
+      { oldStart: 0, oldLines: 1, lines: [] },
+      { oldStart: 3, oldLines: 0, lines: ['3.5\n'] },
+    ]);
+    expect(result).toBe('2\n3\n3.5\n4\n5\n');
+  });
+
+  it('builds a document from empty content', () => {
+    expect(applyLineHunks('', [{ oldStart: 0, oldLines: 0, lines: ['# Title\n'] }])).toBe('# Title\n');
+  });
+});
@@ -0,0 +1,32 @@
+import type { LineHunk } from './api';
+
+/**
+ * Split text after each newline, keeping the terminators (mirrors the
+ * backend's utils.SplitLinesKeepEnds so hunk line numbers agree).
+ */
+function splitLinesKeepEnds(text: string): string[] {
+  const lines = text.split(/(?<=\n)/);
+  if (lines.length > 0 && lines[lines.length - 1] === '') lines.pop();
+  return lines;
+}
+
+/**
+ * Apply file-patch hunks (ascending, in old-text coordinates) to the
+ * previous content.
+ */
+export function applyLineHunks(oldText: string, hunks: LineHunk[]): string {
+  const lines = splitLinesKeepEnds(oldText);
+  const out: string[] = [];
+  let pos = 0;
+  for (const hunk of hunks) {
+    while (pos < hunk.oldStart && pos < lines.length) {
+      out.push(lines[pos++]);
+    }
+    out.push(...hunk.lines);
+    pos += hunk.oldLines;
+  }
+  while (pos < lines.length) {
+    out.push(lines[pos++]);
+  }
+  return out.join('');
+}
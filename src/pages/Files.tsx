@@ -270,6 +270,7 @@ export function Files() {
     unpinTab,
     closeTab,
     setActiveTab,
+    renameTabPath,
     reorderTab,
   } = useTabManager({
     initialTabs: filesState.tabs,
@@ -433,6 +434,7 @@ export function Files() {
     unpinTab: unpinRightTab,
     closeTab: closeRightTabInternal,
     setActiveTab: setRightActiveTab,
+    renameTabPath: renameRightTabPath,
     reorderTab: reorderRightTab,
   } = useRightPaneTabs({
     initialTabs: filesState.rightPaneTabs,
@@ -612,6 +614,7 @@ export function Files() {
     isStreaming,
   } = useFileWatcher({
     path: isCurrentFileBinary ? null : currentFile,
+    onRenamed: renameTabPath,
   });
 
   // File watcher for right pane - subscribe whenever we have a file path.
@@ -625,12 +628,13 @@ export function Files() {
     isStreaming: rightIsStreaming,
   } = useFileWatcher({
     path: rightWatcherPath,
+    onRenamed: renameRightTabPath,
   });
 
   // Workspace streaming detection for follow mode and changed files tracking
   const homePath = getHomePath(workspacePath);
   const extraWatchPaths = useMemo(() => [`${homePath}/.claude/plans`], [homePath]);
-  const { streamingFile, changedFiles, removeChangedFiles } = useWorkspaceStreaming({
+  const { streamingFile, changedFiles, removeChangedFiles, gitStatus: liveGitStatus } = useWorkspaceStreaming({
     workspacePath,
     enabled: true, // Always enabled to track changed files for the Changed filter
     extraWatchPaths,
@@ -1229,6 +1233,7 @@ export function Files() {
             searchInputRef={searchInputRef}
             changedFiles={changedFiles}
             gitStatusVersion={gitStatusVersion}
+            liveGitStatus={liveGitStatus}
             onSendToChat={handleSendToChat}
             onArchiveFile={handleArchiveFile}
             onResumeInChat={handleResumeInChat}